@@ -16,16 +16,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/workload/histogram"
 	"github.com/cockroachdb/cockroach/pkg/workload/querybench"
-	"github.com/lib/pq"
+	"github.com/codahale/hdrhistogram"
+	"github.com/pkg/errors"
 )
 
 // tpchBench is a benchmark run on tpch data. There are different groups of
@@ -55,6 +61,34 @@ type tpchBenchSpec struct {
 	// minVersion specifies the minimum version of CRDB nodes. If omitted, it
 	// will default to maybeMinVersionForFixturesImport.
 	minVersion string
+	// summaryPath, if set, is the path of the file to which a per-query
+	// tpchBenchSummary is written in JSON once the benchmark completes. A
+	// relative path is interpreted relative to the test's artifacts directory.
+	summaryPath string
+}
+
+// tpchBenchSummary is the machine-readable summary of a tpchbench run written
+// to tpchBenchSpec.summaryPath. Its JSON encoding is meant to be consumed by
+// regression dashboards; fields may be added to it, but existing fields must
+// not be renamed or change meaning.
+type tpchBenchSummary struct {
+	// Benchmark is the name of the group of queries that was run, e.g. "tpch".
+	Benchmark string `json:"benchmark"`
+	// ScaleFactor is the TPC-H scale factor of the dataset.
+	ScaleFactor int `json:"scale_factor"`
+	// Queries holds the results of each query, keyed by the 1-based position
+	// of the query in the query file.
+	Queries map[int]tpchBenchQuerySummary `json:"queries"`
+}
+
+// tpchBenchQuerySummary holds the latency statistics of a single query over
+// all of its runs. Latencies are expressed in milliseconds.
+type tpchBenchQuerySummary struct {
+	NumRuns         int64   `json:"num_runs"`
+	MinLatencyMs    float64 `json:"min_latency_ms"`
+	MedianLatencyMs float64 `json:"median_latency_ms"`
+	P90LatencyMs    float64 `json:"p90_latency_ms"`
+	MaxLatencyMs    float64 `json:"max_latency_ms"`
 }
 
 // runTPCHBench runs sets of queries against CockroachDB clusters in different
@@ -116,11 +150,103 @@ func runTPCHBench(ctx context.Context, t *test, c *cluster, b tpchBenchSpec) {
 		if err := c.RunE(ctx, loadNode, cmd); err != nil {
 			t.Fatal(err)
 		}
+		if b.summaryPath != "" {
+			if err := writeTPCHBenchSummary(ctx, t, c, b, loadNode); err != nil {
+				t.Fatal(err)
+			}
+		}
 		return nil
 	})
 	m.Wait()
 }
 
+// writeTPCHBenchSummary fetches the histograms written by the workload on
+// loadNode and writes the per-query summary to b.summaryPath.
+func writeTPCHBenchSummary(
+	ctx context.Context, t *test, c *cluster, b tpchBenchSpec, loadNode nodeListOption,
+) error {
+	resultsDir, err := ioutil.TempDir("", "roachtest-tpchbench")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp dir")
+	}
+	defer func() { _ = os.RemoveAll(resultsDir) }()
+
+	localPath := filepath.Join(resultsDir, "stats.json")
+	c.Get(ctx, "logs/stats.json", localPath, loadNode)
+	snapshots, err := histogram.DecodeSnapshots(localPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode histogram snapshots")
+	}
+	queries, err := summarizeTPCHBenchQueries(snapshots)
+	if err != nil {
+		return err
+	}
+	summary := tpchBenchSummary{
+		Benchmark:   b.benchType.String(),
+		ScaleFactor: b.ScaleFactor,
+		Queries:     queries,
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := b.summaryPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.ArtifactsDir(), path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	t.l.Printf("writing per-query summary to %s", path)
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// summarizeTPCHBenchQueries merges the histogram ticks recorded by querybench
+// for each query and computes its latency statistics. querybench names the
+// histogram of each query "<n>: <query>", where n is the 1-based position of
+// the query in the query file; n is used as the key of the returned map.
+func summarizeTPCHBenchQueries(
+	snapshots map[string][]histogram.SnapshotTick,
+) (map[int]tpchBenchQuerySummary, error) {
+	toMs := func(nanos int64) float64 {
+		return float64(nanos) / float64(time.Millisecond)
+	}
+	queries := make(map[int]tpchBenchQuerySummary, len(snapshots))
+	for name, ticks := range snapshots {
+		idx := strings.Index(name, ":")
+		if idx < 0 {
+			return nil, errors.Errorf("unexpected histogram name %q", name)
+		}
+		queryNum, err := strconv.Atoi(strings.TrimSpace(name[:idx]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unexpected histogram name %q", name)
+		}
+		var h *hdrhistogram.Histogram
+		for _, tick := range ticks {
+			if tick.Hist == nil {
+				continue
+			}
+			if h == nil {
+				h = hdrhistogram.Import(tick.Hist)
+			} else {
+				h.Merge(hdrhistogram.Import(tick.Hist))
+			}
+		}
+		if h == nil || h.TotalCount() == 0 {
+			continue
+		}
+		queries[queryNum] = tpchBenchQuerySummary{
+			NumRuns:         h.TotalCount(),
+			MinLatencyMs:    toMs(h.Min()),
+			MedianLatencyMs: toMs(h.ValueAtQuantile(50)),
+			P90LatencyMs:    toMs(h.ValueAtQuantile(90)),
+			MaxLatencyMs:    toMs(h.Max()),
+		}
+	}
+	return queries, nil
+}
+
 // getNumQueriesInFile downloads a file that url points to, stores it at a
 // temporary location, parses it using querybench, and deletes the file. It
 // returns the number of queries in the file.
@@ -183,7 +309,7 @@ func loadTPCHBench(
 		if err := db.QueryRowContext(
 			ctx, `SELECT count(*) FROM tpch.supplier`,
 		).Scan(&supplierCardinality); err != nil {
-			if pqErr, ok := err.(*pq.Error); !(ok && pqErr.Code == pgerror.CodeUndefinedTableError) {
+			if !pgerror.IsUndefinedObject(err) {
 				return err
 			}
 			// Table does not exist. Set cardinality to 0.
@@ -206,8 +332,7 @@ func loadTPCHBench(
 		c.Wipe(ctx, roachNodes)
 		c.Start(ctx, t, roachNodes)
 		m.ResetDeaths()
-	} else if pqErr, ok := err.(*pq.Error); !ok ||
-		string(pqErr.Code) != pgerror.CodeInvalidCatalogNameError {
+	} else if !pgerror.IsUndefinedObject(err) {
 		return err
 	}
 
@@ -252,6 +377,7 @@ func registerTPCHBench(r *registry) {
 			ScaleFactor:     1,
 			benchType:       sql20,
 			numRunsPerQuery: 3,
+			summaryPath:     "summary.json",
 		},
 		{
 			Nodes:           3,
@@ -259,6 +385,7 @@ func registerTPCHBench(r *registry) {
 			ScaleFactor:     1,
 			benchType:       tpch,
 			numRunsPerQuery: 3,
+			summaryPath:     "summary.json",
 			minVersion:      `v19.1.0`,
 		},
 		{
@@ -267,6 +394,7 @@ func registerTPCHBench(r *registry) {
 			ScaleFactor:     1,
 			benchType:       tpchVec,
 			numRunsPerQuery: 3,
+			summaryPath:     "summary.json",
 			minVersion:      `v19.1.0`,
 		},
 	}
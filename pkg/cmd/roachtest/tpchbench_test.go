@@ -0,0 +1,132 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/workload/histogram"
+	"github.com/codahale/hdrhistogram"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeTPCHBenchQueries(t *testing.T) {
+	tick := func(name string, latencies ...time.Duration) histogram.SnapshotTick {
+		h := hdrhistogram.New(0, int64(time.Minute), 3)
+		for _, l := range latencies {
+			require.NoError(t, h.RecordValue(l.Nanoseconds()))
+		}
+		return histogram.SnapshotTick{Name: name, Hist: h.Export()}
+	}
+
+	const q1 = " 1: SELECT 1"
+	const q12 = "12: SELECT 12"
+	testCases := []struct {
+		name      string
+		snapshots map[string][]histogram.SnapshotTick
+		expected  map[int]tpchBenchQuerySummary
+		err       string
+	}{
+		{
+			name: "merged ticks",
+			snapshots: map[string][]histogram.SnapshotTick{
+				q1: {
+					tick(q1, 10*time.Millisecond, 20*time.Millisecond),
+					tick(q1, 30*time.Millisecond),
+				},
+				q12: {
+					tick(q12, time.Second),
+					tick(q12),
+				},
+			},
+			expected: map[int]tpchBenchQuerySummary{
+				1: {
+					NumRuns:         3,
+					MinLatencyMs:    10,
+					MedianLatencyMs: 20,
+					P90LatencyMs:    30,
+					MaxLatencyMs:    30,
+				},
+				12: {
+					NumRuns:         1,
+					MinLatencyMs:    1000,
+					MedianLatencyMs: 1000,
+					P90LatencyMs:    1000,
+					MaxLatencyMs:    1000,
+				},
+			},
+		},
+		{
+			// Queries whose histograms are empty or missing are left out.
+			name: "empty histogram",
+			snapshots: map[string][]histogram.SnapshotTick{
+				q1:  {tick(q1, 10*time.Millisecond)},
+				q12: {tick(q12), {Name: q12}},
+			},
+			expected: map[int]tpchBenchQuerySummary{
+				1: {
+					NumRuns:         1,
+					MinLatencyMs:    10,
+					MedianLatencyMs: 10,
+					P90LatencyMs:    10,
+					MaxLatencyMs:    10,
+				},
+			},
+		},
+		{
+			name:      "no snapshots",
+			snapshots: map[string][]histogram.SnapshotTick{},
+			expected:  map[int]tpchBenchQuerySummary{},
+		},
+		{
+			name: "name without query number",
+			snapshots: map[string][]histogram.SnapshotTick{
+				"SELECT 1": {tick("SELECT 1", time.Millisecond)},
+			},
+			err: `unexpected histogram name "SELECT 1"`,
+		},
+		{
+			name: "malformed query number",
+			snapshots: map[string][]histogram.SnapshotTick{
+				"q1: SELECT 1": {tick("q1: SELECT 1", time.Millisecond)},
+			},
+			err: `unexpected histogram name "q1: SELECT 1"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			queries, err := summarizeTPCHBenchQueries(tc.snapshots)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, queries, len(tc.expected))
+			for n, expected := range tc.expected {
+				res, ok := queries[n]
+				require.True(t, ok, "missing query %d", n)
+				// The histograms have 3 significant figures.
+				const delta = 1
+				require.Equal(t, expected.NumRuns, res.NumRuns, "query %d", n)
+				require.InDelta(t, expected.MinLatencyMs, res.MinLatencyMs, delta, "query %d", n)
+				require.InDelta(t, expected.MedianLatencyMs, res.MedianLatencyMs, delta, "query %d", n)
+				require.InDelta(t, expected.P90LatencyMs, res.P90LatencyMs, delta, "query %d", n)
+				require.InDelta(t, expected.MaxLatencyMs, res.MaxLatencyMs, delta, "query %d", n)
+			}
+		})
+	}
+}
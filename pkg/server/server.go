@@ -1828,7 +1828,7 @@ func (s *Server) doDrain(
 				if err := s.pgServer.Drain(drainMaxWait); err != nil {
 					return err
 				}
-				s.distSQLServer.Drain(ctx, drainMaxWait)
+				s.distSQLServer.Drain(ctx, drainMaxWait, "the node is draining its client connections")
 				return nil
 			}(); err != nil {
 				return nil, err
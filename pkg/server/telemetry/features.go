@@ -215,7 +215,8 @@ func GetFeatureCounts(quantize QuantizeCounts, reset ResetCounters) map[string]i
 // RecordError takes an error and increments the corresponding count
 // for its error code, and, if it is an unimplemented or internal
 // error, the count for that feature or the internal error's shortened
-// stack trace.
+// stack trace. The counts for any other telemetry keys attached to the
+// error are incremented as well.
 func RecordError(err error) {
 	if err == nil {
 		return
@@ -224,7 +225,7 @@ func RecordError(err error) {
 	if pgErr, ok := pgerror.GetPGCause(err); ok {
 		Count("errorcodes." + pgErr.Code)
 
-		if details := pgErr.TelemetryKey; details != "" {
+		for _, details := range pgerror.GetTelemetryKeys(err) {
 			var prefix string
 			switch pgErr.Code {
 			case pgerror.CodeFeatureNotSupportedError:
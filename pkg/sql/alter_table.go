@@ -195,6 +195,9 @@ func (n *alterTableNode) startExec(params runParams) error {
 					return pgerror.Newf(pgerror.CodeSyntaxError,
 						"multiple primary keys for table %q are not allowed", n.tableDesc.Name)
 				}
+				if d.NullsNotDistinct {
+					return pgerror.Unimplemented("unique nulls not distinct", "UNIQUE NULLS NOT DISTINCT is not supported")
+				}
 				idx := sqlbase.IndexDescriptor{
 					Name:             string(d.Name),
 					Unique:           true,
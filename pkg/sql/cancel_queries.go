@@ -94,8 +94,10 @@ func (n *cancelQueriesNode) Next(params runParams) (bool, error) {
 	}
 
 	if !response.Canceled && !n.ifExists {
-		return false, pgerror.Newf(pgerror.CodeDataExceptionError,
-			"could not cancel query %s: %s", queryID, response.Error)
+		return false, pgerror.WithTelemetryKey(
+			pgerror.Newf(pgerror.CodeDataExceptionError,
+				"could not cancel query %s: %s", queryID, response.Error),
+			"cancel.failed")
 	}
 
 	return true, nil
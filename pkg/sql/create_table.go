@@ -1113,6 +1113,9 @@ func MakeTableDesc(
 				return desc, pgerror.UnimplementedWithIssue(9148, "use CREATE INDEX to make interleaved indexes")
 			}
 		case *tree.UniqueConstraintTableDef:
+			if d.NullsNotDistinct {
+				return desc, pgerror.Unimplemented("unique nulls not distinct", "UNIQUE NULLS NOT DISTINCT is not supported")
+			}
 			idx := sqlbase.IndexDescriptor{
 				Name:             string(d.Name),
 				Unique:           true,
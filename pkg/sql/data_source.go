@@ -126,6 +126,10 @@ func (p *planner) getDataSource(
 		return p.getPlanForDesc(ctx, desc, tn, indexFlags, colCfg)
 
 	case *tree.RowsFromExpr:
+		if t.HasColDefLists() {
+			return planDataSource{}, pgerror.Unimplemented("ROWS FROM with col_def_list",
+				"column definition lists in ROWS FROM are not supported")
+		}
 		return p.getPlanForRowsFrom(ctx, t.Items...)
 
 	case *tree.Subquery:
@@ -169,6 +173,10 @@ func (p *planner) getDataSource(
 		if t.Lateral {
 			return planDataSource{}, pgerror.Newf(pgerror.CodeFeatureNotSupportedError, "LATERAL is not supported")
 		}
+		if t.AsOf != nil {
+			return planDataSource{}, pgerror.Unimplemented("table as of",
+				"AS OF SYSTEM TIME on a table reference is not supported")
+		}
 
 		if t.IndexFlags != nil {
 			indexFlags = t.IndexFlags
@@ -268,7 +268,7 @@ func (ag *aggregatorBase) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(ag.Ctx); sp != nil {
-		tracing.SetSpanStats(
+		ag.setSpanStats(
 			sp,
 			&AggregatorStats{
 				InputStats:      is,
@@ -465,7 +465,7 @@ func (ag *hashAggregator) accumulateRows() (
 	*distsqlpb.ProducerMetadata,
 ) {
 	for {
-		row, meta := ag.input.Next()
+		row, meta := ag.InputNext(ag.input)
 		if meta != nil {
 			if meta.Err != nil {
 				ag.MoveToDraining(nil /* err */)
@@ -528,7 +528,7 @@ func (ag *orderedAggregator) accumulateRows() (
 	*distsqlpb.ProducerMetadata,
 ) {
 	for {
-		row, meta := ag.input.Next()
+		row, meta := ag.InputNext(ag.input)
 		if meta != nil {
 			if meta.Err != nil {
 				ag.MoveToDraining(nil /* err */)
@@ -16,12 +16,14 @@ package distsqlrun
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
 
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
@@ -29,6 +31,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 )
 
 const rowChannelBufSize = 16
@@ -376,6 +379,48 @@ type RowChannel struct {
 	// numSenders is an atomic counter that keeps track of how many senders have
 	// yet to call ProducerDone().
 	numSenders int32
+
+	// maxQueueDepth is the highest number of messages observed in dataChan
+	// after a Push. It is updated atomically since there can be multiple
+	// senders.
+	maxQueueDepth int32
+
+	// canceled is set atomically to 1 once a sender pushes an error signaling
+	// that the query was canceled.
+	canceled int32
+
+	// closeReason is set atomically when the channel is closed; see
+	// CloseReason().
+	closeReason uint32
+}
+
+// RowChannelCloseReason describes whether and why a RowChannel was closed.
+type RowChannelCloseReason uint32
+
+const (
+	// RowChannelOpen indicates that some of the RowChannel's senders have yet to
+	// call ProducerDone().
+	RowChannelOpen RowChannelCloseReason = iota
+	// RowChannelProducersDone indicates that all the senders called
+	// ProducerDone() and none of them reported a cancellation.
+	RowChannelProducersDone
+	// RowChannelCanceled indicates that all the senders called ProducerDone()
+	// and at least one of them pushed an error signaling that the query was
+	// canceled (e.g. sqlbase.QueryCanceledError).
+	RowChannelCanceled
+)
+
+func (r RowChannelCloseReason) String() string {
+	switch r {
+	case RowChannelOpen:
+		return "open"
+	case RowChannelProducersDone:
+		return "producers done"
+	case RowChannelCanceled:
+		return "canceled"
+	default:
+		return fmt.Sprintf("RowChannelCloseReason(%d)", uint32(r))
+	}
 }
 
 var _ RowReceiver = &RowChannel{}
@@ -402,15 +447,20 @@ func (rc *RowChannel) initWithBufSizeAndNumSenders(types []types.T, chanBufSize,
 func (rc *RowChannel) Push(
 	row sqlbase.EncDatumRow, meta *distsqlpb.ProducerMetadata,
 ) ConsumerStatus {
+	if meta != nil && meta.Err != nil && isCancellationError(meta.Err) {
+		atomic.StoreInt32(&rc.canceled, 1)
+	}
 	consumerStatus := ConsumerStatus(
 		atomic.LoadUint32((*uint32)(&rc.consumerStatus)))
 	switch consumerStatus {
 	case NeedMoreRows:
 		rc.dataChan <- RowChannelMsg{Row: row, Meta: meta}
+		rc.recordQueueDepth()
 	case DrainRequested:
 		// If we're draining, only forward metadata.
 		if meta != nil {
 			rc.dataChan <- RowChannelMsg{Meta: meta}
+			rc.recordQueueDepth()
 		}
 	case ConsumerClosed:
 		// If the consumer is gone, swallow all the rows and the metadata.
@@ -418,6 +468,26 @@ func (rc *RowChannel) Push(
 	return consumerStatus
 }
 
+// recordQueueDepth updates the high-water mark of queued messages with the
+// current length of the channel.
+func (rc *RowChannel) recordQueueDepth() {
+	depth := int32(len(rc.dataChan))
+	for {
+		max := atomic.LoadInt32(&rc.maxQueueDepth)
+		if depth <= max || atomic.CompareAndSwapInt32(&rc.maxQueueDepth, max, depth) {
+			return
+		}
+	}
+}
+
+// MaxQueueDepth returns the highest number of rows and metadata records that
+// were queued in the channel, waiting for the consumer, right after a Push.
+// A value equal to the buffer size indicates that producers may have been
+// blocked by a slow consumer.
+func (rc *RowChannel) MaxQueueDepth() int {
+	return int(atomic.LoadInt32(&rc.maxQueueDepth))
+}
+
 // ProducerDone is part of the RowReceiver interface.
 func (rc *RowChannel) ProducerDone() {
 	newVal := atomic.AddInt32(&rc.numSenders, -1)
@@ -425,10 +495,36 @@ func (rc *RowChannel) ProducerDone() {
 		panic("too many ProducerDone() calls")
 	}
 	if newVal == 0 {
+		reason := RowChannelProducersDone
+		if atomic.LoadInt32(&rc.canceled) != 0 {
+			reason = RowChannelCanceled
+		}
+		atomic.StoreUint32(&rc.closeReason, uint32(reason))
 		close(rc.dataChan)
 	}
 }
 
+// CloseReason returns whether the RowChannel has been closed and, if so,
+// whether it was closed after a sender reported that the query was canceled
+// or after all the senders finished normally. It allows consumers to detect
+// cancellation without inspecting every metadata record. The reason is set
+// before the channel is closed, so it is accurate once Next() has returned
+// the end of the stream.
+func (rc *RowChannel) CloseReason() RowChannelCloseReason {
+	return RowChannelCloseReason(atomic.LoadUint32(&rc.closeReason))
+}
+
+// isCancellationError returns true if err signals that the query was
+// canceled, either through a pg error with the query canceled code or through
+// a canceled context.
+func isCancellationError(err error) bool {
+	if errors.Cause(err) == context.Canceled {
+		return true
+	}
+	code, ok := pgerror.GetPGCode(err)
+	return ok && code == pgerror.CodeQueryCanceledError
+}
+
 // OutputTypes is part of the RowSource interface.
 func (rc *RowChannel) OutputTypes() []types.T {
 	return rc.types
@@ -492,9 +588,18 @@ type RowBuffer struct {
 		// set to true when the sender calls ProducerDone().
 		producerClosed bool
 
+		// drained is set by DrainAndClose(). Once set, further records pushed by
+		// the producer are discarded and ProducerDone() is a no-op.
+		drained bool
+
 		// records represent the data that has been buffered. Push appends a row
 		// to the back, Next removes a row from the front.
 		records []BufferedRecord
+
+		// cond is signaled when records are removed or the consumer status
+		// changes. Push waits on it when the RowBuffer has a Capacity and is
+		// full. It is nil for RowBuffers not created through NewRowBuffer.
+		cond *sync.Cond
 	}
 
 	// Done is used when the RowBuffer is used as a RowSource; it is set to true
@@ -531,6 +636,11 @@ type RowBufferArgs struct {
 	OnNext func(*RowBuffer) (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata)
 	// OnPush, if specified, is called as the first thing in the Push() method.
 	OnPush func(sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata)
+	// Capacity, if positive, is the number of records that the RowBuffer can
+	// hold. Once it is full, Push blocks until a consumer calls Next (or closes
+	// the RowBuffer), like a RowChannel does. If zero, the RowBuffer grows
+	// unbounded and Push never blocks.
+	Capacity int
 }
 
 // NewRowBuffer creates a RowBuffer with the given schema and initial rows.
@@ -544,6 +654,7 @@ func NewRowBuffer(types []types.T, rows sqlbase.EncDatumRows, hooks RowBufferArg
 	}
 	rb := &RowBuffer{types: types, args: hooks}
 	rb.mu.records = wrappedRows
+	rb.mu.cond = sync.NewCond(&rb.mu.Mutex)
 	return rb
 }
 
@@ -556,29 +667,46 @@ func (rb *RowBuffer) Push(
 	}
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
+	if rb.mu.drained {
+		return ConsumerClosed
+	}
 	if rb.mu.producerClosed {
 		panic("Push called after ProducerDone")
 	}
 	// We mimic the behavior of RowChannel.
-	storeRow := func() {
+	status := ConsumerStatus(atomic.LoadUint32((*uint32)(&rb.ConsumerStatus)))
+	if rb.args.Capacity > 0 {
+		// Block until the consumer makes room or closes the RowBuffer.
+		for len(rb.mu.records) >= rb.args.Capacity && status != ConsumerClosed &&
+			rb.storesRecord(status, meta) {
+			rb.mu.cond.Wait()
+			status = ConsumerStatus(atomic.LoadUint32((*uint32)(&rb.ConsumerStatus)))
+		}
+		if rb.mu.drained {
+			return ConsumerClosed
+		}
+	}
+	if rb.storesRecord(status, meta) {
 		rowCopy := append(sqlbase.EncDatumRow(nil), row...)
 		rb.mu.records = append(rb.mu.records, BufferedRecord{Row: rowCopy, Meta: meta})
 	}
-	status := ConsumerStatus(atomic.LoadUint32((*uint32)(&rb.ConsumerStatus)))
+	return status
+}
+
+// storesRecord returns whether Push stores a record with the given metadata
+// given the consumer's status.
+func (rb *RowBuffer) storesRecord(status ConsumerStatus, meta *distsqlpb.ProducerMetadata) bool {
 	if rb.args.AccumulateRowsWhileDraining {
-		storeRow()
-	} else {
-		switch status {
-		case NeedMoreRows:
-			storeRow()
-		case DrainRequested:
-			if meta != nil {
-				storeRow()
-			}
-		case ConsumerClosed:
-		}
+		return true
+	}
+	switch status {
+	case NeedMoreRows:
+		return true
+	case DrainRequested:
+		return meta != nil
+	default:
+		return false
 	}
-	return status
 }
 
 // ProducerClosed is a utility function used by tests to check whether the
@@ -594,12 +722,38 @@ func (rb *RowBuffer) ProducerClosed() bool {
 func (rb *RowBuffer) ProducerDone() {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
+	if rb.mu.drained {
+		return
+	}
 	if rb.mu.producerClosed {
 		panic("RowBuffer already closed")
 	}
 	rb.mu.producerClosed = true
 }
 
+// DrainAndClose removes and returns all the records buffered in the RowBuffer,
+// and closes it on both ends: the consumer is marked as closed, which unblocks
+// any Push() waiting for capacity, and the producer is marked as done.
+// Records pushed afterwards are discarded. It is meant to be used when tearing
+// down tests and, unlike ConsumerClosed() and ProducerDone(), it can be called
+// multiple times (and in conjunction with them).
+func (rb *RowBuffer) DrainAndClose() []BufferedRecord {
+	prevStatus := ConsumerStatus(
+		atomic.SwapUint32((*uint32)(&rb.ConsumerStatus), uint32(ConsumerClosed)))
+	rb.mu.Lock()
+	records := rb.mu.records
+	rb.mu.records = nil
+	rb.mu.producerClosed = true
+	rb.mu.drained = true
+	rb.Done = true
+	rb.signalLocked()
+	rb.mu.Unlock()
+	if prevStatus != ConsumerClosed && rb.args.OnConsumerClosed != nil {
+		rb.args.OnConsumerClosed(rb)
+	}
+	return records
+}
+
 // Types is part of the RowReceiver interface.
 func (rb *RowBuffer) Types() []types.T {
 	return rb.types
@@ -618,8 +772,9 @@ func (rb *RowBuffer) Start(ctx context.Context) context.Context { return ctx }
 
 // Next is part of the RowSource interface.
 //
-// There's no synchronization here with Push(). The assumption is that these
-// two methods are not called concurrently.
+// Next may be called concurrently with Push(), in which case it unblocks a
+// Push() waiting for capacity. Note that Next doesn't wait for rows to be
+// pushed: it returns nil, nil if the RowBuffer is empty.
 func (rb *RowBuffer) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
 	if rb.args.OnNext != nil {
 		row, meta := rb.args.OnNext(rb)
@@ -627,19 +782,32 @@ func (rb *RowBuffer) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
 			return row, meta
 		}
 	}
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
 	if len(rb.mu.records) == 0 {
 		rb.Done = true
 		return nil, nil
 	}
 	rec := rb.mu.records[0]
 	rb.mu.records = rb.mu.records[1:]
+	rb.signalLocked()
 	return rec.Row, rec.Meta
 }
 
+// signalLocked wakes up any Push() blocked waiting for capacity.
+func (rb *RowBuffer) signalLocked() {
+	if rb.mu.cond != nil {
+		rb.mu.cond.Broadcast()
+	}
+}
+
 // ConsumerDone is part of the RowSource interface.
 func (rb *RowBuffer) ConsumerDone() {
 	if atomic.CompareAndSwapUint32((*uint32)(&rb.ConsumerStatus),
 		uint32(NeedMoreRows), uint32(DrainRequested)) {
+		rb.mu.Lock()
+		rb.signalLocked()
+		rb.mu.Unlock()
 		if rb.args.OnConsumerDone != nil {
 			rb.args.OnConsumerDone(rb)
 		}
@@ -653,6 +821,9 @@ func (rb *RowBuffer) ConsumerClosed() {
 		log.Fatalf(context.Background(), "RowBuffer already closed")
 	}
 	atomic.StoreUint32((*uint32)(&rb.ConsumerStatus), uint32(ConsumerClosed))
+	rb.mu.Lock()
+	rb.signalLocked()
+	rb.mu.Unlock()
 	if rb.args.OnConsumerClosed != nil {
 		rb.args.OnConsumerClosed(rb)
 	}
@@ -19,12 +19,14 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/pkg/errors"
 )
 
 // Test the behavior of Run in the presence of errors that switch to the drain
@@ -53,6 +55,186 @@ func TestRunDrain(t *testing.T) {
 	}
 }
 
+// TestRowBufferCapacity verifies that a RowBuffer with a Capacity blocks Push
+// once it is full until the consumer reads a row or closes it.
+func TestRowBufferCapacity(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	row := sqlbase.EncDatumRow{sqlbase.IntEncDatum(1)}
+	newFullBuffer := func() *RowBuffer {
+		rb := NewRowBuffer(sqlbase.OneIntCol, nil /* rows */, RowBufferArgs{Capacity: 2})
+		for i := 0; i < 2; i++ {
+			if status := rb.Push(row, nil /* meta */); status != NeedMoreRows {
+				t.Fatalf("unexpected status %d", status)
+			}
+		}
+		return rb
+	}
+	// pushAsync pushes a row to rb in a goroutine and returns a channel on which
+	// the status is sent once Push returns.
+	pushAsync := func(rb *RowBuffer) chan ConsumerStatus {
+		pushed := make(chan ConsumerStatus, 1)
+		go func() {
+			pushed <- rb.Push(row, nil /* meta */)
+		}()
+		select {
+		case <-pushed:
+			t.Fatal("Push into a full RowBuffer did not block")
+		case <-time.After(10 * time.Millisecond):
+		}
+		return pushed
+	}
+
+	t.Run("Next", func(t *testing.T) {
+		rb := newFullBuffer()
+		pushed := pushAsync(rb)
+		if r, _ := rb.Next(); r == nil {
+			t.Fatal("expected a row")
+		}
+		if status := <-pushed; status != NeedMoreRows {
+			t.Fatalf("unexpected status %d", status)
+		}
+		if records := rb.DrainAndClose(); len(records) != 2 {
+			t.Fatalf("expected 2 remaining rows, got %d", len(records))
+		}
+	})
+
+	t.Run("DrainAndClose", func(t *testing.T) {
+		rb := newFullBuffer()
+		pushed := pushAsync(rb)
+		if records := rb.DrainAndClose(); len(records) != 2 {
+			t.Fatalf("expected 2 drained rows, got %d", len(records))
+		}
+		if status := <-pushed; status != ConsumerClosed {
+			t.Fatalf("unexpected status %d", status)
+		}
+		if !rb.ProducerClosed() {
+			t.Fatal("expected the producer to be closed")
+		}
+		// The RowBuffer can be closed again, by either end, and records pushed
+		// in the meantime are discarded.
+		if status := rb.Push(row, nil /* meta */); status != ConsumerClosed {
+			t.Fatalf("unexpected status %d", status)
+		}
+		rb.ProducerDone()
+		if records := rb.DrainAndClose(); len(records) != 0 {
+			t.Fatalf("expected no drained rows, got %d", len(records))
+		}
+	})
+
+	t.Run("ConsumerClosed", func(t *testing.T) {
+		rb := newFullBuffer()
+		pushed := pushAsync(rb)
+		rb.ConsumerClosed()
+		if status := <-pushed; status != ConsumerClosed {
+			t.Fatalf("unexpected status %d", status)
+		}
+	})
+
+	t.Run("ConsumerDone", func(t *testing.T) {
+		// Rows are dropped once draining is requested, so the blocked Push of a
+		// row returns without storing it.
+		rb := newFullBuffer()
+		pushed := pushAsync(rb)
+		rb.ConsumerDone()
+		if status := <-pushed; status != DrainRequested {
+			t.Fatalf("unexpected status %d", status)
+		}
+	})
+}
+
+// TestRowChannelMaxQueueDepth verifies that a RowChannel tracks the highest
+// number of messages queued in it.
+func TestRowChannelMaxQueueDepth(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	row := sqlbase.EncDatumRow{sqlbase.IntEncDatum(1)}
+	rc := &RowChannel{}
+	rc.initWithBufSizeAndNumSenders(sqlbase.OneIntCol, 4, 1)
+	if d := rc.MaxQueueDepth(); d != 0 {
+		t.Fatalf("expected max queue depth 0, got %d", d)
+	}
+
+	for i := 0; i < 3; i++ {
+		rc.Push(row, nil /* meta */)
+	}
+	if d := rc.MaxQueueDepth(); d != 3 {
+		t.Fatalf("expected max queue depth 3, got %d", d)
+	}
+
+	// Consuming rows doesn't lower the high-water mark.
+	for i := 0; i < 3; i++ {
+		rc.Next()
+	}
+	rc.Push(row, nil /* meta */)
+	if d := rc.MaxQueueDepth(); d != 3 {
+		t.Fatalf("expected max queue depth 3, got %d", d)
+	}
+
+	// Filling up the buffer raises it to the buffer size.
+	for i := 0; i < 3; i++ {
+		rc.Push(row, nil /* meta */)
+	}
+	if d := rc.MaxQueueDepth(); d != 4 {
+		t.Fatalf("expected max queue depth 4, got %d", d)
+	}
+}
+
+func TestRowChannelCloseReason(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	row := sqlbase.EncDatumRow{sqlbase.IntEncDatum(1)}
+	testCases := []struct {
+		name     string
+		meta     []*distsqlpb.ProducerMetadata
+		expected RowChannelCloseReason
+	}{
+		{
+			name:     "done",
+			expected: RowChannelProducersDone,
+		},
+		{
+			name:     "error",
+			meta:     []*distsqlpb.ProducerMetadata{{Err: errors.New("boom")}},
+			expected: RowChannelProducersDone,
+		},
+		{
+			name:     "query canceled",
+			meta:     []*distsqlpb.ProducerMetadata{{Err: sqlbase.QueryCanceledError}},
+			expected: RowChannelCanceled,
+		},
+		{
+			name:     "context canceled",
+			meta:     []*distsqlpb.ProducerMetadata{{Err: errors.Wrap(context.Canceled, "wrapped")}},
+			expected: RowChannelCanceled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &RowChannel{}
+			rc.initWithBufSizeAndNumSenders(sqlbase.OneIntCol, 10, 2 /* numSenders */)
+			rc.Push(row, nil /* meta */)
+			for _, meta := range tc.meta {
+				rc.Push(nil /* row */, meta)
+			}
+			rc.ProducerDone()
+			if r := rc.CloseReason(); r != RowChannelOpen {
+				t.Fatalf("expected %s with a sender left, got %s", RowChannelOpen, r)
+			}
+			rc.ProducerDone()
+			for {
+				row, meta := rc.Next()
+				if row == nil && meta == nil {
+					break
+				}
+			}
+			if r := rc.CloseReason(); r != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, r)
+			}
+		})
+	}
+}
+
 // Benchmark a pipeline of RowChannels.
 func BenchmarkRowChannelPipeline(b *testing.B) {
 	for _, length := range []int{1, 2, 3, 4} {
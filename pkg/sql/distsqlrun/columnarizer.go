@@ -77,7 +77,7 @@ func (c *columnarizer) Next(context.Context) coldata.Batch {
 	nRows := uint16(0)
 	columnTypes := c.OutputTypes()
 	for ; nRows < coldata.BatchSize; nRows++ {
-		row, meta := c.input.Next()
+		row, meta := c.InputNext(c.input)
 		if meta != nil {
 			c.accumulatedMeta = append(c.accumulatedMeta, *meta)
 			nRows--
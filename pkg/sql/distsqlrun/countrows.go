@@ -81,7 +81,7 @@ func (ag *countAggregator) Start(ctx context.Context) context.Context {
 
 func (ag *countAggregator) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
 	for ag.State == StateRunning {
-		row, meta := ag.input.Next()
+		row, meta := ag.InputNext(ag.input)
 		if meta != nil {
 			if meta.Err != nil {
 				ag.MoveToDraining(meta.Err)
@@ -118,7 +118,7 @@ func (ag *countAggregator) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(ag.Ctx); sp != nil {
-		tracing.SetSpanStats(
+		ag.setSpanStats(
 			sp, &AggregatorStats{InputStats: is},
 		)
 	}
@@ -201,7 +201,7 @@ func (d *Distinct) close() {
 // Next is part of the RowSource interface.
 func (d *Distinct) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
 	for d.State == StateRunning {
-		row, meta := d.input.Next()
+		row, meta := d.InputNext(d.input)
 		if meta != nil {
 			if meta.Err != nil {
 				d.MoveToDraining(nil /* err */)
@@ -269,7 +269,7 @@ func (d *Distinct) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
 // of the last row it saw, emitting if the new row is different.
 func (d *SortedDistinct) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
 	for d.State == StateRunning {
-		row, meta := d.input.Next()
+		row, meta := d.InputNext(d.input)
 		if meta != nil {
 			if meta.Err != nil {
 				d.MoveToDraining(nil /* err */)
@@ -332,7 +332,7 @@ func (d *Distinct) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(d.Ctx); sp != nil {
-		tracing.SetSpanStats(
+		d.setSpanStats(
 			sp, &DistinctStats{InputStats: is, MaxAllocatedMem: d.MemMonitor.MaximumBytes()},
 		)
 	}
@@ -148,6 +148,39 @@ func TestDistinct(t *testing.T) {
 	}
 }
 
+// TestDistinctRowCounts verifies that the distinct processor counts the rows
+// it reads and emits without a recording span.
+func TestDistinctRowCounts(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(ctx)
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	var rows sqlbase.EncDatumRows
+	for _, v := range []int{1, 2, 1, 3, 2} {
+		rows = append(rows, sqlbase.EncDatumRow{sqlbase.IntEncDatum(v)})
+	}
+	in := NewRowBuffer(sqlbase.OneIntCol, rows, RowBufferArgs{})
+	out := &RowBuffer{}
+	spec := distsqlpb.DistinctSpec{DistinctColumns: []uint32{0}}
+	d, err := NewDistinct(&flowCtx, 0 /* processorID */, &spec, in, &distsqlpb.PostProcessSpec{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Run(ctx)
+
+	expected := ProcessorRowCounts{InputRows: 5, OutputRows: 3}
+	if res := d.(*Distinct).RowCounts(); res != expected {
+		t.Fatalf("expected %+v, got %+v", expected, res)
+	}
+}
+
 func benchmarkDistinct(b *testing.B, orderedColumns []uint32) {
 	const numCols = 2
 
@@ -197,3 +197,116 @@ func (eh *exprHelper) eval(row sqlbase.EncDatumRow) (tree.Datum, error) {
 	eh.evalCtx.PopIVarContainer()
 	return d, err
 }
+
+// simpleFilterFn is a filter specialized by exprHelper.compileSimpleFilter.
+type simpleFilterFn func(row sqlbase.EncDatumRow) (bool, error)
+
+// compileSimpleFilter returns a closure that is equivalent to evalFilter but
+// doesn't walk the expression tree on every call. This is only possible if the
+// expression is a comparison (=, <>, <, <=, >, >=) between columns and
+// constants of the same scalar type, or a conjunction of such comparisons.
+// nil is returned for all other expressions, in which case evalFilter must be
+// used.
+func (eh *exprHelper) compileSimpleFilter() simpleFilterFn {
+	if eh.expr == nil {
+		return nil
+	}
+	return eh.compileFilterExpr(eh.expr)
+}
+
+func (eh *exprHelper) compileFilterExpr(expr tree.TypedExpr) simpleFilterFn {
+	switch t := expr.(type) {
+	case *tree.ParenExpr:
+		return eh.compileFilterExpr(t.TypedInnerExpr())
+
+	case *tree.AndExpr:
+		left := eh.compileFilterExpr(t.TypedLeft())
+		right := eh.compileFilterExpr(t.TypedRight())
+		if left == nil || right == nil {
+			return nil
+		}
+		return func(row sqlbase.EncDatumRow) (bool, error) {
+			if pass, err := left(row); !pass || err != nil {
+				return false, err
+			}
+			return right(row)
+		}
+
+	case *tree.ComparisonExpr:
+		var pass func(cmp int) bool
+		switch t.Operator {
+		case tree.EQ:
+			pass = func(cmp int) bool { return cmp == 0 }
+		case tree.NE:
+			pass = func(cmp int) bool { return cmp != 0 }
+		case tree.LT:
+			pass = func(cmp int) bool { return cmp < 0 }
+		case tree.LE:
+			pass = func(cmp int) bool { return cmp <= 0 }
+		case tree.GT:
+			pass = func(cmp int) bool { return cmp > 0 }
+		case tree.GE:
+			pass = func(cmp int) bool { return cmp >= 0 }
+		default:
+			return nil
+		}
+		leftTyp, rightTyp := t.TypedLeft().ResolvedType(), t.TypedRight().ResolvedType()
+		if !isSimpleFilterType(leftTyp) || !leftTyp.Equivalent(rightTyp) {
+			return nil
+		}
+		left := eh.compileFilterOperand(t.TypedLeft())
+		right := eh.compileFilterOperand(t.TypedRight())
+		if left == nil || right == nil {
+			return nil
+		}
+		return func(row sqlbase.EncDatumRow) (bool, error) {
+			l, err := left(row)
+			if err != nil || l == tree.DNull {
+				return false, err
+			}
+			r, err := right(row)
+			if err != nil || r == tree.DNull {
+				return false, err
+			}
+			return pass(l.Compare(eh.evalCtx, r)), nil
+		}
+	}
+	return nil
+}
+
+// compileFilterOperand returns a closure that produces the value of a column
+// or of a constant for the given row, or nil for any other expression.
+func (eh *exprHelper) compileFilterOperand(
+	expr tree.TypedExpr,
+) func(sqlbase.EncDatumRow) (tree.Datum, error) {
+	switch t := expr.(type) {
+	case *tree.IndexedVar:
+		idx := t.Idx
+		return func(row sqlbase.EncDatumRow) (tree.Datum, error) {
+			if err := row[idx].EnsureDecoded(&eh.types[idx], &eh.datumAlloc); err != nil {
+				return nil, err
+			}
+			return row[idx].Datum, nil
+		}
+	case tree.Datum:
+		return func(sqlbase.EncDatumRow) (tree.Datum, error) {
+			return t, nil
+		}
+	}
+	return nil
+}
+
+// isSimpleFilterType returns whether comparisons between two values of the
+// given type are equivalent to comparing them with Datum.Compare. This isn't
+// the case for composite types such as tuples and arrays, whose comparisons
+// have special NULL semantics.
+func isSimpleFilterType(typ *types.T) bool {
+	switch typ.Family() {
+	case types.BoolFamily, types.IntFamily, types.FloatFamily, types.DecimalFamily,
+		types.StringFamily, types.BytesFamily, types.DateFamily, types.TimeFamily,
+		types.TimestampFamily, types.TimestampTZFamily, types.IntervalFamily,
+		types.UuidFamily, types.INetFamily, types.OidFamily:
+		return true
+	}
+	return false
+}
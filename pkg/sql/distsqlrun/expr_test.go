@@ -22,6 +22,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 )
@@ -91,3 +92,84 @@ func TestProcessExpressionConstantEval(t *testing.T) {
 		t.Errorf("invalid expr '%v', expected '%v'", expr, expected)
 	}
 }
+
+// TestCompileSimpleFilter verifies that compileSimpleFilter only specializes
+// simple comparisons, and that the specialized filters agree with evalFilter.
+func TestCompileSimpleFilter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	colTypes := []types.T{*types.Int, *types.Int, *types.String, *types.Float}
+
+	testCases := []struct {
+		expr     string
+		compiled bool
+	}{
+		{`@1 = @2`, true},
+		{`@1 != @2`, true},
+		{`@1 < @2`, true},
+		{`@1 <= 3`, true},
+		{`3 > @2`, true},
+		{`@3 >= 'b'`, true},
+		{`@1 > @2 AND (@1 < 4 AND @3 = 'a')`, true},
+		{`@4 < 1.5`, true},
+		{`@1 + 1 = @2`, false},
+		{`@1 = @2 OR @1 < 3`, false},
+		{`@1 > 2 AND @1 + 1 = @2`, false},
+		{`@1 IN (1, 2)`, false},
+		{`@1 IS NOT DISTINCT FROM @2`, false},
+		{`@1::FLOAT = @4`, false},
+	}
+
+	var rows sqlbase.EncDatumRows
+	strs := []string{"a", "b", "c"}
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			rows = append(rows, sqlbase.EncDatumRow{
+				sqlbase.IntEncDatum(i),
+				sqlbase.IntEncDatum(j),
+				sqlbase.StrEncDatum(strs[(i+j)%len(strs)]),
+				sqlbase.DatumToEncDatum(types.Float, tree.NewDFloat(tree.DFloat(i)/2)),
+			})
+		}
+	}
+	// Rows with NULLs never pass a comparison.
+	rows = append(rows,
+		sqlbase.EncDatumRow{
+			sqlbase.NullEncDatum(), sqlbase.IntEncDatum(1), sqlbase.StrEncDatum("a"), sqlbase.NullEncDatum(),
+		},
+		sqlbase.EncDatumRow{
+			sqlbase.IntEncDatum(1), sqlbase.NullEncDatum(), sqlbase.NullEncDatum(), sqlbase.NullEncDatum(),
+		},
+	)
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			var eh exprHelper
+			if err := eh.init(distsqlpb.Expression{Expr: tc.expr}, colTypes, &evalCtx); err != nil {
+				t.Fatal(err)
+			}
+			fn := eh.compileSimpleFilter()
+			if (fn != nil) != tc.compiled {
+				t.Fatalf("expected compiled=%t, got %t", tc.compiled, fn != nil)
+			}
+			if fn == nil {
+				return
+			}
+			for _, row := range rows {
+				expected, err := eh.evalFilter(row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				res, err := fn(row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res != expected {
+					t.Errorf("%s: expected %t, got %t", row.String(colTypes), expected, res)
+				}
+			}
+		})
+	}
+}
@@ -16,7 +16,9 @@ package distsqlrun
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
@@ -30,12 +32,14 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlutil"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/storage/diskmap"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
 	"github.com/cockroachdb/cockroach/pkg/util/contextutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/mon"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 )
@@ -114,6 +118,14 @@ type FlowCtx struct {
 
 	// local is true if this flow is being run as part of a local-only query.
 	local bool
+
+	// trailingMetaBudget, if set, limits the total size of the trace data that
+	// the processors in this flow return as trailing metadata.
+	trailingMetaBudget *trailingMetaBudget
+
+	// rowHook, if set, is invoked for every row emitted by the processors in
+	// this flow. See RowHook.
+	rowHook RowHook
 }
 
 // NewEvalCtx returns a modifiable copy of the FlowCtx's EvalContext.
@@ -132,6 +144,17 @@ func (ctx *FlowCtx) TestingKnobs() TestingKnobs {
 	return ctx.testingKnobs
 }
 
+// SpillThresholdBytes returns the amount of memory that a processor that can
+// fall back to disk may use before it spills. It is controlled by the
+// sql.distsql.temp_storage.workmem cluster setting, unless overridden by the
+// MemoryLimitBytes testing knob.
+func (ctx *FlowCtx) SpillThresholdBytes() int64 {
+	if limit := ctx.testingKnobs.MemoryLimitBytes; limit > 0 {
+		return limit
+	}
+	return settingWorkMemBytes.Get(&ctx.Settings.SV)
+}
+
 // Stopper returns the stopper for this flowCtx.
 func (ctx *FlowCtx) Stopper() *stop.Stopper {
 	return ctx.stopper
@@ -150,11 +173,38 @@ type startable interface {
 	start(ctx context.Context, wg *sync.WaitGroup, ctxCancel context.CancelFunc)
 }
 
+// FlowKind distinguishes flows by how their results are delivered.
+type FlowKind int
+
+const (
+	// AsyncFlow is a flow set up through a SetupFlow RPC. It sends its results
+	// to other flows through streams, and may wait for inbound streams to be
+	// connected.
+	AsyncFlow FlowKind = iota
+	// SyncFlow is a flow that returns its results directly to the caller that
+	// set it up, either through a RunSyncFlow RPC or locally.
+	SyncFlow
+)
+
+func (k FlowKind) String() string {
+	switch k {
+	case AsyncFlow:
+		return "async"
+	case SyncFlow:
+		return "sync"
+	default:
+		return fmt.Sprintf("FlowKind(%d)", int(k))
+	}
+}
+
 // Flow represents a flow which consists of processors and streams.
 type Flow struct {
 	FlowCtx
 
 	flowRegistry *flowRegistry
+	// kind is SyncFlow if the flow has a syncFlowConsumer, and AsyncFlow
+	// otherwise.
+	kind FlowKind
 	// processors contains a subset of the processors in the flow - the ones that
 	// run in their own goroutines. Some processors that implement RowSource are
 	// scheduled to run in their consumer's goroutine; those are not present here.
@@ -169,6 +219,16 @@ type Flow struct {
 
 	localProcessors []LocalProcessor
 
+	// memMonitors contains the memory monitors of all the processors in the
+	// flow, including the ones fused with their consumer. It is used by
+	// MaxMemoryUsage.
+	memMonitors []*mon.BytesMonitor
+
+	// allProcessors contains all the processors of the flow, including the
+	// ones fused with their consumer, in the order of spec.Processors. It is
+	// used by Stats.
+	allProcessors []Processor
+
 	// startedGoroutines specifies whether this flow started any goroutines. This
 	// is used in Wait() to avoid the overhead of waiting for non-existent
 	// goroutines.
@@ -197,6 +257,21 @@ type Flow struct {
 
 	// spec is the request that produced this flow. Only used for debugging.
 	spec *distsqlpb.FlowSpec
+
+	// setupDeadline, if set, is the time by which the flow must be started; the
+	// flow fails to start with a query canceled error after it. It also bounds
+	// the time the inbound streams have to connect.
+	setupDeadline time.Time
+}
+
+// checkFlowSetupDeadline returns a query canceled error if the given setup
+// deadline is set and has passed.
+func checkFlowSetupDeadline(deadline time.Time) error {
+	if !deadline.IsZero() && !timeutil.Now().Before(deadline) {
+		return pgerror.Newf(pgerror.CodeQueryCanceledError,
+			"flow could not be set up before its deadline %s", deadline)
+	}
+	return nil
 }
 
 func newFlow(
@@ -211,10 +286,18 @@ func newFlow(
 		syncFlowConsumer: syncFlowConsumer,
 		localProcessors:  localProcessors,
 	}
+	if syncFlowConsumer != nil {
+		f.kind = SyncFlow
+	}
 	f.status = FlowNotStarted
 	return f
 }
 
+// Kind returns whether this is a sync or an async flow.
+func (f *Flow) Kind() FlowKind {
+	return f.kind
+}
+
 // setupInboundStream adds a stream to the stream map (inboundStreams or
 // localStreams).
 func (f *Flow) setupInboundStream(
@@ -372,18 +455,49 @@ func (f *Flow) setupInputSyncs(ctx context.Context) ([][]RowSource, error) {
 			if len(is.Streams) == 0 {
 				return nil, errors.Errorf("input sync with no streams")
 			}
+			priorityIdx := -1
+			for i := range is.Streams {
+				if !is.Streams[i].Priority {
+					continue
+				}
+				if priorityIdx != -1 {
+					return nil, errors.Errorf("input sync with more than one priority stream")
+				}
+				priorityIdx = i
+			}
 			var sync RowSource
 			switch is.Type {
 			case distsqlpb.InputSyncSpec_UNORDERED:
-				mrc := &RowChannel{}
-				mrc.InitWithNumSenders(is.ColumnTypes, len(is.Streams))
-				for _, s := range is.Streams {
-					if err := f.setupInboundStream(ctx, s, mrc); err != nil {
+				if priorityIdx == -1 || len(is.Streams) == 1 {
+					var err error
+					sync, err = f.setupUnorderedSync(ctx, is.ColumnTypes, is.Streams, is.RoundRobin)
+					if err != nil {
 						return nil, err
 					}
+					break
 				}
-				sync = mrc
+				// Priority synchronizer: the priority stream gets its own RowChannel,
+				// the other streams are synchronized as usual.
+				priority := &RowChannel{}
+				priority.InitWithNumSenders(is.ColumnTypes, 1 /* numSenders */)
+				if err := f.setupInboundStream(ctx, is.Streams[priorityIdx], priority); err != nil {
+					return nil, err
+				}
+				others := make([]distsqlpb.StreamEndpointSpec, 0, len(is.Streams)-1)
+				others = append(others, is.Streams[:priorityIdx]...)
+				others = append(others, is.Streams[priorityIdx+1:]...)
+				rest, err := f.setupUnorderedSync(ctx, is.ColumnTypes, others, is.RoundRobin)
+				if err != nil {
+					return nil, err
+				}
+				sync = makePrioritySync(priority, rest)
 			case distsqlpb.InputSyncSpec_ORDERED:
+				if is.RoundRobin {
+					return nil, errors.Errorf("round-robin is not supported by ordered input syncs")
+				}
+				if priorityIdx != -1 {
+					return nil, errors.Errorf("priority streams are not supported by ordered input syncs")
+				}
 				// Ordered synchronizer: create a RowChannel for each input.
 				streams := make([]RowSource, len(is.Streams))
 				for i, s := range is.Streams {
@@ -409,6 +523,38 @@ func (f *Flow) setupInputSyncs(ctx context.Context) ([][]RowSource, error) {
 	return inputSyncs, nil
 }
 
+// setupUnorderedSync creates an unordered synchronizer over the given inbound
+// streams. If roundRobin is set and there are several streams, the streams are
+// consumed in round-robin order; otherwise they share a single RowChannel.
+func (f *Flow) setupUnorderedSync(
+	ctx context.Context,
+	types []types.T,
+	streams []distsqlpb.StreamEndpointSpec,
+	roundRobin bool,
+) (RowSource, error) {
+	if roundRobin && len(streams) > 1 {
+		// Round-robin synchronizer: create a RowChannel for each input.
+		rowChans := make([]*RowChannel, len(streams))
+		for i, s := range streams {
+			rowChan := &RowChannel{}
+			rowChan.InitWithNumSenders(types, 1 /* numSenders */)
+			if err := f.setupInboundStream(ctx, s, rowChan); err != nil {
+				return nil, err
+			}
+			rowChans[i] = rowChan
+		}
+		return makeRoundRobinSync(types, rowChans)
+	}
+	mrc := &RowChannel{}
+	mrc.InitWithNumSenders(types, len(streams))
+	for _, s := range streams {
+		if err := f.setupInboundStream(ctx, s, mrc); err != nil {
+			return nil, err
+		}
+	}
+	return mrc, nil
+}
+
 // setupProcessors creates processors for each spec in f.spec, fusing processors
 // together when possible (when an upstream processor implements RowSource, only
 // has one output, and that output is a simple PASS_THROUGH output), and
@@ -425,6 +571,10 @@ func (f *Flow) setupProcessors(ctx context.Context, inputSyncs [][]RowSource) er
 		if err != nil {
 			return err
 		}
+		if mp, ok := p.(memoryMonitoredProcessor); ok && mp.memMonitor() != nil {
+			f.memMonitors = append(f.memMonitors, mp.memMonitor())
+		}
+		f.allProcessors = append(f.allProcessors, p)
 
 		// fuse will return true if we managed to fuse p, false otherwise.
 		fuse := func() bool {
@@ -536,8 +686,14 @@ func (f *Flow) startInternal(ctx context.Context, doneFn func()) error {
 	ctx, f.ctxCancel = contextutil.WithCancel(ctx)
 	f.ctxDone = ctx.Done()
 
+	if err := checkFlowSetupDeadline(f.setupDeadline); err != nil {
+		return err
+	}
+
 	// Only register the flow if there will be inbound stream connections that
-	// need to look up this flow in the flow registry.
+	// need to look up this flow in the flow registry. Flows without any remote
+	// inbound streams take a fast path: they skip the registry entirely, since
+	// nobody can connect to them, and the last processor runs inline in Run().
 	if !f.isLocal() {
 		// Once we call RegisterFlow, the inbound streams become accessible; we must
 		// set up the WaitGroup counter before.
@@ -545,8 +701,19 @@ func (f *Flow) startInternal(ctx context.Context, doneFn func()) error {
 		// processors.
 		f.waitGroup.Add(len(f.inboundStreams))
 
+		// The inbound streams must connect before the setup deadline, if any.
+		streamTimeout := settingFlowStreamTimeout.Get(&f.FlowCtx.Settings.SV)
+		if !f.setupDeadline.IsZero() {
+			if untilDeadline := timeutil.Until(f.setupDeadline); untilDeadline < streamTimeout {
+				streamTimeout = untilDeadline
+			}
+		}
+		// The flow is canceled with a query canceled error once the deadline of
+		// its context, if any, passes. Local flows, which aren't registered, only
+		// see their context expire.
+		deadline, _ := ctx.Deadline()
 		if err := f.flowRegistry.RegisterFlow(
-			ctx, f.id, f, f.inboundStreams, settingFlowStreamTimeout.Get(&f.FlowCtx.Settings.SV),
+			ctx, f.id, f, f.inboundStreams, streamTimeout, deadline,
 		); err != nil {
 			return err
 		}
@@ -571,7 +738,8 @@ func (f *Flow) startInternal(ctx context.Context, doneFn func()) error {
 	return nil
 }
 
-// isLocal returns whether this flow does not have any remote execution.
+// isLocal returns whether this flow does not have any remote execution. Such
+// flows are never registered with the flowRegistry.
 func (f *Flow) isLocal() bool {
 	return len(f.inboundStreams) == 0
 }
@@ -649,6 +817,56 @@ func (f *Flow) Wait() {
 	}
 }
 
+// MaxMemoryUsage returns the sum of the peak memory usage of all the processors
+// in the flow that use a memory monitor. Since the processors don't
+// necessarily reach their peaks at the same time, this is an upper bound on
+// the peak memory usage of the flow as a whole. It is meant to be called
+// after Wait() returns.
+func (f *Flow) MaxMemoryUsage() int64 {
+	var res int64
+	for _, m := range f.memMonitors {
+		res += m.MaximumBytes()
+	}
+	return res
+}
+
+// ProcessorStats are the stats collected by a processor of a flow.
+type ProcessorStats struct {
+	ProcessorID int32
+	// Name is the name of the processor's span (e.g. "merge joiner"). It is
+	// empty if the processor was never started or doesn't embed a
+	// ProcessorBase.
+	Name string
+	// Stats is nil if the processor didn't collect stats.
+	Stats distsqlpb.DistSQLSpanStats
+	// RowCounts are maintained whether or not the flow's span is recording.
+	// They are zero if the processor doesn't embed a ProcessorBase.
+	RowCounts ProcessorRowCounts
+}
+
+// FlowStats are the stats collected by the processors of a flow.
+type FlowStats struct {
+	// Processors has an entry for every processor of the flow, including the
+	// ones fused with their consumer, in the order of the flow spec.
+	Processors []ProcessorStats
+}
+
+// Stats returns the stats collected by the processors of the flow. Processors
+// only collect stats when the flow's span is recording, so the entries have
+// nil stats otherwise; the row counts are always reported. It is meant to be
+// called after Wait() returns.
+func (f *Flow) Stats() FlowStats {
+	res := FlowStats{Processors: make([]ProcessorStats, len(f.allProcessors))}
+	for i, p := range f.allProcessors {
+		if sp, ok := p.(statsProcessor); ok {
+			res.Processors[i] = sp.procStats()
+		} else {
+			res.Processors[i].ProcessorID = f.spec.Processors[i].ProcessorID
+		}
+	}
+	return res
+}
+
 // Releasable is an interface for objects than can be Released back into a
 // memory pool when finished.
 type Releasable interface {
@@ -17,12 +17,14 @@ package distsqlrun
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
@@ -87,8 +89,20 @@ type flowEntry struct {
 	// streamTimer is a timer that fires after a timeout and verifies that all
 	// inbound streams have been connected.
 	streamTimer *time.Timer
+
+	// deadlineTimer, if set, is a timer that cancels the flow once its
+	// deadline passes.
+	deadlineTimer *time.Timer
+
+	// registeredAt is the time at which the flow was registered. It is used to
+	// detect flows that stay registered for too long; see stuckFlowThreshold.
+	registeredAt time.Time
 }
 
+// defaultStuckFlowThreshold is the age after which a registered flow that
+// hasn't been unregistered is reported as stuck in the flowRegistry's stats.
+const defaultStuckFlowThreshold = 10 * time.Minute
+
 // flowRegistry allows clients to look up flows by ID and to wait for flows to
 // be registered. Multiple clients can wait concurrently for the same flow.
 type flowRegistry struct {
@@ -104,6 +118,12 @@ type flowRegistry struct {
 	// draining specifies whether the flowRegistry is in drain mode. If it is,
 	// the flowRegistry will not accept new flows.
 	draining bool
+	// drainStarted is set as soon as Drain is called, before it starts waiting
+	// for the registered flows, and is reset by Undrain.
+	drainStarted bool
+	// drainReason is the reason passed to Drain, reported in the errors
+	// returned to the flows that are rejected while draining.
+	drainReason string
 
 	// flowDone is signaled whenever the size of flows decreases.
 	flowDone *sync.Cond
@@ -112,6 +132,101 @@ type flowRegistry struct {
 	// flowRegistry has no registered flows but must still wait for a minimum time
 	// for any incoming flows to register.
 	testingRunBeforeDrainSleep func()
+
+	// testingConnectInboundStreamDelay is a testing knob called when an inbound
+	// stream starts connecting, before the flowRegistry's lock is acquired and
+	// before any handshake is sent. ConnectInboundStream waits for the returned
+	// duration (or until its context is canceled) before proceeding, which
+	// allows tests to reproduce slow producers deterministically. It must be
+	// set before the flowRegistry is used.
+	testingConnectInboundStreamDelay func(distsqlpb.FlowID, distsqlpb.StreamID) time.Duration
+
+	// stats is returned by Stats().
+	stats flowRegistryStats
+
+	// stuckFlowThreshold is the age after which a registered flow is counted
+	// as stuck by Stats(). Flows that are registered but never started or never
+	// finish would otherwise only surface by blocking a drain.
+	stuckFlowThreshold time.Duration
+}
+
+// flowRegistryStats contains statistics about the flows registered with a
+// flowRegistry and the inbound streams connected through it.
+type flowRegistryStats struct {
+	// NumSyncFlows and NumAsyncFlows are the numbers of flows of each kind that
+	// are currently registered. Sync flows usually finish quickly, while async
+	// flows may be waiting for their inbound streams.
+	NumSyncFlows  int64
+	NumAsyncFlows int64
+
+	// NumConnectedStreams is the number of inbound streams that were
+	// successfully connected.
+	NumConnectedStreams int64
+	// NumWaitedStreams is the number of connected inbound streams whose producer
+	// arrived before the consumer flow was registered and had to wait for it.
+	NumWaitedStreams int64
+	// TotalWaitTime is the sum of the times that producers spent waiting for the
+	// consumer flow to be registered.
+	TotalWaitTime time.Duration
+	// MaxWaitTime is the longest time a producer spent waiting for the consumer
+	// flow to be registered.
+	MaxWaitTime time.Duration
+
+	// NumNotScheduledHandshakes is the number of handshakes sent to producers
+	// informing them that their consumer flow was not scheduled yet.
+	NumNotScheduledHandshakes int64
+	// NumScheduledHandshakes is the number of handshakes sent to producers
+	// informing them that their consumer flow was scheduled.
+	NumScheduledHandshakes int64
+
+	// NumStuckFlows is the number of flows that have been registered for longer
+	// than the flowRegistry's stuckFlowThreshold without being unregistered.
+	NumStuckFlows int64
+	// MaxStuckFlowAge is the time since the oldest of these flows was
+	// registered. It is zero if there are no stuck flows.
+	MaxStuckFlowAge time.Duration
+}
+
+// Stats returns a snapshot of the flowRegistry's statistics.
+func (fr *flowRegistry) Stats() flowRegistryStats {
+	fr.Lock()
+	defer fr.Unlock()
+	stats := fr.stats
+	now := timeutil.Now()
+	for _, entry := range fr.flows {
+		if entry.flow == nil {
+			// Nobody registered this flow yet; we only have waiters for it.
+			continue
+		}
+		if entry.flow.Kind() == SyncFlow {
+			stats.NumSyncFlows++
+		} else {
+			stats.NumAsyncFlows++
+		}
+		if age := now.Sub(entry.registeredAt); age > fr.stuckFlowThreshold {
+			stats.NumStuckFlows++
+			if age > stats.MaxStuckFlowAge {
+				stats.MaxStuckFlowAge = age
+			}
+		}
+	}
+	return stats
+}
+
+// recordConnectedStreamLocked records a successful inbound stream connection
+// in the flowRegistry's stats. waited indicates whether the producer had to
+// wait for the consumer flow to be registered, and waitTime how long it did.
+// It should only be called while holding the mutex.
+func (fr *flowRegistry) recordConnectedStreamLocked(waited bool, waitTime time.Duration) {
+	fr.stats.NumConnectedStreams++
+	if !waited {
+		return
+	}
+	fr.stats.NumWaitedStreams++
+	fr.stats.TotalWaitTime += waitTime
+	if waitTime > fr.stats.MaxWaitTime {
+		fr.stats.MaxWaitTime = waitTime
+	}
 }
 
 // makeFlowRegistry creates a new flowRegistry.
@@ -120,8 +235,9 @@ type flowRegistry struct {
 // care.
 func makeFlowRegistry(nodeID roachpb.NodeID) *flowRegistry {
 	fr := &flowRegistry{
-		nodeID: nodeID,
-		flows:  make(map[distsqlpb.FlowID]*flowEntry),
+		nodeID:             nodeID,
+		flows:              make(map[distsqlpb.FlowID]*flowEntry),
+		stuckFlowThreshold: defaultStuckFlowThreshold,
 	}
 	fr.flowDone = sync.NewCond(fr)
 	return fr
@@ -168,12 +284,18 @@ func (fr *flowRegistry) releaseEntryLocked(id distsqlpb.FlowID) {
 // responsibility for calling Done() on that WaitGroup; this responsibility will
 // be forwarded forward by ConnectInboundStream. In case this method returns an
 // error, the WaitGroup will be decremented.
+//
+// If deadline is not zero, the flow is canceled if it is still registered once
+// the deadline passes: its context is canceled and its unconnected inbound
+// streams are canceled, so that all the processors drain with a query canceled
+// error.
 func (fr *flowRegistry) RegisterFlow(
 	ctx context.Context,
 	id distsqlpb.FlowID,
 	f *Flow,
 	inboundStreams map[distsqlpb.StreamID]*inboundStreamInfo,
 	timeout time.Duration,
+	deadline time.Time,
 ) (retErr error) {
 	fr.Lock()
 	defer fr.Unlock()
@@ -185,11 +307,7 @@ func (fr *flowRegistry) RegisterFlow(
 		}
 	}()
 	if fr.draining {
-		return errors.Errorf(
-			"could not register flowID %d on node %d because the registry is draining",
-			id,
-			fr.nodeID,
-		)
+		return fr.drainingErrorLocked(id)
 	}
 	entry := fr.getEntryLocked(id)
 	if entry.flow != nil {
@@ -202,6 +320,7 @@ func (fr *flowRegistry) RegisterFlow(
 	entry.refCount++
 	entry.flow = f
 	entry.inboundStreams = inboundStreams
+	entry.registeredAt = timeutil.Now()
 	// If there are any waiters, wake them up by closing waitCh.
 	if entry.waitCh != nil {
 		close(entry.waitCh)
@@ -233,28 +352,56 @@ func (fr *flowRegistry) RegisterFlow(
 				go func(r RowReceiver) {
 					r.Push(
 						nil, /* row */
-						&distsqlpb.ProducerMetadata{Err: errNoInboundStreamConnection})
+						&distsqlpb.ProducerMetadata{Err: classifyInboundStreamError(errNoInboundStreamConnection)})
 					r.ProducerDone()
 				}(r)
 			}
 		})
 	}
+	if !deadline.IsZero() {
+		entry.deadlineTimer = time.AfterFunc(timeutil.Until(deadline), func() {
+			timeoutCtx := opentracing.ContextWithSpan(ctx, nil)
+			log.Errorf(timeoutCtx, "flow id:%s : deadline %s exceeded; canceling flow", id, deadline)
+			if f.ctxCancel != nil {
+				f.ctxCancel()
+			}
+			f.cancel()
+		})
+	}
 	return nil
 }
 
+// drainingErrorLocked returns the error reported to a flow that is rejected
+// because the registry is draining. The drain reason, if any, is included in
+// the message and as the detail of the error.
+// It should only be called while holding the mutex.
+func (fr *flowRegistry) drainingErrorLocked(id distsqlpb.FlowID) error {
+	const msg = "could not register flowID %d on node %d because the registry is draining"
+	if fr.drainReason == "" {
+		return pgerror.Newf(pgerror.CodeAdminShutdownError, msg, id, fr.nodeID)
+	}
+	return pgerror.Newf(
+		pgerror.CodeAdminShutdownError, msg+": %s", id, fr.nodeID, fr.drainReason,
+	).SetDetailf("drain reason: %s", fr.drainReason)
+}
+
 // cancelPendingStreamsLocked cancels all of the streams that haven't been
 // connected yet in this flow, by setting them to finished and ending their
 // wait group. The method returns the list of RowReceivers corresponding to the
 // streams that were canceled. The caller is expected to send those
 // RowReceivers a cancellation message - this method can't do it because sending
 // those messages shouldn't happen under the flow registry's lock.
+//
+// The streams are visited (and the receivers returned) in increasing StreamID
+// order so that the cancellation order is deterministic.
 func (fr *flowRegistry) cancelPendingStreamsLocked(id distsqlpb.FlowID) []RowReceiver {
 	entry := fr.flows[id]
 	if entry == nil || entry.flow == nil {
 		return nil
 	}
 	pendingReceivers := make([]RowReceiver, 0)
-	for streamID, is := range entry.inboundStreams {
+	for _, streamID := range sortedStreamIDs(entry.inboundStreams) {
+		is := entry.inboundStreams[streamID]
 		// Connected, non-finished inbound streams will get an error
 		// returned in ProcessInboundStream(). Non-connected streams
 		// are handled below.
@@ -267,6 +414,46 @@ func (fr *flowRegistry) cancelPendingStreamsLocked(id distsqlpb.FlowID) []RowRec
 	return pendingReceivers
 }
 
+// registeredFlowIDsLocked returns the IDs of all the flows that are currently
+// registered. Flows that have no inbound streams take the local fast path in
+// Flow.startInternal and never show up here. It should only be called while
+// holding the mutex.
+func (fr *flowRegistry) registeredFlowIDsLocked() []distsqlpb.FlowID {
+	ids := make([]distsqlpb.FlowID, 0, len(fr.flows))
+	for id, entry := range fr.flows {
+		// Entries can exist for flows that haven't been registered yet if a
+		// ConnectInboundStream call is waiting for them.
+		if entry.flow != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// DrainingFlowIDs returns the IDs of the flows that are still registered while
+// the flowRegistry is draining, i.e. the flows that a Drain is waiting for. It
+// returns an empty slice if the flowRegistry is not draining.
+func (fr *flowRegistry) DrainingFlowIDs() []distsqlpb.FlowID {
+	fr.Lock()
+	defer fr.Unlock()
+	if !fr.drainStarted {
+		return []distsqlpb.FlowID{}
+	}
+	return fr.registeredFlowIDsLocked()
+}
+
+// sortedStreamIDs returns the IDs of the given inbound streams in increasing
+// order. Iterating over the map directly would visit the streams in a random
+// order.
+func sortedStreamIDs(streams map[distsqlpb.StreamID]*inboundStreamInfo) []distsqlpb.StreamID {
+	ids := make([]distsqlpb.StreamID, 0, len(streams))
+	for id := range streams {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
 // UnregisterFlow removes a flow from the registry. Any subsequent
 // ConnectInboundStream calls for the flow will fail to find it and time out.
 func (fr *flowRegistry) UnregisterFlow(id distsqlpb.FlowID) {
@@ -276,18 +463,23 @@ func (fr *flowRegistry) UnregisterFlow(id distsqlpb.FlowID) {
 		entry.streamTimer.Stop()
 		entry.streamTimer = nil
 	}
+	if entry.deadlineTimer != nil {
+		entry.deadlineTimer.Stop()
+		entry.deadlineTimer = nil
+	}
 	fr.releaseEntryLocked(id)
 	fr.Unlock()
 }
 
 // waitForFlowLocked  waits until the flow with the given id gets registered -
 // up to the given timeout - and returns the flowEntry. If the timeout elapses,
-// returns nil. It should only be called while holding the mutex. The mutex is
-// temporarily unlocked if we need to wait.
+// returns nil. If ctx is done before the flow is registered, returns nil and
+// the context's error. It should only be called while holding the mutex. The
+// mutex is temporarily unlocked if we need to wait.
 // It is illegal to call this if the flow is already connected.
 func (fr *flowRegistry) waitForFlowLocked(
 	ctx context.Context, id distsqlpb.FlowID, timeout time.Duration,
-) *flowEntry {
+) (*flowEntry, error) {
 	entry := fr.getEntryLocked(id)
 	if entry.flow != nil {
 		log.Fatalf(ctx, "waitForFlowLocked called for a flow that's already registered: %d", id)
@@ -306,20 +498,36 @@ func (fr *flowRegistry) waitForFlowLocked(
 	entry.refCount++
 	fr.Unlock()
 
+	var ctxErr error
 	select {
 	case <-waitCh:
 	case <-time.After(timeout):
 	case <-ctx.Done():
+		ctxErr = ctx.Err()
 	}
 
 	fr.Lock()
 
 	fr.releaseEntryLocked(id)
 	if entry.flow == nil {
-		return nil
+		return nil, ctxErr
 	}
 
-	return entry
+	return entry, nil
+}
+
+// newFlowConnectTimeoutError returns the error returned by
+// ConnectInboundStream when the flow is not registered before the timeout
+// elapses or before the context of the connecting stream is done. Unlike the
+// error returned when the stream came too late, the flow might still be set up
+// successfully, so the error carries CodeConnectionFailureError to let the
+// producer retry the connection against a fresh flow.
+func newFlowConnectTimeoutError(
+	flowID distsqlpb.FlowID, streamID distsqlpb.StreamID, cause error,
+) error {
+	return pgerror.Newf(pgerror.CodeConnectionFailureError,
+		"flow %s: inbound stream %d timed out waiting for the flow to be scheduled: %v",
+		flowID, streamID, cause)
 }
 
 // Drain waits at most flowDrainWait for currently running flows to finish and
@@ -331,10 +539,46 @@ func (fr *flowRegistry) waitForFlowLocked(
 // The flowRegistry rejects any new flows once it has finished draining.
 //
 // Note that since local flows are not added to the registry, they are not
-// waited for. However, this is fine since there should be no local flows
-// running when the flowRegistry drains as the draining logic starts with
-// draining all client connections to a node.
-func (fr *flowRegistry) Drain(flowDrainWait time.Duration, minFlowDrainWait time.Duration) {
+// waited for and are not rejected once the registry is draining. However, this
+// is fine since local flows are inherently short-lived (they don't wait for
+// any remote producers) and there should be no local flows running when the
+// flowRegistry drains as the draining logic starts with draining all client
+// connections to a node.
+//
+// reason describes why the node is draining (e.g. decommissioning or
+// upgrading); it is reported in the errors returned to the rejected flows. It
+// can be empty.
+func (fr *flowRegistry) Drain(
+	flowDrainWait time.Duration, minFlowDrainWait time.Duration, reason string,
+) {
+	_ = fr.DrainCtx(context.Background(), flowDrainWait, minFlowDrainWait, reason)
+}
+
+// DrainCtx is like Drain, but stops waiting as soon as ctx is done, so that a
+// slow graceful drain can be cut short when a faster shutdown is requested.
+// The flowRegistry rejects new flows once DrainCtx returns, whether or not
+// the drain was canceled. It returns the IDs of the flows that are still
+// registered at that point.
+func (fr *flowRegistry) DrainCtx(
+	ctx context.Context,
+	flowDrainWait time.Duration,
+	minFlowDrainWait time.Duration,
+	reason string,
+) []distsqlpb.FlowID {
+	fr.drainInternal(ctx, flowDrainWait, minFlowDrainWait, reason)
+	fr.Lock()
+	defer fr.Unlock()
+	return fr.registeredFlowIDsLocked()
+}
+
+// drainInternal implements DrainCtx, except for listing the flows that are
+// still registered once it returns.
+func (fr *flowRegistry) drainInternal(
+	ctx context.Context,
+	flowDrainWait time.Duration,
+	minFlowDrainWait time.Duration,
+	reason string,
+) {
 	allFlowsDone := make(chan struct{}, 1)
 	start := timeutil.Now()
 	stopWaiting := false
@@ -343,21 +587,29 @@ func (fr *flowRegistry) Drain(flowDrainWait time.Duration, minFlowDrainWait time
 		if fr.testingRunBeforeDrainSleep != nil {
 			fr.testingRunBeforeDrainSleep()
 		}
-		time.Sleep(t)
+		select {
+		case <-time.After(t):
+		case <-ctx.Done():
+		}
 	}
 
 	defer func() {
-		// At this stage, we have either hit the flowDrainWait timeout or we have no
-		// flows left. We wait for an expectedConnectionTime longer so that we give
-		// any flows that were registered in the
-		// flowDrainWait - expectedConnectionTime window enough time to establish
-		// connections to their consumers so that the consumers do not block for a
-		// long time waiting for a connection to be established.
+		// At this stage, we have either hit the flowDrainWait timeout, been
+		// canceled or we have no flows left. Unless we've been canceled, we wait
+		// for an expectedConnectionTime longer so that we give any flows that
+		// were registered in the flowDrainWait - expectedConnectionTime window
+		// enough time to establish connections to their consumers so that the
+		// consumers do not block for a long time waiting for a connection to be
+		// established.
 		fr.Lock()
 		fr.draining = true
-		if len(fr.flows) > 0 {
+		fr.drainReason = reason
+		if len(fr.flows) > 0 && ctx.Err() == nil {
 			fr.Unlock()
-			time.Sleep(expectedConnectionTime)
+			select {
+			case <-time.After(expectedConnectionTime):
+			case <-ctx.Done():
+			}
 			fr.Lock()
 		}
 		fr.Unlock()
@@ -366,12 +618,13 @@ func (fr *flowRegistry) Drain(flowDrainWait time.Duration, minFlowDrainWait time
 	// If the flow registry is empty, wait minFlowDrainWait for any incoming flows
 	// to register.
 	fr.Lock()
+	fr.drainStarted = true
 	if len(fr.flows) == 0 {
 		fr.Unlock()
 		sleep(minFlowDrainWait)
 		fr.Lock()
-		// No flows were registered, return.
-		if len(fr.flows) == 0 {
+		// No flows were registered or the drain was canceled, return.
+		if len(fr.flows) == 0 || ctx.Err() != nil {
 			fr.Unlock()
 			return
 		}
@@ -380,12 +633,14 @@ func (fr *flowRegistry) Drain(flowDrainWait time.Duration, minFlowDrainWait time
 	go func() {
 		select {
 		case <-time.After(flowDrainWait):
-			fr.Lock()
-			stopWaiting = true
-			fr.flowDone.Signal()
-			fr.Unlock()
+		case <-ctx.Done():
 		case <-allFlowsDone:
+			return
 		}
+		fr.Lock()
+		stopWaiting = true
+		fr.flowDone.Signal()
+		fr.Unlock()
 	}()
 
 	for !(stopWaiting || len(fr.flows) == 0) {
@@ -397,7 +652,7 @@ func (fr *flowRegistry) Drain(flowDrainWait time.Duration, minFlowDrainWait time
 	// for the minimum time for any new incoming flows and wait for these to
 	// finish.
 	waitTime := timeutil.Since(start)
-	if waitTime < minFlowDrainWait {
+	if waitTime < minFlowDrainWait && ctx.Err() == nil {
 		sleep(minFlowDrainWait - waitTime)
 		fr.Lock()
 		for !(stopWaiting || len(fr.flows) == 0) {
@@ -413,6 +668,8 @@ func (fr *flowRegistry) Drain(flowDrainWait time.Duration, minFlowDrainWait time
 func (fr *flowRegistry) Undrain() {
 	fr.Lock()
 	fr.draining = false
+	fr.drainStarted = false
+	fr.drainReason = ""
 	fr.Unlock()
 }
 
@@ -431,6 +688,10 @@ func (fr *flowRegistry) Undrain() {
 // is not blocked on this stream any more.
 // In case an error is returned, the cleanup function is nil, the Flow is not
 // considered connected and is not cleaned up.
+//
+// If the producer arrives before the consumer flow is registered, the time it
+// waits for the registration is recorded in the flowRegistry's Stats() once
+// the stream is connected.
 func (fr *flowRegistry) ConnectInboundStream(
 	ctx context.Context,
 	flowID distsqlpb.FlowID,
@@ -438,15 +699,30 @@ func (fr *flowRegistry) ConnectInboundStream(
 	stream distsqlpb.DistSQL_FlowStreamServer,
 	timeout time.Duration,
 ) (_ *Flow, _ RowReceiver, _ func(), retErr error) {
+	if fr.testingConnectInboundStreamDelay != nil {
+		if delay := fr.testingConnectInboundStreamDelay(flowID, streamID); delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, nil, nil, ctx.Err()
+			}
+		}
+	}
+
 	fr.Lock()
 	defer fr.Unlock()
 
 	entry := fr.getEntryLocked(flowID)
+	var (
+		waited   bool
+		waitTime time.Duration
+	)
 	if entry.flow == nil {
 		// Send the handshake message informing the producer that the consumer has
 		// not been scheduled yet. Another handshake will be sent below once the
 		// consumer has been connected.
-		deadline := timeutil.Now().Add(timeout)
+		arrival := timeutil.Now()
+		deadline := arrival.Add(timeout)
 		if err := stream.Send(&distsqlpb.ConsumerSignal{
 			Handshake: &distsqlpb.ConsumerHandshake{
 				ConsumerScheduled:        false,
@@ -464,10 +740,18 @@ func (fr *flowRegistry) ConnectInboundStream(
 			// except there we already have the consumer and we can push the error.
 			return nil, nil, nil, err
 		}
-		entry = fr.waitForFlowLocked(ctx, flowID, timeout)
+		fr.stats.NumNotScheduledHandshakes++
+		var err error
+		entry, err = fr.waitForFlowLocked(ctx, flowID, timeout)
+		if err != nil {
+			return nil, nil, nil, newFlowConnectTimeoutError(flowID, streamID, err)
+		}
 		if entry == nil {
-			return nil, nil, nil, errors.Errorf("flow %s not found", flowID)
+			return nil, nil, nil, newFlowConnectTimeoutError(
+				flowID, streamID, errors.Errorf("flow not found after %s", timeout))
 		}
+		waited = true
+		waitTime = timeutil.Since(arrival)
 	}
 
 	s, ok := entry.inboundStreams[streamID]
@@ -501,6 +785,8 @@ func (fr *flowRegistry) ConnectInboundStream(
 	}); err != nil {
 		return nil, nil, nil, err
 	}
+	fr.stats.NumScheduledHandshakes++
+	fr.recordConnectedStreamLocked(waited, waitTime)
 
 	cleanup := func() {
 		fr.Lock()
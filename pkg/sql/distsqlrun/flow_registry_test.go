@@ -16,6 +16,7 @@ package distsqlrun
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"sync"
 	"testing"
@@ -31,6 +32,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/pkg/errors"
 )
@@ -46,7 +48,7 @@ func lookupFlow(fr *flowRegistry, fid distsqlpb.FlowID, timeout time.Duration) *
 	if entry.flow != nil {
 		return entry.flow
 	}
-	entry = fr.waitForFlowLocked(context.TODO(), fid, timeout)
+	entry, _ = fr.waitForFlowLocked(context.TODO(), fid, timeout)
 	if entry == nil {
 		return nil
 	}
@@ -74,6 +76,14 @@ func lookupStreamInfo(
 	return *si, nil
 }
 
+// registeredFlowIDs returns a snapshot of the IDs of all the flows that are
+// registered with a flowRegistry.
+func registeredFlowIDs(fr *flowRegistry) []distsqlpb.FlowID {
+	fr.Lock()
+	defer fr.Unlock()
+	return fr.registeredFlowIDsLocked()
+}
+
 func TestFlowRegistry(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	reg := makeFlowRegistry(roachpb.NodeID(0))
@@ -104,7 +114,7 @@ func TestFlowRegistry(t *testing.T) {
 
 	ctx := context.Background()
 	if err := reg.RegisterFlow(
-		ctx, id1, f1, nil /* inboundStreams */, flowStreamTimeout,
+		ctx, id1, f1, nil /* inboundStreams */, flowStreamTimeout, time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -124,7 +134,7 @@ func TestFlowRegistry(t *testing.T) {
 	go func() {
 		time.Sleep(jiffy)
 		if err := reg.RegisterFlow(
-			ctx, id1, f1, nil /* inboundStreams */, flowStreamTimeout,
+			ctx, id1, f1, nil /* inboundStreams */, flowStreamTimeout, time.Time{}, /* deadline */
 		); err != nil {
 			t.Error(err)
 		}
@@ -159,7 +169,7 @@ func TestFlowRegistry(t *testing.T) {
 
 	time.Sleep(jiffy)
 	if err := reg.RegisterFlow(
-		ctx, id2, f2, nil /* inboundStreams */, flowStreamTimeout,
+		ctx, id2, f2, nil /* inboundStreams */, flowStreamTimeout, time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -188,7 +198,7 @@ func TestFlowRegistry(t *testing.T) {
 
 	wg1.Wait()
 	if err := reg.RegisterFlow(
-		ctx, id3, f3, nil /* inboundStreams */, flowStreamTimeout,
+		ctx, id3, f3, nil /* inboundStreams */, flowStreamTimeout, time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -199,7 +209,7 @@ func TestFlowRegistry(t *testing.T) {
 	go func() {
 		time.Sleep(jiffy)
 		if err := reg.RegisterFlow(
-			ctx, id4, f4, nil /* inboundStreams */, flowStreamTimeout,
+			ctx, id4, f4, nil /* inboundStreams */, flowStreamTimeout, time.Time{}, /* deadline */
 		); err != nil {
 			t.Error(err)
 		}
@@ -231,7 +241,7 @@ func TestStreamConnectionTimeout(t *testing.T) {
 		streamID1: {receiver: consumer, waitGroup: wg},
 	}
 	if err := reg.RegisterFlow(
-		context.TODO(), id1, f1, inboundStreams, jiffy,
+		context.TODO(), id1, f1, inboundStreams, jiffy, time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -273,6 +283,21 @@ func TestStreamConnectionTimeout(t *testing.T) {
 	if !testutils.IsError(err, "not found") {
 		t.Fatalf("expected %q, got: %v", "not found", err)
 	}
+	if code, ok := pgerror.GetPGCode(err); !ok || code != pgerror.CodeConnectionFailureError {
+		t.Fatalf("expected code %s, got: %v", pgerror.CodeConnectionFailureError, err)
+	}
+
+	// If the context of the stream is done while it waits for the flow to be
+	// registered, the same retryable error is returned.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, _, _, err = reg.ConnectInboundStream(ctx, id1, streamID1, serverStream, time.Hour)
+	if !testutils.IsError(err, "timed out waiting for the flow to be scheduled") {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+	if code, ok := pgerror.GetPGCode(err); !ok || code != pgerror.CodeConnectionFailureError {
+		t.Fatalf("expected code %s, got: %v", pgerror.CodeConnectionFailureError, err)
+	}
 }
 
 // Test that the FlowRegistry send the correct handshake messages:
@@ -309,7 +334,10 @@ func TestHandshake(t *testing.T) {
 			}
 			defer cleanup()
 
+			statsBefore := reg.Stats()
+			producerDone := make(chan struct{})
 			connectProducer := func() {
+				defer close(producerDone)
 				// Simulate a producer connecting to the server. This should be called
 				// async because the consumer is not yet there and ConnectInboundStream
 				// is blocking.
@@ -329,6 +357,7 @@ func TestHandshake(t *testing.T) {
 				}
 				if err := reg.RegisterFlow(
 					context.TODO(), flowID, f1, inboundStreams, time.Hour, /* timeout */
+					time.Time{}, /* deadline */
 				); err != nil {
 					t.Fatal(err)
 				}
@@ -372,10 +401,254 @@ func TestHandshake(t *testing.T) {
 			if !consumerSignal.Handshake.ConsumerScheduled {
 				t.Fatal("expected ConsumerScheduled")
 			}
+
+			// The handshake counters match the messages received above.
+			<-producerDone
+			stats := reg.Stats()
+			expNotScheduled := int64(1)
+			if tc.consumerConnectedEarly {
+				expNotScheduled = 0
+			}
+			if n := stats.NumNotScheduledHandshakes - statsBefore.NumNotScheduledHandshakes; n != expNotScheduled {
+				t.Fatalf("expected %d not scheduled handshakes, got %d", expNotScheduled, n)
+			}
+			if n := stats.NumScheduledHandshakes - statsBefore.NumScheduledHandshakes; n != 1 {
+				t.Fatalf("expected 1 scheduled handshake, got %d", n)
+			}
 		})
 	}
 }
 
+// TestInboundStreamWaitStats verifies that the flowRegistry records how long
+// producers wait for their consumer flow to be registered.
+func TestInboundStreamWaitStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	reg := makeFlowRegistry(roachpb.NodeID(0))
+
+	// connect connects a producer and a consumer for a new flow. If
+	// consumerEarly is false, the producer arrives first and the consumer is
+	// registered after at least minWait. It returns a lower bound on the time the
+	// producer waited.
+	connect := func(consumerEarly bool, minWait time.Duration) time.Duration {
+		flowID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+		streamID := distsqlpb.StreamID(1)
+
+		serverStream, clientStream, cleanup, err := createDummyStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+
+		producerDone := make(chan struct{})
+		connectProducer := func() {
+			defer close(producerDone)
+			if _, _, _, err := reg.ConnectInboundStream(
+				context.TODO(), flowID, streamID, serverStream, time.Hour,
+			); err != nil {
+				t.Error(err)
+			}
+		}
+		connectConsumer := func() {
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			inboundStreams := map[distsqlpb.StreamID]*inboundStreamInfo{
+				streamID: {receiver: &RowBuffer{}, waitGroup: wg},
+			}
+			if err := reg.RegisterFlow(
+				context.TODO(), flowID, &Flow{}, inboundStreams, time.Hour, /* timeout */
+				time.Time{}, /* deadline */
+			); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var waitLowerBound time.Duration
+		if consumerEarly {
+			connectConsumer()
+			go connectProducer()
+		} else {
+			go connectProducer()
+			// Wait for the handshake that indicates that the producer is waiting for
+			// the consumer.
+			if _, err := clientStream.Recv(); err != nil {
+				t.Fatal(err)
+			}
+			start := timeutil.Now()
+			time.Sleep(minWait)
+			waitLowerBound = timeutil.Since(start)
+			connectConsumer()
+		}
+		// Receive the handshake indicating that the consumer is scheduled.
+		if _, err := clientStream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+		<-producerDone
+		return waitLowerBound
+	}
+
+	connect(true /* consumerEarly */, 0 /* minWait */)
+	if stats := reg.Stats(); stats != (flowRegistryStats{NumAsyncFlows: 1, NumConnectedStreams: 1}) {
+		t.Fatalf("unexpected stats after early consumer: %+v", stats)
+	}
+
+	minWait1 := connect(false /* consumerEarly */, time.Millisecond)
+	minWait2 := connect(false /* consumerEarly */, 10*time.Millisecond)
+	stats := reg.Stats()
+	if stats.NumConnectedStreams != 3 || stats.NumWaitedStreams != 2 {
+		t.Fatalf("unexpected stream counts: %+v", stats)
+	}
+	if stats.MaxWaitTime < minWait2 {
+		t.Fatalf("expected max wait time of at least %s, got %+v", minWait2, stats)
+	}
+	if stats.TotalWaitTime < minWait1+minWait2 || stats.TotalWaitTime < stats.MaxWaitTime {
+		t.Fatalf("expected total wait time of at least %s, got %+v", minWait1+minWait2, stats)
+	}
+}
+
+// TestConnectInboundStreamDelay verifies that the flowRegistry's testing knob
+// delays the connection of inbound streams, and that the delay is interrupted
+// by the cancellation of the stream's context.
+func TestConnectInboundStreamDelay(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	reg := makeFlowRegistry(roachpb.NodeID(0))
+	const delay = 20 * time.Millisecond
+	delayedStream := distsqlpb.StreamID(1)
+	reg.testingConnectInboundStreamDelay = func(
+		_ distsqlpb.FlowID, streamID distsqlpb.StreamID,
+	) time.Duration {
+		if streamID == delayedStream {
+			return delay
+		}
+		return 0
+	}
+
+	flowID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	inboundStreams := map[distsqlpb.StreamID]*inboundStreamInfo{
+		0:             {receiver: &RowBuffer{}, waitGroup: wg},
+		delayedStream: {receiver: &RowBuffer{}, waitGroup: wg},
+	}
+	if err := reg.RegisterFlow(
+		context.TODO(), flowID, &Flow{}, inboundStreams, time.Hour, /* timeout */
+		time.Time{}, /* deadline */
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.UnregisterFlow(flowID)
+
+	var stream noopFlowStreamServer
+
+	// A canceled context interrupts the delay and leaves the stream
+	// unconnected.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := reg.ConnectInboundStream(
+		ctx, flowID, delayedStream, stream, time.Hour, /* timeout */
+	); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	start := timeutil.Now()
+	_, _, cleanup, err := reg.ConnectInboundStream(
+		context.TODO(), flowID, delayedStream, stream, time.Hour, /* timeout */
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if elapsed := timeutil.Since(start); elapsed < delay {
+		t.Fatalf("expected the connection to take at least %s, took %s", delay, elapsed)
+	}
+
+	_, _, cleanup, err = reg.ConnectInboundStream(
+		context.TODO(), flowID, 0 /* streamID */, stream, time.Hour, /* timeout */
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	wg.Wait()
+}
+
+// TestFlowRegistryStuckFlows verifies that the flowRegistry's stats report the
+// flows that stay registered for longer than the stuck flow threshold.
+func TestFlowRegistryStuckFlows(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	reg := makeFlowRegistry(roachpb.NodeID(0))
+	reg.stuckFlowThreshold = time.Minute
+	ctx := context.Background()
+
+	oldID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+	newID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+	for _, id := range []distsqlpb.FlowID{oldID, newID} {
+		if err := reg.RegisterFlow(
+			ctx, id, &Flow{}, nil /* inboundStreams */, time.Hour, /* timeout */
+			time.Time{}, /* deadline */
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := reg.Stats(); stats.NumStuckFlows != 0 || stats.MaxStuckFlowAge != 0 {
+		t.Fatalf("expected no stuck flows, got %+v", stats)
+	}
+
+	// Pretend that one of the flows was registered an hour ago.
+	reg.Lock()
+	reg.flows[oldID].registeredAt = reg.flows[oldID].registeredAt.Add(-time.Hour)
+	reg.Unlock()
+	stats := reg.Stats()
+	if stats.NumStuckFlows != 1 || stats.MaxStuckFlowAge < time.Hour {
+		t.Fatalf("expected one flow stuck for at least an hour, got %+v", stats)
+	}
+
+	// Unregistered flows are no longer reported.
+	reg.UnregisterFlow(oldID)
+	if stats := reg.Stats(); stats.NumStuckFlows != 0 || stats.MaxStuckFlowAge != 0 {
+		t.Fatalf("expected no stuck flows, got %+v", stats)
+	}
+	reg.UnregisterFlow(newID)
+}
+
+// TestFlowRegistryStatsByKind verifies that the flowRegistry's stats count the
+// registered flows by kind.
+func TestFlowRegistryStatsByKind(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	reg := makeFlowRegistry(roachpb.NodeID(0))
+	ctx := context.Background()
+
+	syncID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+	asyncID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+	if err := reg.RegisterFlow(
+		ctx, syncID, &Flow{kind: SyncFlow}, nil /* inboundStreams */, time.Hour, /* timeout */
+		time.Time{}, /* deadline */
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterFlow(
+		ctx, asyncID, &Flow{kind: AsyncFlow}, nil /* inboundStreams */, time.Hour, /* timeout */
+		time.Time{}, /* deadline */
+	); err != nil {
+		t.Fatal(err)
+	}
+	if stats := reg.Stats(); stats.NumSyncFlows != 1 || stats.NumAsyncFlows != 1 {
+		t.Fatalf("expected one flow of each kind, got %+v", stats)
+	}
+
+	reg.UnregisterFlow(syncID)
+	if stats := reg.Stats(); stats.NumSyncFlows != 0 || stats.NumAsyncFlows != 1 {
+		t.Fatalf("expected only the async flow, got %+v", stats)
+	}
+	reg.UnregisterFlow(asyncID)
+	if stats := reg.Stats(); stats.NumSyncFlows != 0 || stats.NumAsyncFlows != 0 {
+		t.Fatalf("expected no flows, got %+v", stats)
+	}
+}
+
 // TestFlowRegistryDrain verifies a flowRegistry's draining behavior. See
 // subtests for more details.
 func TestFlowRegistryDrain(t *testing.T) {
@@ -389,7 +662,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 	registerFlow := func(t *testing.T, id distsqlpb.FlowID) {
 		t.Helper()
 		if err := reg.RegisterFlow(
-			ctx, id, flow, nil /* inboundStreams */, 0, /* timeout */
+			ctx, id, flow, nil /* inboundStreams */, 0 /* timeout */, time.Time{}, /* deadline */
 		); err != nil {
 			t.Fatal(err)
 		}
@@ -401,7 +674,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 		registerFlow(t, id)
 		drainDone := make(chan struct{})
 		go func() {
-			reg.Drain(math.MaxInt64 /* flowDrainWait */, 0 /* minFlowDrainWait */)
+			reg.Drain(math.MaxInt64 /* flowDrainWait */, 0 /* minFlowDrainWait */, "" /* reason */)
 			drainDone <- struct{}{}
 		}()
 		// Be relatively sure that the flowRegistry is draining.
@@ -414,7 +687,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 	// DrainTimeout verifies that Drain returns once the timeout expires.
 	t.Run("DrainTimeout", func(t *testing.T) {
 		registerFlow(t, id)
-		reg.Drain(0 /* flowDrainWait */, 0 /* minFlowDrainWait */)
+		reg.Drain(0 /* flowDrainWait */, 0 /* minFlowDrainWait */, "" /* reason */)
 		reg.UnregisterFlow(id)
 		reg.Undrain()
 	})
@@ -425,7 +698,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 		registerFlow(t, id)
 		drainDone := make(chan struct{})
 		go func() {
-			reg.Drain(math.MaxInt64 /* flowDrainWait */, 0 /* minFlowDrainWait */)
+			reg.Drain(math.MaxInt64 /* flowDrainWait */, 0 /* minFlowDrainWait */, "" /* reason */)
 			drainDone <- struct{}{}
 		}()
 		// Be relatively sure that the flowRegistry is draining.
@@ -442,10 +715,73 @@ func TestFlowRegistryDrain(t *testing.T) {
 		<-drainDone
 		// The registry should not accept new flows once it has finished draining.
 		if err := reg.RegisterFlow(
-			ctx, id, flow, nil /* inboundStreams */, 0, /* timeout */
+			ctx, id, flow, nil /* inboundStreams */, 0 /* timeout */, time.Time{}, /* deadline */
+		); !testutils.IsError(err, "draining") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reg.Undrain()
+	})
+
+	// DrainingFlowIDs verifies that the flows a Drain is waiting for are
+	// reported, and that nothing is reported when not draining.
+	t.Run("DrainingFlowIDs", func(t *testing.T) {
+		registerFlow(t, id)
+		if ids := reg.DrainingFlowIDs(); ids == nil || len(ids) != 0 {
+			t.Fatalf("expected an empty slice when not draining, got %v", ids)
+		}
+		drainDone := make(chan struct{})
+		go func() {
+			reg.Drain(math.MaxInt64 /* flowDrainWait */, 0 /* minFlowDrainWait */, "" /* reason */)
+			drainDone <- struct{}{}
+		}()
+		testutils.SucceedsSoon(t, func() error {
+			ids := reg.DrainingFlowIDs()
+			if len(ids) != 1 || ids[0] != id {
+				return errors.Errorf("expected draining flows [%s], got %v", id, ids)
+			}
+			return nil
+		})
+		reg.UnregisterFlow(id)
+		<-drainDone
+		if ids := reg.DrainingFlowIDs(); len(ids) != 0 {
+			t.Fatalf("expected no draining flows, got %v", ids)
+		}
+		reg.Undrain()
+		if ids := reg.DrainingFlowIDs(); ids == nil || len(ids) != 0 {
+			t.Fatalf("expected an empty slice after undraining, got %v", ids)
+		}
+	})
+
+	// DrainCanceled verifies that DrainCtx stops waiting for the registered
+	// flows once its context is canceled, returns the flows that are still
+	// registered and leaves the flowRegistry drained.
+	t.Run("DrainCanceled", func(t *testing.T) {
+		registerFlow(t, id)
+		drainCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		drainDone := make(chan []distsqlpb.FlowID)
+		go func() {
+			drainDone <- reg.DrainCtx(
+				drainCtx, math.MaxInt64 /* flowDrainWait */, math.MaxInt64, /* minFlowDrainWait */
+				"" /* reason */)
+		}()
+		testutils.SucceedsSoon(t, func() error {
+			if ids := reg.DrainingFlowIDs(); len(ids) != 1 {
+				return errors.Errorf("expected draining flows [%s], got %v", id, ids)
+			}
+			return nil
+		})
+		cancel()
+		if remaining := <-drainDone; len(remaining) != 1 || remaining[0] != id {
+			t.Fatalf("expected remaining flows [%s], got %v", id, remaining)
+		}
+		newFlowID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+		if err := reg.RegisterFlow(
+			ctx, newFlowID, flow, nil /* inboundStreams */, 0 /* timeout */, time.Time{}, /* deadline */
 		); !testutils.IsError(err, "draining") {
 			t.Fatalf("unexpected error: %v", err)
 		}
+		reg.UnregisterFlow(id)
 		reg.Undrain()
 	})
 
@@ -460,7 +796,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 		errChan := make(chan error)
 		reg.testingRunBeforeDrainSleep = func() {
 			if err := reg.RegisterFlow(
-				ctx, id, flow, nil /* inboundStreams */, 0, /* timeout */
+				ctx, id, flow, nil /* inboundStreams */, 0 /* timeout */, time.Time{}, /* deadline */
 			); err != nil {
 				errChan <- err
 			}
@@ -468,7 +804,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 		}
 		defer func() { reg.testingRunBeforeDrainSleep = nil }()
 		go func() {
-			reg.Drain(math.MaxInt64 /* flowDrainWait */, 0 /* minFlowDrainWait */)
+			reg.Drain(math.MaxInt64 /* flowDrainWait */, 0 /* minFlowDrainWait */, "" /* reason */)
 			drainDone <- struct{}{}
 		}()
 		if err := <-errChan; err != nil {
@@ -487,7 +823,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 		registerFlow(t, id)
 		reg.testingRunBeforeDrainSleep = func() {
 			if err := reg.RegisterFlow(
-				ctx, id, flow, nil /* inboundStreams */, 0, /* timeout */
+				ctx, id, flow, nil /* inboundStreams */, 0 /* timeout */, time.Time{}, /* deadline */
 			); err != nil {
 				errChan <- err
 			}
@@ -496,7 +832,7 @@ func TestFlowRegistryDrain(t *testing.T) {
 		minFlowDrainWait := 10 * time.Millisecond
 		start := timeutil.Now()
 		go func() {
-			reg.Drain(math.MaxInt64 /* flowDrainWait */, minFlowDrainWait)
+			reg.Drain(math.MaxInt64 /* flowDrainWait */, minFlowDrainWait, "" /* reason */)
 			drainDone <- struct{}{}
 		}()
 		// Be relatively sure that the flowRegistry is draining.
@@ -535,7 +871,10 @@ func TestSyncFlowAfterDrain(t *testing.T) {
 	cfg := s.DistSQLServer().(*ServerImpl).ServerConfig
 
 	distSQLSrv := NewServer(ctx, cfg)
-	distSQLSrv.flowRegistry.Drain(time.Duration(0) /* flowDrainWait */, time.Duration(0) /* minFlowDrainWait */)
+	const drainReason = "node is being decommissioned"
+	distSQLSrv.flowRegistry.Drain(
+		time.Duration(0) /* flowDrainWait */, time.Duration(0) /* minFlowDrainWait */, drainReason,
+	)
 
 	// We create some flow; it doesn't matter what.
 	req := distsqlpb.SetupFlowRequest{Version: Version}
@@ -564,7 +903,7 @@ func TestSyncFlowAfterDrain(t *testing.T) {
 
 	types := make([]types.T, 0)
 	rb := NewRowBuffer(types, nil /* rows */, RowBufferArgs{})
-	ctx, flow, err := distSQLSrv.SetupSyncFlow(ctx, &distSQLSrv.memMonitor, &req, rb)
+	ctx, flow, err := distSQLSrv.SetupSyncFlow(ctx, &distSQLSrv.memMonitor, &req, rb, time.Time{} /* deadline */)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -576,12 +915,467 @@ func TestSyncFlowAfterDrain(t *testing.T) {
 	if meta == nil {
 		t.Fatal("expected draining err, got no meta")
 	}
-	if !testutils.IsError(meta.Err, "the registry is draining") {
+	if !testutils.IsError(meta.Err, "the registry is draining: "+drainReason) {
 		t.Fatalf("expected draining err, got: %v", meta.Err)
 	}
+	pgErr, ok := pgerror.GetPGCause(meta.Err)
+	if !ok {
+		t.Fatalf("expected a pgerror, got: %v", meta.Err)
+	}
+	if pgErr.Code != pgerror.CodeAdminShutdownError {
+		t.Fatalf("expected code %s, got %s", pgerror.CodeAdminShutdownError, pgErr.Code)
+	}
+	if expected := "drain reason: " + drainReason; pgErr.Detail != expected {
+		t.Fatalf("expected detail %q, got %q", expected, pgErr.Detail)
+	}
 	flow.Cleanup(ctx)
 }
 
+// TestSyncFlowSetupDeadline verifies that a sync flow that can't be set up or
+// started before its setup deadline fails with a query canceled error.
+func TestSyncFlowSetupDeadline(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.TODO()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	distSQLSrv := NewServer(ctx, s.DistSQLServer().(*ServerImpl).ServerConfig)
+
+	// The flow has a remote inbound stream, so that it gets registered.
+	req := distsqlpb.SetupFlowRequest{Version: Version}
+	req.Flow = distsqlpb.FlowSpec{
+		Processors: []distsqlpb.ProcessorSpec{{
+			Input: []distsqlpb.InputSyncSpec{{
+				Type:    distsqlpb.InputSyncSpec_UNORDERED,
+				Streams: []distsqlpb.StreamEndpointSpec{{StreamID: 1, Type: distsqlpb.StreamEndpointSpec_REMOTE}},
+			}},
+			Core: distsqlpb.ProcessorCoreUnion{Noop: &distsqlpb.NoopCoreSpec{}},
+			Output: []distsqlpb.OutputRouterSpec{{
+				Type:    distsqlpb.OutputRouterSpec_PASS_THROUGH,
+				Streams: []distsqlpb.StreamEndpointSpec{{Type: distsqlpb.StreamEndpointSpec_SYNC_RESPONSE}},
+			}},
+		}},
+	}
+	checkErr := func(err error) {
+		t.Helper()
+		if !testutils.IsError(err, "flow could not be set up before its deadline") {
+			t.Fatalf("expected deadline error, got: %v", err)
+		}
+		if code, _ := pgerror.GetPGCode(err); code != pgerror.CodeQueryCanceledError {
+			t.Fatalf("expected code %s, got %s", pgerror.CodeQueryCanceledError, code)
+		}
+	}
+
+	t.Run("setup", func(t *testing.T) {
+		rb := NewRowBuffer(nil /* types */, nil /* rows */, RowBufferArgs{})
+		_, flow, err := distSQLSrv.SetupSyncFlow(
+			ctx, &distSQLSrv.memMonitor, &req, rb, timeutil.Now().Add(-time.Second),
+		)
+		if flow != nil {
+			t.Fatal("expected no flow")
+		}
+		checkErr(err)
+	})
+
+	t.Run("start", func(t *testing.T) {
+		rb := NewRowBuffer(nil /* types */, nil /* rows */, RowBufferArgs{})
+		flowCtx, flow, err := distSQLSrv.SetupSyncFlow(
+			ctx, &distSQLSrv.memMonitor, &req, rb, timeutil.Now().Add(time.Hour),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Simulate the deadline passing between the setup and the start of the
+		// flow.
+		flow.setupDeadline = timeutil.Now().Add(-time.Second)
+		if err := flow.Start(flowCtx, func() {}); err != nil {
+			t.Fatal(err)
+		}
+		flow.Wait()
+		_, meta := rb.Next()
+		if meta == nil {
+			t.Fatal("expected deadline err, got no meta")
+		}
+		checkErr(meta.Err)
+		flow.Cleanup(flowCtx)
+	})
+
+	t.Run("connect", func(t *testing.T) {
+		rb := NewRowBuffer(nil /* types */, nil /* rows */, RowBufferArgs{})
+		flowCtx, flow, err := distSQLSrv.SetupSyncFlow(
+			ctx, &distSQLSrv.memMonitor, &req, rb, timeutil.Now().Add(time.Hour),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The inbound stream never connects, and the setup deadline is much
+		// shorter than the flow stream timeout.
+		flow.setupDeadline = timeutil.Now().Add(10 * time.Millisecond)
+		if err := flow.Start(flowCtx, func() {}); err != nil {
+			t.Fatal(err)
+		}
+		flow.Wait()
+		_, meta := rb.Next()
+		if meta == nil {
+			t.Fatal("expected inbound stream err, got no meta")
+		}
+		if !testutils.IsError(meta.Err, "no inbound stream connection") {
+			t.Fatalf("expected inbound stream timeout, got %v", meta.Err)
+		}
+		flow.Cleanup(flowCtx)
+	})
+}
+
+// TestFlowContextDeadline verifies that a flow started with a context that has
+// a deadline drains with a query canceled error once the deadline passes.
+func TestFlowContextDeadline(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.TODO()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	distSQLSrv := NewServer(ctx, s.DistSQLServer().(*ServerImpl).ServerConfig)
+
+	// The flow has a remote inbound stream that never connects, so that it gets
+	// registered and blocks until it is canceled.
+	req := distsqlpb.SetupFlowRequest{Version: Version}
+	req.Flow = distsqlpb.FlowSpec{
+		Processors: []distsqlpb.ProcessorSpec{{
+			Input: []distsqlpb.InputSyncSpec{{
+				Type:    distsqlpb.InputSyncSpec_UNORDERED,
+				Streams: []distsqlpb.StreamEndpointSpec{{StreamID: 1, Type: distsqlpb.StreamEndpointSpec_REMOTE}},
+			}},
+			Core: distsqlpb.ProcessorCoreUnion{Noop: &distsqlpb.NoopCoreSpec{}},
+			Output: []distsqlpb.OutputRouterSpec{{
+				Type:    distsqlpb.OutputRouterSpec_PASS_THROUGH,
+				Streams: []distsqlpb.StreamEndpointSpec{{Type: distsqlpb.StreamEndpointSpec_SYNC_RESPONSE}},
+			}},
+		}},
+	}
+
+	deadlineCtx, cancel := context.WithDeadline(ctx, timeutil.Now().Add(10*time.Millisecond))
+	defer cancel()
+	rb := NewRowBuffer(nil /* types */, nil /* rows */, RowBufferArgs{})
+	flowCtx, flow, err := distSQLSrv.SetupSyncFlow(
+		deadlineCtx, &distSQLSrv.memMonitor, &req, rb, time.Time{}, /* deadline */
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flow.Start(flowCtx, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	flow.Wait()
+	_, meta := rb.Next()
+	if meta == nil {
+		t.Fatal("expected query canceled err, got no meta")
+	}
+	if code, _ := pgerror.GetPGCode(meta.Err); code != pgerror.CodeQueryCanceledError {
+		t.Fatalf("expected code %s, got %v", pgerror.CodeQueryCanceledError, meta.Err)
+	}
+	flow.Cleanup(flowCtx)
+}
+
+// TestLocalFlowBypassesRegistry verifies that a flow without any remote
+// streams is run without being registered with the flowRegistry, and that such
+// a flow can still run (and produce correct results) while the registry is
+// draining.
+func TestLocalFlowBypassesRegistry(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.TODO()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	cfg := s.DistSQLServer().(*ServerImpl).ServerConfig
+
+	const numRows = 10
+	inputRows := sqlbase.MakeIntRows(numRows, 1 /* numCols */)
+	valuesSpec, err := generateValuesSpec(sqlbase.OneIntCol, inputRows, 3 /* rowsPerChunk */)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, draining := range []bool{false, true} {
+		t.Run(fmt.Sprintf("draining=%t", draining), func(t *testing.T) {
+			distSQLSrv := NewServer(ctx, cfg)
+			if draining {
+				distSQLSrv.flowRegistry.Drain(
+					time.Duration(0) /* flowDrainWait */, time.Duration(0) /* minFlowDrainWait */, "", /* reason */
+				)
+			}
+
+			flowID := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+			req := distsqlpb.SetupFlowRequest{Version: Version}
+			req.Flow = distsqlpb.FlowSpec{
+				FlowID: flowID,
+				Processors: []distsqlpb.ProcessorSpec{{
+					Core: distsqlpb.ProcessorCoreUnion{Values: &valuesSpec},
+					Output: []distsqlpb.OutputRouterSpec{{
+						Type:    distsqlpb.OutputRouterSpec_PASS_THROUGH,
+						Streams: []distsqlpb.StreamEndpointSpec{{Type: distsqlpb.StreamEndpointSpec_SYNC_RESPONSE}},
+					}},
+				}},
+			}
+
+			rb := NewRowBuffer(sqlbase.OneIntCol, nil /* rows */, RowBufferArgs{})
+			ctx, flow, err := distSQLSrv.SetupSyncFlow(ctx, &distSQLSrv.memMonitor, &req, rb, time.Time{} /* deadline */)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !flow.isLocal() {
+				t.Fatal("expected flow without remote streams to be local")
+			}
+			if err := flow.Start(ctx, func() {}); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range registeredFlowIDs(distSQLSrv.flowRegistry) {
+				if id == flowID {
+					t.Fatalf("local flow %s unexpectedly registered", flowID)
+				}
+			}
+			flow.Wait()
+
+			var res sqlbase.EncDatumRows
+			for _, rec := range rb.DrainAndClose() {
+				if rec.Meta != nil && rec.Meta.Err != nil {
+					t.Fatal(rec.Meta.Err)
+				}
+				if rec.Row != nil {
+					res = append(res, rec.Row)
+				}
+			}
+			if expected, actual := inputRows.String(sqlbase.OneIntCol), res.String(sqlbase.OneIntCol); expected != actual {
+				t.Fatalf("expected %s, got %s", expected, actual)
+			}
+			flow.Cleanup(ctx)
+		})
+	}
+}
+
+// TestFlowMaxMemoryUsage verifies that Flow.MaxMemoryUsage reports the memory
+// used by the processors of a flow, including the ones fused with their
+// consumer.
+func TestFlowMaxMemoryUsage(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.TODO()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	cfg := s.DistSQLServer().(*ServerImpl).ServerConfig
+	distSQLSrv := NewServer(ctx, cfg)
+
+	const numRows = 100
+	inputRows := sqlbase.MakeIntRows(numRows, 1 /* numCols */)
+	valuesSpec, err := generateValuesSpec(sqlbase.OneIntCol, inputRows, 10 /* rowsPerChunk */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncResponse := []distsqlpb.OutputRouterSpec{{
+		Type:    distsqlpb.OutputRouterSpec_PASS_THROUGH,
+		Streams: []distsqlpb.StreamEndpointSpec{{Type: distsqlpb.StreamEndpointSpec_SYNC_RESPONSE}},
+	}}
+	localStream := []distsqlpb.StreamEndpointSpec{{StreamID: 1, Type: distsqlpb.StreamEndpointSpec_LOCAL}}
+
+	testCases := []struct {
+		name       string
+		processors []distsqlpb.ProcessorSpec
+		expectMem  bool
+	}{
+		{
+			// The values processor doesn't use a memory monitor.
+			name: "values",
+			processors: []distsqlpb.ProcessorSpec{{
+				Core:   distsqlpb.ProcessorCoreUnion{Values: &valuesSpec},
+				Output: syncResponse,
+			}},
+			expectMem: false,
+		},
+		{
+			// The values processor is fused with the sorter, which buffers all
+			// the rows.
+			name: "sorter",
+			processors: []distsqlpb.ProcessorSpec{
+				{
+					Core: distsqlpb.ProcessorCoreUnion{Values: &valuesSpec},
+					Output: []distsqlpb.OutputRouterSpec{{
+						Type:    distsqlpb.OutputRouterSpec_PASS_THROUGH,
+						Streams: localStream,
+					}},
+				},
+				{
+					Input: []distsqlpb.InputSyncSpec{{
+						Type:        distsqlpb.InputSyncSpec_UNORDERED,
+						ColumnTypes: sqlbase.OneIntCol,
+						Streams:     localStream,
+					}},
+					Core: distsqlpb.ProcessorCoreUnion{Sorter: &distsqlpb.SorterSpec{
+						OutputOrdering: distsqlpb.Ordering{Columns: []distsqlpb.Ordering_Column{
+							{ColIdx: 0, Direction: distsqlpb.Ordering_Column_DESC},
+						}},
+					}},
+					Output: syncResponse,
+				},
+			},
+			expectMem: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := distsqlpb.SetupFlowRequest{Version: Version}
+			req.Flow = distsqlpb.FlowSpec{
+				FlowID:     distsqlpb.FlowID{UUID: uuid.MakeV4()},
+				Processors: tc.processors,
+			}
+
+			rb := NewRowBuffer(sqlbase.OneIntCol, nil /* rows */, RowBufferArgs{})
+			ctx, flow, err := distSQLSrv.SetupSyncFlow(ctx, &distSQLSrv.memMonitor, &req, rb, time.Time{} /* deadline */)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := flow.Start(ctx, func() {}); err != nil {
+				t.Fatal(err)
+			}
+			flow.Wait()
+
+			var numResults int
+			for _, rec := range rb.DrainAndClose() {
+				if rec.Meta != nil && rec.Meta.Err != nil {
+					t.Fatal(rec.Meta.Err)
+				}
+				if rec.Row != nil {
+					numResults++
+				}
+			}
+			if numResults != numRows {
+				t.Fatalf("expected %d rows, got %d", numRows, numResults)
+			}
+			if mem := flow.MaxMemoryUsage(); (mem > 0) != tc.expectMem {
+				t.Fatalf("unexpected max memory usage %d", mem)
+			}
+			flow.Cleanup(ctx)
+		})
+	}
+}
+
+// TestFlowStats verifies that Flow.Stats reports the stats and row counts
+// collected by the processors of a flow, including the ones fused with their
+// consumer, once the flow has completed.
+func TestFlowStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.TODO()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop(ctx)
+	cfg := s.DistSQLServer().(*ServerImpl).ServerConfig
+	distSQLSrv := NewServer(ctx, cfg)
+
+	const numRows = 10
+	inputRows := sqlbase.MakeIntRows(numRows, 1 /* numCols */)
+	valuesSpec, err := generateValuesSpec(sqlbase.OneIntCol, inputRows, 10 /* rowsPerChunk */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localStream := []distsqlpb.StreamEndpointSpec{{StreamID: 1, Type: distsqlpb.StreamEndpointSpec_LOCAL}}
+	processors := []distsqlpb.ProcessorSpec{
+		{
+			Core: distsqlpb.ProcessorCoreUnion{Values: &valuesSpec},
+			Output: []distsqlpb.OutputRouterSpec{{
+				Type:    distsqlpb.OutputRouterSpec_PASS_THROUGH,
+				Streams: localStream,
+			}},
+			ProcessorID: 1,
+		},
+		{
+			Input: []distsqlpb.InputSyncSpec{{
+				Type:        distsqlpb.InputSyncSpec_UNORDERED,
+				ColumnTypes: sqlbase.OneIntCol,
+				Streams:     localStream,
+			}},
+			Core: distsqlpb.ProcessorCoreUnion{Sorter: &distsqlpb.SorterSpec{
+				OutputOrdering: distsqlpb.Ordering{Columns: []distsqlpb.Ordering_Column{
+					{ColIdx: 0, Direction: distsqlpb.Ordering_Column_DESC},
+				}},
+			}},
+			Output: []distsqlpb.OutputRouterSpec{{
+				Type:    distsqlpb.OutputRouterSpec_PASS_THROUGH,
+				Streams: []distsqlpb.StreamEndpointSpec{{Type: distsqlpb.StreamEndpointSpec_SYNC_RESPONSE}},
+			}},
+			ProcessorID: 2,
+		},
+	}
+
+	runFlow := func(ctx context.Context, t *testing.T) FlowStats {
+		req := distsqlpb.SetupFlowRequest{Version: Version}
+		req.Flow = distsqlpb.FlowSpec{
+			FlowID:     distsqlpb.FlowID{UUID: uuid.MakeV4()},
+			Processors: processors,
+		}
+		rb := NewRowBuffer(sqlbase.OneIntCol, nil /* rows */, RowBufferArgs{})
+		ctx, flow, err := distSQLSrv.SetupSyncFlow(ctx, &distSQLSrv.memMonitor, &req, rb, time.Time{} /* deadline */)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer flow.Cleanup(ctx)
+		if err := flow.Start(ctx, func() {}); err != nil {
+			t.Fatal(err)
+		}
+		flow.Wait()
+		for _, rec := range rb.DrainAndClose() {
+			if rec.Meta != nil && rec.Meta.Err != nil {
+				t.Fatal(rec.Meta.Err)
+			}
+		}
+		stats := flow.Stats()
+		if len(stats.Processors) != len(processors) {
+			t.Fatalf("expected %d processors, got %+v", len(processors), stats)
+		}
+		for i, ps := range stats.Processors {
+			if ps.ProcessorID != processors[i].ProcessorID {
+				t.Fatalf("expected processor %d, got %d", processors[i].ProcessorID, ps.ProcessorID)
+			}
+		}
+		if name := stats.Processors[1].Name; name != sortAllProcName {
+			t.Fatalf("expected %q, got %q", sortAllProcName, name)
+		}
+		// The values processor doesn't collect stats.
+		if ps := stats.Processors[0].Stats; ps != nil {
+			t.Fatalf("expected no values stats, got %+v", ps)
+		}
+		// The row counts are reported whether or not the flow is traced.
+		expectedCounts := []ProcessorRowCounts{
+			{InputRows: 0, OutputRows: numRows},
+			{InputRows: numRows, OutputRows: numRows},
+		}
+		for i, expected := range expectedCounts {
+			if res := stats.Processors[i].RowCounts; res != expected {
+				t.Fatalf("processor %d: expected row counts %+v, got %+v", i, expected, res)
+			}
+		}
+		return stats
+	}
+
+	t.Run("untraced", func(t *testing.T) {
+		if ps := runFlow(ctx, t).Processors[1].Stats; ps != nil {
+			t.Fatalf("expected no sorter stats, got %+v", ps)
+		}
+	})
+
+	t.Run("traced", func(t *testing.T) {
+		ctx, sp, err := tracing.StartSnowballTrace(ctx, distSQLSrv.Tracer, "test flow ctx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sp.Finish()
+		ss, ok := runFlow(ctx, t).Processors[1].Stats.(*SorterStats)
+		if !ok {
+			t.Fatalf("expected sorter stats, got %+v", ss)
+		}
+		if ss.InputStats.NumRows != numRows {
+			t.Fatalf("expected %d input rows, got %d", numRows, ss.InputStats.NumRows)
+		}
+	})
+}
+
 // TestInboundStreamTimeoutIsRetryable verifies that a failure from an inbound
 // stream to connect in a timeout is considered retryable by
 // pgerror.IsSQLRetryableError.
@@ -602,6 +1396,7 @@ func TestInboundStreamTimeoutIsRetryable(t *testing.T) {
 	wg.Add(1)
 	if err := fr.RegisterFlow(
 		context.Background(), distsqlpb.FlowID{}, &Flow{}, inboundStreams, 0, /* timeout */
+		time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -621,15 +1416,16 @@ func TestTimeoutPushDoesntBlockRegister(t *testing.T) {
 	ctx := context.Background()
 	fr := makeFlowRegistry(0)
 	// pushChan is used to be able to tell when a Push on the RowBuffer has
-	// occurred.
-	pushChan := make(chan *distsqlpb.ProducerMetadata)
+	// occurred. The RowBuffer is full, so the Push then blocks until the
+	// RowBuffer is closed.
+	pushChan := make(chan *distsqlpb.ProducerMetadata, 1)
 	rc := NewRowBuffer(
 		sqlbase.OneIntCol,
-		nil, /* rows */
+		sqlbase.EncDatumRows{{sqlbase.IntEncDatum(1)}},
 		RowBufferArgs{
+			Capacity: 1,
 			OnPush: func(_ sqlbase.EncDatumRow, meta *distsqlpb.ProducerMetadata) {
 				pushChan <- meta
-				<-pushChan
 			},
 		},
 	)
@@ -645,27 +1441,32 @@ func TestTimeoutPushDoesntBlockRegister(t *testing.T) {
 
 	// RegisterFlow with an immediate timeout.
 	if err := fr.RegisterFlow(
-		ctx, distsqlpb.FlowID{}, &Flow{}, inboundStreams, 0, /* timeout */
+		ctx, distsqlpb.FlowID{}, &Flow{}, inboundStreams, 0 /* timeout */, time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
 
 	// Ensure RegisterFlow performs a Push.
 	meta := <-pushChan
-	if !testutils.IsError(meta.Err, errNoInboundStreamConnection.Error()) {
-		t.Fatalf("unexpected err %v, expected %s", meta.Err, errNoInboundStreamConnection)
+	if !testutils.IsError(meta.Err, "no inbound stream connection") {
+		t.Fatalf("unexpected err %v, expected inbound stream timeout", meta.Err)
+	}
+	// The timeout is distinguishable from a connection failure.
+	if code, _ := pgerror.GetPGCode(meta.Err); code != pgerror.CodeQueryCanceledError {
+		t.Fatalf("expected code %s, got %s", pgerror.CodeQueryCanceledError, code)
 	}
 
 	// Attempt to register a flow. Note that this flow has no inbound streams, so
 	// Pushing to the RowBuffer is unexpected.
 	if err := fr.RegisterFlow(
 		ctx, distsqlpb.FlowID{UUID: uuid.MakeV4()}, &Flow{}, nil /* inboundStreams */, time.Hour, /* timeout */
+		time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
 
-	// Unblock the first RegisterFlow.
-	close(pushChan)
+	// Unblock the Push of the first RegisterFlow.
+	rc.DrainAndClose()
 }
 
 // TestFlowCancelPartiallyBlocked tests that cancellation messages can propagate
@@ -707,7 +1508,7 @@ func TestFlowCancelPartiallyBlocked(t *testing.T) {
 		flowRegistry:   fr,
 	}
 	if err := fr.RegisterFlow(
-		ctx, flow.id, flow, inboundStreams, 10*time.Second, /* timeout */
+		ctx, flow.id, flow, inboundStreams, 10*time.Second /* timeout */, time.Time{}, /* deadline */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -731,3 +1532,166 @@ func TestFlowCancelPartiallyBlocked(t *testing.T) {
 		t.Fatal("expected query canceled, found", meta.Err)
 	}
 }
+
+// TestFlowDeadline tests that a flow registered with a deadline gets its
+// context canceled, and its pending inbound streams canceled, once the
+// deadline passes.
+func TestFlowDeadline(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	fr := makeFlowRegistry(0)
+	receiver := &RowChannel{}
+	receiver.initWithBufSizeAndNumSenders(nil /* types */, 1, 1)
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	inboundStreams := map[distsqlpb.StreamID]*inboundStreamInfo{
+		0: {
+			receiver:  receiver,
+			waitGroup: &wg,
+		},
+	}
+
+	flowCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	flow := &Flow{
+		FlowCtx: FlowCtx{
+			id: distsqlpb.FlowID{UUID: uuid.FastMakeV4()},
+		},
+		inboundStreams: inboundStreams,
+		flowRegistry:   fr,
+		ctxCancel:      cancel,
+		ctxDone:        flowCtx.Done(),
+	}
+	if err := fr.RegisterFlow(
+		flowCtx, flow.id, flow, inboundStreams, time.Hour, /* timeout */
+		timeutil.Now().Add(10*time.Millisecond), /* deadline */
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer fr.UnregisterFlow(flow.id)
+
+	select {
+	case <-flowCtx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("flow context was not canceled after the deadline")
+	}
+
+	_, meta := receiver.Next()
+	if meta == nil || meta.Err != sqlbase.QueryCanceledError {
+		t.Fatal("expected query canceled, found", meta)
+	}
+	// The pending stream must have been marked as done.
+	wg.Wait()
+}
+
+// TestFlowCancelStreamOrder verifies that pending inbound streams are canceled
+// in increasing StreamID order, regardless of the map iteration order.
+func TestFlowCancelStreamOrder(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	fr := makeFlowRegistry(0)
+
+	const numStreams = 10
+	wg := sync.WaitGroup{}
+	wg.Add(numStreams)
+	inboundStreams := make(map[distsqlpb.StreamID]*inboundStreamInfo, numStreams)
+	receivers := make([]RowReceiver, numStreams)
+	for i := range receivers {
+		receivers[i] = NewRowBuffer(sqlbase.OneIntCol, nil /* rows */, RowBufferArgs{})
+		inboundStreams[distsqlpb.StreamID(i)] = &inboundStreamInfo{
+			receiver:  receivers[i],
+			waitGroup: &wg,
+		}
+	}
+
+	id := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+	if err := fr.RegisterFlow(
+		ctx, id, &Flow{}, inboundStreams, time.Hour /* timeout */, time.Time{}, /* deadline */
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer fr.UnregisterFlow(id)
+
+	fr.Lock()
+	canceled := fr.cancelPendingStreamsLocked(id)
+	fr.Unlock()
+	wg.Wait()
+
+	if len(canceled) != numStreams {
+		t.Fatalf("expected %d canceled streams, found %d", numStreams, len(canceled))
+	}
+	for i := range canceled {
+		if canceled[i] != receivers[i] {
+			t.Fatalf("stream %d canceled out of order", i)
+		}
+	}
+}
+
+// noopFlowStreamServer is a DistSQL_FlowStreamServer whose Send is a no-op. It
+// lets tests and benchmarks connect inbound streams without paying for gRPC.
+type noopFlowStreamServer struct {
+	distsqlpb.DistSQL_FlowStreamServer
+}
+
+func (noopFlowStreamServer) Send(*distsqlpb.ConsumerSignal) error {
+	return nil
+}
+
+// BenchmarkFlowRegistryChurn measures the throughput of the flow registry when
+// many short-lived flows are registered, have their inbound streams connected
+// and are unregistered concurrently. The inbound streams race with the
+// registration of their flow, so both the "consumer already scheduled" and the
+// "waiting for the flow" paths of ConnectInboundStream are exercised. Run with
+// -mutexprofile to inspect contention on the registry's lock.
+func BenchmarkFlowRegistryChurn(b *testing.B) {
+	ctx := context.Background()
+	for _, numStreams := range []int{1, 4} {
+		for _, parallelism := range []int{1, 16} {
+			b.Run(fmt.Sprintf("streams=%d/parallelism=%d", numStreams, parallelism), func(b *testing.B) {
+				fr := makeFlowRegistry(roachpb.NodeID(0))
+				b.SetParallelism(parallelism)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					var stream noopFlowStreamServer
+					var connectWG sync.WaitGroup
+					for pb.Next() {
+						id := distsqlpb.FlowID{UUID: uuid.MakeV4()}
+						var streamsWG sync.WaitGroup
+						streamsWG.Add(numStreams)
+						inboundStreams := make(map[distsqlpb.StreamID]*inboundStreamInfo, numStreams)
+						for i := 0; i < numStreams; i++ {
+							inboundStreams[distsqlpb.StreamID(i)] = &inboundStreamInfo{
+								receiver: &RowBuffer{}, waitGroup: &streamsWG,
+							}
+						}
+
+						connectWG.Add(numStreams)
+						for i := 0; i < numStreams; i++ {
+							go func(streamID distsqlpb.StreamID) {
+								defer connectWG.Done()
+								_, _, cleanup, err := fr.ConnectInboundStream(
+									ctx, id, streamID, stream, time.Hour, /* timeout */
+								)
+								if err != nil {
+									panic(err)
+								}
+								cleanup()
+							}(distsqlpb.StreamID(i))
+						}
+						if err := fr.RegisterFlow(
+							ctx, id, &Flow{}, inboundStreams, time.Hour, /* timeout */
+							time.Time{}, /* deadline */
+						); err != nil {
+							panic(err)
+						}
+						connectWG.Wait()
+						streamsWG.Wait()
+						fr.UnregisterFlow(id)
+					}
+				})
+			})
+		}
+	}
+}
@@ -180,10 +180,7 @@ func newHashJoiner(
 	if h.useTempStorage {
 		// Limit the memory use by creating a child monitor with a hard limit.
 		// The hashJoiner will overflow to disk if this limit is not enough.
-		limit := h.flowCtx.testingKnobs.MemoryLimitBytes
-		if limit <= 0 {
-			limit = settingWorkMemBytes.Get(&st.SV)
-		}
+		limit := h.flowCtx.SpillThresholdBytes()
 		limitedMon := mon.MakeMonitorInheritWithLimit("hashjoiner-limited", limit, flowCtx.EvalCtx.Mon)
 		limitedMon.Start(ctx, flowCtx.EvalCtx.Mon, mon.BoundAccount{})
 		h.MemMonitor = &limitedMon
@@ -653,7 +650,7 @@ func (h *hashJoiner) receiveNext(
 		if err := h.cancelChecker.Check(); err != nil {
 			return nil, nil, false, err
 		}
-		row, meta := source.Next()
+		row, meta := h.InputNext(source)
 		if meta != nil {
 			return nil, meta, false, nil
 		} else if row == nil {
@@ -803,7 +800,7 @@ func (h *hashJoiner) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(h.Ctx); sp != nil {
-		tracing.SetSpanStats(
+		h.setSpanStats(
 			sp,
 			&HashJoinerStats{
 				LeftInputStats:   lis,
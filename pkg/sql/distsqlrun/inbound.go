@@ -23,6 +23,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // ProcessInboundStream receives rows from a DistSQL_FlowStreamServer and sends
@@ -97,7 +100,7 @@ func processInboundStreamHelper(
 			if err != nil {
 				if err != io.EOF {
 					// Communication error.
-					err = pgerror.Newf(pgerror.CodeConnectionFailureError, "communication error: %s", err)
+					err = classifyInboundStreamError(err)
 					sendErrToConsumer(err)
 					errChan <- err
 					return
@@ -128,6 +131,25 @@ func processInboundStreamHelper(
 	}
 }
 
+// classifyInboundStreamError tags an error that made an inbound stream fail
+// with a code that tells whether the stream timed out (CodeQueryCanceledError)
+// or whether the connection failed (CodeConnectionFailureError). The gateway
+// can retry a flow whose connection failed, while a timeout is reported to the
+// client. A stream that never connected before the flow stream timeout
+// (errNoInboundStreamConnection) is a timeout. Errors that already carry a code
+// are returned unchanged.
+func classifyInboundStreamError(err error) error {
+	if _, ok := pgerror.GetPGCode(err); ok {
+		return err
+	}
+	cause := errors.Cause(err)
+	if s, ok := status.FromError(cause); (ok && s.Code() == codes.DeadlineExceeded) ||
+		cause == context.DeadlineExceeded || cause == errNoInboundStreamConnection {
+		return pgerror.Newf(pgerror.CodeQueryCanceledError, "inbound stream timed out: %s", err)
+	}
+	return pgerror.Newf(pgerror.CodeConnectionFailureError, "communication error: %s", err)
+}
+
 // sendDrainSignalToProducer is called when the consumer wants to signal the
 // producer that it doesn't need any more rows and the producer should drain. A
 // signal is sent on stream to the producer to ask it to send metadata.
@@ -24,6 +24,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/rpc/nodedialer"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
@@ -35,6 +36,8 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // TestOutboxInboundStreamIntegration verifies that if an inbound stream gets
@@ -101,7 +104,7 @@ func TestOutboxInboundStreamIntegration(t *testing.T) {
 	f.waitGroup.Add(1)
 	require.NoError(
 		t,
-		srv.flowRegistry.RegisterFlow(ctx, distsqlpb.FlowID{}, f, connectionInfo, time.Hour /* timeout */),
+		srv.flowRegistry.RegisterFlow(ctx, distsqlpb.FlowID{}, f, connectionInfo, time.Hour /* timeout */, time.Time{} /* deadline */),
 	)
 
 	outbox.start(ctx, &f.waitGroup, func() {})
@@ -136,3 +139,27 @@ func TestOutboxInboundStreamIntegration(t *testing.T) {
 	// the outbox's drain signal listener to return.
 	outboxStopper.Quiesce(ctx)
 }
+
+func TestClassifyInboundStreamError(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		err  error
+		code string
+	}{
+		{status.Error(codes.DeadlineExceeded, "deadline exceeded"), pgerror.CodeQueryCanceledError},
+		{errors.Wrap(context.DeadlineExceeded, "recv"), pgerror.CodeQueryCanceledError},
+		{errNoInboundStreamConnection, pgerror.CodeQueryCanceledError},
+		{status.Error(codes.Unavailable, "transport is closing"), pgerror.CodeConnectionFailureError},
+		{errors.New("connection reset by peer"), pgerror.CodeConnectionFailureError},
+		// Errors that already have a code are left alone.
+		{pgerror.New(pgerror.CodeConnectionFailureError, "boom"), pgerror.CodeConnectionFailureError},
+		{pgerror.New(pgerror.CodeInternalError, "boom"), pgerror.CodeInternalError},
+	}
+	for _, tc := range testCases {
+		err := classifyInboundStreamError(tc.err)
+		if code, _ := pgerror.GetPGCode(err); code != tc.code {
+			t.Errorf("%v: expected code %s, got %s (%v)", tc.err, tc.code, code, err)
+		}
+	}
+}
@@ -137,7 +137,7 @@ func (ij *indexJoiner) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata)
 		if !ij.fetcherReady {
 			// Retrieve a batch of rows from the input.
 			for len(ij.spans) < ij.batchSize {
-				row, meta := ij.input.Next()
+				row, meta := ij.InputNext(ij.input)
 				if meta != nil {
 					if meta.Err != nil {
 						ij.MoveToDraining(nil /* err */)
@@ -223,7 +223,7 @@ func (ij *indexJoiner) outputStatsToTrace() {
 		IndexLookupStats: ils,
 	}
 	if sp := opentracing.SpanFromContext(ij.Ctx); sp != nil {
-		tracing.SetSpanStats(sp, jrs)
+		ij.setSpanStats(sp, jrs)
 	}
 }
 
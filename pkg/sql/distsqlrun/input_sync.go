@@ -20,6 +20,7 @@ package distsqlrun
 import (
 	"container/heap"
 	"context"
+	"reflect"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
@@ -377,3 +378,172 @@ func makeOrderedSync(
 	}
 	return s, nil
 }
+
+// prioritySynchronizer produces the rows of a priority stream and then the
+// rows of the synchronizer of the other streams. It is used for inputs on
+// which one stream carries a small amount of data that the consumer wants to
+// see first, for example the small side of a broadcast join, so that the
+// consumer doesn't wait for the streams carrying the bulk of the data to
+// deliver it.
+type prioritySynchronizer struct {
+	// priority is the priority stream. It is set to nil once exhausted.
+	priority *RowChannel
+	// rest synchronizes the other streams.
+	rest RowSource
+}
+
+var _ RowSource = &prioritySynchronizer{}
+
+// OutputTypes is part of the RowSource interface.
+func (s *prioritySynchronizer) OutputTypes() []types.T {
+	return s.rest.OutputTypes()
+}
+
+// Start is part of the RowSource interface.
+func (s *prioritySynchronizer) Start(ctx context.Context) context.Context {
+	s.priority.Start(ctx)
+	return s.rest.Start(ctx)
+}
+
+// Next is part of the RowSource interface.
+func (s *prioritySynchronizer) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
+	if s.priority != nil {
+		row, meta := s.priority.Next()
+		if row != nil || meta != nil {
+			return row, meta
+		}
+		s.priority = nil
+	}
+	return s.rest.Next()
+}
+
+// ConsumerDone is part of the RowSource interface.
+func (s *prioritySynchronizer) ConsumerDone() {
+	if s.priority != nil {
+		s.priority.ConsumerDone()
+	}
+	s.rest.ConsumerDone()
+}
+
+// ConsumerClosed is part of the RowSource interface.
+func (s *prioritySynchronizer) ConsumerClosed() {
+	if s.priority != nil {
+		s.priority.ConsumerClosed()
+	}
+	s.rest.ConsumerClosed()
+}
+
+// makePrioritySync creates a prioritySynchronizer that produces the rows of
+// priority, which is expected to be fed by a single stream, before the rows
+// of rest.
+func makePrioritySync(priority *RowChannel, rest RowSource) RowSource {
+	return &prioritySynchronizer{priority: priority, rest: rest}
+}
+
+// roundRobinSynchronizer receives rows from multiple streams and produces a
+// single stream of rows, without any ordering guarantees. Unlike a RowChannel
+// shared by all the producers, which returns whatever row was pushed first, it
+// cycles through the streams so that a fast producer cannot starve the others:
+// after returning a row from a stream, the next stream that has a row (or
+// metadata) ready is preferred.
+type roundRobinSynchronizer struct {
+	types []types.T
+
+	// sources contains the streams that haven't been exhausted yet.
+	sources []*RowChannel
+	// next is the index in sources of the stream that is polled first on the
+	// next call to Next().
+	next int
+
+	// cases is used to block on all the sources when none has a message ready.
+	cases []reflect.SelectCase
+}
+
+var _ RowSource = &roundRobinSynchronizer{}
+
+// OutputTypes is part of the RowSource interface.
+func (s *roundRobinSynchronizer) OutputTypes() []types.T {
+	return s.types
+}
+
+// Start is part of the RowSource interface.
+func (s *roundRobinSynchronizer) Start(ctx context.Context) context.Context {
+	for _, src := range s.sources {
+		src.Start(ctx)
+	}
+	return ctx
+}
+
+// Next is part of the RowSource interface.
+func (s *roundRobinSynchronizer) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
+	for len(s.sources) > 0 {
+		idx, msg, ok := s.receive()
+		if !ok {
+			// The source is exhausted; the source after it is now at idx.
+			s.sources = append(s.sources[:idx], s.sources[idx+1:]...)
+			if s.next > idx {
+				s.next--
+			}
+			if s.next >= len(s.sources) {
+				s.next = 0
+			}
+			continue
+		}
+		s.next = (idx + 1) % len(s.sources)
+		return msg.Row, msg.Meta
+	}
+	return nil, nil
+}
+
+// receive returns the next message from the first source, starting at s.next,
+// that has one ready. If no source has a message ready, it blocks until one
+// does. ok is false if the returned source has been exhausted.
+func (s *roundRobinSynchronizer) receive() (idx int, msg RowChannelMsg, ok bool) {
+	for i := range s.sources {
+		idx = (s.next + i) % len(s.sources)
+		select {
+		case msg, ok = <-s.sources[idx].C:
+			return idx, msg, ok
+		default:
+		}
+	}
+	s.cases = s.cases[:0]
+	for _, src := range s.sources {
+		s.cases = append(s.cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(src.C),
+		})
+	}
+	idx, v, ok := reflect.Select(s.cases)
+	if ok {
+		msg = v.Interface().(RowChannelMsg)
+	}
+	return idx, msg, ok
+}
+
+// ConsumerDone is part of the RowSource interface.
+func (s *roundRobinSynchronizer) ConsumerDone() {
+	for _, src := range s.sources {
+		src.ConsumerDone()
+	}
+}
+
+// ConsumerClosed is part of the RowSource interface.
+func (s *roundRobinSynchronizer) ConsumerClosed() {
+	for _, src := range s.sources {
+		src.ConsumerClosed()
+	}
+}
+
+// makeRoundRobinSync creates a roundRobinSynchronizer over the given sources;
+// each source is expected to be fed by a single stream.
+func makeRoundRobinSync(types []types.T, sources []*RowChannel) (RowSource, error) {
+	if len(sources) < 2 {
+		return nil, errors.Errorf("only %d sources for round-robin synchronizer", len(sources))
+	}
+	return &roundRobinSynchronizer{
+		types:   types,
+		sources: sources,
+		cases:   make([]reflect.SelectCase, 0, len(sources)),
+	}, nil
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/pkg/errors"
@@ -277,3 +278,114 @@ func TestUnorderedSync(t *testing.T) {
 		t.Error("Did not receive expected error")
 	}
 }
+
+func TestRoundRobinSync(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// Pre-fill the streams: the first one has many more rows than the others,
+	// which must not prevent the others from being consumed.
+	numRows := []int{10, 2, 3}
+	sources := make([]*RowChannel, len(numRows))
+	for i, n := range numRows {
+		rc := &RowChannel{}
+		rc.initWithBufSizeAndNumSenders(sqlbase.TwoIntCols, n, 1 /* numSenders */)
+		for j := 1; j <= n; j++ {
+			a := sqlbase.DatumToEncDatum(types.Int, tree.NewDInt(tree.DInt(i)))
+			b := sqlbase.DatumToEncDatum(types.Int, tree.NewDInt(tree.DInt(j)))
+			if status := rc.Push(sqlbase.EncDatumRow{a, b}, nil /* meta */); status != NeedMoreRows {
+				t.Fatalf("unexpected response: %d", status)
+			}
+		}
+		rc.ProducerDone()
+		sources[i] = rc
+	}
+
+	sync, err := makeRoundRobinSync(sqlbase.TwoIntCols, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sync.Start(context.Background())
+	var res []string
+	for {
+		row, meta := sync.Next()
+		if meta != nil {
+			t.Fatalf("unexpected metadata: %v", meta)
+		}
+		if row == nil {
+			break
+		}
+		res = append(res, row.String(sqlbase.TwoIntCols))
+	}
+	expected := []string{
+		"[0 1]", "[1 1]", "[2 1]",
+		"[0 2]", "[1 2]", "[2 2]",
+		"[0 3]", "[2 3]",
+		"[0 4]", "[0 5]", "[0 6]", "[0 7]", "[0 8]", "[0 9]", "[0 10]",
+	}
+	if fmt.Sprint(res) != fmt.Sprint(expected) {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, res)
+	}
+
+	if _, err := makeRoundRobinSync(nil /* types */, sources[:1]); !testutils.IsError(
+		err, "only 1 sources for round-robin synchronizer",
+	) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPrioritySync(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	makeRow := func(stream, i int) sqlbase.EncDatumRow {
+		return sqlbase.EncDatumRow{
+			sqlbase.DatumToEncDatum(types.Int, tree.NewDInt(tree.DInt(stream))),
+			sqlbase.DatumToEncDatum(types.Int, tree.NewDInt(tree.DInt(i))),
+		}
+	}
+
+	// The other streams have all their rows ready.
+	rest := &RowChannel{}
+	rest.initWithBufSizeAndNumSenders(sqlbase.TwoIntCols, 4, 2 /* numSenders */)
+	for stream := 1; stream <= 2; stream++ {
+		for i := 1; i <= 2; i++ {
+			if status := rest.Push(makeRow(stream, i), nil /* meta */); status != NeedMoreRows {
+				t.Fatalf("unexpected response: %d", status)
+			}
+		}
+		rest.ProducerDone()
+	}
+
+	// The priority stream produces its rows later; they are still returned
+	// first.
+	priority := &RowChannel{}
+	priority.InitWithNumSenders(sqlbase.TwoIntCols, 1 /* numSenders */)
+	go func() {
+		for i := 1; i <= 2; i++ {
+			priority.Push(makeRow(0, i), nil /* meta */)
+		}
+		priority.Push(nil /* row */, &distsqlpb.ProducerMetadata{Err: errors.New("test error")})
+		priority.ProducerDone()
+	}()
+
+	sync := makePrioritySync(priority, rest)
+	sync.Start(context.Background())
+	var res []string
+	for {
+		row, meta := sync.Next()
+		if meta != nil {
+			res = append(res, meta.Err.Error())
+			continue
+		}
+		if row == nil {
+			break
+		}
+		res = append(res, row.String(sqlbase.TwoIntCols))
+	}
+	expected := []string{
+		"[0 1]", "[0 2]", "test error",
+		"[1 1]", "[1 2]", "[2 1]", "[2 2]",
+	}
+	if fmt.Sprint(res) != fmt.Sprint(expected) {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, res)
+	}
+}
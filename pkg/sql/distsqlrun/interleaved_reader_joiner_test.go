@@ -417,15 +417,11 @@ func TestInterleavedReaderJoiner(t *testing.T) {
 			}
 
 			var res sqlbase.EncDatumRows
-			for {
-				row, meta := out.Next()
-				if meta != nil {
-					t.Fatalf("unexpected metadata: %v", meta)
+			for _, rec := range out.DrainAndClose() {
+				if rec.Meta != nil {
+					t.Fatalf("unexpected metadata: %v", rec.Meta)
 				}
-				if row == nil {
-					break
-				}
-				res = append(res, row.Copy())
+				res = append(res, rec.Row)
 			}
 
 			if result := res.String(irj.OutputTypes()); result != tc.expected {
@@ -619,18 +615,14 @@ func TestInterleavedReaderJoinerTrailingMetadata(t *testing.T) {
 
 	// Check for trailing metadata.
 	var traceSeen, txnCoordMetaSeen bool
-	for {
-		row, meta := out.Next()
-		if row != nil {
-			t.Fatalf("row was pushed unexpectedly: %s", row.String(sqlbase.OneIntCol))
-		}
-		if meta == nil {
-			break
+	for _, rec := range out.DrainAndClose() {
+		if rec.Row != nil {
+			t.Fatalf("row was pushed unexpectedly: %s", rec.Row.String(sqlbase.OneIntCol))
 		}
-		if meta.TraceData != nil {
+		if rec.Meta.TraceData != nil {
 			traceSeen = true
 		}
-		if meta.TxnCoordMeta != nil {
+		if rec.Meta.TxnCoordMeta != nil {
 			txnCoordMetaSeen = true
 		}
 	}
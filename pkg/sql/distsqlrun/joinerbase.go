@@ -31,6 +31,10 @@ type joinerBase struct {
 	emptyRight  sqlbase.EncDatumRow
 	combinedRow sqlbase.EncDatumRow
 
+	// onCondFn, if set, is a specialized version of onCond's filter that is
+	// used by render instead; see exprHelper.compileSimpleFilter.
+	onCondFn simpleFilterFn
+
 	// eqCols contains the indices of the columns that are constrained to be
 	// equal. Specifically column eqCols[0][i] on the left side must match the
 	// column eqCols[1][i] on the right side.
@@ -40,6 +44,12 @@ type joinerBase struct {
 	// columns must be merged at the beginning of each result row. This
 	// is the desired behavior for USING and NATURAL JOIN.
 	numMergedEqualityColumns int
+
+	// emitMatchCount, if set, indicates that the output rows are made of the
+	// columns of a left row followed by the number of right rows it matched,
+	// instead of the columns of both sides. It must be set before init is
+	// called. See renderMatchCountRow.
+	emitMatchCount bool
 }
 
 // init initializes the joinerBase.
@@ -105,6 +115,13 @@ func (jb *joinerBase) init(
 		outputSize += len(rightTypes)
 	}
 	outputTypes := condTypes[:outputSize]
+	if jb.emitMatchCount {
+		// The match count column replaces the columns of the right side.
+		leftSize := len(leftTypes) + jb.numMergedEqualityColumns
+		outputTypes = make([]types.T, leftSize, leftSize+1)
+		copy(outputTypes, condTypes)
+		outputTypes = append(outputTypes, *types.Int)
+	}
 
 	if err := jb.ProcessorBase.Init(
 		self, post, outputTypes, flowCtx, processorID, output, nil /* memMonitor */, opts,
@@ -155,6 +172,23 @@ func (jb *joinerBase) renderUnmatchedRow(
 	return jb.combinedRow
 }
 
+// renderMatchCountRow creates a result row made of the given left row followed
+// by the number of right rows that it matched. Only used when emitMatchCount
+// is set.
+func (jb *joinerBase) renderMatchCountRow(
+	lrow sqlbase.EncDatumRow, count int,
+) sqlbase.EncDatumRow {
+	jb.combinedRow = jb.combinedRow[:0]
+	for idx := 0; idx < jb.numMergedEqualityColumns; idx++ {
+		jb.combinedRow = append(jb.combinedRow, lrow[jb.eqCols[leftSide][idx]])
+	}
+	jb.combinedRow = append(jb.combinedRow, lrow...)
+	jb.combinedRow = append(
+		jb.combinedRow, sqlbase.DatumToEncDatum(types.Int, tree.NewDInt(tree.DInt(count))),
+	)
+	return jb.combinedRow
+}
+
 func shouldIncludeRightColsInOutput(joinType sqlbase.JoinType) bool {
 	switch joinType {
 	case sqlbase.LeftSemiJoin, sqlbase.LeftAntiJoin, sqlbase.IntersectAllJoin, sqlbase.ExceptAllJoin:
@@ -204,7 +238,12 @@ func (jb *joinerBase) render(lrow, rrow sqlbase.EncDatumRow) (sqlbase.EncDatumRo
 	copy(jb.combinedRow[n:], lrow)
 	copy(jb.combinedRow[n+len(lrow):], rrow)
 
-	if jb.onCond.expr != nil {
+	if jb.onCondFn != nil {
+		res, err := jb.onCondFn(jb.combinedRow)
+		if !res || err != nil {
+			return nil, err
+		}
+	} else if jb.onCond.expr != nil {
 		res, err := jb.onCond.evalFilter(jb.combinedRow)
 		if !res || err != nil {
 			return nil, err
@@ -324,7 +324,7 @@ func (jr *joinReader) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata)
 func (jr *joinReader) readInput() (joinReaderState, *distsqlpb.ProducerMetadata) {
 	// Read the next batch of input rows.
 	for len(jr.inputRows) < jr.batchSize {
-		row, meta := jr.input.Next()
+		row, meta := jr.InputNext(jr.input)
 		if meta != nil {
 			if meta.Err != nil {
 				jr.MoveToDraining(nil /* err */)
@@ -558,7 +558,7 @@ func (jr *joinReader) outputStatsToTrace() {
 		IndexLookupStats: ils,
 	}
 	if sp := opentracing.SpanFromContext(jr.Ctx); sp != nil {
-		tracing.SetSpanStats(sp, jrs)
+		jr.setSpanStats(sp, jrs)
 	}
 }
 
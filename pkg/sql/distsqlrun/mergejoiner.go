@@ -16,15 +16,24 @@ package distsqlrun
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+var settingMergeJoinBatchRowLimit = settings.RegisterNonNegativeIntSetting(
+	"sql.distsql.merge_joins.batch_row_limit",
+	"maximum number of rows with equal keys from the left input that a merge join "+
+		"buffers before emitting results; larger groups are joined incrementally (0 = no limit)",
+	0,
 )
 
 // mergeJoiner performs merge join, it has two input row sources with the same
@@ -42,6 +51,12 @@ type mergeJoiner struct {
 	emitUnmatchedRight      bool
 	matchedRight            util.FastIntSet
 	matchedRightCount       int
+	// leftMore is set when leftRows is not the last chunk of its group (see
+	// settingMergeJoinBatchRowLimit); rightRows is then the same for the next
+	// chunk, and the unmatched right rows are only emitted after the last one.
+	leftMore bool
+	// leftOffset is the position of leftRows[0] within its group.
+	leftOffset int
 
 	streamMerger streamMerger
 }
@@ -60,20 +75,37 @@ func newMergeJoiner(
 	post *distsqlpb.PostProcessSpec,
 	output RowReceiver,
 ) (*mergeJoiner, error) {
+	if len(spec.LeftOrdering.Columns) != len(spec.RightOrdering.Columns) {
+		return nil, pgerror.AssertionFailedf(
+			"unmatched column orderings: %d left columns, %d right columns",
+			len(spec.LeftOrdering.Columns), len(spec.RightOrdering.Columns))
+	}
 	leftEqCols := make([]uint32, 0, len(spec.LeftOrdering.Columns))
 	rightEqCols := make([]uint32, 0, len(spec.RightOrdering.Columns))
 	for i, c := range spec.LeftOrdering.Columns {
-		if spec.RightOrdering.Columns[i].Direction != c.Direction {
-			return nil, errors.New("unmatched column orderings")
+		if r := spec.RightOrdering.Columns[i]; r.Direction != c.Direction {
+			return nil, pgerror.AssertionFailedf(
+				"unmatched column orderings: ordering column %d is %s on the left (column %d) "+
+					"but %s on the right (column %d)",
+				i, c.Direction, c.ColIdx, r.Direction, r.ColIdx)
 		}
 		leftEqCols = append(leftEqCols, c.ColIdx)
 		rightEqCols = append(rightEqCols, spec.RightOrdering.Columns[i].ColIdx)
 	}
 
+	if spec.EmitMatchCount {
+		switch spec.Type {
+		case sqlbase.LeftSemiJoin, sqlbase.LeftOuterJoin:
+		default:
+			return nil, errors.Errorf("match count is not supported for %s joins", spec.Type)
+		}
+	}
+
 	m := &mergeJoiner{
 		leftSource:  leftSource,
 		rightSource: rightSource,
 	}
+	m.emitMatchCount = spec.EmitMatchCount
 
 	if sp := opentracing.SpanFromContext(flowCtx.EvalCtx.Ctx()); sp != nil && tracing.IsRecording(sp) {
 		m.leftSource = NewInputStatCollector(m.leftSource)
@@ -94,6 +126,9 @@ func newMergeJoiner(
 	); err != nil {
 		return nil, err
 	}
+	// The ON condition is evaluated for every pair of rows that match on the
+	// equality columns, so avoid walking its expression tree if possible.
+	m.onCondFn = m.onCond.compileSimpleFilter()
 
 	m.MemMonitor = NewMonitor(flowCtx.EvalCtx.Ctx(), flowCtx.EvalCtx.Mon, "mergejoiner-mem")
 
@@ -104,6 +139,7 @@ func newMergeJoiner(
 		m.rightSource,
 		distsqlpb.ConvertToColumnOrdering(spec.RightOrdering),
 		spec.NullEquality,
+		int(settingMergeJoinBatchRowLimit.Get(&flowCtx.Settings.SV)),
 		m.MemMonitor,
 	)
 	if err != nil {
@@ -162,6 +198,10 @@ func (m *mergeJoiner) nextRow() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadat
 				}
 				if renderedRow != nil {
 					m.matchedRightCount++
+					if m.emitMatchCount {
+						// All the right rows are counted before the left row is emitted.
+						continue
+					}
 					if m.joinType == sqlbase.LeftAntiJoin || m.joinType == sqlbase.ExceptAllJoin {
 						break
 					}
@@ -192,7 +232,19 @@ func (m *mergeJoiner) nextRow() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadat
 			// previously matched rows on the next right-side iteration, since we
 			// don't want to match them again.
 			if m.joinType.IsSetOpJoin() {
-				m.rightIdx = m.leftIdx
+				m.rightIdx = m.leftOffset + m.leftIdx
+			}
+
+			// When emitting match counts, emit the left-side row along with the
+			// number of right-side rows it matched. Unmatched rows are only emitted
+			// for left outer joins.
+			if m.emitMatchCount {
+				count := m.matchedRightCount
+				m.matchedRightCount = 0
+				if count > 0 || shouldEmitUnmatchedRow(leftSide, m.joinType) {
+					return m.renderMatchCountRow(lrow, count), nil
+				}
+				continue
 			}
 
 			// If we didn't match any rows on the right-side of the batch and this is
@@ -206,8 +258,9 @@ func (m *mergeJoiner) nextRow() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadat
 		}
 
 		// We've exhausted the left-side batch. If this is a right or full outer
-		// join (and thus matchedRight!=nil), emit unmatched right-side rows.
-		if m.emitUnmatchedRight {
+		// join (and thus matchedRight!=nil), emit unmatched right-side rows once
+		// the whole left group has been processed.
+		if m.emitUnmatchedRight && !m.leftMore {
 			for m.rightIdx < len(m.rightRows) {
 				ridx := m.rightIdx
 				m.rightIdx++
@@ -222,21 +275,37 @@ func (m *mergeJoiner) nextRow() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadat
 		}
 
 		// Retrieve the next batch of rows to process.
-		var meta *distsqlpb.ProducerMetadata
 		// TODO(paul): Investigate (with benchmarks) whether or not it's
 		// worthwhile to only buffer one row from the right stream per batch
 		// for semi-joins.
-		m.leftRows, m.rightRows, meta = m.streamMerger.NextBatch(m.Ctx, m.evalCtx)
+		leftRows, rightRows, leftMore, meta := m.streamMerger.NextBatch(m.Ctx, m.evalCtx)
 		if meta != nil {
 			return nil, meta
 		}
-		if m.leftRows == nil && m.rightRows == nil {
+		if leftRows == nil && rightRows == nil {
 			return nil, nil
 		}
 
-		// Prepare for processing the next batch.
-		m.emitUnmatchedRight = shouldEmitUnmatchedRow(rightSide, m.joinType)
+		// Count the input rows. A batch that continues the previous left group
+		// carries the same right rows as the previous batch.
+		m.addInputRows(len(leftRows))
+		if !m.leftMore {
+			m.addInputRows(len(rightRows))
+		}
+
+		// Prepare for processing the next batch. If it continues the previous
+		// left group, matchedRight carries over.
+		if m.leftMore {
+			m.leftOffset += len(m.leftRows)
+		} else {
+			m.leftOffset = 0
+			m.emitUnmatchedRight = shouldEmitUnmatchedRow(rightSide, m.joinType)
+		}
+		m.leftRows, m.rightRows, m.leftMore = leftRows, rightRows, leftMore
 		m.leftIdx, m.rightIdx = 0, 0
+		if m.joinType.IsSetOpJoin() {
+			m.rightIdx = m.leftOffset
+		}
 	}
 }
 
@@ -277,7 +346,11 @@ func (mjs *MergeJoinerStats) StatsForQueryPlan() []string {
 		mjs.LeftInputStats.StatsForQueryPlan("left "),
 		mjs.RightInputStats.StatsForQueryPlan("right ")...,
 	)
-	return append(stats, fmt.Sprintf("%s: %s", maxMemoryQueryPlanSuffix, humanizeutil.IBytes(mjs.MaxAllocatedMem)))
+	return append(
+		stats,
+		fmt.Sprintf("join type: %s", mjs.JoinType),
+		fmt.Sprintf("%s: %s", maxMemoryQueryPlanSuffix, humanizeutil.IBytes(mjs.MaxAllocatedMem)),
+	)
 }
 
 // outputStatsToTrace outputs the collected mergeJoiner stats to the trace. Will
@@ -292,12 +365,13 @@ func (m *mergeJoiner) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(m.Ctx); sp != nil {
-		tracing.SetSpanStats(
+		m.setSpanStats(
 			sp,
 			&MergeJoinerStats{
 				LeftInputStats:  lis,
 				RightInputStats: ris,
 				MaxAllocatedMem: m.MemMonitor.MaximumBytes(),
+				JoinType:        m.joinType.String(),
 			},
 		)
 	}
@@ -18,13 +18,16 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"reflect"
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 )
@@ -682,6 +685,85 @@ func TestMergeJoiner(t *testing.T) {
 				{v[6], v[1]},
 			},
 		},
+		{
+			spec: distsqlpb.MergeJoinerSpec{
+				LeftOrdering: distsqlpb.ConvertToSpecOrdering(
+					sqlbase.ColumnOrdering{
+						{ColIdx: 0, Direction: encoding.Ascending},
+					}),
+				RightOrdering: distsqlpb.ConvertToSpecOrdering(
+					sqlbase.ColumnOrdering{
+						{ColIdx: 0, Direction: encoding.Ascending},
+					}),
+				Type:           sqlbase.LeftSemiJoin,
+				EmitMatchCount: true,
+				// Implicit @1 = @3 constraint.
+			},
+			outCols:   []uint32{0, 1, 2},
+			leftTypes: sqlbase.TwoIntCols,
+			leftInput: sqlbase.EncDatumRows{
+				{v[0], v[0]},
+				{v[0], v[1]},
+				{v[1], v[0]},
+				{v[5], v[0]},
+				{v[6], v[0]},
+			},
+			rightTypes: sqlbase.TwoIntCols,
+			rightInput: sqlbase.EncDatumRows{
+				{v[0], v[4]},
+				{v[0], v[1]},
+				{v[0], v[0]},
+				{v[5], v[4]},
+				{v[5], v[5]},
+			},
+			expectedTypes: sqlbase.ThreeIntCols,
+			expected: sqlbase.EncDatumRows{
+				{v[0], v[0], v[3]},
+				{v[0], v[1], v[3]},
+				{v[5], v[0], v[2]},
+			},
+		},
+		{
+			spec: distsqlpb.MergeJoinerSpec{
+				LeftOrdering: distsqlpb.ConvertToSpecOrdering(
+					sqlbase.ColumnOrdering{
+						{ColIdx: 0, Direction: encoding.Ascending},
+					}),
+				RightOrdering: distsqlpb.ConvertToSpecOrdering(
+					sqlbase.ColumnOrdering{
+						{ColIdx: 0, Direction: encoding.Ascending},
+					}),
+				Type:           sqlbase.LeftOuterJoin,
+				OnExpr:         distsqlpb.Expression{Expr: "@4 >= 4"},
+				EmitMatchCount: true,
+				// Implicit AND @1 = @3 constraint.
+			},
+			outCols:   []uint32{0, 1, 2},
+			leftTypes: sqlbase.TwoIntCols,
+			leftInput: sqlbase.EncDatumRows{
+				{v[0], v[0]},
+				{v[0], v[1]},
+				{v[1], v[0]},
+				{v[5], v[0]},
+				{v[6], v[0]},
+			},
+			rightTypes: sqlbase.TwoIntCols,
+			rightInput: sqlbase.EncDatumRows{
+				{v[0], v[4]},
+				{v[0], v[1]},
+				{v[0], v[0]},
+				{v[5], v[4]},
+				{v[5], v[5]},
+			},
+			expectedTypes: sqlbase.ThreeIntCols,
+			expected: sqlbase.EncDatumRows{
+				{v[0], v[0], v[1]},
+				{v[0], v[1], v[1]},
+				{v[1], v[0], v[0]},
+				{v[5], v[0], v[2]},
+				{v[6], v[0], v[0]},
+			},
+		},
 	}
 
 	// Add INTERSECT ALL cases with MergeJoinerSpecs.
@@ -694,47 +776,53 @@ func TestMergeJoiner(t *testing.T) {
 		testCases = append(testCases, setOpTestCaseToMergeJoinerTestCase(tc))
 	}
 
-	for _, c := range testCases {
-		t.Run("", func(t *testing.T) {
-			ms := c.spec
-			leftInput := NewRowBuffer(c.leftTypes, c.leftInput, RowBufferArgs{})
-			rightInput := NewRowBuffer(c.rightTypes, c.rightInput, RowBufferArgs{})
-			out := &RowBuffer{}
-			st := cluster.MakeTestingClusterSettings()
-			evalCtx := tree.MakeTestingEvalContext(st)
-			defer evalCtx.Stop(context.Background())
-			flowCtx := FlowCtx{
-				Settings: st,
-				EvalCtx:  &evalCtx,
-			}
+	// Run every case without a batch row limit, and with limits small enough to
+	// split the groups of equal keys into several chunks. The results must be
+	// the same in all cases.
+	for _, batchRowLimit := range []int64{0, 1, 2, 3} {
+		for _, c := range testCases {
+			t.Run(fmt.Sprintf("limit=%d", batchRowLimit), func(t *testing.T) {
+				ms := c.spec
+				leftInput := NewRowBuffer(c.leftTypes, c.leftInput, RowBufferArgs{})
+				rightInput := NewRowBuffer(c.rightTypes, c.rightInput, RowBufferArgs{})
+				out := &RowBuffer{}
+				st := cluster.MakeTestingClusterSettings()
+				settingMergeJoinBatchRowLimit.Override(&st.SV, batchRowLimit)
+				evalCtx := tree.MakeTestingEvalContext(st)
+				defer evalCtx.Stop(context.Background())
+				flowCtx := FlowCtx{
+					Settings: st,
+					EvalCtx:  &evalCtx,
+				}
 
-			post := distsqlpb.PostProcessSpec{Projection: true, OutputColumns: c.outCols}
-			m, err := newMergeJoiner(&flowCtx, 0 /* processorID */, &ms, leftInput, rightInput, &post, out)
-			if err != nil {
-				t.Fatal(err)
-			}
+				post := distsqlpb.PostProcessSpec{Projection: true, OutputColumns: c.outCols}
+				m, err := newMergeJoiner(&flowCtx, 0 /* processorID */, &ms, leftInput, rightInput, &post, out)
+				if err != nil {
+					t.Fatal(err)
+				}
 
-			m.Run(context.Background())
+				m.Run(context.Background())
 
-			if !out.ProducerClosed() {
-				t.Fatalf("output RowReceiver not closed")
-			}
+				if !out.ProducerClosed() {
+					t.Fatalf("output RowReceiver not closed")
+				}
 
-			var retRows sqlbase.EncDatumRows
-			for {
-				row := out.NextNoMeta(t)
-				if row == nil {
-					break
+				var retRows sqlbase.EncDatumRows
+				for {
+					row := out.NextNoMeta(t)
+					if row == nil {
+						break
+					}
+					retRows = append(retRows, row)
 				}
-				retRows = append(retRows, row)
-			}
-			expStr := c.expected.String(c.expectedTypes)
-			retStr := retRows.String(c.expectedTypes)
-			if expStr != retStr {
-				t.Errorf("invalid results; expected:\n   %s\ngot:\n   %s",
-					expStr, retStr)
-			}
-		})
+				expStr := c.expected.String(c.expectedTypes)
+				retStr := retRows.String(c.expectedTypes)
+				if expStr != retStr {
+					t.Errorf("invalid results; expected:\n   %s\ngot:\n   %s",
+						expStr, retStr)
+				}
+			})
+		}
 	}
 }
 
@@ -828,6 +916,243 @@ func TestConsumerClosed(t *testing.T) {
 	}
 }
 
+// TestMergeJoinerRowHook verifies that a RowHook installed in the FlowCtx
+// observes the rows emitted by a merge joiner as well as by its inputs.
+func TestMergeJoinerRowHook(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(ctx)
+	rowCounts := make(map[int32]int)
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+		rowHook: func(processorID int32, _ sqlbase.EncDatumRow) {
+			rowCounts[processorID]++
+		},
+	}
+
+	const (
+		leftID  = 0
+		rightID = 1
+		joinID  = 2
+	)
+	// The left input has rows 0..9 and the right input rows 5..14 so that the
+	// inner join on the first column produces 5 rows.
+	leftRows := sqlbase.MakeIntRows(10, 1)
+	rightRows := make(sqlbase.EncDatumRows, 10)
+	for i := range rightRows {
+		rightRows[i] = sqlbase.EncDatumRow{sqlbase.IntEncDatum(i + 5)}
+	}
+	leftInput := NewRowBuffer(sqlbase.OneIntCol, leftRows, RowBufferArgs{})
+	left, err := newNoopProcessor(&flowCtx, leftID, leftInput, &distsqlpb.PostProcessSpec{}, nil /* output */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rightInput := NewRowBuffer(sqlbase.OneIntCol, rightRows, RowBufferArgs{})
+	right, err := newNoopProcessor(&flowCtx, rightID, rightInput, &distsqlpb.PostProcessSpec{}, nil /* output */)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ordering := distsqlpb.ConvertToSpecOrdering(
+		sqlbase.ColumnOrdering{{ColIdx: 0, Direction: encoding.Ascending}},
+	)
+	spec := distsqlpb.MergeJoinerSpec{
+		LeftOrdering:  ordering,
+		RightOrdering: ordering,
+		Type:          sqlbase.InnerJoin,
+	}
+	out := &RowBuffer{}
+	m, err := newMergeJoiner(&flowCtx, joinID, &spec, left, right, &distsqlpb.PostProcessSpec{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Run(ctx)
+
+	numOutputRows := 0
+	for out.NextNoMeta(t) != nil {
+		numOutputRows++
+	}
+	if numOutputRows != 5 {
+		t.Fatalf("expected 5 output rows, got %d", numOutputRows)
+	}
+	expected := map[int32]int{leftID: 10, rightID: 10, joinID: 5}
+	if !reflect.DeepEqual(expected, rowCounts) {
+		t.Fatalf("expected row counts %v, got %v", expected, rowCounts)
+	}
+}
+
+func TestMergeJoinerMismatchedOrderings(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(ctx)
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	testCases := []struct {
+		left, right sqlbase.ColumnOrdering
+		expected    string
+	}{
+		{
+			left: sqlbase.ColumnOrdering{
+				{ColIdx: 0, Direction: encoding.Ascending},
+				{ColIdx: 1, Direction: encoding.Ascending},
+			},
+			right: sqlbase.ColumnOrdering{
+				{ColIdx: 0, Direction: encoding.Ascending},
+				{ColIdx: 2, Direction: encoding.Descending},
+			},
+			expected: `unmatched column orderings: ordering column 1 is ASC on the left \(column 1\) ` +
+				`but DESC on the right \(column 2\)`,
+		},
+		{
+			left: sqlbase.ColumnOrdering{
+				{ColIdx: 0, Direction: encoding.Ascending},
+				{ColIdx: 1, Direction: encoding.Ascending},
+			},
+			right: sqlbase.ColumnOrdering{
+				{ColIdx: 0, Direction: encoding.Ascending},
+			},
+			expected: `unmatched column orderings: 2 left columns, 1 right columns`,
+		},
+	}
+	for _, tc := range testCases {
+		spec := distsqlpb.MergeJoinerSpec{
+			LeftOrdering:  distsqlpb.ConvertToSpecOrdering(tc.left),
+			RightOrdering: distsqlpb.ConvertToSpecOrdering(tc.right),
+			Type:          sqlbase.InnerJoin,
+		}
+		left := NewRowBuffer(sqlbase.ThreeIntCols, nil /* rows */, RowBufferArgs{})
+		right := NewRowBuffer(sqlbase.ThreeIntCols, nil /* rows */, RowBufferArgs{})
+		_, err := newMergeJoiner(
+			&flowCtx, 0 /* processorID */, &spec, left, right, &distsqlpb.PostProcessSpec{}, &RowBuffer{},
+		)
+		if !testutils.IsError(err, tc.expected) {
+			t.Fatalf("expected error %q, got %v", tc.expected, err)
+		}
+		if code, _ := pgerror.GetPGCode(err); code != pgerror.CodeInternalError {
+			t.Fatalf("expected code %s, got %s", pgerror.CodeInternalError, code)
+		}
+	}
+}
+
+// TestMergeJoinerCloseTwice verifies that closing a merge joiner both from its
+// trailing metadata callback and through ConsumerClosed, in either order,
+// releases its resources exactly once.
+func TestMergeJoinerCloseTwice(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(ctx)
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	ordering := distsqlpb.ConvertToSpecOrdering(
+		sqlbase.ColumnOrdering{{ColIdx: 0, Direction: encoding.Ascending}},
+	)
+	spec := distsqlpb.MergeJoinerSpec{
+		LeftOrdering:  ordering,
+		RightOrdering: ordering,
+		Type:          sqlbase.InnerJoin,
+	}
+	for _, consumerClosedFirst := range []bool{false, true} {
+		t.Run(fmt.Sprintf("consumerClosedFirst=%t", consumerClosedFirst), func(t *testing.T) {
+			allocBefore := evalCtx.Mon.AllocBytes()
+			left := NewRowBuffer(sqlbase.OneIntCol, sqlbase.MakeIntRows(10, 1), RowBufferArgs{})
+			right := NewRowBuffer(sqlbase.OneIntCol, sqlbase.MakeIntRows(10, 1), RowBufferArgs{})
+			m, err := newMergeJoiner(
+				&flowCtx, 0 /* processorID */, &spec, left, right, &distsqlpb.PostProcessSpec{}, nil, /* output */
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.Start(ctx)
+			if row, meta := m.Next(); row == nil || meta != nil {
+				t.Fatalf("expected a row, got %v, %v", row, meta)
+			}
+
+			if consumerClosedFirst {
+				m.ConsumerClosed()
+			}
+			// Draining the joiner runs its trailing metadata callback, which closes
+			// it.
+			for {
+				row, meta := m.Next()
+				if row == nil && meta == nil {
+					break
+				}
+			}
+			m.ConsumerClosed()
+			m.ConsumerClosed()
+
+			if !m.closed {
+				t.Fatal("expected the merge joiner to be closed")
+			}
+			if res := evalCtx.Mon.AllocBytes(); res != allocBefore {
+				t.Fatalf("expected %d bytes allocated after closing, got %d", allocBefore, res)
+			}
+		})
+	}
+}
+
+// TestMergeJoinerRowCounts verifies that the merge joiner counts the rows it
+// reads and emits without a recording span.
+func TestMergeJoinerRowCounts(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(ctx)
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	ordering := distsqlpb.ConvertToSpecOrdering(
+		sqlbase.ColumnOrdering{{ColIdx: 0, Direction: encoding.Ascending}},
+	)
+	spec := distsqlpb.MergeJoinerSpec{
+		LeftOrdering:  ordering,
+		RightOrdering: ordering,
+		Type:          sqlbase.InnerJoin,
+	}
+	makeRows := func(vals ...int) sqlbase.EncDatumRows {
+		rows := make(sqlbase.EncDatumRows, len(vals))
+		for i, v := range vals {
+			rows[i] = sqlbase.EncDatumRow{sqlbase.IntEncDatum(v)}
+		}
+		return rows
+	}
+	left := NewRowBuffer(sqlbase.OneIntCol, makeRows(0, 1, 1, 2, 3), RowBufferArgs{})
+	right := NewRowBuffer(sqlbase.OneIntCol, makeRows(1, 1, 3, 4), RowBufferArgs{})
+	out := &RowBuffer{}
+	m, err := newMergeJoiner(
+		&flowCtx, 0 /* processorID */, &spec, left, right, &distsqlpb.PostProcessSpec{}, out,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Run(ctx)
+
+	expected := ProcessorRowCounts{InputRows: 9, OutputRows: 5}
+	if res := m.RowCounts(); res != expected {
+		t.Fatalf("expected %+v, got %+v", expected, res)
+	}
+}
+
 func BenchmarkMergeJoiner(b *testing.B) {
 	ctx := context.Background()
 	st := cluster.MakeTestingClusterSettings()
@@ -912,3 +1237,101 @@ func BenchmarkMergeJoiner(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkMergeJoinerOnExpr compares the evaluation of a range ON predicate
+// using the specialized filter (see exprHelper.compileSimpleFilter) to its
+// evaluation using the general expression evaluator.
+func BenchmarkMergeJoinerOnExpr(b *testing.B) {
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(ctx)
+	flowCtx := &FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	spec := &distsqlpb.MergeJoinerSpec{
+		LeftOrdering: distsqlpb.ConvertToSpecOrdering(
+			sqlbase.ColumnOrdering{
+				{ColIdx: 0, Direction: encoding.Ascending},
+			}),
+		RightOrdering: distsqlpb.ConvertToSpecOrdering(
+			sqlbase.ColumnOrdering{
+				{ColIdx: 0, Direction: encoding.Ascending},
+			}),
+		Type:   sqlbase.InnerJoin,
+		OnExpr: distsqlpb.Expression{Expr: "@2 >= 10 AND @2 < @4"},
+	}
+	post := &distsqlpb.PostProcessSpec{}
+	disposer := &RowDisposer{}
+
+	// Each group of rows with the same value in the equality column contains
+	// numRepeats rows with distinct values in the second column, so the ON
+	// predicate is evaluated numRepeats^2 times per group.
+	const numRepeats = 64
+	for _, inputSize := range []int{1 << 8, 1 << 12} {
+		rows := make(sqlbase.EncDatumRows, inputSize)
+		for i := range rows {
+			rows[i] = sqlbase.EncDatumRow{sqlbase.IntEncDatum(i / numRepeats), sqlbase.IntEncDatum(i)}
+		}
+		leftInput := NewRepeatableRowSource(sqlbase.TwoIntCols, rows)
+		rightInput := NewRepeatableRowSource(sqlbase.TwoIntCols, rows)
+		for _, specialized := range []bool{false, true} {
+			b.Run(fmt.Sprintf("InputSize=%d/specialized=%t", inputSize, specialized), func(b *testing.B) {
+				b.SetBytes(int64(8 * inputSize * 2 * 2))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					m, err := newMergeJoiner(flowCtx, 0 /* processorID */, spec, leftInput, rightInput, post, disposer)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if m.onCondFn == nil {
+						b.Fatal("expected the ON expression to be specialized")
+					}
+					if !specialized {
+						m.onCondFn = nil
+					}
+					m.Run(context.Background())
+					leftInput.Reset()
+					rightInput.Reset()
+				}
+			})
+		}
+	}
+}
+
+// TestMergeJoinerMatchCountUnsupported verifies that emitting match counts is
+// rejected for join types other than LEFT SEMI and LEFT OUTER joins.
+func TestMergeJoinerMatchCountUnsupported(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(context.Background())
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	for _, joinType := range []sqlbase.JoinType{
+		sqlbase.InnerJoin, sqlbase.RightOuterJoin, sqlbase.FullOuterJoin, sqlbase.LeftAntiJoin,
+	} {
+		spec := distsqlpb.MergeJoinerSpec{
+			LeftOrdering: distsqlpb.ConvertToSpecOrdering(
+				sqlbase.ColumnOrdering{{ColIdx: 0, Direction: encoding.Ascending}}),
+			RightOrdering: distsqlpb.ConvertToSpecOrdering(
+				sqlbase.ColumnOrdering{{ColIdx: 0, Direction: encoding.Ascending}}),
+			Type:           joinType,
+			EmitMatchCount: true,
+		}
+		leftInput := NewRowBuffer(sqlbase.OneIntCol, nil /* rows */, RowBufferArgs{})
+		rightInput := NewRowBuffer(sqlbase.OneIntCol, nil /* rows */, RowBufferArgs{})
+		_, err := newMergeJoiner(
+			&flowCtx, 0 /* processorID */, &spec, leftInput, rightInput, &distsqlpb.PostProcessSpec{}, &RowBuffer{},
+		)
+		if !testutils.IsError(err, "match count is not supported") {
+			t.Errorf("%s: expected error, got %v", joinType, err)
+		}
+	}
+}
@@ -31,6 +31,8 @@ type DistSQLMetrics struct {
 	QueueWaitHist *metric.Histogram
 	MaxBytesHist  *metric.Histogram
 	CurBytesCount *metric.Gauge
+
+	TrailingMetaTruncated *metric.Counter
 }
 
 // MetricStruct implements the metrics.Struct interface.
@@ -87,6 +89,12 @@ var (
 		Measurement: "Memory",
 		Unit:        metric.Unit_BYTES,
 	}
+	metaTrailingMetaTruncated = metric.Metadata{
+		Name:        "sql.distsql.flows.trailing_metadata_truncated",
+		Help:        "Number of pieces of trace data dropped because a flow exceeded its trailing metadata limit",
+		Measurement: "Trace Data",
+		Unit:        metric.Unit_COUNT,
+	}
 )
 
 // See pkg/sql/mem_metrics.go
@@ -104,6 +112,8 @@ func MakeDistSQLMetrics(histogramWindow time.Duration) DistSQLMetrics {
 		QueueWaitHist: metric.NewLatency(metaQueueWaitHist, histogramWindow),
 		MaxBytesHist:  metric.NewHistogram(metaMemMaxBytes, histogramWindow, log10int64times1000, 3),
 		CurBytesCount: metric.NewGauge(metaMemCurBytes),
+
+		TrailingMetaTruncated: metric.NewCounter(metaTrailingMetaTruncated),
 	}
 }
 
@@ -67,7 +67,7 @@ func (n *noopProcessor) Start(ctx context.Context) context.Context {
 // Next is part of the RowSource interface.
 func (n *noopProcessor) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
 	for n.State == StateRunning {
-		row, meta := n.input.Next()
+		row, meta := n.InputNext(n.input)
 
 		if meta != nil {
 			if meta.Err != nil {
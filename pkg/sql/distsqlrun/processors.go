@@ -396,6 +396,20 @@ func (h *ProcOutputHelper) consumerClosed() {
 	h.rowIdx = h.maxRowIdx
 }
 
+// memoryMonitoredProcessor is implemented by processors that account for
+// their memory usage with a monitor of their own (i.e. all processors that
+// embed a ProcessorBase). The monitor is nil if the processor doesn't use one.
+type memoryMonitoredProcessor interface {
+	memMonitor() *mon.BytesMonitor
+}
+
+// statsProcessor is implemented by processors that can report the stats they
+// collected during execution (i.e. all processors that embed a
+// ProcessorBase).
+type statsProcessor interface {
+	procStats() ProcessorStats
+}
+
 // ProcessorBase is supposed to be embedded by Processors. It provides
 // facilities for dealing with filtering and projection (through a
 // ProcOutputHelper) and for implementing the RowSource interface (draining,
@@ -450,9 +464,9 @@ func (h *ProcOutputHelper) consumerClosed() {
 //       var row sqlbase.EncDatumRow
 //       var meta *ProducerMetadata
 //       if !p.leftConsumed {
-//         row, meta = p.l.Next()
+//         row, meta = p.InputNext(p.l)
 //       } else {
-//         row, meta = p.r.Next()
+//         row, meta = p.InputNext(p.r)
 //       }
 //
 //       if meta != nil {
@@ -547,6 +561,9 @@ type ProcessorBase struct {
 	// later.
 	trailingMeta []distsqlpb.ProducerMetadata
 
+	// rowHook is the FlowCtx's RowHook, cached at initialization.
+	rowHook RowHook
+
 	// inputsToDrain, if not empty, contains inputs to be drained by
 	// DrainHelper(). MoveToDraining() calls ConsumerDone() on them,
 	// InternalClose() calls ConsumerClosed() on then.
@@ -555,6 +572,71 @@ type ProcessorBase struct {
 	// one by one (in stateDraining, inputsToDrain[0] is the one currently being
 	// drained).
 	inputsToDrain []RowSource
+
+	// rowCounts are maintained whether or not the processor's span is
+	// recording.
+	rowCounts ProcessorRowCounts
+
+	// name is the name of the processor's span, set by StartInternal().
+	name string
+	// spanStats are the stats set on the processor's span by setSpanStats(), if
+	// any.
+	spanStats distsqlpb.DistSQLSpanStats
+}
+
+// ProcessorRowCounts are basic row counts that are maintained by processors
+// built on ProcessorBase independently of tracing, so that they can be read
+// cheaply after the flow completes through Flow.Stats().
+type ProcessorRowCounts struct {
+	// InputRows is the number of rows read from the processor's inputs through
+	// InputNext or addInputRows. All the processors that have inputs read them
+	// this way; processors that read from KV instead (table readers, the
+	// interleaved reader joiner, the zigzag joiner) don't report input rows.
+	InputRows int64
+	// OutputRows is the number of rows emitted by ProcessRowHelper, after
+	// post-processing.
+	OutputRows int64
+}
+
+// RowCounts returns the row counts of the processor.
+func (pb *ProcessorBase) RowCounts() ProcessorRowCounts {
+	return pb.rowCounts
+}
+
+// InputNext returns the next row or metadata from the given input of the
+// processor, counting the row in the processor's row counts. Processors should
+// read their inputs through it rather than calling Next on them directly.
+func (pb *ProcessorBase) InputNext(
+	input RowSource,
+) (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
+	row, meta := input.Next()
+	if row != nil {
+		pb.rowCounts.InputRows++
+	}
+	return row, meta
+}
+
+// addInputRows adds n rows to the processor's input row count, for processors
+// that don't read their inputs through InputNext.
+func (pb *ProcessorBase) addInputRows(n int) {
+	pb.rowCounts.InputRows += int64(n)
+}
+
+// setSpanStats sets the stats on the processor's span and retains them so
+// that they can be retrieved through Flow.Stats().
+func (pb *ProcessorBase) setSpanStats(sp opentracing.Span, stats distsqlpb.DistSQLSpanStats) {
+	pb.spanStats = stats
+	tracing.SetSpanStats(sp, stats)
+}
+
+// procStats is part of the statsProcessor interface.
+func (pb *ProcessorBase) procStats() ProcessorStats {
+	return ProcessorStats{
+		ProcessorID: pb.processorID,
+		Name:        pb.name,
+		Stats:       pb.spanStats,
+		RowCounts:   pb.rowCounts,
+	}
 }
 
 // Reset resets this ProcessorBase, retaining allocated memory in slices.
@@ -746,6 +828,7 @@ func (pb *ProcessorBase) moveToTrailingMeta() {
 	}
 
 	pb.State = stateTrailingMeta
+	start := len(pb.trailingMeta)
 	if pb.span != nil {
 		if trace := getTraceData(pb.Ctx); trace != nil {
 			pb.trailingMeta = append(pb.trailingMeta, distsqlpb.ProducerMetadata{TraceData: trace})
@@ -759,6 +842,12 @@ func (pb *ProcessorBase) moveToTrailingMeta() {
 	} else {
 		pb.InternalClose()
 	}
+	// Drop whatever trailing metadata doesn't fit in the flow's budget.
+	if pb.flowCtx != nil && pb.flowCtx.trailingMetaBudget != nil {
+		pb.trailingMeta = append(
+			pb.trailingMeta[:start], pb.flowCtx.trailingMetaBudget.filter(pb.Ctx, pb.trailingMeta[start:])...,
+		)
+	}
 }
 
 // ProcessRowHelper is a wrapper on top of ProcOutputHelper.ProcessRow(). It
@@ -778,15 +867,32 @@ func (pb *ProcessorBase) ProcessRowHelper(row sqlbase.EncDatumRow) sqlbase.EncDa
 	if !ok {
 		pb.MoveToDraining(nil /* err */)
 	}
+	if outRow != nil {
+		pb.rowCounts.OutputRows++
+		if pb.rowHook != nil {
+			pb.rowHook(pb.processorID, outRow)
+		}
+	}
 	// Note that outRow might be nil here.
 	return outRow
 }
 
+// RowHook is a function that is invoked with every row emitted by a processor
+// through ProcessorBase.ProcessRowHelper, along with the ID of the processor.
+// It is meant for tests and diagnostics that need to observe the data flowing
+// through a flow. The row must not be modified or retained past the call.
+type RowHook func(processorID int32, row sqlbase.EncDatumRow)
+
 // OutputTypes is part of the processor interface.
 func (pb *ProcessorBase) OutputTypes() []types.T {
 	return pb.out.outputTypes
 }
 
+// memMonitor is part of the memoryMonitoredProcessor interface.
+func (pb *ProcessorBase) memMonitor() *mon.BytesMonitor {
+	return pb.MemMonitor
+}
+
 // Run is part of the processor interface.
 func (pb *ProcessorBase) Run(ctx context.Context) {
 	if pb.out.output == nil {
@@ -841,6 +947,9 @@ func (pb *ProcessorBase) InitWithEvalCtx(
 	pb.flowCtx = flowCtx
 	pb.evalCtx = evalCtx
 	pb.processorID = processorID
+	if flowCtx != nil {
+		pb.rowHook = flowCtx.rowHook
+	}
 	pb.MemMonitor = memMonitor
 	pb.trailingMetaCallback = opts.TrailingMetaCallback
 	pb.inputsToDrain = opts.InputsToDrain
@@ -863,6 +972,7 @@ func (pb *ProcessorBase) AppendTrailingMeta(meta distsqlpb.ProducerMetadata) {
 // annotated context that's also stored in pb.ctx.
 func (pb *ProcessorBase) StartInternal(ctx context.Context, name string) context.Context {
 	pb.Ctx = ctx
+	pb.name = name
 
 	pb.origCtx = pb.Ctx
 	pb.Ctx, pb.span = processorSpan(pb.Ctx, name)
@@ -16,11 +16,16 @@ package distsqlrun
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/builtins"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	opentracing "github.com/opentracing/opentracing-go"
 )
 
 // projectSetProcessor is the physical processor implementation of
@@ -58,9 +63,24 @@ type projectSetProcessor struct {
 	// thus also whether NULLs should be emitted instead.
 	done []bool
 
+	// genRowCounts contains for each `expr` the number of rows produced by its
+	// generator for the current input row. It is only maintained when the spec
+	// limits the number of rows per generator.
+	genRowCounts []uint64
+
 	// emitCount is used to track the number of rows that have been
 	// emitted from Next().
 	emitCount int64
+
+	// cancelCheckInterval is the number of iterations of Next() between
+	// checks for cancellation.
+	cancelCheckInterval int64
+
+	// stats tracks the number of input rows consumed and of rows produced by
+	// the generators. curOutputRows is the number of rows produced for the
+	// current input row so far.
+	stats         ProjectSetStats
+	curOutputRows int64
 }
 
 var _ Processor = &projectSetProcessor{}
@@ -68,6 +88,10 @@ var _ RowSource = &projectSetProcessor{}
 
 const projectSetProcName = "projectSet"
 
+// defaultProjectSetCancelCheckInterval is the number of iterations between
+// checks for cancellation used when the ProjectSetSpec doesn't specify one.
+const defaultProjectSetCancelCheckInterval = 10000
+
 func newProjectSetProcessor(
 	flowCtx *FlowCtx,
 	processorID int32,
@@ -85,6 +109,14 @@ func newProjectSetProcessor(
 		rowBuffer:   make(sqlbase.EncDatumRow, len(outputTypes)),
 		gens:        make([]tree.ValueGenerator, len(spec.Exprs)),
 		done:        make([]bool, len(spec.Exprs)),
+
+		cancelCheckInterval: defaultProjectSetCancelCheckInterval,
+	}
+	if spec.CancelCheckInterval != 0 {
+		ps.cancelCheckInterval = int64(spec.CancelCheckInterval)
+	}
+	if spec.MaxRowsPerGenerator != 0 {
+		ps.genRowCounts = make([]uint64, len(spec.Exprs))
 	}
 	if err := ps.Init(
 		ps,
@@ -98,6 +130,10 @@ func newProjectSetProcessor(
 	); err != nil {
 		return nil, err
 	}
+
+	if sp := opentracing.SpanFromContext(flowCtx.EvalCtx.Ctx()); sp != nil && tracing.IsRecording(sp) {
+		ps.finishTrace = ps.outputStatsToTrace
+	}
 	return ps, nil
 }
 
@@ -130,7 +166,7 @@ func (ps *projectSetProcessor) nextInputRow() (
 	*distsqlpb.ProducerMetadata,
 	error,
 ) {
-	row, meta := ps.input.Next()
+	row, meta := ps.InputNext(ps.input)
 	if row == nil {
 		return nil, meta, nil
 	}
@@ -157,6 +193,9 @@ func (ps *projectSetProcessor) nextInputRow() (
 			ps.gens[i] = gen
 		}
 		ps.done[i] = false
+		if ps.genRowCounts != nil {
+			ps.genRowCounts[i] = 0
+		}
 	}
 
 	return row, nil, nil
@@ -178,6 +217,14 @@ func (ps *projectSetProcessor) nextGeneratorValues() (newValAvail bool, err erro
 					return false, err
 				}
 				if hasVals {
+					if ps.genRowCounts != nil {
+						ps.genRowCounts[i]++
+						if ps.genRowCounts[i] > ps.spec.MaxRowsPerGenerator {
+							return false, pgerror.Newf(pgerror.CodeProgramLimitExceededError,
+								"generator %s produced more than %d rows",
+								ps.exprHelpers[i].expr, ps.spec.MaxRowsPerGenerator)
+						}
+					}
 					// This source has values, use them.
 					for _, value := range gen.Values() {
 						ps.rowBuffer[colIdx] = ps.toEncDatum(value, colIdx)
@@ -221,13 +268,11 @@ func (ps *projectSetProcessor) nextGeneratorValues() (newValAvail bool, err erro
 
 // Next is part of the RowSource interface.
 func (ps *projectSetProcessor) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
-	const cancelCheckCount = 10000
-
 	for ps.State == StateRunning {
 
 		// Occasionally check for cancellation.
 		ps.emitCount++
-		if ps.emitCount%cancelCheckCount == 0 {
+		if ps.emitCount%ps.cancelCheckInterval == 0 {
 			if err := ps.Ctx.Err(); err != nil {
 				ps.MoveToDraining(err)
 				return nil, ps.DrainHelper()
@@ -256,6 +301,8 @@ func (ps *projectSetProcessor) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerM
 			// Keep the values for later.
 			copy(ps.rowBuffer, row)
 			ps.inputRowReady = true
+			ps.stats.NumInputRows++
+			ps.curOutputRows = 0
 		}
 
 		// Try to find some data on the generator side.
@@ -265,6 +312,11 @@ func (ps *projectSetProcessor) Next() (sqlbase.EncDatumRow, *distsqlpb.ProducerM
 			return nil, ps.DrainHelper()
 		}
 		if newValAvail {
+			ps.stats.NumOutputRows++
+			ps.curOutputRows++
+			if ps.curOutputRows > ps.stats.MaxOutputRowsPerInputRow {
+				ps.stats.MaxOutputRowsPerInputRow = ps.curOutputRows
+			}
 			if outRow := ps.ProcessRowHelper(ps.rowBuffer); outRow != nil {
 				return outRow, nil
 			}
@@ -288,3 +340,46 @@ func (ps *projectSetProcessor) ConsumerClosed() {
 	// The consumer is done, Next() will not be called again.
 	ps.InternalClose()
 }
+
+var _ distsqlpb.DistSQLSpanStats = &ProjectSetStats{}
+
+const projectSetTagPrefix = "projectset."
+
+// avgOutputRowsPerInputRow returns the average number of rows produced by the
+// generators for each input row.
+func (pss *ProjectSetStats) avgOutputRowsPerInputRow() float64 {
+	if pss.NumInputRows == 0 {
+		return 0
+	}
+	return float64(pss.NumOutputRows) / float64(pss.NumInputRows)
+}
+
+// Stats implements the SpanStats interface.
+func (pss *ProjectSetStats) Stats() map[string]string {
+	return map[string]string{
+		projectSetTagPrefix + rowsReadTagSuffix: strconv.FormatInt(pss.NumInputRows, 10),
+		projectSetTagPrefix + "output.rows":     strconv.FormatInt(pss.NumOutputRows, 10),
+		projectSetTagPrefix + "output.rows.avg": fmt.Sprintf("%.2f", pss.avgOutputRowsPerInputRow()),
+		projectSetTagPrefix + "output.rows.max": strconv.FormatInt(pss.MaxOutputRowsPerInputRow, 10),
+	}
+}
+
+// StatsForQueryPlan implements the DistSQLSpanStats interface.
+func (pss *ProjectSetStats) StatsForQueryPlan() []string {
+	return []string{
+		fmt.Sprintf("%s: %d", rowsReadQueryPlanSuffix, pss.NumInputRows),
+		fmt.Sprintf("rows generated: %d", pss.NumOutputRows),
+		fmt.Sprintf("avg rows generated per input row: %.2f", pss.avgOutputRowsPerInputRow()),
+		fmt.Sprintf("max rows generated per input row: %d", pss.MaxOutputRowsPerInputRow),
+	}
+}
+
+// outputStatsToTrace outputs the collected projectSetProcessor stats to the
+// trace. Will fail silently if the projectSetProcessor is not collecting
+// stats.
+func (ps *projectSetProcessor) outputStatsToTrace() {
+	if sp := opentracing.SpanFromContext(ps.Ctx); sp != nil {
+		stats := ps.stats
+		ps.setSpanStats(sp, &stats)
+	}
+}
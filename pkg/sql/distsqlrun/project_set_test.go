@@ -16,13 +16,17 @@ package distsqlrun
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 )
 
@@ -121,6 +125,203 @@ func TestProjectSet(t *testing.T) {
 	}
 }
 
+// TestProjectSetStats verifies that the projectSetProcessor tracks the number
+// of rows produced by its generators per input row.
+func TestProjectSetStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(context.Background())
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	spec := distsqlpb.ProjectSetSpec{
+		Exprs: []distsqlpb.Expression{
+			{Expr: "generate_series(@1, 2)"},
+		},
+		GeneratedColumns: sqlbase.OneIntCol,
+		NumColsPerGen:    []uint32{1},
+	}
+	input := sqlbase.EncDatumRows{
+		{sqlbase.IntEncDatum(0)},
+		{sqlbase.IntEncDatum(1)},
+		{sqlbase.IntEncDatum(3)},
+	}
+	in := NewRowBuffer(sqlbase.OneIntCol, input, RowBufferArgs{})
+	out := &RowBuffer{}
+	ps, err := newProjectSetProcessor(&flowCtx, 0 /* processorID */, &spec, in, &distsqlpb.PostProcessSpec{}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.Run(context.Background())
+
+	expected := ProjectSetStats{NumInputRows: 3, NumOutputRows: 5, MaxOutputRowsPerInputRow: 3}
+	if ps.stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, ps.stats)
+	}
+	expectedPlan := []string{
+		"rows read: 3",
+		"rows generated: 5",
+		"avg rows generated per input row: 1.67",
+		"max rows generated per input row: 3",
+	}
+	if res := ps.stats.StatsForQueryPlan(); !reflect.DeepEqual(res, expectedPlan) {
+		t.Fatalf("expected %v, got %v", expectedPlan, res)
+	}
+	// The row counts are maintained even though the span isn't recording.
+	expectedCounts := ProcessorRowCounts{InputRows: 3, OutputRows: 5}
+	if res := ps.RowCounts(); res != expectedCounts {
+		t.Fatalf("expected %+v, got %+v", expectedCounts, res)
+	}
+}
+
+// TestProjectSetCancelCheckInterval verifies that the projectSetProcessor
+// checks for cancellation at the interval specified by its spec.
+func TestProjectSetCancelCheckInterval(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(context.Background())
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	for _, tc := range []struct {
+		interval uint32
+		// expectedRows is the number of rows emitted before the cancellation is
+		// noticed.
+		expectedRows int
+	}{
+		{interval: 1, expectedRows: 0},
+		{interval: 5, expectedRows: 4},
+		// The default interval is larger than the number of rows generated.
+		{interval: 0, expectedRows: 10},
+	} {
+		t.Run(fmt.Sprintf("interval=%d", tc.interval), func(t *testing.T) {
+			spec := distsqlpb.ProjectSetSpec{
+				Exprs: []distsqlpb.Expression{
+					{Expr: "generate_series(1, 10)"},
+				},
+				GeneratedColumns:    sqlbase.OneIntCol,
+				NumColsPerGen:       []uint32{1},
+				CancelCheckInterval: tc.interval,
+			}
+			in := NewRowBuffer(sqlbase.OneIntCol, sqlbase.EncDatumRows{{sqlbase.IntEncDatum(0)}}, RowBufferArgs{})
+			ps, err := newProjectSetProcessor(&flowCtx, 0 /* processorID */, &spec, in, &distsqlpb.PostProcessSpec{}, nil /* output */)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			ps.Start(ctx)
+
+			var rows int
+			for {
+				row, meta := ps.Next()
+				if meta != nil {
+					if tc.interval == 0 {
+						t.Fatalf("unexpected metadata %v", meta)
+					}
+					if meta.Err != context.Canceled {
+						t.Fatalf("expected %v, got %v", context.Canceled, meta.Err)
+					}
+					break
+				}
+				if row == nil {
+					break
+				}
+				rows++
+			}
+			if rows != tc.expectedRows {
+				t.Fatalf("expected %d rows before cancellation, got %d", tc.expectedRows, rows)
+			}
+		})
+	}
+}
+
+// TestProjectSetMaxRowsPerGenerator verifies that the projectSetProcessor
+// stops with an error when a generator produces more rows for a single input
+// row than its spec allows.
+func TestProjectSetMaxRowsPerGenerator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	st := cluster.MakeTestingClusterSettings()
+	evalCtx := tree.MakeTestingEvalContext(st)
+	defer evalCtx.Stop(context.Background())
+	flowCtx := FlowCtx{
+		Settings: st,
+		EvalCtx:  &evalCtx,
+	}
+
+	for _, tc := range []struct {
+		maxRows uint64
+		// expectedRows is the number of rows emitted before the limit is hit.
+		expectedRows int
+		expectedErr  string
+	}{
+		{maxRows: 3, expectedRows: 3, expectedErr: `generator generate_series\(@1, 10\) produced more than 3 rows`},
+		// Each input row produces at most 10 rows.
+		{maxRows: 10, expectedRows: 20},
+		// Zero means no limit.
+		{maxRows: 0, expectedRows: 20},
+	} {
+		t.Run(fmt.Sprintf("max=%d", tc.maxRows), func(t *testing.T) {
+			spec := distsqlpb.ProjectSetSpec{
+				Exprs: []distsqlpb.Expression{
+					{Expr: "generate_series(@1, 10)"},
+					{Expr: "generate_series(1, 2)"},
+				},
+				GeneratedColumns:    sqlbase.TwoIntCols,
+				NumColsPerGen:       []uint32{1, 1},
+				MaxRowsPerGenerator: tc.maxRows,
+			}
+			input := sqlbase.EncDatumRows{
+				{sqlbase.IntEncDatum(1)},
+				{sqlbase.IntEncDatum(1)},
+			}
+			in := NewRowBuffer(sqlbase.OneIntCol, input, RowBufferArgs{})
+			ps, err := newProjectSetProcessor(&flowCtx, 0 /* processorID */, &spec, in, &distsqlpb.PostProcessSpec{}, nil /* output */)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ps.Start(context.Background())
+
+			var rows int
+			var metaErr error
+			for {
+				row, meta := ps.Next()
+				if meta != nil {
+					if meta.Err != nil {
+						metaErr = meta.Err
+					}
+					continue
+				}
+				if row == nil {
+					break
+				}
+				rows++
+			}
+			if rows != tc.expectedRows {
+				t.Fatalf("expected %d rows, got %d", tc.expectedRows, rows)
+			}
+			if !testutils.IsError(metaErr, tc.expectedErr) {
+				t.Fatalf("expected error %q, got %v", tc.expectedErr, metaErr)
+			}
+			if tc.expectedErr != "" {
+				if code, _ := pgerror.GetPGCode(metaErr); code != pgerror.CodeProgramLimitExceededError {
+					t.Fatalf("expected code %s, got %s", pgerror.CodeProgramLimitExceededError, code)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkProjectSet(b *testing.B) {
 	defer leaktest.AfterTest(b)()
 
@@ -133,6 +334,17 @@ func BenchmarkProjectSet(b *testing.B) {
 		v[i] = sqlbase.IntEncDatum(i)
 	}
 
+	// wideInput is a few rows of 100 columns, each of which is repeated in
+	// every row generated from it.
+	const wideInputCols = 100
+	wideInput := make(sqlbase.EncDatumRows, 10)
+	for i := range wideInput {
+		wideInput[i] = make(sqlbase.EncDatumRow, wideInputCols)
+		for j := range wideInput[i] {
+			wideInput[i][j] = v[j%len(v)]
+		}
+	}
+
 	benchCases := []struct {
 		description string
 		spec        distsqlpb.ProjectSetSpec
@@ -153,6 +365,18 @@ func BenchmarkProjectSet(b *testing.B) {
 			},
 			inputTypes: sqlbase.OneIntCol,
 		},
+		{
+			description: "wide input",
+			spec: distsqlpb.ProjectSetSpec{
+				Exprs: []distsqlpb.Expression{
+					{Expr: "generate_series(1, 1000)"},
+				},
+				GeneratedColumns: sqlbase.OneIntCol,
+				NumColsPerGen:    []uint32{1},
+			},
+			input:      wideInput,
+			inputTypes: intCols(wideInputCols),
+		},
 	}
 
 	for _, c := range benchCases {
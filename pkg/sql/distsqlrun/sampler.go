@@ -190,7 +190,7 @@ func (s *samplerProcessor) mainLoop(ctx context.Context) (earlyExit bool, err er
 	rowCount := 0
 	lastWakeupTime := timeutil.Now()
 	for {
-		row, meta := s.input.Next()
+		row, meta := s.InputNext(s.input)
 		if meta != nil {
 			if !emitHelper(ctx, &s.out, nil /* row */, meta, s.pushTrailingMeta, s.input) {
 				// No cleanup required; emitHelper() took care of it.
@@ -76,7 +76,7 @@ import (
 //
 // ATTENTION: When updating these fields, add to version_history.txt explaining
 // what changed.
-const Version distsqlpb.DistSQLVersion = 23
+const Version distsqlpb.DistSQLVersion = 26
 
 // MinAcceptedVersion is the oldest version that the server is
 // compatible with; see above.
@@ -236,8 +236,9 @@ func (ds *ServerImpl) Start() {
 }
 
 // Drain changes the node's draining state through gossip and drains the
-// server's flowRegistry. See flowRegistry.Drain for more details.
-func (ds *ServerImpl) Drain(ctx context.Context, flowDrainWait time.Duration) {
+// server's flowRegistry. See flowRegistry.Drain for more details, including
+// how the reason is reported.
+func (ds *ServerImpl) Drain(ctx context.Context, flowDrainWait time.Duration, reason string) {
 	if err := ds.setDraining(true); err != nil {
 		log.Warningf(ctx, "unable to gossip distsql draining state: %s", err)
 	}
@@ -252,7 +253,7 @@ func (ds *ServerImpl) Drain(ctx context.Context, flowDrainWait time.Duration) {
 		// wait a minimum time for the draining state to be gossiped.
 		minWait = 0
 	}
-	ds.flowRegistry.Drain(flowWait, minWait)
+	ds.flowRegistry.Drain(flowWait, minWait, reason)
 }
 
 // Undrain changes the node's draining state through gossip and undrains the
@@ -297,7 +298,11 @@ func (ds *ServerImpl) setupFlow(
 	req *distsqlpb.SetupFlowRequest,
 	syncFlowConsumer RowReceiver,
 	localState LocalState,
+	setupDeadline time.Time,
 ) (context.Context, *Flow, error) {
+	if err := checkFlowSetupDeadline(setupDeadline); err != nil {
+		return ctx, nil, err
+	}
 	if !FlowVerIsCompatible(req.Version, MinAcceptedVersion, Version) {
 		err := errors.Errorf(
 			"version mismatch in flow request: %d; this node accepts %d through %d",
@@ -458,8 +463,13 @@ func (ds *ServerImpl) setupFlow(
 		JobRegistry:    ds.JobRegistry,
 		traceKV:        req.TraceKV,
 		local:          localState.IsLocal,
+		trailingMetaBudget: newTrailingMetaBudget(
+			settingFlowMaxTrailingMetaBytes.Get(&ds.Settings.SV), ds.Metrics.TrailingMetaTruncated,
+		),
+		rowHook: ds.TestingKnobs.RowHook,
 	}
 	f := newFlow(flowCtx, ds.flowRegistry, syncFlowConsumer, localState.LocalProcs)
+	f.setupDeadline = setupDeadline
 	if err := f.setup(ctx, &req.Flow); err != nil {
 		log.Errorf(ctx, "error setting up flow: %s", err)
 		tracing.FinishSpan(sp)
@@ -476,6 +486,9 @@ func (ds *ServerImpl) setupFlow(
 // SetupSyncFlow sets up a synchronous flow, connecting the sync response
 // output stream to the given RowReceiver. The flow is not started. The flow
 // will be associated with the given context.
+// If deadline is not zero, a query canceled error is returned if the flow
+// cannot be set up before the deadline, and the flow fails to start if it is
+// started after the deadline.
 // Note: the returned context contains a span that must be finished through
 // Flow.Cleanup.
 func (ds *ServerImpl) SetupSyncFlow(
@@ -483,8 +496,12 @@ func (ds *ServerImpl) SetupSyncFlow(
 	parentMonitor *mon.BytesMonitor,
 	req *distsqlpb.SetupFlowRequest,
 	output RowReceiver,
+	deadline time.Time,
 ) (context.Context, *Flow, error) {
-	return ds.setupFlow(ds.AnnotateCtx(ctx), opentracing.SpanFromContext(ctx), parentMonitor, req, output, LocalState{})
+	return ds.setupFlow(
+		ds.AnnotateCtx(ctx), opentracing.SpanFromContext(ctx), parentMonitor, req, output, LocalState{},
+		deadline,
+	)
 }
 
 // LocalState carries information that is required to set up a flow with wrapped
@@ -515,7 +532,10 @@ func (ds *ServerImpl) SetupLocalSyncFlow(
 	output RowReceiver,
 	localState LocalState,
 ) (context.Context, *Flow, error) {
-	return ds.setupFlow(ctx, opentracing.SpanFromContext(ctx), parentMonitor, req, output, localState)
+	return ds.setupFlow(
+		ctx, opentracing.SpanFromContext(ctx), parentMonitor, req, output, localState,
+		time.Time{}, /* setupDeadline */
+	)
 }
 
 // RunSyncFlow is part of the DistSQLServer interface.
@@ -531,7 +551,9 @@ func (ds *ServerImpl) RunSyncFlow(stream distsqlpb.DistSQL_RunSyncFlowServer) er
 		return pgerror.AssertionFailedf("first message in RunSyncFlow doesn't contain SetupFlowRequest")
 	}
 	req := firstMsg.SetupFlowRequest
-	ctx, f, err := ds.SetupSyncFlow(stream.Context(), &ds.memMonitor, req, mbox)
+	// The deadline of the RPC, if any, bounds the setup of the flow.
+	setupDeadline, _ := stream.Context().Deadline()
+	ctx, f, err := ds.SetupSyncFlow(stream.Context(), &ds.memMonitor, req, mbox, setupDeadline)
 	if err != nil {
 		return err
 	}
@@ -560,11 +582,17 @@ func (ds *ServerImpl) SetupFlow(
 ) (*distsqlpb.SimpleResponse, error) {
 	log.VEventf(ctx, 1, "received SetupFlow request from n%v for flow %v", req.Flow.Gateway, req.Flow.FlowID)
 	parentSpan := opentracing.SpanFromContext(ctx)
+	// The deadline of the RPC, if any, bounds the setup of the flow, including
+	// the time it spends queued in the flow scheduler.
+	setupDeadline, _ := ctx.Deadline()
 
 	// Note: the passed context will be canceled when this RPC completes, so we
 	// can't associate it with the flow.
 	ctx = ds.AnnotateCtx(context.Background())
-	ctx, f, err := ds.setupFlow(ctx, parentSpan, &ds.memMonitor, req, nil /* syncFlowConsumer */, LocalState{})
+	ctx, f, err := ds.setupFlow(
+		ctx, parentSpan, &ds.memMonitor, req, nil /* syncFlowConsumer */, LocalState{},
+		setupDeadline,
+	)
 	if err == nil {
 		err = ds.flowScheduler.ScheduleFlow(ctx, f)
 	}
@@ -655,6 +683,10 @@ type TestingKnobs struct {
 
 	// Changefeed contains testing knobs specific to the changefeed system.
 	Changefeed base.ModuleTestingKnobs
+
+	// RowHook, if set, is installed in the FlowCtx of every flow set up by the
+	// server and is invoked for each row emitted by a processor.
+	RowHook RowHook
 }
 
 // MetadataTestLevel represents the types of queries where metadata test
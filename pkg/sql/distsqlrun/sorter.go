@@ -69,12 +69,8 @@ func (s *sorterBase) init(
 	if useTempStorage {
 		// Limit the memory use by creating a child monitor with a hard limit.
 		// The processor will overflow to disk if this limit is not enough.
-		limit := flowCtx.testingKnobs.MemoryLimitBytes
-		if limit <= 0 {
-			limit = settingWorkMemBytes.Get(&flowCtx.Settings.SV)
-		}
 		limitedMon := mon.MakeMonitorInheritWithLimit(
-			"sortall-limited", limit, flowCtx.EvalCtx.Mon,
+			"sortall-limited", flowCtx.SpillThresholdBytes(), flowCtx.EvalCtx.Mon,
 		)
 		limitedMon.Start(ctx, flowCtx.EvalCtx.Mon, mon.BoundAccount{})
 		memMonitor = &limitedMon
@@ -182,7 +178,7 @@ func (s *sorterBase) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(s.Ctx); sp != nil {
-		tracing.SetSpanStats(
+		s.setSpanStats(
 			sp,
 			&SorterStats{
 				InputStats:       is,
@@ -305,7 +301,7 @@ func (s *sortAllProcessor) fill() (ok bool, _ error) {
 	ctx := s.evalCtx.Ctx()
 
 	for {
-		row, meta := s.input.Next()
+		row, meta := s.InputNext(s.input)
 		if meta != nil {
 			s.trailingMeta = append(s.trailingMeta, *meta)
 			if meta.Err != nil {
@@ -409,7 +405,7 @@ func (s *sortTopKProcessor) Start(ctx context.Context) context.Context {
 	// of size at most K, and only sort those.
 	heapCreated := false
 	for {
-		row, meta := s.input.Next()
+		row, meta := s.InputNext(s.input)
 		if meta != nil {
 			s.trailingMeta = append(s.trailingMeta, *meta)
 			if meta.Err != nil {
@@ -533,7 +529,7 @@ func (s *sortChunksProcessor) fill() (bool, error) {
 	nextChunkRow := s.nextChunkRow
 	s.nextChunkRow = nil
 	for nextChunkRow == nil {
-		nextChunkRow, meta = s.input.Next()
+		nextChunkRow, meta = s.InputNext(s.input)
 		if meta != nil {
 			s.trailingMeta = append(s.trailingMeta, *meta)
 			if meta.Err != nil {
@@ -555,7 +551,7 @@ func (s *sortChunksProcessor) fill() (bool, error) {
 	// We will accumulate rows to form a chunk such that they all share the same values
 	// as prefix for the first s.matchLen ordering columns.
 	for {
-		nextChunkRow, meta = s.input.Next()
+		nextChunkRow, meta = s.InputNext(s.input)
 
 		if meta != nil {
 			s.trailingMeta = append(s.trailingMeta, *meta)
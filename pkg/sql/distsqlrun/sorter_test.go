@@ -373,6 +373,69 @@ func TestSorter(t *testing.T) {
 	}
 }
 
+// TestSorterSpillThresholdSetting verifies that the
+// sql.distsql.temp_storage.workmem cluster setting, as exposed by
+// FlowCtx.SpillThresholdBytes, controls when a sorter spills to disk.
+func TestSorterSpillThresholdSetting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ordering := distsqlpb.ConvertToSpecOrdering(
+		sqlbase.ColumnOrdering{{ColIdx: 0, Direction: encoding.Descending}},
+	)
+	for _, threshold := range []int64{1, 1 << 20} {
+		t.Run(fmt.Sprintf("threshold=%d", threshold), func(t *testing.T) {
+			ctx := context.Background()
+			st := cluster.MakeTestingClusterSettings()
+			settingWorkMemBytes.Override(&st.SV, threshold)
+			tempEngine, err := engine.NewTempEngine(base.DefaultTestTempStorageConfig(st), base.DefaultTestStoreSpec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tempEngine.Close()
+
+			evalCtx := tree.MakeTestingEvalContext(st)
+			defer evalCtx.Stop(ctx)
+			diskMonitor := makeTestDiskMonitor(ctx, st)
+			defer diskMonitor.Stop(ctx)
+			flowCtx := FlowCtx{
+				EvalCtx:     &evalCtx,
+				Settings:    st,
+				TempStorage: tempEngine,
+				diskMonitor: diskMonitor,
+			}
+			if res := flowCtx.SpillThresholdBytes(); res != threshold {
+				t.Fatalf("expected a spill threshold of %d, got %d", threshold, res)
+			}
+
+			in := NewRowBuffer(sqlbase.OneIntCol, sqlbase.MakeIntRows(100, 1), RowBufferArgs{})
+			out := &RowBuffer{}
+			s, err := newSorter(
+				ctx, &flowCtx, 0 /* processorID */, &distsqlpb.SorterSpec{OutputOrdering: ordering},
+				in, &distsqlpb.PostProcessSpec{}, out,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Run(ctx)
+			if !out.ProducerClosed() {
+				t.Fatalf("output RowReceiver not closed")
+			}
+			expSpill := threshold == 1
+			if spilled := s.(rowsAccessor).getRows().Spilled(); spilled != expSpill {
+				t.Fatalf("expected spill to disk=%t, found %t", expSpill, spilled)
+			}
+		})
+	}
+
+	// The testing knob takes precedence over the cluster setting.
+	st := cluster.MakeTestingClusterSettings()
+	flowCtx := FlowCtx{Settings: st}
+	flowCtx.testingKnobs.MemoryLimitBytes = 42
+	if res := flowCtx.SpillThresholdBytes(); res != 42 {
+		t.Fatalf("expected the testing knob to override the setting, got %d", res)
+	}
+}
+
 // TestSortInvalidLimit verifies that a top-k sorter will never be created with
 // an invalid k-parameter.
 func TestSortInvalidLimit(t *testing.T) {
@@ -46,6 +46,10 @@ type streamGroupAccumulator struct {
 
 	rowAlloc sqlbase.EncDatumRowAlloc
 
+	// maxChunkRows, if positive, is the maximum number of rows returned by a
+	// single call to nextGroup. Larger groups are returned in several chunks.
+	maxChunkRows int
+
 	memAcc mon.BoundAccount
 }
 
@@ -66,13 +70,17 @@ func (s *streamGroupAccumulator) start(ctx context.Context) {
 
 // nextGroup returns the next group from the inputs. The returned slice is not safe
 // to use after the next call to nextGroup.
+//
+// If maxChunkRows is set and the group has more rows than that, only the first
+// maxChunkRows rows are returned and more is true; the following calls return
+// the rest of the group.
 func (s *streamGroupAccumulator) nextGroup(
 	ctx context.Context, evalCtx *tree.EvalContext,
-) ([]sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
+) (_ []sqlbase.EncDatumRow, more bool, _ *distsqlpb.ProducerMetadata) {
 	if s.srcConsumed {
 		// If src has been exhausted, then we also must have advanced away from the
 		// last group.
-		return nil, nil
+		return nil, false, nil
 	}
 
 	if s.leftoverRow != nil {
@@ -83,15 +91,15 @@ func (s *streamGroupAccumulator) nextGroup(
 	for {
 		row, meta := s.src.Next()
 		if meta != nil {
-			return nil, meta
+			return nil, false, meta
 		}
 		if row == nil {
 			s.srcConsumed = true
-			return s.curGroup, nil
+			return s.curGroup, false, nil
 		}
 
 		if err := s.memAcc.Grow(ctx, int64(row.Size())); err != nil {
-			return nil, &distsqlpb.ProducerMetadata{Err: err}
+			return nil, false, &distsqlpb.ProducerMetadata{Err: err}
 		}
 		row = s.rowAlloc.CopyRow(row)
 
@@ -105,27 +113,40 @@ func (s *streamGroupAccumulator) nextGroup(
 
 		cmp, err := s.curGroup[0].Compare(s.types, &s.datumAlloc, s.ordering, evalCtx, row)
 		if err != nil {
-			return nil, &distsqlpb.ProducerMetadata{Err: err}
+			return nil, false, &distsqlpb.ProducerMetadata{Err: err}
 		}
 		if cmp == 0 {
+			if s.maxChunkRows > 0 && len(s.curGroup) >= s.maxChunkRows {
+				// The group doesn't fit in a single chunk. Return what we have so
+				// far; row becomes the first row of the next chunk.
+				return s.flushGroup(ctx, row), true, nil
+			}
 			s.curGroup = append(s.curGroup, row)
 		} else if cmp == 1 {
-			return nil, &distsqlpb.ProducerMetadata{
+			return nil, false, &distsqlpb.ProducerMetadata{
 				Err: errors.Errorf(
 					"detected badly ordered input: %s > %s, but expected '<'",
 					s.curGroup[0].String(s.types), row.String(s.types)),
 			}
 		} else {
-			n := len(s.curGroup)
-			ret := s.curGroup[:n:n]
-			s.curGroup = s.curGroup[:0]
-			s.memAcc.Empty(ctx)
-			s.leftoverRow = row
-			return ret, nil
+			return s.flushGroup(ctx, row), false, nil
 		}
 	}
 }
 
+// flushGroup returns the rows accumulated in curGroup and resets the
+// accumulator, saving leftoverRow to start the next call to nextGroup.
+func (s *streamGroupAccumulator) flushGroup(
+	ctx context.Context, leftoverRow sqlbase.EncDatumRow,
+) []sqlbase.EncDatumRow {
+	n := len(s.curGroup)
+	ret := s.curGroup[:n:n]
+	s.curGroup = s.curGroup[:0]
+	s.memAcc.Empty(ctx)
+	s.leftoverRow = leftoverRow
+	return ret
+}
+
 func (s *streamGroupAccumulator) close(ctx context.Context) {
 	s.memAcc.Close(ctx)
 }
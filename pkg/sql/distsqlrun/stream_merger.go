@@ -30,11 +30,21 @@ import (
 // group key, in this case the set of ordered columns. streamMerger emits
 // batches of rows that are the cross-product of matching groups from each
 // stream.
+//
+// Groups from the left stream can be emitted in chunks of a bounded number of
+// rows (see makeStreamMerger), in which case the matching right group is
+// emitted again alongside every chunk.
 type streamMerger struct {
 	left       streamGroupAccumulator
 	right      streamGroupAccumulator
 	leftGroup  []sqlbase.EncDatumRow
 	rightGroup []sqlbase.EncDatumRow
+	// leftMore is set when leftGroup is not the last chunk of its group.
+	leftMore bool
+	// pendingRightGroup is the right group matching the left group that is
+	// being emitted in chunks. It is set while more chunks of that left group
+	// remain.
+	pendingRightGroup []sqlbase.EncDatumRow
 	// nulLEquality indicates when NULL = NULL is truth-y. This is helpful
 	// when we want NULL to be meaningful during equality, for example
 	// during SCRUB secondary index checks.
@@ -50,25 +60,41 @@ func (sm *streamMerger) start(ctx context.Context) {
 // NextBatch returns a set of rows from the left stream and a set of rows from
 // the right stream, all matching on the equality columns. One of the sets can
 // be empty.
+//
+// If leftMore is returned, the left rows are only a chunk of their group: the
+// next batch contains more rows of the same group, along with the same right
+// rows.
 func (sm *streamMerger) NextBatch(
 	ctx context.Context, evalCtx *tree.EvalContext,
-) ([]sqlbase.EncDatumRow, []sqlbase.EncDatumRow, *distsqlpb.ProducerMetadata) {
+) (_, _ []sqlbase.EncDatumRow, leftMore bool, _ *distsqlpb.ProducerMetadata) {
+	if sm.pendingRightGroup != nil {
+		// We are in the middle of a left group that matched pendingRightGroup.
+		leftGroup, more, meta := sm.left.nextGroup(ctx, evalCtx)
+		if meta != nil {
+			return nil, nil, false, meta
+		}
+		rightGroup := sm.pendingRightGroup
+		if !more {
+			sm.pendingRightGroup = nil
+		}
+		return leftGroup, rightGroup, more, nil
+	}
 	if sm.leftGroup == nil {
 		var meta *distsqlpb.ProducerMetadata
-		sm.leftGroup, meta = sm.left.nextGroup(ctx, evalCtx)
+		sm.leftGroup, sm.leftMore, meta = sm.left.nextGroup(ctx, evalCtx)
 		if meta != nil {
-			return nil, nil, meta
+			return nil, nil, false, meta
 		}
 	}
 	if sm.rightGroup == nil {
 		var meta *distsqlpb.ProducerMetadata
-		sm.rightGroup, meta = sm.right.nextGroup(ctx, evalCtx)
+		sm.rightGroup, _, meta = sm.right.nextGroup(ctx, evalCtx)
 		if meta != nil {
-			return nil, nil, meta
+			return nil, nil, false, meta
 		}
 	}
 	if sm.leftGroup == nil && sm.rightGroup == nil {
-		return nil, nil, nil
+		return nil, nil, false, nil
 	}
 
 	var lrow, rrow sqlbase.EncDatumRow
@@ -84,18 +110,23 @@ func (sm *streamMerger) NextBatch(
 		sm.nullEquality, &sm.datumAlloc, evalCtx,
 	)
 	if err != nil {
-		return nil, nil, &distsqlpb.ProducerMetadata{Err: err}
+		return nil, nil, false, &distsqlpb.ProducerMetadata{Err: err}
 	}
 	var leftGroup, rightGroup []sqlbase.EncDatumRow
 	if cmp <= 0 {
 		leftGroup = sm.leftGroup
+		leftMore = sm.leftMore
 		sm.leftGroup = nil
+		sm.leftMore = false
 	}
 	if cmp >= 0 {
 		rightGroup = sm.rightGroup
 		sm.rightGroup = nil
 	}
-	return leftGroup, rightGroup, nil
+	if cmp == 0 && leftMore {
+		sm.pendingRightGroup = rightGroup
+	}
+	return leftGroup, rightGroup, leftMore, nil
 }
 
 // CompareEncDatumRowForMerge EncDatumRow compares two EncDatumRows for merging.
@@ -167,6 +198,10 @@ func (sm *streamMerger) close(ctx context.Context) {
 // makeStreamMerger creates a streamMerger, joining rows from leftSource with
 // rows from rightSource.
 //
+// If maxLeftChunkRows is positive, left groups larger than that are emitted in
+// chunks of at most maxLeftChunkRows rows. Right groups are always buffered in
+// full, since every left row has to be matched against the whole right group.
+//
 // All metadata from the sources is forwarded to metadataSink.
 func makeStreamMerger(
 	leftSource RowSource,
@@ -174,6 +209,7 @@ func makeStreamMerger(
 	rightSource RowSource,
 	rightOrdering sqlbase.ColumnOrdering,
 	nullEquality bool,
+	maxLeftChunkRows int,
 	memMonitor *mon.BytesMonitor,
 ) (streamMerger, error) {
 	if len(leftOrdering) != len(rightOrdering) {
@@ -186,9 +222,11 @@ func makeStreamMerger(
 		}
 	}
 
-	return streamMerger{
+	sm := streamMerger{
 		left:         makeStreamGroupAccumulator(leftSource, leftOrdering, memMonitor),
 		right:        makeStreamGroupAccumulator(rightSource, rightOrdering, memMonitor),
 		nullEquality: nullEquality,
-	}, nil
+	}
+	sm.left.maxChunkRows = maxLeftChunkRows
+	return sm, nil
 }
@@ -339,7 +339,7 @@ func (tr *tableReader) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(tr.Ctx); sp != nil {
-		tracing.SetSpanStats(sp, &TableReaderStats{
+		tr.setSpanStats(sp, &TableReaderStats{
 			InputStats: is,
 			BytesRead:  tr.fetcher.GetBytesRead(),
 		})
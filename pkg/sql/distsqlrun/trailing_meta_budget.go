@@ -0,0 +1,118 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package distsqlrun
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+var settingFlowMaxTrailingMetaBytes = settings.RegisterByteSizeSetting(
+	"sql.distsql.flow_trailing_metadata.max_bytes",
+	"maximum total size of the trace data (including execution statistics) "+
+		"returned by the processors of a single flow; 0 disables the limit",
+	0,
+)
+
+// trailingMetaBudget limits the total size of the trailing metadata produced
+// by all the processors of a flow. Only metadata that can be dropped without
+// affecting the outcome of the query is subject to the budget: that's trace
+// data, which also carries the execution statistics. Errors and transaction
+// metadata are always let through.
+//
+// Dropped metadata is counted in the budget and in the node's
+// sql.distsql.flows.trailing_metadata_truncated metric.
+//
+// A nil *trailingMetaBudget imposes no limit.
+type trailingMetaBudget struct {
+	limit int64
+	// truncatedCounter, if set, is incremented for every piece of metadata
+	// that is dropped.
+	truncatedCounter *metric.Counter
+
+	mu struct {
+		syncutil.Mutex
+		used int64
+		// truncated counts the pieces of metadata that were dropped because
+		// they didn't fit in the budget.
+		truncated int
+	}
+}
+
+// newTrailingMetaBudget creates a trailingMetaBudget with the given limit,
+// which counts the metadata it drops in truncatedCounter (if not nil).
+// Returns nil if limit is not positive.
+func newTrailingMetaBudget(limit int64, truncatedCounter *metric.Counter) *trailingMetaBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &trailingMetaBudget{limit: limit, truncatedCounter: truncatedCounter}
+}
+
+// filter removes from meta (in place) the pieces of metadata that don't fit in
+// the budget and returns the resulting slice. The first time metadata is
+// dropped for a flow, a warning is logged.
+func (b *trailingMetaBudget) filter(
+	ctx context.Context, meta []distsqlpb.ProducerMetadata,
+) []distsqlpb.ProducerMetadata {
+	if b == nil {
+		return meta
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := meta[:0]
+	for i := range meta {
+		if meta[i].TraceData == nil {
+			res = append(res, meta[i])
+			continue
+		}
+		var size int64
+		for j := range meta[i].TraceData {
+			size += int64(meta[i].TraceData[j].Size())
+		}
+		if b.mu.used+size <= b.limit {
+			b.mu.used += size
+			res = append(res, meta[i])
+			continue
+		}
+		if b.mu.truncated == 0 {
+			log.Warningf(ctx,
+				"trailing metadata of flow exceeds the limit of %s; dropping trace data and statistics",
+				humanizeutil.IBytes(b.limit))
+		}
+		b.mu.truncated++
+		if b.truncatedCounter != nil {
+			b.truncatedCounter.Inc(1)
+		}
+	}
+	return res
+}
+
+// numTruncated returns the number of pieces of metadata that have been dropped
+// so far.
+func (b *trailingMetaBudget) numTruncated() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mu.truncated
+}
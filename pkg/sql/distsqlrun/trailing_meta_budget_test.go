@@ -0,0 +1,94 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package distsqlrun
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/pkg/errors"
+)
+
+// TestTrailingMetaBudget verifies that, once the trailing metadata of a flow
+// exceeds the flow's budget, trace data (and the statistics it carries) is
+// dropped while errors are still returned.
+func TestTrailingMetaBudget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	const limit = 1024
+	truncated := metric.NewCounter(metaTrailingMetaTruncated)
+	flowCtx := &FlowCtx{trailingMetaBudget: newTrailingMetaBudget(limit, truncated)}
+
+	trace := []tracing.RecordedSpan{{Operation: strings.Repeat("x", 600)}}
+	if size := trace[0].Size(); size <= limit/2 || size > limit {
+		t.Fatalf("unexpected trace size %d", size)
+	}
+	expectedErr := errors.New("processor error")
+
+	// Each processor produces a trace that takes up more than half of the
+	// budget, so only the first processor's trace fits.
+	const numProcessors = 3
+	var traces, errs int
+	for i := 0; i < numProcessors; i++ {
+		pb := &ProcessorBase{flowCtx: flowCtx, Ctx: ctx}
+		pb.trailingMetaCallback = func(context.Context) []distsqlpb.ProducerMetadata {
+			return []distsqlpb.ProducerMetadata{{TraceData: trace}, {Err: expectedErr}}
+		}
+		pb.MoveToDraining(nil /* err */)
+		for meta := pb.DrainHelper(); meta != nil; meta = pb.DrainHelper() {
+			switch {
+			case meta.TraceData != nil:
+				traces++
+			case meta.Err == expectedErr:
+				errs++
+			default:
+				t.Fatalf("unexpected metadata %+v", meta)
+			}
+		}
+	}
+
+	if traces != 1 {
+		t.Fatalf("expected 1 trace to fit in the budget, found %d", traces)
+	}
+	if errs != numProcessors {
+		t.Fatalf("expected %d errors to be preserved, found %d", numProcessors, errs)
+	}
+	if n := flowCtx.trailingMetaBudget.numTruncated(); n != numProcessors-1 {
+		t.Fatalf("expected %d truncated pieces of metadata, found %d", numProcessors-1, n)
+	}
+	if n := truncated.Count(); n != numProcessors-1 {
+		t.Fatalf("expected the metric to count %d truncated pieces of metadata, found %d",
+			numProcessors-1, n)
+	}
+}
+
+func TestTrailingMetaBudgetUnlimited(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	if b := newTrailingMetaBudget(0, nil /* truncatedCounter */); b != nil {
+		t.Fatalf("expected no budget for a zero limit, found %+v", b)
+	}
+	meta := []distsqlpb.ProducerMetadata{{TraceData: []tracing.RecordedSpan{{Operation: "x"}}}}
+	var b *trailingMetaBudget
+	if res := b.filter(context.Background(), meta); len(res) != 1 {
+		t.Fatalf("expected metadata to be let through, found %+v", res)
+	}
+}
@@ -302,7 +302,7 @@ func (w *windower) accumulateRows() (
 	*distsqlpb.ProducerMetadata,
 ) {
 	for {
-		row, meta := w.input.Next()
+		row, meta := w.InputNext(w.input)
 		if meta != nil {
 			if meta.Err != nil {
 				// We want to send the whole meta (below) rather than just the err,
@@ -873,7 +873,7 @@ func (w *windower) outputStatsToTrace() {
 		return
 	}
 	if sp := opentracing.SpanFromContext(w.Ctx); sp != nil {
-		tracing.SetSpanStats(
+		w.setSpanStats(
 			sp,
 			&WindowerStats{
 				InputStats:       is,
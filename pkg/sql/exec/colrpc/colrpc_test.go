@@ -122,6 +122,46 @@ func handleStream(
 
 const staticNodeID roachpb.NodeID = 3
 
+func TestHeartbeatMinVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// A server must not advertise heartbeat support before it understands the
+	// corresponding DistSQL version.
+	require.True(t, HeartbeatMinVersion <= distsqlrun.Version)
+}
+
+func TestNegotiateColumnarFormatVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for _, tc := range []struct {
+		consumerVersion, consumerMinAccepted ColumnarFormatVersion
+		expected                             ColumnarFormatVersion
+		expectedErr                          string
+	}{
+		// A consumer that predates format version negotiation.
+		{consumerVersion: 0, consumerMinAccepted: 0, expected: ColumnarFormatVersion1},
+		{consumerVersion: CurrentColumnarFormatVersion, consumerMinAccepted: MinAcceptedColumnarFormatVersion, expected: CurrentColumnarFormatVersion},
+		// A newer consumer that still understands the current format.
+		{consumerVersion: CurrentColumnarFormatVersion + 1, consumerMinAccepted: CurrentColumnarFormatVersion, expected: CurrentColumnarFormatVersion},
+		// A newer consumer that no longer understands the current format.
+		{consumerVersion: CurrentColumnarFormatVersion + 2, consumerMinAccepted: CurrentColumnarFormatVersion + 1, expectedErr: "incompatible columnar format versions"},
+	} {
+		v, err := negotiateColumnarFormatVersion(tc.consumerVersion, tc.consumerMinAccepted)
+		if tc.expectedErr != "" {
+			require.True(t, testutils.IsError(err, tc.expectedErr), err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, v)
+		require.NoError(t, checkColumnarFormatVersion(v))
+	}
+
+	require.NoError(t, checkColumnarFormatVersion(0))
+	require.True(t, testutils.IsError(
+		checkColumnarFormatVersion(CurrentColumnarFormatVersion+1), "unsupported columnar format version",
+	))
+}
+
 func TestOutboxInbox(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -297,6 +337,12 @@ func TestOutboxInbox(t *testing.T) {
 			require.NoError(t, streamHandlerErr)
 			require.NoError(t, readerErr)
 
+			// Every byte sent by the Outbox should have been received by the Inbox.
+			outboxStats, inboxStats := outbox.Stats(), inbox.Stats()
+			require.True(t, outboxStats.UncompressedBytes > 0)
+			require.Equal(t, outboxStats, inboxStats)
+			require.Equal(t, int64(0), inboxStats.CompressedBytes)
+
 			// If no cancellation happened, the output can be fully verified against
 			// the input.
 			for batchNum := 0; ; batchNum++ {
@@ -0,0 +1,80 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package colrpc
+
+import "github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+
+// ColumnarFormatVersion identifies a version of the serialization format of
+// the columnar batches sent from an Outbox to an Inbox. The Inbox advertises
+// the range of versions it understands in its ConsumerHandshake, and the
+// Outbox tags every batch it sends with the version that was negotiated.
+type ColumnarFormatVersion uint32
+
+const (
+	// ColumnarFormatVersion1 is the initial format: Arrow record batches
+	// serialized with colserde.RecordBatchSerializer. Peers that predate
+	// format version negotiation use this format.
+	ColumnarFormatVersion1 ColumnarFormatVersion = 1
+
+	// CurrentColumnarFormatVersion is the newest format that this node can
+	// produce and consume.
+	CurrentColumnarFormatVersion = ColumnarFormatVersion1
+	// MinAcceptedColumnarFormatVersion is the oldest format that this node can
+	// produce and consume.
+	MinAcceptedColumnarFormatVersion = ColumnarFormatVersion1
+)
+
+// negotiateColumnarFormatVersion returns the highest format version that both
+// this node, as a producer, and a consumer that supports the versions in
+// [consumerMinAccepted, consumerVersion] understand. A zero consumerVersion
+// indicates a consumer that predates format version negotiation, which only
+// understands ColumnarFormatVersion1. An error is returned if there is no such
+// version.
+func negotiateColumnarFormatVersion(
+	consumerVersion, consumerMinAccepted ColumnarFormatVersion,
+) (ColumnarFormatVersion, error) {
+	if consumerVersion == 0 {
+		consumerVersion, consumerMinAccepted = ColumnarFormatVersion1, ColumnarFormatVersion1
+	}
+	v := CurrentColumnarFormatVersion
+	if consumerVersion < v {
+		v = consumerVersion
+	}
+	if v < MinAcceptedColumnarFormatVersion || v < consumerMinAccepted {
+		return 0, pgerror.Newf(pgerror.CodeFeatureNotSupportedError,
+			"incompatible columnar format versions: producer supports [%d, %d], consumer supports [%d, %d]",
+			MinAcceptedColumnarFormatVersion, CurrentColumnarFormatVersion,
+			consumerMinAccepted, consumerVersion,
+		)
+	}
+	return v, nil
+}
+
+// checkColumnarFormatVersion returns an error if a batch serialized with the
+// given format version can't be consumed by this node. A zero version
+// indicates a producer that predates format version negotiation, which uses
+// ColumnarFormatVersion1.
+func checkColumnarFormatVersion(v ColumnarFormatVersion) error {
+	if v == 0 {
+		v = ColumnarFormatVersion1
+	}
+	if v < MinAcceptedColumnarFormatVersion || v > CurrentColumnarFormatVersion {
+		return pgerror.Newf(pgerror.CodeFeatureNotSupportedError,
+			"unsupported columnar format version %d: consumer supports [%d, %d]",
+			v, MinAcceptedColumnarFormatVersion, CurrentColumnarFormatVersion,
+		)
+	}
+	return nil
+}
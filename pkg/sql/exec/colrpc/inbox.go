@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/apache/arrow/go/arrow/array"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
@@ -26,6 +27,8 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/exec/colserde"
 	"github.com/cockroachdb/cockroach/pkg/sql/exec/types"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
 // flowStreamServer is a utility interface used to mock out the RPC layer.
@@ -77,6 +80,29 @@ type Inbox struct {
 	// stream and is returned by DrainMeta.
 	bufferedMeta []distsqlpb.ProducerMetadata
 
+	heartbeat struct {
+		// timeout, if non-zero, is the amount of time the reader goroutine may
+		// wait in Recv before the connection is considered dead. It is only
+		// enforced once the Outbox has sent its first heartbeat.
+		timeout time.Duration
+		// errCh is the channel over which RunWithStream passes a heartbeat
+		// timeout error to the reader goroutine.
+		errCh chan error
+		mu    struct {
+			syncutil.Mutex
+			// armed is set once the first heartbeat has been received, which
+			// indicates that the Outbox supports heartbeats.
+			armed bool
+			// waitingSince is the time at which the reader goroutine started
+			// waiting in Recv, or zero if it is not currently in Recv.
+			waitingSince time.Time
+		}
+	}
+
+	// stats counts the bytes of the batches received on the stream. Only the
+	// reader goroutine updates it.
+	stats streamStats
+
 	scratch struct {
 		data []*array.Data
 	}
@@ -101,10 +127,24 @@ func NewInbox(typs []types.T) (*Inbox, error) {
 		bufferedMeta: make([]distsqlpb.ProducerMetadata, 0),
 	}
 	i.zeroBatch.SetLength(0)
+	i.heartbeat.errCh = make(chan error, 1)
 	i.scratch.data = make([]*array.Data, len(typs))
 	return i, nil
 }
 
+// SetHeartbeatTimeout makes the Inbox advertise support for heartbeats to the
+// Outbox and treat the stream as broken if, once heartbeats have started, no
+// message arrives within the given timeout. The resulting error is returned by
+// DrainMeta. Must be called before Next or RunWithStream.
+func (i *Inbox) SetHeartbeatTimeout(timeout time.Duration) {
+	i.heartbeat.timeout = timeout
+}
+
+// Stats returns the number of bytes of batches received by the Inbox so far.
+func (i *Inbox) Stats() StreamStats {
+	return i.stats.get()
+}
+
 // maybeInit calls Inbox.init if the inbox is not initialized and returns an
 // error if the initialization was not successful. Usually this is because the
 // given context is canceled before the remote stream arrives.
@@ -133,9 +173,56 @@ func (i *Inbox) init(ctx context.Context) error {
 		return ctx.Err()
 	}
 	i.contextCh <- ctx
+	// Advertise the columnar format versions that the Inbox understands, as
+	// well as its support for heartbeats if enabled.
+	handshake := &distsqlpb.ConsumerHandshake{
+		ConsumerScheduled:                true,
+		ColumnarFormatVersion:            uint32(CurrentColumnarFormatVersion),
+		MinAcceptedColumnarFormatVersion: uint32(MinAcceptedColumnarFormatVersion),
+	}
+	if i.heartbeat.timeout > 0 {
+		handshake.Version = HeartbeatMinVersion
+		handshake.MinAcceptedVersion = HeartbeatMinVersion
+	}
+	if err := i.stream.Send(&distsqlpb.ConsumerSignal{Handshake: handshake}); err != nil {
+		log.Warningf(ctx, "Inbox unable to send handshake to Outbox: %s", err)
+	}
 	return nil
 }
 
+// startRecv records that the reader goroutine is about to wait in Recv.
+func (i *Inbox) startRecv() {
+	if i.heartbeat.timeout == 0 {
+		return
+	}
+	i.heartbeat.mu.Lock()
+	i.heartbeat.mu.waitingSince = timeutil.Now()
+	i.heartbeat.mu.Unlock()
+}
+
+// finishRecv records that the reader goroutine returned from Recv. isHeartbeat
+// indicates whether the received message was a heartbeat.
+func (i *Inbox) finishRecv(isHeartbeat bool) {
+	if i.heartbeat.timeout == 0 {
+		return
+	}
+	i.heartbeat.mu.Lock()
+	i.heartbeat.mu.waitingSince = time.Time{}
+	if isHeartbeat {
+		i.heartbeat.mu.armed = true
+	}
+	i.heartbeat.mu.Unlock()
+}
+
+// heartbeatTimedOut returns whether heartbeats have started and the reader
+// goroutine has been waiting in Recv for longer than the heartbeat timeout.
+func (i *Inbox) heartbeatTimedOut() bool {
+	i.heartbeat.mu.Lock()
+	defer i.heartbeat.mu.Unlock()
+	return i.heartbeat.mu.armed && !i.heartbeat.mu.waitingSince.IsZero() &&
+		timeutil.Since(i.heartbeat.mu.waitingSince) > i.heartbeat.timeout
+}
+
 // close closes the inbox, ensuring that any call to RunWithStream will return
 // immediately. close is idempotent.
 func (i *Inbox) close() {
@@ -164,19 +251,38 @@ func (i *Inbox) RunWithStream(streamCtx context.Context, stream flowStreamServer
 		return fmt.Errorf("%s: streamCtx while waiting for reader (remote client canceled)", streamCtx.Err())
 	}
 
+	// If heartbeats are enabled, periodically check that the Outbox is still
+	// alive.
+	var heartbeatCheckC <-chan time.Time
+	if i.heartbeat.timeout > 0 {
+		ticker := time.NewTicker(i.heartbeat.timeout / 2)
+		defer ticker.Stop()
+		heartbeatCheckC = ticker.C
+	}
+
 	// Now wait for one of the events described in the method comment. If a
 	// cancellation is encountered, nothing special must be done to cancel the
 	// reader goroutine, as returning from the handler will close the stream.
-	select {
-	case err := <-i.errCh:
-		// nil will be read from errCh when the channel is closed.
-		return err
-	case <-readerCtx.Done():
-		// The reader canceled the stream.
-		return fmt.Errorf("%s: readerCtx in Inbox stream handler (local reader canceled)", readerCtx.Err())
-	case <-streamCtx.Done():
-		// The client canceled the stream.
-		return fmt.Errorf("%s: streamCtx in Inbox stream handler (remote client canceled)", streamCtx.Err())
+	for {
+		select {
+		case err := <-i.errCh:
+			// nil will be read from errCh when the channel is closed.
+			return err
+		case <-readerCtx.Done():
+			// The reader canceled the stream.
+			return fmt.Errorf("%s: readerCtx in Inbox stream handler (local reader canceled)", readerCtx.Err())
+		case <-streamCtx.Done():
+			// The client canceled the stream.
+			return fmt.Errorf("%s: streamCtx in Inbox stream handler (remote client canceled)", streamCtx.Err())
+		case <-heartbeatCheckC:
+			if i.heartbeatTimedOut() {
+				// Pass the error to the reader goroutine before returning, which
+				// closes the stream and unblocks the reader's Recv.
+				err := fmt.Errorf("Inbox did not receive a heartbeat from Outbox within %s", i.heartbeat.timeout)
+				i.heartbeat.errCh <- err
+				return err
+			}
+		}
 	}
 }
 
@@ -209,8 +315,19 @@ func (i *Inbox) Next(ctx context.Context) coldata.Batch {
 	}
 
 	for {
+		i.startRecv()
 		m, err := i.stream.Recv()
+		i.finishRecv(err == nil && isHeartbeat(m))
 		if err != nil {
+			select {
+			case hbErr := <-i.heartbeat.errCh:
+				// The stream was closed because the Outbox stopped sending
+				// heartbeats. Surface the error through DrainMeta.
+				i.bufferedMeta = append(i.bufferedMeta, distsqlpb.ProducerMetadata{Err: hbErr})
+				i.close()
+				return i.zeroBatch
+			default:
+			}
 			if err == io.EOF {
 				// Done.
 				i.close()
@@ -231,10 +348,15 @@ func (i *Inbox) Next(ctx context.Context) coldata.Batch {
 			continue
 		}
 		if len(m.Data.RawBytes) == 0 {
+			// Heartbeats are empty messages and are skipped here as well.
 			// Protect against Deserialization panics by skipping empty messages.
 			// TODO(asubiotto): I don't think we're using NumEmptyRows, right?
 			continue
 		}
+		if err := checkColumnarFormatVersion(ColumnarFormatVersion(m.ColumnarFormatVersion)); err != nil {
+			panic(err)
+		}
+		i.stats.add(len(m.Data.RawBytes), 0 /* compressed */)
 		i.scratch.data = i.scratch.data[:0]
 		if err := i.serializer.Deserialize(&i.scratch.data, m.Data.RawBytes); err != nil {
 			panic(err)
@@ -247,11 +369,18 @@ func (i *Inbox) Next(ctx context.Context) coldata.Batch {
 	}
 }
 
+// isHeartbeat returns whether m is an Outbox heartbeat, i.e. an empty message.
+func isHeartbeat(m *distsqlpb.ProducerMessage) bool {
+	return m.Header == nil && len(m.Typing) == 0 && len(m.Data.RawBytes) == 0 &&
+		m.Data.NumEmptyRows == 0 && len(m.Data.Metadata) == 0
+}
+
 // DrainMeta is part of the MetadataGenerator interface. DrainMeta may not be
 // called concurrently with Next.
 func (i *Inbox) DrainMeta(ctx context.Context) []distsqlpb.ProducerMetadata {
 	allMeta := i.bufferedMeta
 	i.bufferedMeta = i.bufferedMeta[:0]
+	i.stats.recordInSpan(ctx, "colrpc.inbox.")
 
 	if i.done {
 		return allMeta
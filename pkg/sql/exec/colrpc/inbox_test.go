@@ -17,6 +17,7 @@ package colrpc
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/exec"
@@ -138,3 +139,59 @@ func TestInboxNextPanicDoesntLeakGoroutines(t *testing.T) {
 	// panic is bubbled up through the Next chain on the Inbox's host.
 	require.NoError(t, <-streamHandlerErrCh)
 }
+
+func TestInboxHeartbeatTimeout(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	typs := []types.T{types.Int64}
+	t.Run("AfterHeartbeat", func(t *testing.T) {
+		rpcLayer := makeMockFlowStreamRPCLayer()
+		inbox, err := NewInbox(typs)
+		require.NoError(t, err)
+		inbox.SetHeartbeatTimeout(10 * time.Millisecond)
+
+		// Returning from the stream handler closes the stream, which the mock RPC
+		// layer models by closing pmChan.
+		streamHandlerErrCh := handleStream(context.Background(), inbox, rpcLayer.server, func() { close(rpcLayer.server.pmChan) })
+
+		// A single heartbeat is sent, after which the Outbox goes silent.
+		require.NoError(t, rpcLayer.client.Send(&distsqlpb.ProducerMessage{}))
+
+		ctx := context.Background()
+		require.True(t, inbox.Next(ctx).Length() == 0)
+
+		// The Inbox should have advertised support for heartbeats.
+		signal, err := rpcLayer.client.Recv()
+		require.NoError(t, err)
+		require.NotNil(t, signal.Handshake)
+		require.Equal(t, HeartbeatMinVersion, signal.Handshake.Version)
+
+		meta := inbox.DrainMeta(ctx)
+		require.True(t, len(meta) == 1)
+		require.True(t, testutils.IsError(meta[0].Err, "did not receive a heartbeat"), meta[0].Err)
+
+		err = <-streamHandlerErrCh
+		require.True(t, testutils.IsError(err, "did not receive a heartbeat"), err)
+	})
+
+	t.Run("NoHeartbeats", func(t *testing.T) {
+		// An Outbox that does not support heartbeats never sends any, so the
+		// Inbox must not time out.
+		rpcLayer := makeMockFlowStreamRPCLayer()
+		inbox, err := NewInbox(typs)
+		require.NoError(t, err)
+		inbox.SetHeartbeatTimeout(time.Millisecond)
+
+		streamHandlerErrCh := handleStream(context.Background(), inbox, rpcLayer.server, nil /* doneFn */)
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			_ = rpcLayer.client.CloseSend()
+		}()
+
+		ctx := context.Background()
+		require.True(t, inbox.Next(ctx).Length() == 0)
+		require.True(t, len(inbox.DrainMeta(ctx)) == 0)
+		require.NoError(t, <-streamHandlerErrCh)
+	})
+}
@@ -18,7 +18,9 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc/nodedialer"
@@ -29,8 +31,21 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/exec/types"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/log/logtags"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
+// HeartbeatMinVersion is the first DistSQL version at which a consumer
+// understands Outbox heartbeats. An Outbox only sends heartbeats once it has
+// received a ConsumerHandshake that advertises at least this version. Note
+// that the handshakes sent by the flowRegistry on behalf of the consumer carry
+// distsqlrun.Version, so heartbeats are sent to every consumer at this version
+// or a later one, whether or not its Inbox has a heartbeat timeout; an Inbox
+// without one skips them. An Inbox advertises this version itself only when
+// it has a heartbeat timeout. This must not be greater than
+// distsqlrun.Version.
+const HeartbeatMinVersion distsqlpb.DistSQLVersion = 24
+
 // flowStreamClient is a utility interface used to mock out the RPC layer.
 type flowStreamClient interface {
 	Send(*distsqlpb.ProducerMessage) error
@@ -52,6 +67,35 @@ type Outbox struct {
 	draining        uint32
 	metadataSources []distsqlpb.MetadataSource
 
+	// heartbeatInterval, if non-zero, is the interval after which the Outbox
+	// sends an empty keepalive message if no other message has been sent.
+	heartbeatInterval time.Duration
+	// heartbeatsSupported is an atomic that is set to 1 once the consumer has
+	// advertised support for heartbeats in a handshake.
+	heartbeatsSupported uint32
+
+	// formatMu protects the columnar format version negotiated with the
+	// consumer. Until the consumer's handshake is received, batches are sent
+	// using ColumnarFormatVersion1, which every consumer understands.
+	formatMu struct {
+		syncutil.Mutex
+		version ColumnarFormatVersion
+		// err is set if the consumer doesn't understand any of the format
+		// versions that the Outbox can produce.
+		err error
+	}
+
+	// sendMu serializes Sends on the stream between the goroutine pushing
+	// batches and the heartbeat goroutine.
+	sendMu struct {
+		syncutil.Mutex
+		// lastSend is the time at which the last message was sent.
+		lastSend time.Time
+	}
+
+	// stats counts the bytes of the batches sent on the stream.
+	stats streamStats
+
 	scratch struct {
 		buf *bytes.Buffer
 		msg *distsqlpb.ProducerMessage
@@ -75,11 +119,26 @@ func NewOutbox(
 		serializer:      s,
 		metadataSources: metadataSources,
 	}
+	o.formatMu.version = ColumnarFormatVersion1
 	o.scratch.buf = &bytes.Buffer{}
 	o.scratch.msg = &distsqlpb.ProducerMessage{}
 	return o, nil
 }
 
+// SetHeartbeatInterval enables heartbeats: if no message has been sent on the
+// stream for the given interval, the Outbox sends an empty keepalive message so
+// that the remote Inbox can detect a dead connection. Heartbeats are only sent
+// once the consumer advertises HeartbeatMinVersion or later in a handshake.
+// Must be called before Run.
+func (o *Outbox) SetHeartbeatInterval(interval time.Duration) {
+	o.heartbeatInterval = interval
+}
+
+// Stats returns the number of bytes of batches sent by the Outbox so far.
+func (o *Outbox) Stats() StreamStats {
+	return o.stats.get()
+}
+
 // Get rid of unused warning.
 // TODO(asubiotto): Remove this once Outbox is used.
 var _ = (&Outbox{}).Run
@@ -168,6 +227,85 @@ func (o *Outbox) handleStreamErr(
 	}
 }
 
+// send sends msg on the given stream, serializing with any concurrent
+// heartbeats.
+func (o *Outbox) send(stream flowStreamClient, msg *distsqlpb.ProducerMessage) error {
+	o.sendMu.Lock()
+	defer o.sendMu.Unlock()
+	o.sendMu.lastSend = timeutil.Now()
+	return stream.Send(msg)
+}
+
+// sendHeartbeats sends an empty message on the stream every time
+// Outbox.heartbeatInterval elapses without any other message being sent, once
+// the consumer has advertised support for heartbeats. It returns when stopCh is
+// closed or a Send fails.
+func (o *Outbox) sendHeartbeats(
+	ctx context.Context, stream flowStreamClient, stopCh <-chan struct{},
+) {
+	ticker := time.NewTicker(o.heartbeatInterval)
+	defer ticker.Stop()
+	heartbeat := &distsqlpb.ProducerMessage{}
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		if atomic.LoadUint32(&o.heartbeatsSupported) == 0 {
+			continue
+		}
+		o.sendMu.Lock()
+		var err error
+		if timeutil.Since(o.sendMu.lastSend) >= o.heartbeatInterval {
+			o.sendMu.lastSend = timeutil.Now()
+			err = stream.Send(heartbeat)
+		}
+		o.sendMu.Unlock()
+		if err != nil {
+			// The stream is broken, the goroutine pushing batches will encounter
+			// the error on its next Send.
+			log.VEventf(ctx, 2, "Outbox heartbeat Send error: %s", err)
+			return
+		}
+	}
+}
+
+// handleHandshake negotiates the columnar format version with the consumer
+// that sent the given handshake. Handshakes that don't advertise any columnar
+// format version, such as the ones sent by the flowRegistry, leave the format
+// unchanged.
+func (o *Outbox) handleHandshake(ctx context.Context, h *distsqlpb.ConsumerHandshake) {
+	if h.Version >= HeartbeatMinVersion {
+		atomic.StoreUint32(&o.heartbeatsSupported, 1)
+	}
+	if h.ColumnarFormatVersion == 0 {
+		return
+	}
+	v, err := negotiateColumnarFormatVersion(
+		ColumnarFormatVersion(h.ColumnarFormatVersion),
+		ColumnarFormatVersion(h.MinAcceptedColumnarFormatVersion),
+	)
+	o.formatMu.Lock()
+	defer o.formatMu.Unlock()
+	if err != nil {
+		log.Warningf(ctx, "Outbox unable to negotiate columnar format version: %s", err)
+		o.formatMu.err = err
+		return
+	}
+	log.VEventf(ctx, 2, "Outbox using columnar format version %d", v)
+	o.formatMu.version = v
+}
+
+// formatVersion returns the columnar format version to use for the next
+// batch, or an error if the consumer can't understand any of the versions
+// that the Outbox can produce.
+func (o *Outbox) formatVersion() (ColumnarFormatVersion, error) {
+	o.formatMu.Lock()
+	defer o.formatMu.Unlock()
+	return o.formatMu.version, o.formatMu.err
+}
+
 func (o *Outbox) moveToDraining(ctx context.Context) {
 	if atomic.CompareAndSwapUint32(&o.draining, 0, 1) {
 		log.VEvent(ctx, 2, "Outbox moved to draining")
@@ -185,8 +323,9 @@ func (o *Outbox) moveToDraining(ctx context.Context) {
 // 2) Outbox.draining is observed to be true. This is also considered graceful
 //    termination. true, nil is returned.
 // 3) An error unrelated to the stream occurs (e.g. while deserializing a
-//    coldata.Batch). false, err is returned. This err should be sent over the
-//    stream as metadata.
+//    coldata.Batch, or if the consumer doesn't support any of the columnar
+//    format versions that the Outbox can produce). false, err is returned.
+//    This err should be sent over the stream as metadata.
 // 4) An error related to the stream occurs. In this case, the error is logged
 //    but not returned, as there is no way to propagate this error anywhere
 //    meaningful. false, nil is returned. NOTE: io.EOF is a special case. This
@@ -208,6 +347,15 @@ func (o *Outbox) sendBatches(
 			return true, nil
 		}
 
+		// All the format versions serialize batches the same way for now; the
+		// serializer will need to depend on the version once a new one is
+		// introduced.
+		version, err := o.formatVersion()
+		if err != nil {
+			return false, err
+		}
+		o.scratch.msg.ColumnarFormatVersion = uint32(version)
+
 		o.scratch.buf.Reset()
 		d, err := o.converter.BatchToArrow(b)
 		if err != nil {
@@ -223,10 +371,11 @@ func (o *Outbox) sendBatches(
 		// o.scratch.msg can be reused as soon as Send returns since it returns as
 		// soon as the message is written to the control buffer. The message is
 		// marshaled (bytes are copied) before writing.
-		if err := stream.Send(o.scratch.msg); err != nil {
+		if err := o.send(stream, o.scratch.msg); err != nil {
 			o.handleStreamErr(ctx, "Send (batches)", err, cancelFn)
 			return false, nil
 		}
+		o.stats.add(len(o.scratch.msg.Data.RawBytes), 0 /* compressed */)
 	}
 }
 
@@ -271,6 +420,7 @@ func (o *Outbox) runWithStream(
 			switch {
 			case msg.Handshake != nil:
 				log.VEventf(ctx, 2, "Outbox received handshake: %v", msg.Handshake)
+				o.handleHandshake(ctx, msg.Handshake)
 			case msg.DrainRequest != nil:
 				o.moveToDraining(ctx)
 			}
@@ -278,7 +428,21 @@ func (o *Outbox) runWithStream(
 		close(waitCh)
 	}()
 
+	var heartbeatWG sync.WaitGroup
+	heartbeatStopCh := make(chan struct{})
+	if o.heartbeatInterval > 0 {
+		heartbeatWG.Add(1)
+		go func() {
+			defer heartbeatWG.Done()
+			o.sendHeartbeats(ctx, stream, heartbeatStopCh)
+		}()
+	}
+
 	terminatedGracefully, errToSend := o.sendBatches(ctx, stream, cancelFn)
+	// Stop sending heartbeats before sending metadata and closing the stream.
+	close(heartbeatStopCh)
+	heartbeatWG.Wait()
+	o.stats.recordInSpan(ctx, "colrpc.outbox.")
 	if terminatedGracefully || errToSend != nil {
 		o.moveToDraining(ctx)
 		if err := o.sendMetadata(ctx, stream, errToSend); err != nil {
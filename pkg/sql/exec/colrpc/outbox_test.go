@@ -16,14 +16,18 @@ package colrpc
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/distsqlrun"
 	"github.com/cockroachdb/cockroach/pkg/sql/exec"
 	"github.com/cockroachdb/cockroach/pkg/sql/exec/coldata"
 	"github.com/cockroachdb/cockroach/pkg/sql/exec/types"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/stretchr/testify/require"
@@ -139,3 +143,186 @@ func TestOutboxDrainsMetadataSources(t *testing.T) {
 		require.True(t, atomic.LoadUint32(sourceDrained) == 1)
 	})
 }
+
+// blockingOp is an Operator that blocks in Next until unblockCh is closed, at
+// which point it returns a zero-length batch.
+type blockingOp struct {
+	unblockCh chan struct{}
+	zeroBatch coldata.Batch
+}
+
+var _ exec.Operator = &blockingOp{}
+
+func (b *blockingOp) Init() {}
+
+func (b *blockingOp) Next(context.Context) coldata.Batch {
+	<-b.unblockCh
+	return b.zeroBatch
+}
+
+func TestOutboxSendsHeartbeats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var (
+		ctx      = context.Background()
+		typs     = []types.T{types.Int64}
+		rpcLayer = makeMockFlowStreamRPCLayer()
+		input    = &blockingOp{unblockCh: make(chan struct{}), zeroBatch: coldata.NewMemBatchWithSize(typs, 0)}
+	)
+	input.zeroBatch.SetLength(0)
+
+	outbox, err := NewOutbox(input, typs, nil)
+	require.NoError(t, err)
+	const heartbeatInterval = time.Millisecond
+	outbox.SetHeartbeatInterval(heartbeatInterval)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		outbox.runWithStream(ctx, rpcLayer.client, nil /* cancelFn */)
+		wg.Done()
+	}()
+
+	// No heartbeats should be sent before the consumer advertises support for
+	// them.
+	time.Sleep(10 * heartbeatInterval)
+	require.True(t, len(rpcLayer.server.pmChan) == 0)
+
+	require.NoError(t, rpcLayer.server.Send(&distsqlpb.ConsumerSignal{
+		Handshake: &distsqlpb.ConsumerHandshake{
+			ConsumerScheduled:  true,
+			Version:            HeartbeatMinVersion,
+			MinAcceptedVersion: HeartbeatMinVersion,
+		},
+	}))
+	for i := 0; i < 3; i++ {
+		m, err := rpcLayer.server.Recv()
+		require.NoError(t, err)
+		require.True(t, isHeartbeat(m), "expected heartbeat, got %v", m)
+	}
+
+	// Let the Outbox finish, which closes the stream. Any heartbeats sent
+	// before then are drained.
+	close(input.unblockCh)
+	for {
+		_, err := rpcLayer.server.Recv()
+		if err != nil {
+			break
+		}
+	}
+	close(rpcLayer.server.csChan)
+	wg.Wait()
+}
+
+// TestOutboxHandshakeEnablesHeartbeats verifies which consumer handshakes make
+// the Outbox send heartbeats.
+func TestOutboxHandshakeEnablesHeartbeats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	typs := []types.T{types.Int64}
+	for _, tc := range []struct {
+		name      string
+		handshake distsqlpb.ConsumerHandshake
+		expected  bool
+	}{
+		{
+			// An Inbox without a heartbeat timeout doesn't advertise any version.
+			name:      "Inbox",
+			handshake: distsqlpb.ConsumerHandshake{ConsumerScheduled: true},
+			expected:  false,
+		},
+		{
+			name: "InboxWithHeartbeatTimeout",
+			handshake: distsqlpb.ConsumerHandshake{
+				ConsumerScheduled:  true,
+				Version:            HeartbeatMinVersion,
+				MinAcceptedVersion: HeartbeatMinVersion,
+			},
+			expected: true,
+		},
+		{
+			name: "OldConsumer",
+			handshake: distsqlpb.ConsumerHandshake{
+				ConsumerScheduled:  true,
+				Version:            HeartbeatMinVersion - 1,
+				MinAcceptedVersion: HeartbeatMinVersion - 1,
+			},
+			expected: false,
+		},
+		{
+			// The handshake sent by the flowRegistry while the consumer is not
+			// scheduled yet.
+			name: "FlowRegistry",
+			handshake: distsqlpb.ConsumerHandshake{
+				ConsumerScheduled:  false,
+				Version:            distsqlrun.Version,
+				MinAcceptedVersion: distsqlrun.MinAcceptedVersion,
+			},
+			expected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			outbox, err := NewOutbox(exec.NewBatchBuffer(), typs, nil)
+			require.NoError(t, err)
+			outbox.handleHandshake(context.Background(), &tc.handshake)
+			require.Equal(t, tc.expected, atomic.LoadUint32(&outbox.heartbeatsSupported) == 1)
+		})
+	}
+}
+
+func TestOutboxIncompatibleColumnarFormatVersion(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var (
+		ctx      = context.Background()
+		typs     = []types.T{types.Int64}
+		rpcLayer = makeMockFlowStreamRPCLayer()
+		input    = &blockingOp{unblockCh: make(chan struct{}), zeroBatch: coldata.NewMemBatch(typs)}
+	)
+	// The Outbox must not send this batch, so it doesn't matter that it is
+	// returned forever.
+	input.zeroBatch.SetLength(1)
+
+	outbox, err := NewOutbox(input, typs, nil)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		outbox.runWithStream(ctx, rpcLayer.client, nil /* cancelFn */)
+		wg.Done()
+	}()
+
+	// The consumer only understands format versions that this node can't
+	// produce.
+	require.NoError(t, rpcLayer.server.Send(&distsqlpb.ConsumerSignal{
+		Handshake: &distsqlpb.ConsumerHandshake{
+			ConsumerScheduled:                true,
+			ColumnarFormatVersion:            uint32(CurrentColumnarFormatVersion + 1),
+			MinAcceptedColumnarFormatVersion: uint32(CurrentColumnarFormatVersion + 1),
+		},
+	}))
+	testutils.SucceedsSoon(t, func() error {
+		_, err := outbox.formatVersion()
+		if err == nil {
+			return errors.New("handshake not processed yet")
+		}
+		return nil
+	})
+	close(input.unblockCh)
+
+	// The negotiation error should be sent as metadata instead of the batch.
+	m, err := rpcLayer.server.Recv()
+	require.NoError(t, err)
+	require.True(t, len(m.Data.RawBytes) == 0)
+	require.True(t, len(m.Data.Metadata) == 1)
+	meta, ok := distsqlpb.RemoteProducerMetaToLocalMeta(m.Data.Metadata[0])
+	require.True(t, ok)
+	require.True(t, testutils.IsError(meta.Err, "incompatible columnar format versions"), meta.Err)
+	code, ok := pgerror.GetPGCode(meta.Err)
+	require.True(t, ok)
+	require.Equal(t, pgerror.CodeFeatureNotSupportedError, code)
+
+	close(rpcLayer.server.csChan)
+	wg.Wait()
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package colrpc
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/opentracing/opentracing-go"
+)
+
+// StreamStats are the number of bytes of serialized batches that were
+// transferred on a stream, either sent by an Outbox or received by an Inbox.
+// Metadata and heartbeats are not included.
+type StreamStats struct {
+	// UncompressedBytes is the size of the serialized batches.
+	UncompressedBytes int64
+	// CompressedBytes is the size of the batches on the wire, after
+	// compression. Batches are not compressed yet, so it is always zero.
+	CompressedBytes int64
+}
+
+// streamStats accumulates StreamStats. It can be read concurrently with
+// updates.
+type streamStats struct {
+	uncompressedBytes int64
+	compressedBytes   int64
+}
+
+// add records a batch of the given sizes. compressed is zero if the batch was
+// not compressed.
+func (s *streamStats) add(uncompressed, compressed int) {
+	atomic.AddInt64(&s.uncompressedBytes, int64(uncompressed))
+	atomic.AddInt64(&s.compressedBytes, int64(compressed))
+}
+
+func (s *streamStats) get() StreamStats {
+	return StreamStats{
+		UncompressedBytes: atomic.LoadInt64(&s.uncompressedBytes),
+		CompressedBytes:   atomic.LoadInt64(&s.compressedBytes),
+	}
+}
+
+// recordInSpan sets the stats as tags of the span in ctx, if any, so that
+// they are reported along with the rest of the trace. The tags are named
+// after the given prefix.
+func (s *streamStats) recordInSpan(ctx context.Context, prefix string) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	stats := s.get()
+	span.SetTag(tracing.StatTagPrefix+prefix+"bytes_uncompressed",
+		strconv.FormatInt(stats.UncompressedBytes, 10))
+	span.SetTag(tracing.StatTagPrefix+prefix+"bytes_compressed",
+		strconv.FormatInt(stats.CompressedBytes, 10))
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/sql/exec/coldata"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/pkg/errors"
 )
 
@@ -31,6 +32,8 @@ const panicLineSubstring = "runtime/panic.go"
 // CatchVectorizedRuntimeError executes operation, catches a runtime error if
 // it is coming from the vectorized engine, and returns it. If an error not
 // related to the vectorized engine occurs, it is not recovered from.
+// Errors caused by a context cancellation are returned as a query canceled
+// error.
 func CatchVectorizedRuntimeError(operation func()) (retErr error) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -54,6 +57,14 @@ func CatchVectorizedRuntimeError(operation func()) (retErr error) {
 					switch t := err.(type) {
 					case *pgerror.Error:
 						retErr = t
+					case error:
+						if isContextCanceledError(t) {
+							// Context cancellation is reported the same way as in the
+							// row-based engine.
+							retErr = sqlbase.QueryCanceledError
+						} else {
+							retErr = pgerror.AssertionFailedf("unexpected error from the vectorized runtime: %v", t)
+						}
 					default:
 						retErr = pgerror.AssertionFailedf("unexpected error from the vectorized runtime: %v", t)
 					}
@@ -73,6 +84,13 @@ func CatchVectorizedRuntimeError(operation func()) (retErr error) {
 	return retErr
 }
 
+// isContextCanceledError returns whether err is or wraps an error caused by
+// the cancellation of a context.
+func isContextCanceledError(err error) bool {
+	cause := errors.Cause(err)
+	return cause == context.Canceled || cause == context.DeadlineExceeded
+}
+
 const (
 	execPackagePrefix  = "github.com/cockroachdb/cockroach/pkg/sql/exec"
 	colBatchScanPrefix = "github.com/cockroachdb/cockroach/pkg/sql/distsqlrun.(*colBatchScan)"
@@ -87,6 +105,55 @@ func isPanicFromVectorizedEngine(panicEmittedFrom string) bool {
 		strings.HasPrefix(panicEmittedFrom, colBatchScanPrefix)
 }
 
+// SafeOperator is an Operator that guards every call to its input's Next: if
+// the input panics with an error coming from the vectorized engine, the error
+// is stored (it can be retrieved with Err) and a zero-length batch is returned
+// instead of propagating the panic. Panics that did not originate in the
+// vectorized engine are not recovered from. Once an error has been caught,
+// the input is not called anymore and Next always returns a zero-length batch.
+//
+// SafeOperator allows for isolating a single operator in a pipeline, as
+// opposed to CatchVectorizedRuntimeError which wraps a whole operation.
+type SafeOperator struct {
+	input     Operator
+	zeroBatch coldata.Batch
+	err       error
+}
+
+var _ Operator = &SafeOperator{}
+
+// NewSafeOperator creates a new SafeOperator wrapping input.
+func NewSafeOperator(input Operator) *SafeOperator {
+	zeroBatch := coldata.NewMemBatchWithSize(nil /* types */, 0 /* size */)
+	zeroBatch.SetLength(0)
+	return &SafeOperator{input: input, zeroBatch: zeroBatch}
+}
+
+// Init is part of the Operator interface.
+func (s *SafeOperator) Init() {
+	s.err = CatchVectorizedRuntimeError(s.input.Init)
+}
+
+// Next is part of the Operator interface.
+func (s *SafeOperator) Next(ctx context.Context) coldata.Batch {
+	if s.err != nil {
+		return s.zeroBatch
+	}
+	var batch coldata.Batch
+	if err := CatchVectorizedRuntimeError(func() {
+		batch = s.input.Next(ctx)
+	}); err != nil {
+		s.err = err
+		return s.zeroBatch
+	}
+	return batch
+}
+
+// Err returns the error caught from the input, if any.
+func (s *SafeOperator) Err() error {
+	return s.err
+}
+
 // TestVectorizedErrorEmitter is an Operator that panics on every odd-numbered
 // invocation of Next() and returns the next batch from the input on every
 // even-numbered (i.e. it becomes a noop for those iterations). Used for tests
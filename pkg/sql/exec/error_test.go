@@ -0,0 +1,127 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package exec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/exec/coldata"
+	"github.com/cockroachdb/cockroach/pkg/sql/exec/types"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/pkg/errors"
+)
+
+func TestSafeOperator(t *testing.T) {
+	ctx := context.Background()
+	batch := coldata.NewMemBatch([]types.T{types.Int64})
+	batch.SetLength(coldata.BatchSize)
+	source := NewRepeatableBatchSource(batch)
+
+	// The error emitter panics on the first call to Next.
+	op := NewSafeOperator(NewTestVectorizedErrorEmitter(source))
+	op.Init()
+	if err := op.Err(); err != nil {
+		t.Fatalf("unexpected error after Init: %v", err)
+	}
+	if b := op.Next(ctx); b.Length() != 0 {
+		t.Fatalf("expected a zero-length batch, found length %d", b.Length())
+	}
+	if op.Err() == nil {
+		t.Fatal("expected the panic to be converted into an error")
+	}
+	// The input must not be called again: the error emitter would return a
+	// full batch on the second call.
+	if b := op.Next(ctx); b.Length() != 0 {
+		t.Fatalf("expected a zero-length batch after an error, found length %d", b.Length())
+	}
+
+	// Without any panic, the batches are passed through.
+	op = NewSafeOperator(source)
+	op.Init()
+	if b := op.Next(ctx); b.Length() != coldata.BatchSize {
+		t.Fatalf("expected a batch of length %d, found %d", coldata.BatchSize, b.Length())
+	}
+	if err := op.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// ctxErrOp is an Operator that panics with its context's error once the
+// context is done.
+type ctxErrOp struct {
+	input Operator
+	wrap  bool
+}
+
+func (o *ctxErrOp) Init() {
+	o.input.Init()
+}
+
+func (o *ctxErrOp) Next(ctx context.Context) coldata.Batch {
+	if err := ctx.Err(); err != nil {
+		if o.wrap {
+			err = errors.Wrap(err, "reading input")
+		}
+		panic(err)
+	}
+	return o.input.Next(ctx)
+}
+
+func TestCatchVectorizedRuntimeErrorContextCanceled(t *testing.T) {
+	batch := coldata.NewMemBatch([]types.T{types.Int64})
+	batch.SetLength(coldata.BatchSize)
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	expiredCtx, cancel := context.WithDeadline(context.Background(), timeutil.Now())
+	defer cancel()
+
+	testCases := []struct {
+		name string
+		ctx  context.Context
+		wrap bool
+	}{
+		{"canceled", canceledCtx, false},
+		{"canceled-wrapped", canceledCtx, true},
+		{"deadline", expiredCtx, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			op := &ctxErrOp{input: NewRepeatableBatchSource(batch), wrap: tc.wrap}
+			op.Init()
+			err := CatchVectorizedRuntimeError(func() {
+				op.Next(tc.ctx)
+			})
+			pgErr, ok := pgerror.GetPGCause(err)
+			if !ok {
+				t.Fatalf("expected a pgerror, found %v", err)
+			}
+			if pgErr.Code != pgerror.CodeQueryCanceledError {
+				t.Fatalf("expected code %s, found %s (%v)", pgerror.CodeQueryCanceledError, pgErr.Code, err)
+			}
+		})
+	}
+
+	// Other errors are still reported as unexpected.
+	op := &ctxErrOp{input: NewRepeatableBatchSource(batch)}
+	err := CatchVectorizedRuntimeError(func() {
+		NewTestVectorizedErrorEmitter(op).Next(context.Background())
+	})
+	if pgErr, ok := pgerror.GetPGCause(err); !ok || pgErr.Code == pgerror.CodeQueryCanceledError {
+		t.Fatalf("expected an internal error, found %v", err)
+	}
+}
@@ -836,6 +836,9 @@ func (s *scope) VisitPre(expr tree.Expr) (recurse bool, newExpr tree.Expr) {
 		if err != nil {
 			panic(builderError{err})
 		}
+		if len(t.OrderBy) > 0 {
+			panic(builderError{pgerror.UnimplementedWithIssue(23620, "ORDER BY in aggregate function arguments")})
+		}
 
 		if isGenerator(def) && s.replaceSRFs {
 			expr = s.replaceSRF(t, def)
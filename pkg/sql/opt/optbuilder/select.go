@@ -50,6 +50,10 @@ func (b *Builder) buildDataSource(
 	// NB: The case statements are sorted lexicographically.
 	switch source := texpr.(type) {
 	case *tree.AliasedTableExpr:
+		if source.AsOf != nil {
+			panic(pgerror.Unimplemented("table as of",
+				"AS OF SYSTEM TIME on a table reference is not supported"))
+		}
 		if source.IndexFlags != nil {
 			telemetry.Inc(sqltelemetry.IndexHintUseCounter)
 			indexFlags = source.IndexFlags
@@ -104,6 +108,10 @@ func (b *Builder) buildDataSource(
 		return b.buildDataSource(source.Expr, indexFlags, inScope)
 
 	case *tree.RowsFromExpr:
+		if source.HasColDefLists() {
+			panic(pgerror.Unimplemented("ROWS FROM with col_def_list",
+				"column definition lists in ROWS FROM are not supported"))
+		}
 		return b.buildZip(source.Items, inScope)
 
 	case *tree.Subquery:
@@ -382,6 +390,14 @@ func (b *Builder) buildScan(
 					}
 					panic(builderError{err})
 				}
+				if err := indexFlags.CheckIndexColumns(tab.Index(idx).KeyColumnCount()); err != nil {
+					panic(builderError{err})
+				}
+				if len(indexFlags.ColumnDirections) > 0 {
+					panic(pgerror.Unimplemented(
+						"index flags per-column directions",
+						"per-column ASC/DESC index flags are not supported"))
+				}
 				private.Flags.ForceIndex = true
 				private.Flags.Index = idx
 				private.Flags.Direction = indexFlags.Direction
@@ -576,8 +592,14 @@ func (b *Builder) buildSelect(
 	limit := stmt.Limit
 	with := stmt.With
 
+	if stmt.Locking != nil {
+		panic(pgerror.UnimplementedWithIssue(6583, "locking clauses are not supported"))
+	}
 	for s, ok := wrapped.(*tree.ParenSelect); ok; s, ok = wrapped.(*tree.ParenSelect) {
 		stmt = s.Select
+		if stmt.Locking != nil {
+			panic(pgerror.UnimplementedWithIssue(6583, "locking clauses are not supported"))
+		}
 		if stmt.With != nil {
 			if with != nil {
 				// (WITH ... (WITH ...))
@@ -663,6 +685,9 @@ func (b *Builder) buildSelectClause(
 	if len(sel.Window) > 0 {
 		panic(unimplementedWithIssueDetailf(34251, "", "unsupported window function"))
 	}
+	if sel.Into != nil {
+		panic(pgerror.Unimplemented("select into", "SELECT ... INTO is not supported"))
+	}
 	fromScope := b.buildFrom(sel.From, inScope)
 	b.buildWhere(sel.Where, fromScope)
 
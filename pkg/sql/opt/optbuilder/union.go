@@ -30,6 +30,11 @@ import (
 func (b *Builder) buildUnion(
 	clause *tree.UnionClause, desiredTypes []*types.T, inScope *scope,
 ) (outScope *scope) {
+	if clause.Corresponding {
+		panic(pgerror.Unimplementedf("corresponding",
+			"%v CORRESPONDING is not supported", clause.Type))
+	}
+
 	leftScope := b.buildSelect(clause.Left, desiredTypes, inScope)
 	rightScope := b.buildSelect(clause.Right, desiredTypes, inScope)
 
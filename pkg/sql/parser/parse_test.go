@@ -171,6 +171,8 @@ func TestParse(t *testing.T) {
 		{`CREATE TABLE a (b INT8, c STRING, CONSTRAINT d UNIQUE (b, c) INTERLEAVE IN PARENT d (e, f))`},
 		{`CREATE TABLE a (b INT8, UNIQUE (b))`},
 		{`CREATE TABLE a (b INT8, UNIQUE (b) STORING (c))`},
+		{`CREATE TABLE a (b INT8, UNIQUE NULLS NOT DISTINCT (b))`},
+		{`CREATE TABLE a (b INT8, c STRING, CONSTRAINT d UNIQUE NULLS NOT DISTINCT (b, c) STORING (e))`},
 		{`CREATE TABLE a (b INT8, INDEX (b))`},
 		{`CREATE TABLE a (b INT8, INVERTED INDEX (b))`},
 		{`CREATE TABLE a (b INT8, c INT8 REFERENCES foo)`},
@@ -626,6 +628,18 @@ func TestParse(t *testing.T) {
 		{`SELECT ((((VALUES (1)))))`},
 		{`SELECT EXISTS (SELECT 1)`},
 		{`SELECT (VALUES (1))`},
+		{`SELECT (a, b) OVERLAPS (c, d)`},
+		{`SELECT ROW(a, b) OVERLAPS ROW(c, d)`},
+		{`SELECT NOT ((a, b) OVERLAPS (c, d))`},
+		{`WITH a AS (SELECT 1) SELECT * FROM a`},
+		{`WITH a AS MATERIALIZED (SELECT 1) SELECT * FROM a`},
+		{`WITH a AS NOT MATERIALIZED (SELECT 1) SELECT * FROM a`},
+		{`WITH a (x) AS MATERIALIZED (SELECT 1), b AS NOT MATERIALIZED (SELECT 2), c AS (SELECT 3) SELECT * FROM a, b, c`},
+		{`VALUES (1), (2) ORDER BY 1 LIMIT 1`},
+		{`VALUES (1), (2) ORDER BY column1 DESC LIMIT 1 OFFSET 1`},
+		{`(VALUES (1), (2)) ORDER BY column1 LIMIT 1`},
+		{`(VALUES (1), (2) ORDER BY column1) LIMIT 1`},
+		{`SELECT * FROM (VALUES (1), (2) ORDER BY column1 LIMIT 1) AS t`},
 		{`SELECT (1, 2, 3)`},
 		{`SELECT ((1, 2, 3) AS a, b, c)`},
 		{`SELECT ((1, 2, 3))`},
@@ -639,6 +653,8 @@ func TestParse(t *testing.T) {
 		{`SELECT (TABLE a)`},
 		{`SELECT 0x1`},
 		{`SELECT 'Deutsch' COLLATE de`},
+		{`SELECT a FROM t ORDER BY a COLLATE de DESC`},
+		{`SELECT a FROM t ORDER BY (a || b) COLLATE de_DE ASC, c`},
 		{`SELECT a @> b`},
 		{`SELECT a <@ b`},
 		{`SELECT a ? b`},
@@ -676,8 +692,14 @@ func TestParse(t *testing.T) {
 		{`SELECT 'a' FROM t@like`},
 		{`SELECT 'a' FROM t@{NO_INDEX_JOIN}`},
 		{`SELECT 'a' FROM t@{IGNORE_FOREIGN_KEYS}`},
+		{`SELECT 'a' FROM ONLY t`},
+		{`SELECT 'a' FROM ONLY t@bar AS u`},
+		{`SELECT 'a' FROM ONLY t WITH ORDINALITY, u`},
+		{`SELECT 'a' FROM ONLY t JOIN ONLY u ON true`},
 		{`SELECT 'a' FROM t@{FORCE_INDEX=idx,ASC}`},
 		{`SELECT 'a' FROM t@{FORCE_INDEX=idx,DESC,IGNORE_FOREIGN_KEYS}`},
+		{`SELECT 'a' FROM t@{FORCE_INDEX=idx,ASC,DESC}`},
+		{`SELECT 'a' FROM t@{FORCE_INDEX=[42],DESC,DESC,ASC,IGNORE_FOREIGN_KEYS}`},
 		{`SELECT * FROM t AS "of" AS OF SYSTEM TIME '2016-01-01'`},
 
 		{`SELECT BOOL 'foo', 'foo'::BOOL`},
@@ -753,6 +775,9 @@ func TestParse(t *testing.T) {
 		{`SELECT a FROM (SELECT 1 FROM t) WITH ORDINALITY`},
 		{`SELECT a FROM (SELECT 1 FROM t) WITH ORDINALITY AS bar`},
 		{`SELECT a FROM ROWS FROM (a(x), b(y), c(z))`},
+		{`SELECT a FROM ROWS FROM (json_to_recordset(x) AS (a INT8, b STRING))`},
+		{`SELECT a FROM ROWS FROM (a(x), b(y) AS (c INT8), c(z))`},
+		{`SELECT a FROM ROWS FROM (a(x) AS (c INT8), b(y) AS (d DECIMAL, e STRING[])) AS t (c, d, e)`},
 		{`SELECT a FROM t1, t2`},
 		{`SELECT a FROM t1, LATERAL (SELECT * FROM t2 WHERE a = b)`},
 		{`SELECT a FROM t1, LATERAL ROWS FROM (generate_series(1, t1.x))`},
@@ -762,6 +787,9 @@ func TestParse(t *testing.T) {
 		{`SELECT a FROM s.t`},
 
 		{`SELECT count(DISTINCT a) FROM t`},
+		{`SELECT max(a ORDER BY b) FROM ab`},
+		{`SELECT array_agg(ALL a ORDER BY a DESC, b) FROM t`},
+		{`SELECT string_agg(DISTINCT s, ',' ORDER BY s) FROM t`},
 		{`SELECT count(ALL a) FROM t`},
 
 		{`SELECT a FROM t WHERE a = b`},
@@ -842,6 +870,13 @@ func TestParse(t *testing.T) {
 
 		{`SELECT 1 FROM t GROUP BY a`},
 		{`SELECT 1 FROM t GROUP BY a, b`},
+		{`SELECT 1 FROM t GROUP BY ROLLUP(a, b)`},
+		{`SELECT 1 FROM t GROUP BY CUBE(a, b)`},
+		{`SELECT 1 FROM t GROUP BY a, GROUPING SETS ((b), (c))`},
+		{`SELECT 1 FROM t GROUP BY GROUPING SETS ((a, b), (a), ())`},
+		{`SELECT 1 FROM t GROUP BY a, ROLLUP(b, c), CUBE(d)`},
+		{`SELECT 1 FROM t GROUP BY GROUPING SETS (ROLLUP(a, b), CUBE(c), GROUPING SETS ((d), ()))`},
+		{`SELECT rollup(a), cube(b) FROM t GROUP BY a`},
 
 		{`SELECT a FROM t HAVING a = b`},
 
@@ -929,6 +964,13 @@ func TestParse(t *testing.T) {
 
 		{`SELECT avg(1) FILTER (WHERE a > b)`},
 		{`SELECT avg(1) FILTER (WHERE a > b) OVER (ORDER BY c)`},
+		{`SELECT array_agg(a ORDER BY b DESC) FILTER (WHERE a > 0) FROM t`},
+		{`SELECT string_agg(DISTINCT a, ',' ORDER BY a) FILTER (WHERE a IS NOT NULL) FROM t`},
+		{`SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY a) FROM t`},
+		{`SELECT percentile_disc(0.5) WITHIN GROUP (ORDER BY a DESC) FILTER (WHERE a > 0) FROM t`},
+		{`SELECT mode() WITHIN GROUP (ORDER BY a, b) FROM t`},
+		{`SELECT f(a => 1)`},
+		{`SELECT f(1, b => 2, "C" => c + 1)`},
 
 		{`SELECT a FROM t UNION SELECT 1 FROM t`},
 		{`SELECT a FROM t UNION SELECT 1 FROM t UNION SELECT 1 FROM t`},
@@ -937,6 +979,12 @@ func TestParse(t *testing.T) {
 		{`SELECT a FROM t EXCEPT ALL SELECT 1 FROM t`},
 		{`SELECT a FROM t INTERSECT SELECT 1 FROM t`},
 		{`SELECT a FROM t INTERSECT ALL SELECT 1 FROM t`},
+		{`SELECT a, b FROM t UNION CORRESPONDING SELECT b, a FROM u`},
+		{`SELECT a, b FROM t UNION ALL CORRESPONDING SELECT b, a FROM u`},
+		{`SELECT a, b FROM t UNION CORRESPONDING BY (a, b) SELECT b, a FROM u`},
+		{`SELECT a, b FROM t UNION ALL CORRESPONDING BY (a) SELECT b, a FROM u`},
+		{`SELECT a, b FROM t EXCEPT CORRESPONDING BY (b) SELECT b, a FROM u`},
+		{`SELECT a, b FROM t INTERSECT ALL CORRESPONDING SELECT b, a FROM u`},
 
 		{`SELECT a FROM t1 JOIN t2 ON a = b`},
 		{`SELECT a FROM t1 JOIN t2 USING (a)`},
@@ -958,14 +1006,38 @@ func TestParse(t *testing.T) {
 		{`SELECT a FROM t1 AS OF SYSTEM TIME '2016-01-01'`},
 		{`SELECT a FROM t1, t2 AS OF SYSTEM TIME '2016-01-01'`},
 		{`SELECT a FROM t1 AS OF SYSTEM TIME -('a' || 'b')::INTERVAL`},
+		{`SELECT a FROM t1 AS OF SYSTEM TIME '-10s' JOIN t2 ON t1.a = t2.a`},
+		{`SELECT a FROM t1 JOIN t2 AS OF SYSTEM TIME '-10s' USING (a)`},
+		{`SELECT a FROM t1 AS OF SYSTEM TIME '-10s', t2`},
+		{`SELECT a FROM t1@idx AS OF SYSTEM TIME '-10s' WITH ORDINALITY AS x`},
+		{`SELECT a FROM t1 CROSS JOIN t2 AS OF SYSTEM TIME '-10s'`},
 
 		{`SELECT a FROM t LIMIT a`},
 		{`SELECT a FROM t OFFSET b`},
 		{`SELECT a FROM t LIMIT a OFFSET b`},
+
+		{`SELECT a FROM t FOR UPDATE`},
+		{`SELECT a FROM t FOR NO KEY UPDATE`},
+		{`SELECT a FROM t FOR SHARE`},
+		{`SELECT a FROM t FOR KEY SHARE`},
+		{`SELECT a FROM t FOR UPDATE OF t`},
+		{`SELECT a FROM t, u FOR UPDATE OF t, db.u NOWAIT`},
+		{`SELECT a FROM t FOR SHARE SKIP LOCKED`},
+		{`SELECT a FROM t FOR UPDATE OF t NOWAIT FOR SHARE OF u SKIP LOCKED`},
+		{`SELECT a FROM t ORDER BY a LIMIT 1 FOR UPDATE`},
+		{`WITH w AS (SELECT 1) SELECT a FROM t FOR UPDATE`},
+		{`SELECT a FROM (SELECT a FROM t FOR UPDATE) FOR SHARE`},
+		{`SELECT DISTINCT a FROM t FOR UPDATE NOWAIT`},
 		{`SELECT DISTINCT * FROM t`},
 		{`SELECT DISTINCT a, b FROM t`},
 		{`SELECT DISTINCT ON (a, b) c FROM t`},
 
+		{`SELECT a INTO u FROM t`},
+		{`SELECT a, b INTO db.sc.u FROM t WHERE a > 1`},
+		{`SELECT DISTINCT a INTO TEMP u FROM t`},
+		{`SELECT 1 INTO UNLOGGED u`},
+		{`SELECT a INTO u FROM t UNION SELECT b FROM v`},
+
 		{`SET a = 3`},
 		{`EXPLAIN SET a = 3`},
 		{`SET a = 3, 4`},
@@ -980,12 +1052,20 @@ func TestParse(t *testing.T) {
 		{`SET TRANSACTION PRIORITY NORMAL`},
 		{`SET TRANSACTION PRIORITY HIGH`},
 		{`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, PRIORITY HIGH`},
+		{`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, READ ONLY`},
+		{`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, PRIORITY HIGH, READ WRITE`},
+		{`SET TRANSACTION READ ONLY, AS OF SYSTEM TIME '-1s'`},
+		{`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, PRIORITY LOW, READ ONLY, AS OF SYSTEM TIME '-1s'`},
 
 		{`SET TRACING = off`},
 		{`EXPLAIN SET TRACING = off`},
 		{`SET TRACING = 'cluster', 'kv'`},
 
 		{`SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL SERIALIZABLE`},
+		{`SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY`},
+		{`SET SESSION CHARACTERISTICS AS TRANSACTION PRIORITY LOW`},
+		{`SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL SERIALIZABLE, READ ONLY`},
+		{`SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL SERIALIZABLE, PRIORITY HIGH, READ WRITE`},
 
 		{`SET CLUSTER SETTING a = 3`},
 		{`EXPLAIN SET CLUSTER SETTING a = 3`},
@@ -1065,6 +1145,7 @@ func TestParse(t *testing.T) {
 		{`ALTER TABLE a ADD COLUMN IF NOT EXISTS b INT8, ADD CONSTRAINT a_idx UNIQUE (a)`},
 		{`ALTER TABLE IF EXISTS a ADD COLUMN b INT8, ADD CONSTRAINT a_idx UNIQUE (a)`},
 		{`ALTER TABLE IF EXISTS a ADD COLUMN IF NOT EXISTS b INT8, ADD CONSTRAINT a_idx UNIQUE (a)`},
+		{`ALTER TABLE a ADD CONSTRAINT a_idx UNIQUE NULLS NOT DISTINCT (a)`},
 		{`ALTER TABLE a ADD COLUMN b INT8, ADD CONSTRAINT a_idx UNIQUE (a)`},
 		{`ALTER TABLE a ADD COLUMN IF NOT EXISTS b INT8, ADD CONSTRAINT a_idx UNIQUE (a) NOT VALID`},
 		{`ALTER TABLE IF EXISTS a ADD COLUMN b INT8, ADD CONSTRAINT a_idx UNIQUE (a)`},
@@ -1331,6 +1412,8 @@ func TestParse2(t *testing.T) {
 			`CREATE DATABASE a ENCODING = 'foo'`},
 		{`CREATE DATABASE a TEMPLATE = template0`,
 			`CREATE DATABASE a TEMPLATE = 'template0'`},
+		{`SELECT * FROM t WHERE (s, e) OVERLAPS ('2019-01-01', '2019-01-31') AND a = 1`,
+			`SELECT * FROM t WHERE ((s, e) OVERLAPS ('2019-01-01', '2019-01-31')) AND (a = 1)`},
 		{`CREATE DATABASE a TEMPLATE = invalid`,
 			`CREATE DATABASE a TEMPLATE = 'invalid'`},
 		{`CREATE TABLE a (b INT, UNIQUE INDEX foo (b))`,
@@ -1339,6 +1422,8 @@ func TestParse2(t *testing.T) {
 			`CREATE TABLE a (b INT8, CONSTRAINT foo UNIQUE (b) INTERLEAVE IN PARENT c (d))`},
 		{`CREATE TABLE a (UNIQUE INDEX (b) PARTITION BY LIST (c) (PARTITION d VALUES IN (1)))`,
 			`CREATE TABLE a (UNIQUE (b) PARTITION BY LIST (c) (PARTITION d VALUES IN (1)))`},
+		{`CREATE TABLE a (b INT, UNIQUE NULLS DISTINCT (b))`,
+			`CREATE TABLE a (b INT8, UNIQUE (b))`},
 		{`CREATE INDEX ON a (b) COVERING (c)`, `CREATE INDEX ON a (b) STORING (c)`},
 
 		{`CREATE INDEX a ON b USING GIN (c)`,
@@ -1383,10 +1468,16 @@ func TestParse2(t *testing.T) {
 
 		{`SELECT 'a' FROM t@{FORCE_INDEX=bar}`, `SELECT 'a' FROM t@bar`},
 		{`SELECT 'a' FROM t@{ASC,FORCE_INDEX=idx}`, `SELECT 'a' FROM t@{FORCE_INDEX=idx,ASC}`},
+		{`SELECT 'a' FROM t@{ASC,FORCE_INDEX=idx,DESC}`, `SELECT 'a' FROM t@{FORCE_INDEX=idx,ASC,DESC}`},
 
 		{`SELECT 'a' FROM t@{FORCE_INDEX=[123]}`, `SELECT 'a' FROM t@[123]`},
 		{`SELECT 'a' FROM [123 AS t]@{FORCE_INDEX=[456]}`, `SELECT 'a' FROM [123 AS t]@[456]`},
 
+		// The collation stays attached to the ordering expression, before the
+		// direction.
+		{`SELECT a FROM t ORDER BY name COLLATE "de_DE" DESC`, `SELECT a FROM t ORDER BY name COLLATE de_DE DESC`},
+		{`SELECT a FROM t ORDER BY name COLLATE "de-DE" DESC`, `SELECT a FROM t ORDER BY name COLLATE de_DE DESC`},
+
 		{`SELECT a FROM t WHERE a ISNULL`, `SELECT a FROM t WHERE a IS NULL`},
 		{`SELECT a FROM t WHERE a NOTNULL`, `SELECT a FROM t WHERE a IS NOT NULL`},
 		{`SELECT a FROM t WHERE a IS UNKNOWN`, `SELECT a FROM t WHERE a IS NULL`},
@@ -1533,6 +1624,8 @@ func TestParse2(t *testing.T) {
 			`SELECT a FROM t EXCEPT SELECT 1 FROM t`},
 		{`SELECT a FROM t INTERSECT DISTINCT SELECT 1 FROM t`,
 			`SELECT a FROM t INTERSECT SELECT 1 FROM t`},
+		{`SELECT a FROM t UNION DISTINCT CORRESPONDING BY (a) SELECT a FROM u`,
+			`SELECT a FROM t UNION CORRESPONDING BY (a) SELECT a FROM u`},
 
 		{`SELECT a #- '{x}'`, `SELECT json_remove_path(a, '{x}')`},
 
@@ -1649,8 +1742,14 @@ func TestParse2(t *testing.T) {
 			`SELECT a FROM ROWS FROM (generate_series(1, 32)) AS s (x)`},
 		{`SELECT a FROM generate_series(1, 32) WITH ORDINALITY AS s (x)`,
 			`SELECT a FROM ROWS FROM (generate_series(1, 32)) WITH ORDINALITY AS s (x)`},
+		{`SELECT 'a' FROM ONLY (t)`,
+			`SELECT 'a' FROM ONLY t`},
+		{`SELECT 'a' FROM t *`,
+			`SELECT 'a' FROM t`},
 		{`SELECT a FROM LATERAL generate_series(1, 32)`,
 			`SELECT a FROM LATERAL ROWS FROM (generate_series(1, 32))`},
+		{`SELECT a FROM ROWS FROM (json_to_recordset(x) AS (a int, b text))`,
+			`SELECT a FROM ROWS FROM (json_to_recordset(x) AS (a INT8, b STRING))`},
 
 		// Tuples
 		{`SELECT 1 IN (b)`, `SELECT 1 IN (b,)`},
@@ -1698,6 +1797,20 @@ func TestParse2(t *testing.T) {
 			`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, READ WRITE`},
 		{`SET TRANSACTION ISOLATION LEVEL SNAPSHOT READ ONLY`,
 			`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, READ ONLY`},
+		{`SELECT 1 FROM t GROUP BY rollup (a, b)`,
+			`SELECT 1 FROM t GROUP BY ROLLUP(a, b)`},
+		{`SELECT 1 FROM t GROUP BY cube (a)`,
+			`SELECT 1 FROM t GROUP BY CUBE(a)`},
+		{`SELECT 1 FROM t GROUP BY grouping sets (a, (b, c))`,
+			`SELECT 1 FROM t GROUP BY GROUPING SETS (a, (b, c))`},
+		{`SET TRANSACTION READ ONLY AS OF SYSTEM TIME '-1s'`,
+			`SET TRANSACTION READ ONLY, AS OF SYSTEM TIME '-1s'`},
+		{`SET SESSION TRANSACTION ISOLATION LEVEL SERIALIZABLE READ ONLY`,
+			`SET TRANSACTION ISOLATION LEVEL SERIALIZABLE, READ ONLY`},
+		{`SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL SERIALIZABLE READ ONLY`,
+			`SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL SERIALIZABLE, READ ONLY`},
+		{`SET SESSION CHARACTERISTICS AS TRANSACTION READ WRITE PRIORITY HIGH`,
+			`SET SESSION CHARACTERISTICS AS TRANSACTION PRIORITY HIGH, READ WRITE`},
 		{"SET CLUSTER SETTING a TO 1", "SET CLUSTER SETTING a = 1"},
 		{"SET TRACING TO off", "SET TRACING = off"},
 		{"RELEASE foo", "RELEASE SAVEPOINT foo"},
@@ -2050,6 +2163,11 @@ func TestParse2(t *testing.T) {
 
 		{`CREATE TABLE a (b INT) PARTITION BY RANGE (b) (PARTITION p1 VALUES FROM (MINVALUE) TO (1), PARTITION p2 VALUES FROM (2, MAXVALUE) TO (4, 4), PARTITION p3 VALUES FROM (4, 4) TO (MAXVALUE))`,
 			`CREATE TABLE a (b INT8) PARTITION BY RANGE (b) (PARTITION p1 VALUES FROM (minvalue) TO (1), PARTITION p2 VALUES FROM (2, maxvalue) TO (4, 4), PARTITION p3 VALUES FROM (4, 4) TO (maxvalue))`},
+
+		{`SELECT a INTO TABLE u FROM t`, `SELECT a INTO u FROM t`},
+		{`SELECT a INTO TEMPORARY u FROM t`, `SELECT a INTO TEMP u FROM t`},
+		{`SELECT a INTO TEMP TABLE u FROM t`, `SELECT a INTO TEMP u FROM t`},
+		{`SELECT a INTO UNLOGGED TABLE u FROM t`, `SELECT a INTO UNLOGGED u FROM t`},
 	}
 	for _, d := range testData {
 		t.Run(d.sql, func(t *testing.T) {
@@ -2070,6 +2188,44 @@ func TestParse2(t *testing.T) {
 	}
 }
 
+// TestParseReferenceActions verifies that every combination of ON DELETE and
+// ON UPDATE referential actions round-trips through the parser and formatter,
+// both for table-level and column-level foreign key constraints.
+func TestParseReferenceActions(t *testing.T) {
+	actions := []string{``, `NO ACTION`, `RESTRICT`, `SET NULL`, `SET DEFAULT`, `CASCADE`}
+	// The formatter omits NO ACTION, since it is the default.
+	clause := func(op, action string, omitDefault bool) string {
+		if action == `` || (omitDefault && action == `NO ACTION`) {
+			return ``
+		}
+		return fmt.Sprintf(` ON %s %s`, op, action)
+	}
+	forms := []string{
+		`CREATE TABLE a (b INT8, FOREIGN KEY (b) REFERENCES other%s)`,
+		`CREATE TABLE a (b INT8, CONSTRAINT fk FOREIGN KEY (b) REFERENCES other (c) MATCH FULL%s)`,
+		`CREATE TABLE a (b INT8 REFERENCES other%s)`,
+		`ALTER TABLE a ADD CONSTRAINT fk FOREIGN KEY (b) REFERENCES other (c)%s`,
+	}
+	for _, form := range forms {
+		for _, del := range actions {
+			for _, upd := range actions {
+				sql := fmt.Sprintf(form, clause(`DELETE`, del, false)+clause(`UPDATE`, upd, false))
+				expected := fmt.Sprintf(form, clause(`DELETE`, del, true)+clause(`UPDATE`, upd, true))
+				t.Run(sql, func(t *testing.T) {
+					stmts, err := parser.Parse(sql)
+					if err != nil {
+						t.Fatalf("%s: expected success, but found %s", sql, err)
+					}
+					if s := stmts.String(); s != expected {
+						t.Errorf("expected \n%q\n, but found \n%q", expected, s)
+					}
+					sqlutils.VerifyStatementPrettyRoundtrip(t, expected)
+				})
+			}
+		}
+	}
+}
+
 // TestParseTree checks that the implicit grouping done by the grammar
 // is properly reflected in the parse tree.
 func TestParseTree(t *testing.T) {
@@ -2342,6 +2498,13 @@ SELECT a FROM foo@{ASC}
 			`syntax error: ASC/DESC must be specified in conjunction with an index at or near "}"
 SELECT a FROM foo@{DESC}
                        ^
+`,
+		},
+		{
+			`SELECT a FROM foo@{ASC,DESC}`,
+			`syntax error: ASC/DESC must be specified in conjunction with an index at or near "}"
+SELECT a FROM foo@{ASC,DESC}
+                           ^
 `,
 		},
 		{
@@ -2583,6 +2746,48 @@ CREATE STATISTICS a ON col1 FROM t WITH OPTIONS THROTTLING 0.1 THROTTLING 0.5
 			`syntax error: AS OF specified multiple times at or near "EOF"
 CREATE STATISTICS a ON col1 FROM t WITH OPTIONS AS OF SYSTEM TIME '-1s' THROTTLING 0.1 AS OF SYSTEM TIME '-2s'
                                                                                                               ^
+`,
+		},
+		{
+			`SELECT a FROM t FOR UPDATE OF t NOWAIT FOR SHARE OF t SKIP LOCKED`,
+			`syntax error: conflicting wait policies NOWAIT and SKIP LOCKED for table t at or near "EOF"
+SELECT a FROM t FOR UPDATE OF t NOWAIT FOR SHARE OF t SKIP LOCKED
+                                                                 ^
+`,
+		},
+		{
+			`SELECT DISTINCT a FROM t FOR UPDATE SKIP LOCKED`,
+			`syntax error: SKIP LOCKED is not allowed with DISTINCT clause at or near "EOF"
+SELECT DISTINCT a FROM t FOR UPDATE SKIP LOCKED
+                                               ^
+`,
+		},
+		{
+			`SELECT a FROM t GROUP BY a FOR SHARE SKIP LOCKED`,
+			`syntax error: SKIP LOCKED is not allowed with GROUP BY clause at or near "EOF"
+SELECT a FROM t GROUP BY a FOR SHARE SKIP LOCKED
+                                                ^
+`,
+		},
+		{
+			`SELECT sum(a) WITHIN GROUP (ORDER BY a)`,
+			`syntax error: WITHIN GROUP is specified, but sum is not an ordered-set aggregate at or near "EOF"
+SELECT sum(a) WITHIN GROUP (ORDER BY a)
+                                       ^
+`,
+		},
+		{
+			`SELECT f(a => 1, 2)`,
+			`syntax error: positional argument cannot follow named argument at or near "EOF"
+SELECT f(a => 1, 2)
+                   ^
+`,
+		},
+		{
+			`SELECT f(a => 1, a => 2)`,
+			`syntax error: argument name "a" used more than once at or near "EOF"
+SELECT f(a => 1, a => 2)
+                        ^
 `,
 		},
 	}
@@ -2935,11 +3140,6 @@ func TestUnimplementedSyntax(t *testing.T) {
 		{`INSERT INTO foo(a, a.b) VALUES (1,2)`, 27792, ``},
 		{`INSERT INTO foo VALUES (1,2) ON CONFLICT ON CONSTRAINT a DO NOTHING`, 28161, ``},
 
-		{`SELECT max(a ORDER BY b) FROM ab`, 23620, ``},
-
-		{`SELECT * FROM a FOR UPDATE`, 6583, ``},
-		{`SELECT * FROM ROWS FROM (a(b) AS (d))`, 0, `ROWS FROM with col_def_list`},
-
 		{`SELECT 123 AT TIME ZONE 'b'`, 32005, ``},
 
 		{`SELECT 'a'::INTERVAL SECOND`, 0, `interval with unit qualifier`},
@@ -2962,7 +3162,6 @@ func TestUnimplementedSyntax(t *testing.T) {
 		{`SELECT TIMETZ(3) 'a'`, 26097, `type with precision`},
 
 		{`SELECT a(b) 'c'`, 0, `a(...) SCONST`},
-		{`SELECT (a,b) OVERLAPS (c,d)`, 0, `overlaps`},
 		{`SELECT UNIQUE (SELECT b)`, 0, `UNIQUE predicate`},
 		{`SELECT GROUPING (a,b,c)`, 0, `d_expr grouping`},
 		{`SELECT a(VARIADIC b)`, 0, `variadic`},
@@ -2971,7 +3170,6 @@ func TestUnimplementedSyntax(t *testing.T) {
 		{`SELECT CURRENT_TIME`, 26097, `current_time`},
 		{`SELECT CURRENT_TIME()`, 26097, `current_time`},
 		{`SELECT TREAT (a AS INT8)`, 0, `treat`},
-		{`SELECT a(b) WITHIN GROUP (ORDER BY c)`, 0, `within group`},
 
 		{`CREATE TABLE a(b BOX)`, 21286, `box`},
 		{`CREATE TABLE a(b CIDR)`, 18846, `cidr`},
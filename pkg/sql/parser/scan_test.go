@@ -48,6 +48,7 @@ func TestScanner(t *testing.T) {
 		{`>>`, []int{RSHIFT}},
 		{`>>=`, []int{INET_CONTAINS_OR_EQUALS}},
 		{`=`, []int{'='}},
+		{`=>`, []int{EQUALS_GREATER}},
 		{`:`, []int{':'}},
 		{`::`, []int{TYPECAST}},
 		{`:: :`, []int{TYPECAST, ':'}},
@@ -58,6 +58,63 @@ func unimplementedWithIssueDetail(sqllex sqlLexer, issue int, detail string) int
     sqllex.(*lexer).UnimplementedWithIssueDetail(issue, detail)
     return 1
 }
+
+// hoistTrailingAsOf removes and returns the AS OF SYSTEM TIME clause that
+// ends the given FROM list, if any. Such a clause is parsed as part of the last
+// table reference (see opt_table_as_of_clause), but it applies to the whole
+// statement, as it did before table references could have their own.
+func hoistTrailingAsOf(tables tree.TableExprs) tree.AsOfClause {
+    if len(tables) == 0 {
+        return tree.AsOfClause{}
+    }
+    expr := tables[len(tables)-1]
+    for {
+        switch t := expr.(type) {
+        case *tree.JoinTableExpr:
+            // The right operand ends the join unless it is followed by a
+            // join condition.
+            switch t.Cond.(type) {
+            case nil, tree.NaturalJoinCond:
+                expr = t.Right
+                continue
+            }
+        case *tree.AliasedTableExpr:
+            if t.AsOf != nil && !t.Ordinality && t.As.Alias == "" {
+                asOf := *t.AsOf
+                t.AsOf = nil
+                return asOf
+            }
+        }
+        return tree.AsOfClause{}
+    }
+}
+
+// checkSelect verifies the placement of the INTO and locking clauses of sel,
+// which the grammar does not restrict by itself.
+func checkSelect(sel *tree.Select) error {
+    if err := sel.ValidateInto(); err != nil {
+        return err
+    }
+    return sel.Locking.Check(sel.Select)
+}
+
+// funcArgList holds the arguments of a function application. The names
+// are parallel to the expressions and are empty for positional arguments.
+type funcArgList struct {
+    exprs tree.Exprs
+    names []tree.Name
+}
+
+// argNames returns the argument names in the form expected by
+// tree.FuncExpr: nil if all the arguments are positional.
+func (l funcArgList) argNames() []tree.Name {
+    for _, name := range l.names {
+        if name != "" {
+            return l.names
+        }
+    }
+    return nil
+}
 %}
 
 %{
@@ -254,6 +311,9 @@ func (u *sqlSymUnion) expr() tree.Expr {
 func (u *sqlSymUnion) exprs() tree.Exprs {
     return u.val.(tree.Exprs)
 }
+func (u *sqlSymUnion) funcArgList() funcArgList {
+    return u.val.(funcArgList)
+}
 func (u *sqlSymUnion) selExpr() tree.SelectExpr {
     return u.val.(tree.SelectExpr)
 }
@@ -269,6 +329,9 @@ func (u *sqlSymUnion) aliasClause() tree.AliasClause {
 func (u *sqlSymUnion) asOfClause() tree.AsOfClause {
     return u.val.(tree.AsOfClause)
 }
+func (u *sqlSymUnion) asOfClausePtr() *tree.AsOfClause {
+    return u.val.(*tree.AsOfClause)
+}
 func (u *sqlSymUnion) tblExpr() tree.TableExpr {
     return u.val.(tree.TableExpr)
 }
@@ -278,6 +341,9 @@ func (u *sqlSymUnion) tblExprs() tree.TableExprs {
 func (u *sqlSymUnion) from() *tree.From {
     return u.val.(*tree.From)
 }
+func (u *sqlSymUnion) intoClause() *tree.IntoClause {
+    return u.val.(*tree.IntoClause)
+}
 func (u *sqlSymUnion) int32s() []int32 {
     return u.val.([]int32)
 }
@@ -299,6 +365,18 @@ func (u *sqlSymUnion) updateExprs() tree.UpdateExprs {
 func (u *sqlSymUnion) limit() *tree.Limit {
     return u.val.(*tree.Limit)
 }
+func (u *sqlSymUnion) lockingClause() tree.LockingClause {
+    return u.val.(tree.LockingClause)
+}
+func (u *sqlSymUnion) lockingItem() *tree.LockingItem {
+    return u.val.(*tree.LockingItem)
+}
+func (u *sqlSymUnion) lockingStrength() tree.LockingStrength {
+    return u.val.(tree.LockingStrength)
+}
+func (u *sqlSymUnion) lockingWaitPolicy() tree.LockingWaitPolicy {
+    return u.val.(tree.LockingWaitPolicy)
+}
 func (u *sqlSymUnion) targetList() tree.TargetList {
     return u.val.(tree.TargetList)
 }
@@ -317,6 +395,9 @@ func (u *sqlSymUnion) onConflict() *tree.OnConflict {
 func (u *sqlSymUnion) orderBy() tree.OrderBy {
     return u.val.(tree.OrderBy)
 }
+func (u *sqlSymUnion) orderByPtr() *tree.OrderBy {
+    return u.val.(*tree.OrderBy)
+}
 func (u *sqlSymUnion) order() *tree.Order {
     return u.val.(*tree.Order)
 }
@@ -452,6 +533,15 @@ func (u *sqlSymUnion) resolvableFuncRefFromName() tree.ResolvableFunctionReferen
 func (u *sqlSymUnion) rowsFromExpr() *tree.RowsFromExpr {
     return u.val.(*tree.RowsFromExpr)
 }
+func (u *sqlSymUnion) colDefListElem() tree.ColumnDef {
+    return u.val.(tree.ColumnDef)
+}
+func (u *sqlSymUnion) colDefList() tree.ColumnDefList {
+    if colDefs, ok := u.val.(tree.ColumnDefList); ok {
+        return colDefs
+    }
+    return nil
+}
 func newNameFromStr(s string) *tree.Name {
     return (*tree.Name)(&s)
 }
@@ -465,7 +555,7 @@ func newNameFromStr(s string) *tree.Name {
 %token <*tree.NumVal> ICONST FCONST
 %token <*tree.Placeholder> PLACEHOLDER
 %token <str> TYPECAST TYPEANNOTATE DOT_DOT
-%token <str> LESS_EQUALS GREATER_EQUALS NOT_EQUALS
+%token <str> LESS_EQUALS GREATER_EQUALS NOT_EQUALS EQUALS_GREATER
 %token <str> NOT_REGMATCH REGIMATCH NOT_REGIMATCH
 %token <str> ERROR
 
@@ -485,7 +575,7 @@ func newNameFromStr(s string) *tree.Name {
 %token <str> CHARACTER CHARACTERISTICS CHECK
 %token <str> CLUSTER COALESCE COLLATE COLLATION COLUMN COLUMNS COMMENT COMMIT
 %token <str> COMMITTED COMPACT CONCAT CONFIGURATION CONFIGURATIONS CONFIGURE
-%token <str> CONFLICT CONSTRAINT CONSTRAINTS CONTAINS CONVERSION COPY COVERING CREATE
+%token <str> CONFLICT CONSTRAINT CONSTRAINTS CONTAINS CONVERSION COPY CORRESPONDING COVERING CREATE
 %token <str> CROSS CUBE CURRENT CURRENT_CATALOG CURRENT_DATE CURRENT_SCHEMA
 %token <str> CURRENT_ROLE CURRENT_TIME CURRENT_TIMESTAMP
 %token <str> CURRENT_USER CYCLE
@@ -519,13 +609,13 @@ func newNameFromStr(s string) *tree.Name {
 %token <str> KEY KEYS KV
 
 %token <str> LANGUAGE LATERAL LC_CTYPE LC_COLLATE
-%token <str> LEADING LEASE LEAST LEFT LESS LEVEL LIKE LIMIT LIST LOCAL
+%token <str> LEADING LEASE LEAST LEFT LESS LEVEL LIKE LIMIT LIST LOCAL LOCKED
 %token <str> LOCALTIME LOCALTIMESTAMP LOOKUP LOW LSHIFT
 
 %token <str> MATCH MATERIALIZED MERGE MINVALUE MAXVALUE MINUTE MONTH
 
 %token <str> NAN NAME NAMES NATURAL NEXT NO NO_INDEX_JOIN NORMAL
-%token <str> NOT NOTHING NOTNULL NULL NULLIF NUMERIC
+%token <str> NOT NOTHING NOTNULL NOWAIT NULL NULLIF NULLS NUMERIC
 
 %token <str> OF OFF OFFSET OID OIDS OIDVECTOR ON ONLY OPT OPTION OPTIONS OR
 %token <str> ORDER ORDINALITY OUT OUTER OVER OVERLAPS OVERLAY OWNED OPERATOR
@@ -544,8 +634,8 @@ func newNameFromStr(s string) *tree.Name {
 
 %token <str> SAVEPOINT SCATTER SCHEMA SCHEMAS SCRUB SEARCH SECOND SELECT SEQUENCE SEQUENCES
 %token <str> SERIAL SERIAL2 SERIAL4 SERIAL8
-%token <str> SERIALIZABLE SERVER SESSION SESSIONS SESSION_USER SET SETTING SETTINGS
-%token <str> SHOW SIMILAR SIMPLE SMALLINT SMALLSERIAL SNAPSHOT SOME SPLIT SQL
+%token <str> SERIALIZABLE SERVER SESSION SESSIONS SESSION_USER SET SETS SETTING SETTINGS
+%token <str> SHARE SHOW SIMILAR SIMPLE SKIP SMALLINT SMALLSERIAL SNAPSHOT SOME SPLIT SQL
 
 %token <str> START STATISTICS STATUS STDIN STRICT STRING STORE STORED STORING SUBSTRING
 %token <str> SYMMETRIC SYNTAX SYSTEM SUBSCRIPTION
@@ -820,10 +910,13 @@ func newNameFromStr(s string) *tree.Name {
 %type <tree.NameList> name_list privilege_list
 %type <[]int32> opt_array_bounds
 %type <*tree.From> from_clause update_from_clause
-%type <tree.TableExprs> from_list rowsfrom_list
+%type <tree.TableExprs> from_list
 %type <tree.TablePatterns> table_pattern_list single_table_pattern_list
 %type <tree.TableNames> table_name_list
 %type <tree.Exprs> expr_list opt_expr_list tuple1_ambiguous_values tuple1_unambiguous_values
+%type <funcArgList> func_arg_list func_arg_expr
+%type <tree.Exprs> group_by_list
+%type <tree.Expr> group_by_item rollup_clause cube_clause grouping_sets_clause
 %type <*tree.Tuple> expr_tuple1_ambiguous expr_tuple_unambiguous
 %type <tree.NameList> attrs
 %type <tree.SelectExprs> target_list
@@ -832,6 +925,13 @@ func newNameFromStr(s string) *tree.Name {
 %type <tree.ArraySubscripts> array_subscripts
 %type <tree.GroupBy> group_clause
 %type <*tree.Limit> select_limit
+%type <*tree.IntoClause> opt_into_clause
+%type <*tree.AsOfClause> opt_table_as_of_clause
+%type <tree.LockingClause> opt_for_locking_clause for_locking_items
+%type <*tree.LockingItem> for_locking_item
+%type <tree.LockingStrength> for_locking_strength
+%type <tree.TableNames> opt_locked_rels
+%type <tree.LockingWaitPolicy> opt_nowait_or_skip
 %type <tree.TableNames> relation_expr_list
 %type <tree.ReturningClause> returning_clause
 
@@ -854,7 +954,7 @@ func newNameFromStr(s string) *tree.Name {
 %type <tree.DurationField> opt_interval interval_second interval_qualifier
 %type <tree.Expr> overlay_placing
 
-%type <bool> opt_unique opt_cluster
+%type <bool> opt_unique opt_cluster opt_nulls_not_distinct
 %type <bool> opt_using_gin_btree
 
 %type <*tree.Limit> limit_clause offset_clause opt_limit_clause
@@ -864,7 +964,7 @@ func newNameFromStr(s string) *tree.Name {
 %type <empty> first_or_next
 
 %type <tree.Statement> insert_rest
-%type <tree.NameList> opt_conf_expr opt_col_def_list
+%type <tree.NameList> opt_conf_expr opt_corresponding_clause
 %type <*tree.OnConflict> on_conflict
 
 %type <tree.Statement> begin_transaction
@@ -897,9 +997,10 @@ func newNameFromStr(s string) *tree.Name {
 %type <bool> opt_ordinality opt_compact opt_automatic
 %type <*tree.Order> sortby
 %type <tree.IndexElem> index_elem
-%type <tree.TableExpr> table_ref func_table
-%type <tree.Exprs> rowsfrom_list
-%type <tree.Expr> rowsfrom_item
+%type <tree.TableExpr> table_ref func_table from_relation_expr
+%type <*tree.RowsFromExpr> rowsfrom_list rowsfrom_item
+%type <tree.ColumnDefList> opt_col_def_list col_def_list
+%type <tree.ColumnDef> col_def_list_elem
 %type <tree.TableExpr> joined_table
 %type <*tree.UnresolvedObjectName> relation_expr
 %type <tree.TableExpr> table_name_expr_opt_alias_idx table_name_expr_with_index
@@ -958,7 +1059,7 @@ func newNameFromStr(s string) *tree.Name {
 %type <[]*tree.CTE> cte_list
 %type <*tree.CTE> common_table_expr
 
-%type <empty> within_group_clause
+%type <*tree.OrderBy> within_group_clause
 %type <tree.Expr> filter_clause
 %type <tree.Exprs> opt_partition_clause
 %type <tree.Window> window_clause window_definition_list
@@ -985,6 +1086,8 @@ func newNameFromStr(s string) *tree.Name {
 // Precedence: lowest to highest
 %nonassoc  VALUES              // see value_clause
 %nonassoc  SET                 // see table_name_expr_opt_alias_idx
+%nonassoc  NO_TABLE_AS_OF      // dummy for the empty opt_table_as_of_clause
+%nonassoc  AS_LA               // see opt_table_as_of_clause
 %left      UNION EXCEPT
 %left      INTERSECT
 %left      OR
@@ -3940,7 +4043,7 @@ pause_stmt:
 // Table constraints:
 //    PRIMARY KEY ( <colnames...> )
 //    FOREIGN KEY ( <colnames...> ) REFERENCES <tablename> [( <colnames...> )] [ON DELETE {NO ACTION | RESTRICT}] [ON UPDATE {NO ACTION | RESTRICT}]
-//    UNIQUE ( <colnames... ) [STORING ( <colnames...> )] [<interleave>]
+//    UNIQUE [NULLS [NOT] DISTINCT] ( <colnames... ) [STORING ( <colnames...> )] [<interleave>]
 //    CHECK ( <expr> )
 //
 // Column qualifiers:
@@ -4361,15 +4464,16 @@ constraint_elem:
       Expr: $3.expr(),
     }
   }
-| UNIQUE '(' index_params ')' opt_storing opt_interleave opt_partition_by  opt_deferrable
+| UNIQUE opt_nulls_not_distinct '(' index_params ')' opt_storing opt_interleave opt_partition_by  opt_deferrable
   {
     $$.val = &tree.UniqueConstraintTableDef{
       IndexTableDef: tree.IndexTableDef{
-        Columns: $3.idxElems(),
-        Storing: $5.nameList(),
-        Interleave: $6.interleave(),
-        PartitionBy: $7.partitionBy(),
+        Columns: $4.idxElems(),
+        Storing: $6.nameList(),
+        Interleave: $7.interleave(),
+        PartitionBy: $8.partitionBy(),
       },
+      NullsNotDistinct: $2.bool(),
     }
   }
 | PRIMARY KEY '(' index_params ')'
@@ -4805,6 +4909,20 @@ opt_unique:
     $$.val = false
   }
 
+opt_nulls_not_distinct:
+  NULLS NOT DISTINCT
+  {
+    $$.val = true
+  }
+| NULLS DISTINCT
+  {
+    $$.val = false
+  }
+| /* EMPTY */
+  {
+    $$.val = false
+  }
+
 index_params:
   index_elem
   {
@@ -5484,34 +5602,123 @@ select_with_parens:
 //      clause.
 //      - 2002-08-28 bjm
 select_no_parens:
-  simple_select opt_for
+  simple_select opt_for_locking_clause
   {
-    $$.val = &tree.Select{Select: $1.selectStmt()}
+    sel := &tree.Select{Select: $1.selectStmt(), Locking: $2.lockingClause()}
+    if err := checkSelect(sel); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = sel
   }
-| select_clause sort_clause opt_for
+| select_clause sort_clause opt_for_locking_clause
   {
-    $$.val = &tree.Select{Select: $1.selectStmt(), OrderBy: $2.orderBy()}
+    sel := &tree.Select{Select: $1.selectStmt(), OrderBy: $2.orderBy(), Locking: $3.lockingClause()}
+    if err := checkSelect(sel); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = sel
   }
-| select_clause opt_sort_clause select_limit opt_for
+| select_clause opt_sort_clause select_limit opt_for_locking_clause
   {
-    $$.val = &tree.Select{Select: $1.selectStmt(), OrderBy: $2.orderBy(), Limit: $3.limit()}
+    sel := &tree.Select{Select: $1.selectStmt(), OrderBy: $2.orderBy(), Limit: $3.limit(), Locking: $4.lockingClause()}
+    if err := checkSelect(sel); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = sel
   }
-| with_clause select_clause opt_for
+| with_clause select_clause opt_for_locking_clause
   {
-    $$.val = &tree.Select{With: $1.with(), Select: $2.selectStmt()}
+    sel := &tree.Select{With: $1.with(), Select: $2.selectStmt(), Locking: $3.lockingClause()}
+    if err := checkSelect(sel); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = sel
   }
-| with_clause select_clause sort_clause opt_for
+| with_clause select_clause sort_clause opt_for_locking_clause
   {
-    $$.val = &tree.Select{With: $1.with(), Select: $2.selectStmt(), OrderBy: $3.orderBy()}
+    sel := &tree.Select{With: $1.with(), Select: $2.selectStmt(), OrderBy: $3.orderBy(), Locking: $4.lockingClause()}
+    if err := checkSelect(sel); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = sel
   }
-| with_clause select_clause opt_sort_clause select_limit opt_for
+| with_clause select_clause opt_sort_clause select_limit opt_for_locking_clause
   {
-    $$.val = &tree.Select{With: $1.with(), Select: $2.selectStmt(), OrderBy: $3.orderBy(), Limit: $4.limit()}
+    sel := &tree.Select{With: $1.with(), Select: $2.selectStmt(), OrderBy: $3.orderBy(), Limit: $4.limit(), Locking: $5.lockingClause()}
+    if err := checkSelect(sel); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = sel
   }
 
-opt_for:
-  /* EMPTY */ { /* no error */ }
-| FOR error { return unimplementedWithIssue(sqllex, 6583) }
+opt_for_locking_clause:
+  for_locking_items
+| /* EMPTY */
+  {
+    $$.val = tree.LockingClause(nil)
+  }
+
+for_locking_items:
+  for_locking_item
+  {
+    $$.val = tree.LockingClause{$1.lockingItem()}
+  }
+| for_locking_items for_locking_item
+  {
+    $$.val = append($1.lockingClause(), $2.lockingItem())
+  }
+
+for_locking_item:
+  for_locking_strength opt_locked_rels opt_nowait_or_skip
+  {
+    $$.val = &tree.LockingItem{
+      Strength:   $1.lockingStrength(),
+      Targets:    $2.tableNames(),
+      WaitPolicy: $3.lockingWaitPolicy(),
+    }
+  }
+
+for_locking_strength:
+  FOR UPDATE
+  {
+    $$.val = tree.ForUpdate
+  }
+| FOR NO KEY UPDATE
+  {
+    $$.val = tree.ForNoKeyUpdate
+  }
+| FOR SHARE
+  {
+    $$.val = tree.ForShare
+  }
+| FOR KEY SHARE
+  {
+    $$.val = tree.ForKeyShare
+  }
+
+opt_locked_rels:
+  /* EMPTY */
+  {
+    $$.val = tree.TableNames(nil)
+  }
+| OF table_name_list
+  {
+    $$.val = $2.tableNames()
+  }
+
+opt_nowait_or_skip:
+  /* EMPTY */
+  {
+    $$.val = tree.LockWaitBlock
+  }
+| SKIP LOCKED
+  {
+    $$.val = tree.LockWaitSkip
+  }
+| NOWAIT
+  {
+    $$.val = tree.LockWaitError
+  }
 
 select_clause:
 // We only provide help if an open parenthesis is provided, because
@@ -5561,6 +5768,7 @@ simple_select:
 // %Text:
 // SELECT [DISTINCT [ ON ( <expr> [ , ... ] ) ] ]
 //        { <expr> [[AS] <name>] | [ [<dbname>.] <tablename>. ] * } [, ...]
+//        [ INTO [ TEMP | UNLOGGED ] [ TABLE ] <tablename> ]
 //        [ FROM <source> ]
 //        [ WHERE <expr> ]
 //        [ GROUP BY <expr> [ , ... ] ]
@@ -5570,36 +5778,40 @@ simple_select:
 //        [ ORDER BY <expr> [ ASC | DESC ] [, ...] ]
 //        [ LIMIT { <expr> | ALL } ]
 //        [ OFFSET <expr> [ ROW | ROWS ] ]
+//        [ FOR { UPDATE | NO KEY UPDATE | SHARE | KEY SHARE } [ OF <tablename> [, ...] ]
+//              [ NOWAIT | SKIP LOCKED ] [...] ]
 // %SeeAlso: WEBDOCS/select-clause.html
 simple_select_clause:
-  SELECT opt_all_clause target_list
+  SELECT opt_all_clause target_list opt_into_clause
     from_clause opt_where_clause
     group_clause having_clause window_clause
   {
     $$.val = &tree.SelectClause{
       Exprs:   $3.selExprs(),
-      From:    $4.from(),
-      Where:   tree.NewWhere(tree.AstWhere, $5.expr()),
-      GroupBy: $6.groupBy(),
-      Having:  tree.NewWhere(tree.AstHaving, $7.expr()),
-      Window:  $8.window(),
+      Into:    $4.intoClause(),
+      From:    $5.from(),
+      Where:   tree.NewWhere(tree.AstWhere, $6.expr()),
+      GroupBy: $7.groupBy(),
+      Having:  tree.NewWhere(tree.AstHaving, $8.expr()),
+      Window:  $9.window(),
     }
   }
-| SELECT distinct_clause target_list
+| SELECT distinct_clause target_list opt_into_clause
     from_clause opt_where_clause
     group_clause having_clause window_clause
   {
     $$.val = &tree.SelectClause{
       Distinct: $2.bool(),
       Exprs:    $3.selExprs(),
-      From:     $4.from(),
-      Where:    tree.NewWhere(tree.AstWhere, $5.expr()),
-      GroupBy:  $6.groupBy(),
-      Having:   tree.NewWhere(tree.AstHaving, $7.expr()),
-      Window:   $8.window(),
+      Into:     $4.intoClause(),
+      From:     $5.from(),
+      Where:    tree.NewWhere(tree.AstWhere, $6.expr()),
+      GroupBy:  $7.groupBy(),
+      Having:   tree.NewWhere(tree.AstHaving, $8.expr()),
+      Window:   $9.window(),
     }
   }
-| SELECT distinct_on_clause target_list
+| SELECT distinct_on_clause target_list opt_into_clause
     from_clause opt_where_clause
     group_clause having_clause window_clause
   {
@@ -5607,41 +5819,76 @@ simple_select_clause:
       Distinct:   true,
       DistinctOn: $2.distinctOn(),
       Exprs:      $3.selExprs(),
-      From:       $4.from(),
-      Where:      tree.NewWhere(tree.AstWhere, $5.expr()),
-      GroupBy:    $6.groupBy(),
-      Having:     tree.NewWhere(tree.AstHaving, $7.expr()),
-      Window:     $8.window(),
+      Into:       $4.intoClause(),
+      From:       $5.from(),
+      Where:      tree.NewWhere(tree.AstWhere, $6.expr()),
+      GroupBy:    $7.groupBy(),
+      Having:     tree.NewWhere(tree.AstHaving, $8.expr()),
+      Window:     $9.window(),
     }
   }
 | SELECT error // SHOW HELP: SELECT
 
+// The INTO clause of SELECT ... INTO, which creates a new table from the
+// results of the query. As in Postgres, LOCAL and GLOBAL are not accepted
+// here since they would be ambiguous.
+opt_into_clause:
+  INTO opt_table table_name
+  {
+    $$.val = &tree.IntoClause{Table: $3.unresolvedObjectName().ToTableName()}
+  }
+| INTO TEMPORARY opt_table table_name
+  {
+    $$.val = &tree.IntoClause{Persistence: tree.IntoTemporary, Table: $4.unresolvedObjectName().ToTableName()}
+  }
+| INTO TEMP opt_table table_name
+  {
+    $$.val = &tree.IntoClause{Persistence: tree.IntoTemporary, Table: $4.unresolvedObjectName().ToTableName()}
+  }
+| INTO UNLOGGED opt_table table_name
+  {
+    $$.val = &tree.IntoClause{Persistence: tree.IntoUnlogged, Table: $4.unresolvedObjectName().ToTableName()}
+  }
+| /* EMPTY */
+  {
+    $$.val = (*tree.IntoClause)(nil)
+  }
+
 set_operation:
-  select_clause UNION all_or_distinct select_clause
+  select_clause UNION all_or_distinct opt_corresponding_clause select_clause
   {
+    corresponding := $4.nameList()
     $$.val = &tree.UnionClause{
-      Type:  tree.UnionOp,
-      Left:  &tree.Select{Select: $1.selectStmt()},
-      Right: &tree.Select{Select: $4.selectStmt()},
-      All:   $3.bool(),
+      Type:              tree.UnionOp,
+      Left:              &tree.Select{Select: $1.selectStmt()},
+      Right:             &tree.Select{Select: $5.selectStmt()},
+      All:               $3.bool(),
+      Corresponding:     corresponding != nil,
+      CorrespondingCols: corresponding,
     }
   }
-| select_clause INTERSECT all_or_distinct select_clause
+| select_clause INTERSECT all_or_distinct opt_corresponding_clause select_clause
   {
+    corresponding := $4.nameList()
     $$.val = &tree.UnionClause{
-      Type:  tree.IntersectOp,
-      Left:  &tree.Select{Select: $1.selectStmt()},
-      Right: &tree.Select{Select: $4.selectStmt()},
-      All:   $3.bool(),
+      Type:              tree.IntersectOp,
+      Left:              &tree.Select{Select: $1.selectStmt()},
+      Right:             &tree.Select{Select: $5.selectStmt()},
+      All:               $3.bool(),
+      Corresponding:     corresponding != nil,
+      CorrespondingCols: corresponding,
     }
   }
-| select_clause EXCEPT all_or_distinct select_clause
+| select_clause EXCEPT all_or_distinct opt_corresponding_clause select_clause
   {
+    corresponding := $4.nameList()
     $$.val = &tree.UnionClause{
-      Type:  tree.ExceptOp,
-      Left:  &tree.Select{Select: $1.selectStmt()},
-      Right: &tree.Select{Select: $4.selectStmt()},
-      All:   $3.bool(),
+      Type:              tree.ExceptOp,
+      Left:              &tree.Select{Select: $1.selectStmt()},
+      Right:             &tree.Select{Select: $5.selectStmt()},
+      All:               $3.bool(),
+      Corresponding:     corresponding != nil,
+      CorrespondingCols: corresponding,
     }
   }
 
@@ -5698,6 +5945,22 @@ common_table_expr:
       Stmt: $5.stmt(),
     }
   }
+| table_alias_name opt_column_list AS MATERIALIZED '(' preparable_stmt ')'
+  {
+    $$.val = &tree.CTE{
+      Name: tree.AliasClause{Alias: tree.Name($1), Cols: $2.nameList() },
+      Materialized: tree.CTEMaterializeAlways,
+      Stmt: $6.stmt(),
+    }
+  }
+| table_alias_name opt_column_list AS NOT MATERIALIZED '(' preparable_stmt ')'
+  {
+    $$.val = &tree.CTE{
+      Name: tree.AliasClause{Alias: tree.Name($1), Cols: $2.nameList() },
+      Materialized: tree.CTEMaterializeNever,
+      Stmt: $7.stmt(),
+    }
+  }
 
 opt_with:
   WITH {}
@@ -5731,6 +5994,22 @@ all_or_distinct:
     $$.val = false
   }
 
+// opt_corresponding_clause returns nil if the clause is absent, and a
+// non-nil (possibly empty) list of column names otherwise.
+opt_corresponding_clause:
+  CORRESPONDING BY '(' name_list ')'
+  {
+    $$.val = $4.nameList()
+  }
+| CORRESPONDING
+  {
+    $$.val = tree.NameList{}
+  }
+| /* EMPTY */
+  {
+    $$.val = tree.NameList(nil)
+  }
+
 distinct_clause:
   DISTINCT
   {
@@ -5900,7 +6179,7 @@ first_or_next:
 // Each item in the group_clause list is either an expression tree or a
 // GroupingSet node of some type.
 group_clause:
-  GROUP BY expr_list
+  GROUP BY group_by_list
   {
     $$.val = tree.GroupBy($3.exprs())
   }
@@ -5909,6 +6188,41 @@ group_clause:
     $$.val = tree.GroupBy(nil)
   }
 
+group_by_list:
+  group_by_item
+  {
+    $$.val = tree.Exprs{$1.expr()}
+  }
+| group_by_list ',' group_by_item
+  {
+    $$.val = append($1.exprs(), $3.expr())
+  }
+
+// The empty grouping set "()" is parsed as an empty tuple by a_expr.
+group_by_item:
+  a_expr
+| rollup_clause
+| cube_clause
+| grouping_sets_clause
+
+rollup_clause:
+  ROLLUP '(' expr_list ')'
+  {
+    $$.val = &tree.Rollup{Exprs: $3.exprs()}
+  }
+
+cube_clause:
+  CUBE '(' expr_list ')'
+  {
+    $$.val = &tree.Cube{Exprs: $3.exprs()}
+  }
+
+grouping_sets_clause:
+  GROUPING SETS '(' group_by_list ')'
+  {
+    $$.val = &tree.GroupingSets{Sets: $4.exprs()}
+  }
+
 having_clause:
   HAVING a_expr
   {
@@ -5952,7 +6266,14 @@ values_clause:
 from_clause:
   FROM from_list opt_as_of_clause
   {
-    $$.val = &tree.From{Tables: $2.tblExprs(), AsOf: $3.asOfClause()}
+    from := &tree.From{Tables: $2.tblExprs(), AsOf: $3.asOfClause()}
+    if from.AsOf.Expr == nil {
+      from.AsOf = hoistTrailingAsOf(from.Tables)
+    }
+    if err := from.ValidateAsOf(); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = from
   }
 | FROM error // SHOW HELP: <SOURCE>
 | /* EMPTY */
@@ -6080,15 +6401,14 @@ table_ref:
         As:         $8.aliasClause(),
     }
   }
-| relation_expr opt_index_flags opt_ordinality opt_alias_clause
+| from_relation_expr opt_index_flags opt_table_as_of_clause opt_ordinality opt_alias_clause
   {
-    name := $1.unresolvedObjectName().ToTableName()
-    $$.val = &tree.AliasedTableExpr{
-      Expr:       &name,
-      IndexFlags: $2.indexFlags(),
-      Ordinality: $3.bool(),
-      As:         $4.aliasClause(),
-    }
+    tbl := $1.tblExpr().(*tree.AliasedTableExpr)
+    tbl.IndexFlags = $2.indexFlags()
+    tbl.AsOf = $3.asOfClausePtr()
+    tbl.Ordinality = $4.bool()
+    tbl.As = $5.aliasClause()
+    $$.val = tbl
   }
 | select_with_parens opt_ordinality opt_alias_clause
   {
@@ -6162,26 +6482,58 @@ func_table:
   }
 | ROWS FROM '(' rowsfrom_list ')'
   {
-    $$.val = &tree.RowsFromExpr{Items: $4.exprs()}
+    rowsFrom := $4.rowsFromExpr()
+    if !rowsFrom.HasColDefLists() {
+      rowsFrom.ColDefLists = nil
+    }
+    $$.val = rowsFrom
   }
 
 rowsfrom_list:
   rowsfrom_item
-  { $$.val = tree.Exprs{$1.expr()} }
 | rowsfrom_list ',' rowsfrom_item
-  { $$.val = append($1.exprs(), $3.expr()) }
+  {
+    rowsFrom := $1.rowsFromExpr()
+    item := $3.rowsFromExpr()
+    rowsFrom.Items = append(rowsFrom.Items, item.Items...)
+    rowsFrom.ColDefLists = append(rowsFrom.ColDefLists, item.ColDefLists...)
+    $$.val = rowsFrom
+  }
 
 rowsfrom_item:
   func_expr_windowless opt_col_def_list
   {
-    $$.val = $1.expr()
+    $$.val = &tree.RowsFromExpr{
+      Items: tree.Exprs{$1.expr()},
+      ColDefLists: []tree.ColumnDefList{$2.colDefList()},
+    }
   }
 
 opt_col_def_list:
   /* EMPTY */
-  { }
-| AS '(' error
-  { return unimplemented(sqllex, "ROWS FROM with col_def_list") }
+  {
+    $$.val = tree.ColumnDefList(nil)
+  }
+| AS '(' col_def_list ')'
+  {
+    $$.val = $3.colDefList()
+  }
+
+col_def_list:
+  col_def_list_elem
+  {
+    $$.val = tree.ColumnDefList{$1.colDefListElem()}
+  }
+| col_def_list ',' col_def_list_elem
+  {
+    $$.val = append($1.colDefList(), $3.colDefListElem())
+  }
+
+col_def_list_elem:
+  column_name typename
+  {
+    $$.val = tree.ColumnDef{Name: tree.Name($1), Type: $2.colType()}
+  }
 
 opt_tableref_col_list:
   /* EMPTY */               { $$.val = nil }
@@ -6278,6 +6630,22 @@ opt_as_of_clause:
     $$.val = tree.AsOfClause{}
   }
 
+// The AS OF SYSTEM TIME clause of a table reference. It is ambiguous with the
+// AS OF SYSTEM TIME clause of the FROM clause when it ends the FROM clause, as
+// in "FROM t AS OF SYSTEM TIME x". The precedences make the parser always read
+// it as part of the table reference; from_clause then moves such a trailing
+// clause to the statement, where it has always applied.
+opt_table_as_of_clause:
+  as_of_clause
+  {
+    asOf := $1.asOfClause()
+    $$.val = &asOf
+  }
+| /* EMPTY */ %prec NO_TABLE_AS_OF
+  {
+    $$.val = (*tree.AsOfClause)(nil)
+  }
+
 join_type:
   FULL join_outer
   {
@@ -6359,6 +6727,31 @@ relation_expr:
 | ONLY table_name         { $$.val = $2.unresolvedObjectName() }
 | ONLY '(' table_name ')' { $$.val = $3.unresolvedObjectName() }
 
+// from_relation_expr is like relation_expr, but returns an AliasedTableExpr
+// that records whether the ONLY keyword was used. It is used in FROM clauses,
+// where the keyword is preserved in the AST.
+from_relation_expr:
+  table_name
+  {
+    name := $1.unresolvedObjectName().ToTableName()
+    $$.val = &tree.AliasedTableExpr{Expr: &name}
+  }
+| table_name '*'
+  {
+    name := $1.unresolvedObjectName().ToTableName()
+    $$.val = &tree.AliasedTableExpr{Expr: &name}
+  }
+| ONLY table_name
+  {
+    name := $2.unresolvedObjectName().ToTableName()
+    $$.val = &tree.AliasedTableExpr{Expr: &name, Only: true}
+  }
+| ONLY '(' table_name ')'
+  {
+    name := $3.unresolvedObjectName().ToTableName()
+    $$.val = &tree.AliasedTableExpr{Expr: &name, Only: true}
+  }
+
 relation_expr_list:
   relation_expr
   {
@@ -7257,7 +7650,10 @@ a_expr:
   {
     $$.val = &tree.ComparisonExpr{Operator: tree.IsDistinctFrom, Left: $1.expr(), Right: tree.DNull}
   }
-| row OVERLAPS row { return unimplemented(sqllex, "overlaps") }
+| row OVERLAPS row
+  {
+    $$.val = &tree.OverlapsExpr{Left: $1.tuple(), Right: $3.tuple()}
+  }
 | a_expr IS TRUE %prec IS
   {
     $$.val = &tree.ComparisonExpr{Operator: tree.IsNotDistinctFrom, Left: $1.expr(), Right: tree.MakeDBool(true)}
@@ -7544,7 +7940,7 @@ d_expr:
     if err != nil { return setErr(sqllex, err) }
     $$.val = d
   }
-| func_name '(' expr_list opt_sort_clause_err ')' SCONST { return unimplemented(sqllex, $1.unresolvedName().String() + "(...) SCONST") }
+| func_name '(' func_arg_list opt_sort_clause ')' SCONST { return unimplemented(sqllex, $1.unresolvedName().String() + "(...) SCONST") }
 | const_typename SCONST
   {
     $$.val = &tree.CastExpr{Expr: tree.NewStrVal($2), Type: $1.colType(), SyntaxMode: tree.CastPrepend}
@@ -7626,19 +8022,29 @@ func_application:
   {
     $$.val = &tree.FuncExpr{Func: $1.resolvableFuncRefFromName()}
   }
-| func_name '(' expr_list opt_sort_clause_err ')'
+| func_name '(' func_arg_list opt_sort_clause ')'
   {
-    $$.val = &tree.FuncExpr{Func: $1.resolvableFuncRefFromName(), Exprs: $3.exprs()}
+    args := $3.funcArgList()
+    f := &tree.FuncExpr{
+      Func: $1.resolvableFuncRefFromName(),
+      Exprs: args.exprs,
+      ArgNames: args.argNames(),
+      OrderBy: $4.orderBy(),
+    }
+    if err := f.ValidateArgNames(); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = f
   }
 | func_name '(' VARIADIC a_expr opt_sort_clause_err ')' { return unimplemented(sqllex, "variadic") }
-| func_name '(' expr_list ',' VARIADIC a_expr opt_sort_clause_err ')' { return unimplemented(sqllex, "variadic") }
-| func_name '(' ALL expr_list opt_sort_clause_err ')'
+| func_name '(' func_arg_list ',' VARIADIC a_expr opt_sort_clause_err ')' { return unimplemented(sqllex, "variadic") }
+| func_name '(' ALL expr_list opt_sort_clause ')'
   {
-    $$.val = &tree.FuncExpr{Func: $1.resolvableFuncRefFromName(), Type: tree.AllFuncType, Exprs: $4.exprs()}
+    $$.val = &tree.FuncExpr{Func: $1.resolvableFuncRefFromName(), Type: tree.AllFuncType, Exprs: $4.exprs(), OrderBy: $5.orderBy()}
   }
-| func_name '(' DISTINCT expr_list opt_sort_clause_err ')'
+| func_name '(' DISTINCT expr_list opt_sort_clause ')'
   {
-    $$.val = &tree.FuncExpr{Func: $1.resolvableFuncRefFromName(), Type: tree.DistinctFuncType, Exprs: $4.exprs()}
+    $$.val = &tree.FuncExpr{Func: $1.resolvableFuncRefFromName(), Type: tree.DistinctFuncType, Exprs: $4.exprs(), OrderBy: $5.orderBy()}
   }
 | func_name '(' '*' ')'
   {
@@ -7646,6 +8052,32 @@ func_application:
   }
 | func_name '(' error { return helpWithFunction(sqllex, $1.resolvableFuncRefFromName()) }
 
+// Arguments of a function application. An argument can be passed by name,
+// as in f(a, b => c); the names are validated by FuncExpr.ValidateArgNames.
+func_arg_list:
+  func_arg_expr
+  {
+    $$.val = $1.funcArgList()
+  }
+| func_arg_list ',' func_arg_expr
+  {
+    l, arg := $1.funcArgList(), $3.funcArgList()
+    $$.val = funcArgList{
+      exprs: append(l.exprs, arg.exprs...),
+      names: append(l.names, arg.names...),
+    }
+  }
+
+func_arg_expr:
+  a_expr
+  {
+    $$.val = funcArgList{exprs: tree.Exprs{$1.expr()}, names: []tree.Name{""}}
+  }
+| type_function_name EQUALS_GREATER a_expr
+  {
+    $$.val = funcArgList{exprs: tree.Exprs{$3.expr()}, names: []tree.Name{tree.Name($1)}}
+  }
+
 // func_expr and its cousin func_expr_windowless are split out from c_expr just
 // so that we have classifications for "everything that is a function call or
 // looks like one". This isn't very important, but it saves us having to
@@ -7657,8 +8089,12 @@ func_expr:
   func_application within_group_clause filter_clause over_clause
   {
     f := $1.expr().(*tree.FuncExpr)
+    f.WithinGroup = $2.orderByPtr()
     f.Filter = $3.expr()
     f.WindowDef = $4.windowDef()
+    if err := f.ValidateWithinGroup(); err != nil {
+      return setErr(sqllex, err)
+    }
     $$.val = f
   }
 | func_expr_common_subexpr
@@ -7840,8 +8276,15 @@ special_function:
 
 // Aggregate decoration clauses
 within_group_clause:
-WITHIN GROUP '(' sort_clause ')' { return unimplemented(sqllex, "within group") }
-| /* EMPTY */ {}
+  WITHIN GROUP '(' sort_clause ')'
+  {
+    ob := $4.orderBy()
+    $$.val = &ob
+  }
+| /* EMPTY */
+  {
+    $$.val = (*tree.OrderBy)(nil)
+  }
 
 filter_clause:
   FILTER '(' WHERE a_expr ')'
@@ -7941,24 +8384,36 @@ opt_partition_clause:
 opt_frame_clause:
   RANGE frame_extent
   {
-    $$.val = &tree.WindowFrame{
+    frame := &tree.WindowFrame{
       Mode: tree.RANGE,
       Bounds: $2.windowFrameBounds(),
     }
+    if err := frame.Validate(); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = frame
   }
 | ROWS frame_extent
   {
-    $$.val = &tree.WindowFrame{
+    frame := &tree.WindowFrame{
       Mode: tree.ROWS,
       Bounds: $2.windowFrameBounds(),
     }
+    if err := frame.Validate(); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = frame
   }
 | GROUPS frame_extent
   {
-    $$.val = &tree.WindowFrame{
+    frame := &tree.WindowFrame{
       Mode: tree.GROUPS,
       Bounds: $2.windowFrameBounds(),
     }
+    if err := frame.Validate(); err != nil {
+      return setErr(sqllex, err)
+    }
+    $$.val = frame
   }
 | /* EMPTY */
   {
@@ -7968,44 +8423,19 @@ opt_frame_clause:
 frame_extent:
   frame_bound
   {
-    startBound := $1.windowFrameBound()
-    switch {
-    case startBound.BoundType == tree.UnboundedFollowing:
-      sqllex.Error("frame start cannot be UNBOUNDED FOLLOWING")
-      return 1
-    case startBound.BoundType == tree.OffsetFollowing:
-      sqllex.Error("frame starting from following row cannot end with current row")
-      return 1
-    }
-    $$.val = tree.WindowFrameBounds{StartBound: startBound}
+    $$.val = tree.WindowFrameBounds{StartBound: $1.windowFrameBound()}
   }
 | BETWEEN frame_bound AND frame_bound
   {
-    startBound := $2.windowFrameBound()
-    endBound := $4.windowFrameBound()
-    switch {
-    case startBound.BoundType == tree.UnboundedFollowing:
-      sqllex.Error("frame start cannot be UNBOUNDED FOLLOWING")
-      return 1
-    case endBound.BoundType == tree.UnboundedPreceding:
-      sqllex.Error("frame end cannot be UNBOUNDED PRECEDING")
-      return 1
-    case startBound.BoundType == tree.CurrentRow && endBound.BoundType == tree.OffsetPreceding:
-      sqllex.Error("frame starting from current row cannot have preceding rows")
-      return 1
-    case startBound.BoundType == tree.OffsetFollowing && endBound.BoundType == tree.OffsetPreceding:
-      sqllex.Error("frame starting from following row cannot have preceding rows")
-      return 1
-    case startBound.BoundType == tree.OffsetFollowing && endBound.BoundType == tree.CurrentRow:
-      sqllex.Error("frame starting from following row cannot have preceding rows")
-      return 1
+    $$.val = tree.WindowFrameBounds{
+      StartBound: $2.windowFrameBound(),
+      EndBound: $4.windowFrameBound(),
     }
-    $$.val = tree.WindowFrameBounds{StartBound: startBound, EndBound: endBound}
   }
 
 // This is used for both frame start and frame end, with output set up on the
-// assumption it's frame start; the frame_extent productions must reject
-// invalid cases.
+// assumption it's frame start; opt_frame_clause rejects invalid cases with
+// WindowFrame.Validate.
 frame_bound:
   UNBOUNDED PRECEDING
   {
@@ -8894,6 +9324,7 @@ unreserved_keyword:
 | CONSTRAINTS
 | CONVERSION
 | COPY
+| CORRESPONDING
 | COVERING
 | CUBE
 | CURRENT
@@ -8969,6 +9400,7 @@ unreserved_keyword:
 | LEVEL
 | LIST
 | LOCAL
+| LOCKED
 | LOOKUP
 | LOW
 | MATCH
@@ -8984,6 +9416,8 @@ unreserved_keyword:
 | NEXT
 | NO
 | NORMAL
+| NOWAIT
+| NULLS
 | NO_INDEX_JOIN
 | IGNORE_FOREIGN_KEYS
 | OF
@@ -9058,8 +9492,11 @@ unreserved_keyword:
 | SESSION
 | SESSIONS
 | SET
+| SETS
+| SHARE
 | SHOW
 | SIMPLE
+| SKIP
 | SMALLSERIAL
 | SNAPSHOT
 | SQL
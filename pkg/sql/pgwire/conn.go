@@ -1223,6 +1223,11 @@ func writeErr(
 		msgBuilder.writeTerminatedString(pgErr.Hint)
 	}
 
+	if ok && pgErr.Context != "" {
+		msgBuilder.putErrFieldMsg(pgwirebase.ServerErrFieldWhere)
+		msgBuilder.writeTerminatedString(pgErr.Context)
+	}
+
 	if ok && pgErr.Source != nil {
 		errCtx := pgErr.Source
 		if errCtx.File != "" {
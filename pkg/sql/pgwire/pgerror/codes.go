@@ -14,6 +14,8 @@
 
 package pgerror
 
+import "sort"
+
 // PG error codes from: http://www.postgresql.org/docs/9.5/static/errcodes-appendix.html.
 // Specifically, errcodes.txt is copied from from Postgres' src/backend/utils/errcodes.txt.
 //
@@ -337,3 +339,163 @@ var (
 	//       must use 'error pgcode XXA00 ...'
 	CodeTransactionCommittedWithSchemaChangeFailure = "XXA00"
 )
+
+// IsUndefinedObjectCode returns true if the given code signals that an object
+// referenced by a statement (a database, table, column, function or any other
+// named object) does not exist.
+func IsUndefinedObjectCode(code string) bool {
+	switch code {
+	case CodeUndefinedTableError,
+		CodeUndefinedColumnError,
+		CodeUndefinedFunctionError,
+		CodeUndefinedObjectError,
+		CodeInvalidCatalogNameError:
+		return true
+	}
+	return false
+}
+
+// IsDefinitelyNotRetryableCode returns true if the given code signals an error
+// that retrying the statement cannot resolve: syntax errors and access rule
+// violations (class 42), authorization failures (class 28) and unsupported
+// features (class 0A). Clients should report such errors immediately instead
+// of retrying.
+func IsDefinitelyNotRetryableCode(code string) bool {
+	if len(code) != 5 {
+		return false
+	}
+	switch code[:2] {
+	case "42", "28", "0A":
+		return true
+	}
+	return false
+}
+
+// IsWarningCode returns true if the given code belongs to one of the classes
+// that the SQL standard considers to be warnings rather than errors:
+// successful completion (00), warning (01), no data (02) and SQL statement
+// not yet complete (03).
+func IsWarningCode(code string) bool {
+	if len(code) != 5 {
+		return false
+	}
+	switch code[:2] {
+	case "00", "01", "02", "03":
+		return true
+	}
+	return false
+}
+
+// ShouldLogAtServer returns whether an error carrying the given code should be
+// logged by the server. It returns false for the classes of errors that are
+// caused by the client: data exceptions (class 22), integrity constraint
+// violations (class 23), authorization failures (class 28) and syntax errors
+// and access rule violations (class 42). It returns true for all the other
+// codes, notably for the classes of errors that are caused by the server:
+// insufficient resources (class 53), system errors (class 58), configuration
+// file errors (class F0) and internal errors (class XX).
+func ShouldLogAtServer(code string) bool {
+	if len(code) != 5 {
+		return true
+	}
+	switch code[:2] {
+	case "22", "23", "28", "42":
+		return false
+	}
+	return true
+}
+
+// Severity levels reported alongside error codes, as defined by Postgres.
+const (
+	SeverityError   = "ERROR"
+	SeverityFatal   = "FATAL"
+	SeverityWarning = "WARNING"
+)
+
+// Severity returns the severity level with which an error carrying the given
+// code should be reported to a client: SeverityWarning for the codes for which
+// IsWarningCode returns true, SeverityFatal for connection exceptions (class
+// 08) and for the admin and crash shutdown codes, and SeverityError otherwise.
+func Severity(code string) string {
+	switch code {
+	case CodeAdminShutdownError, CodeCrashShutdownError:
+		return SeverityFatal
+	}
+	if IsWarningCode(code) {
+		return SeverityWarning
+	}
+	if len(code) == 5 && code[:2] == "08" {
+		return SeverityFatal
+	}
+	return SeverityError
+}
+
+// DefaultHint returns a generic hint for errors carrying the given code, to
+// be reported to a client when the error doesn't have a hint of its own. It
+// returns an empty string for the codes that don't have a default hint.
+func DefaultHint(code string) string {
+	switch code {
+	case CodeUndefinedColumnError:
+		return "Check the columns of the table with \\d <tablename> or SHOW COLUMNS FROM <tablename>."
+	case CodeUndefinedTableError:
+		return "Check the tables of the current database with SHOW TABLES."
+	case CodeUniqueViolationError:
+		return "A row with the same value already exists for the unique constraint named in the error message. Consider using UPSERT or INSERT ... ON CONFLICT."
+	case CodeForeignKeyViolationError:
+		return "The row is referenced by, or references, a row that violates the foreign key constraint named in the error message."
+	case CodeSerializationFailureError:
+		return "The transaction conflicted with a concurrent transaction. Retry the transaction."
+	}
+	return ""
+}
+
+// codeIDs is the inverse of codesByID.
+var codeIDs = func() map[string]uint32 {
+	m := make(map[string]uint32, len(codesByID))
+	for id, code := range codesByID[1:] {
+		m[code] = uint32(id + 1)
+	}
+	return m
+}()
+
+// CodeID returns a small numeric ID for the given error code, for use in
+// compact encodings of errors. The ID of a code never changes. Unknown codes
+// have ID 0.
+//
+// See generate-ids.sh to assign IDs to new codes.
+func CodeID(code string) uint32 {
+	return codeIDs[code]
+}
+
+// CodeFromID returns the error code whose ID is id, as returned by CodeID.
+// The boolean is false if there is no such code.
+func CodeFromID(id uint32) (string, bool) {
+	if id == 0 || id >= uint32(len(codesByID)) {
+		return "", false
+	}
+	return codesByID[id], true
+}
+
+// allCodes lists the codes of codesByID in sorted order.
+var allCodes = func() []string {
+	codes := append([]string(nil), codesByID[1:]...)
+	sort.Strings(codes)
+	return codes
+}()
+
+// AllCodes returns every error code defined in this package, sorted. It is
+// meant for tests that check that a property is defined for all the codes.
+// The caller may modify the returned slice.
+func AllCodes() []string {
+	return append([]string(nil), allCodes...)
+}
+
+// ConditionName returns the PL/pgSQL condition name of the given error code,
+// e.g. "unique_violation" for CodeUniqueViolationError, as listed in
+// errcodes.txt. The boolean is false if the code has no condition name.
+//
+// See generate-names.sh to regenerate the names from errcodes.txt.
+func ConditionName(code string) (string, bool) {
+	name, ok := conditionNames[code]
+	return name, ok
+}
@@ -0,0 +1,321 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pgerror_test
+
+import (
+	"bufio"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+)
+
+// TestCodeIDsTotal verifies that every error code defined in codes.go has an
+// ID, and that the IDs map back to the codes.
+func TestCodeIDsTotal(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "codes.go", nil /* src */, 0 /* mode */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numCodes int
+	for _, decl := range f.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || (genDecl.Tok != token.CONST && genDecl.Tok != token.VAR) {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for i, name := range valueSpec.Names {
+				if !strings.HasPrefix(name.Name, "Code") || i >= len(valueSpec.Values) {
+					continue
+				}
+				lit, ok := valueSpec.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+				code, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				numCodes++
+
+				id := pgerror.CodeID(code)
+				if id == 0 {
+					t.Errorf("%s (%s) has no ID; run generate-ids.sh", name.Name, code)
+					continue
+				}
+				if c, ok := pgerror.CodeFromID(id); !ok || c != code {
+					t.Errorf("%s (%s) has ID %d, which maps back to %q", name.Name, code, id, c)
+				}
+			}
+		}
+	}
+	if numCodes == 0 {
+		t.Fatal("found no codes in codes.go")
+	}
+
+	if id := pgerror.CodeID("not a code"); id != 0 {
+		t.Errorf("expected ID 0 for an unknown code, got %d", id)
+	}
+	for _, id := range []uint32{0, 1 << 20} {
+		if c, ok := pgerror.CodeFromID(id); ok {
+			t.Errorf("expected no code for ID %d, got %q", id, c)
+		}
+	}
+}
+
+// TestCodeIDsStable verifies that the IDs recorded in testdata/codeids haven't
+// changed.
+func TestCodeIDsStable(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "codeids"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			t.Fatalf("invalid line: %q", line)
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := fields[1]
+		if actual := pgerror.CodeID(code); actual != uint32(id) {
+			t.Errorf("ID of %s changed from %d to %d", code, id, actual)
+		}
+		if actual, ok := pgerror.CodeFromID(uint32(id)); !ok || actual != code {
+			t.Errorf("ID %d now maps to %q instead of %s", id, actual, code)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsDefinitelyNotRetryableCode(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected bool
+	}{
+		{pgerror.CodeSyntaxError, true},
+		{pgerror.CodeUndefinedTableError, true},
+		{pgerror.CodeInsufficientPrivilegeError, true},
+		{pgerror.CodeInvalidAuthorizationSpecificationError, true},
+		{pgerror.CodeInvalidPasswordError, true},
+		{pgerror.CodeFeatureNotSupportedError, true},
+		{pgerror.CodeSerializationFailureError, false},
+		{pgerror.CodeStatementCompletionUnknownError, false},
+		{pgerror.CodeConnectionFailureError, false},
+		{pgerror.CodeQueryCanceledError, false},
+		{pgerror.CodeInternalError, false},
+		{pgerror.CodeDivisionByZeroError, false},
+		// Only well-formed codes are classified.
+		{"42", false},
+		{"4200", false},
+		{"420000", false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		if res := pgerror.IsDefinitelyNotRetryableCode(tc.code); res != tc.expected {
+			t.Errorf("%q: expected %t, got %t", tc.code, tc.expected, res)
+		}
+	}
+}
+
+func TestIsWarningCode(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected bool
+	}{
+		{pgerror.CodeSuccessfulCompletionError, true},
+		{pgerror.CodeWarningError, true},
+		{pgerror.CodeWarningStringDataRightTruncationError, true},
+		{pgerror.CodeNoDataError, true},
+		{pgerror.CodeSQLStatementNotYetCompleteError, true},
+		{pgerror.CodeConnectionFailureError, false},
+		{pgerror.CodeSyntaxError, false},
+		{pgerror.CodeInternalError, false},
+		{"01", false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		if res := pgerror.IsWarningCode(tc.code); res != tc.expected {
+			t.Errorf("%q: expected %t, got %t", tc.code, tc.expected, res)
+		}
+	}
+}
+
+func TestShouldLogAtServer(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected bool
+	}{
+		// Client faults.
+		{pgerror.CodeDivisionByZeroError, false},
+		{pgerror.CodeInvalidTextRepresentationError, false},
+		{pgerror.CodeUniqueViolationError, false},
+		{pgerror.CodeCheckViolationError, false},
+		{pgerror.CodeInvalidPasswordError, false},
+		{pgerror.CodeSyntaxError, false},
+		{pgerror.CodeUndefinedTableError, false},
+		{pgerror.CodeInsufficientPrivilegeError, false},
+		// Server faults.
+		{pgerror.CodeInternalError, true},
+		{pgerror.CodeDataCorruptedError, true},
+		{pgerror.CodeUncategorizedError, true},
+		{pgerror.CodeDiskFullError, true},
+		{pgerror.CodeOutOfMemoryError, true},
+		{pgerror.CodeSystemError, true},
+		{pgerror.CodeConfigFileError, true},
+		// Other codes are logged.
+		{pgerror.CodeSerializationFailureError, true},
+		{pgerror.CodeQueryCanceledError, true},
+		{"not a code", true},
+	}
+	for _, tc := range testCases {
+		if res := pgerror.ShouldLogAtServer(tc.code); res != tc.expected {
+			t.Errorf("%q: expected %t, got %t", tc.code, tc.expected, res)
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected string
+	}{
+		{pgerror.CodeSuccessfulCompletionError, pgerror.SeverityWarning},
+		{pgerror.CodeWarningDeprecatedFeatureError, pgerror.SeverityWarning},
+		{pgerror.CodeNoDataError, pgerror.SeverityWarning},
+		{pgerror.CodeSQLStatementNotYetCompleteError, pgerror.SeverityWarning},
+		{pgerror.CodeConnectionFailureError, pgerror.SeverityFatal},
+		{pgerror.CodeAdminShutdownError, pgerror.SeverityFatal},
+		{pgerror.CodeCrashShutdownError, pgerror.SeverityFatal},
+		// Other codes in the same class as the shutdown codes are errors.
+		{pgerror.CodeQueryCanceledError, pgerror.SeverityError},
+		{pgerror.CodeSyntaxError, pgerror.SeverityError},
+		{pgerror.CodeUncategorizedError, pgerror.SeverityError},
+		{"not a code", pgerror.SeverityError},
+	}
+	for _, tc := range testCases {
+		if res := pgerror.Severity(tc.code); res != tc.expected {
+			t.Errorf("%q: expected %s, got %s", tc.code, tc.expected, res)
+		}
+	}
+}
+
+func TestDefaultHint(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected string
+	}{
+		{pgerror.CodeUndefinedColumnError, `\d <tablename>`},
+		{pgerror.CodeUndefinedTableError, `SHOW TABLES`},
+		{pgerror.CodeUniqueViolationError, `unique constraint named in the error message`},
+		{pgerror.CodeForeignKeyViolationError, `foreign key constraint named in the error message`},
+		{pgerror.CodeSerializationFailureError, `Retry the transaction`},
+		// Other codes, including the ones in the same classes, have no default
+		// hint.
+		{pgerror.CodeNotNullViolationError, ``},
+		{pgerror.CodeSyntaxError, ``},
+		{pgerror.CodeStatementCompletionUnknownError, ``},
+		{"not a code", ``},
+	}
+	for _, tc := range testCases {
+		res := pgerror.DefaultHint(tc.code)
+		if tc.expected == "" {
+			if res != "" {
+				t.Errorf("%q: expected no hint, got %q", tc.code, res)
+			}
+		} else if !strings.Contains(res, tc.expected) {
+			t.Errorf("%q: expected hint containing %q, got %q", tc.code, tc.expected, res)
+		}
+	}
+}
+
+func TestConditionName(t *testing.T) {
+	testCases := []struct {
+		code     string
+		expected string
+	}{
+		{pgerror.CodeSuccessfulCompletionError, "successful_completion"},
+		{pgerror.CodeWarningDeprecatedFeatureError, "deprecated_feature"},
+		{pgerror.CodeWarningStringDataRightTruncationError, "string_data_right_truncation"},
+		{pgerror.CodeStringDataRightTruncationError, "string_data_right_truncation"},
+		{pgerror.CodeDivisionByZeroError, "division_by_zero"},
+		{pgerror.CodeUniqueViolationError, "unique_violation"},
+		{pgerror.CodeSerializationFailureError, "serialization_failure"},
+		{pgerror.CodeUndefinedTableError, "undefined_table"},
+		{pgerror.CodeRaiseExceptionError, "raise_exception"},
+		{pgerror.CodeInternalError, "internal_error"},
+		// 2202E is listed twice in errcodes.txt, once without a condition name.
+		{pgerror.CodeArraySubscriptError, "array_subscript_error"},
+		// Codes without a condition name.
+		{pgerror.CodeRangeUnavailable, ""},
+		{pgerror.CodeUncategorizedError, ""},
+		{"not a code", ""},
+	}
+	for _, tc := range testCases {
+		res, ok := pgerror.ConditionName(tc.code)
+		if res != tc.expected || ok != (tc.expected != "") {
+			t.Errorf("%q: expected %q, got %q (%t)", tc.code, tc.expected, res, ok)
+		}
+	}
+}
+
+func TestAllCodes(t *testing.T) {
+	codes := pgerror.AllCodes()
+	if len(codes) == 0 {
+		t.Fatal("expected some codes")
+	}
+	var foundInternal bool
+	for i, code := range codes {
+		if i > 0 && codes[i-1] >= code {
+			t.Errorf("codes are not sorted and unique: %q before %q", codes[i-1], code)
+		}
+		if pgerror.CodeID(code) == 0 {
+			t.Errorf("%q has no ID", code)
+		}
+		switch pgerror.Severity(code) {
+		case pgerror.SeverityWarning, pgerror.SeverityError, pgerror.SeverityFatal:
+		default:
+			t.Errorf("%q has unexpected severity %q", code, pgerror.Severity(code))
+		}
+		foundInternal = foundInternal || code == pgerror.CodeInternalError
+	}
+	if !foundInternal {
+		t.Errorf("expected %s in %v", pgerror.CodeInternalError, codes)
+	}
+
+	// Modifying the result doesn't affect later calls.
+	codes[0] = "not a code"
+	if res := pgerror.AllCodes(); res[0] == "not a code" {
+		t.Fatal("AllCodes returned a shared slice")
+	}
+}
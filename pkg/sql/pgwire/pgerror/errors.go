@@ -23,7 +23,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/caller"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/lib/pq"
-	"github.com/pkg/errors"
 )
 
 var _ error = &Error{}
@@ -46,6 +45,23 @@ func FullError(err error) string {
 	return errString
 }
 
+// FlattenMessage returns the message of err without the SQLSTATE code
+// annotation, for use in logs that do not care about pg error codes. If err
+// wraps a pg error (or a lib/pq error), the message of the innermost such error
+// is returned. err is not modified. An empty string is returned if err is nil.
+func FlattenMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	if pqErr, ok := cause(err).(*pq.Error); ok {
+		return pqErr.Message
+	}
+	if pgErr, ok := GetPGCause(err); ok {
+		return pgErr.Message
+	}
+	return err.Error()
+}
+
 func formatMsgHintDetail(prefix, msg, hint, detail string) string {
 	var b strings.Builder
 	b.WriteString(prefix)
@@ -82,6 +98,32 @@ func Newf(code string, format string, args ...interface{}) *Error {
 	return NewWithDepthf(1, code, format, args...)
 }
 
+// NewWithSafeDetail creates an Error annotated with a detail that is safe to
+// report, for example in telemetry. The detail is derived from the safeDetail
+// arguments, which are redacted: only the arguments wrapped with log.Safe()
+// are reported verbatim. The details can be retrieved with GetSafeDetails.
+func NewWithSafeDetail(code, msg string, safeDetail ...interface{}) *Error {
+	err := NewWithDepthf(1, code, "%s", msg)
+	err.SafeDetail = []*Error_SafeDetail{{
+		SafeMessage: log.ReportablesToSafeError(1, "", safeDetail).Error(),
+	}}
+	return err
+}
+
+// GetSafeDetails returns the reportable details attached to the Error
+// underlying err, if any. See NewWithSafeDetail.
+func GetSafeDetails(err error) []string {
+	pgErr, ok := GetPGCause(err)
+	if !ok {
+		return nil
+	}
+	details := make([]string, 0, len(pgErr.SafeDetail))
+	for _, d := range pgErr.SafeDetail {
+		details = append(details, d.SafeMessage)
+	}
+	return details
+}
+
 // DangerousStatementf creates a new Error for "rejected dangerous statements".
 func DangerousStatementf(format string, args ...interface{}) *Error {
 	var buf bytes.Buffer
@@ -126,7 +168,7 @@ func makeSrcCtx(depth int) Error_Source {
 
 // GetPGCause returns an unwrapped Error.
 func GetPGCause(err error) (*Error, bool) {
-	switch pgErr := errors.Cause(err).(type) {
+	switch pgErr := cause(err).(type) {
 	case *Error:
 		return pgErr, true
 
@@ -135,6 +177,102 @@ func GetPGCause(err error) (*Error, bool) {
 	}
 }
 
+// GetPGCode returns the pg error code carried by err, unwrapping it with
+// cause(). Both errors generated by this package and errors received by lib/pq
+// clients are recognized. The second return value is false if err does not
+// carry a code.
+func GetPGCode(err error) (string, bool) {
+	switch e := cause(err).(type) {
+	case *Error:
+		return e.Code, true
+	case *pq.Error:
+		return string(e.Code), true
+	default:
+		return "", false
+	}
+}
+
+// cause returns the innermost error wrapped by err. Like errors.Cause(), it
+// follows the Cause() method of github.com/pkg/errors wrappers; it also
+// follows the Unwrap() method used by the errors produced by fmt.Errorf with
+// the %w verb in go 1.13 and later, so that wrapping a pg error either way
+// preserves its code.
+func cause(err error) error {
+	type causer interface {
+		Cause() error
+	}
+	type unwrapper interface {
+		Unwrap() error
+	}
+	for err != nil {
+		var next error
+		switch e := err.(type) {
+		case causer:
+			next = e.Cause()
+		case unwrapper:
+			next = e.Unwrap()
+		}
+		if next == nil {
+			break
+		}
+		err = next
+	}
+	return err
+}
+
+// IsUndefinedObject returns true if err carries a code that signals that the
+// object referenced by a statement does not exist; see IsUndefinedObjectCode.
+// Both errors generated by this package and errors received by lib/pq clients
+// are recognized.
+func IsUndefinedObject(err error) bool {
+	code, ok := GetPGCode(err)
+	return ok && IsUndefinedObjectCode(code)
+}
+
+// IsWarning returns true if err carries a code that signals a warning instead
+// of an error; see IsWarningCode. Like IsUndefinedObject, it is the
+// counterpart for errors of the predicate on codes. Note that carrying a
+// warning code doesn't make an error safe to ignore: DangerousStatementf, for
+// one, rejects statements with CodeWarningError.
+func IsWarning(err error) bool {
+	code, ok := GetPGCode(err)
+	return ok && IsWarningCode(code)
+}
+
+// hasPGCode returns true if err carries the given pg error code.
+func hasPGCode(err error, code string) bool {
+	c, ok := GetPGCode(err)
+	return ok && c == code
+}
+
+// IsUniqueViolation returns true if err signals a unique constraint violation.
+func IsUniqueViolation(err error) bool {
+	return hasPGCode(err, CodeUniqueViolationError)
+}
+
+// IsForeignKeyViolation returns true if err signals a foreign key constraint
+// violation.
+func IsForeignKeyViolation(err error) bool {
+	return hasPGCode(err, CodeForeignKeyViolationError)
+}
+
+// IsNotNullViolation returns true if err signals a NOT NULL constraint
+// violation.
+func IsNotNullViolation(err error) bool {
+	return hasPGCode(err, CodeNotNullViolationError)
+}
+
+// IsCheckViolation returns true if err signals a CHECK constraint violation.
+func IsCheckViolation(err error) bool {
+	return hasPGCode(err, CodeCheckViolationError)
+}
+
+// IsSerializationFailure returns true if err signals a serialization failure,
+// i.e. a transaction that must be retried.
+func IsSerializationFailure(err error) bool {
+	return hasPGCode(err, CodeSerializationFailureError)
+}
+
 // UnimplementedWithIssuef constructs an error with the formatted message
 // and a link to the passed issue. Recorded as "#<issue>" in tracking.
 func UnimplementedWithIssuef(issue int, format string, args ...interface{}) *Error {
@@ -0,0 +1,38 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build go1.13
+
+// This file holds the tests that rely on the %w verb of fmt.Errorf, which was
+// introduced in go1.13, and carries the appropriate build constraint.
+
+package pgerror_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+)
+
+func TestGetPGCodeErrorfWrap(t *testing.T) {
+	pgErr := pgerror.New(pgerror.CodeDivisionByZeroError, "division by zero")
+	err := fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", pgErr))
+	if code, ok := pgerror.GetPGCode(err); !ok || code != pgerror.CodeDivisionByZeroError {
+		t.Fatalf("expected code %s, got %q (%t)", pgerror.CodeDivisionByZeroError, code, ok)
+	}
+	if cause, ok := pgerror.GetPGCause(err); !ok || cause != pgErr {
+		t.Fatalf("expected cause %v, got %v", pgErr, cause)
+	}
+}
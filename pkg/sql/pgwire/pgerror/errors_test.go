@@ -21,6 +21,8 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
@@ -75,3 +77,179 @@ func TestIsSQLRetryableError(t *testing.T) {
 		t.Fatalf("%s should be a SQLRetryableError", errAmbiguous)
 	}
 }
+
+func TestIsUndefinedObject(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{pgerror.New(pgerror.CodeUndefinedTableError, "table"), true},
+		{pgerror.New(pgerror.CodeUndefinedColumnError, "column"), true},
+		{pgerror.New(pgerror.CodeUndefinedFunctionError, "function"), true},
+		{pgerror.New(pgerror.CodeUndefinedObjectError, "object"), true},
+		{pgerror.New(pgerror.CodeInvalidCatalogNameError, "database"), true},
+		{errors.Wrap(pgerror.New(pgerror.CodeUndefinedTableError, "table"), "wrap"), true},
+		{&pq.Error{Code: pgerror.CodeUndefinedTableError}, true},
+		{&pq.Error{Code: pgerror.CodeInvalidCatalogNameError}, true},
+		{pgerror.New(pgerror.CodeDuplicateRelationError, "duplicate"), false},
+		{&pq.Error{Code: pgerror.CodeSyntaxError}, false},
+		{errors.New("undefined table"), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			if actual := pgerror.IsUndefinedObject(tc.err); actual != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, actual)
+			}
+		})
+	}
+}
+
+// unwrapError wraps an error with the Unwrap() method that fmt.Errorf's %w
+// verb provides in go 1.13 and later.
+type unwrapError struct {
+	msg string
+	err error
+}
+
+func (e *unwrapError) Error() string { return e.msg + ": " + e.err.Error() }
+
+func (e *unwrapError) Unwrap() error { return e.err }
+
+func TestGetPGCodeUnwrap(t *testing.T) {
+	pgErr := pgerror.New(pgerror.CodeUndefinedTableError, "table")
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{"unwrap", &unwrapError{msg: "a", err: pgErr}},
+		{"unwrap twice", &unwrapError{msg: "b", err: &unwrapError{msg: "a", err: pgErr}}},
+		{"wrap then unwrap", &unwrapError{msg: "b", err: errors.Wrap(pgErr, "a")}},
+		{"unwrap then wrap", errors.Wrap(&unwrapError{msg: "a", err: pgErr}, "b")},
+		{"pq", &unwrapError{msg: "a", err: &pq.Error{Code: pgerror.CodeUndefinedTableError}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code, ok := pgerror.GetPGCode(tc.err); !ok || code != pgerror.CodeUndefinedTableError {
+				t.Fatalf("expected code %s, got %q (%t)", pgerror.CodeUndefinedTableError, code, ok)
+			}
+			if !pgerror.IsUndefinedObject(tc.err) {
+				t.Fatalf("expected %v to be an undefined object error", tc.err)
+			}
+		})
+	}
+
+	if _, ok := pgerror.GetPGCode(&unwrapError{msg: "a", err: errors.New("b")}); ok {
+		t.Fatal("expected no code for an uncoded wrapped error")
+	}
+}
+
+func TestErrorClassPredicates(t *testing.T) {
+	predicates := []struct {
+		name string
+		code string
+		fn   func(error) bool
+	}{
+		{"IsUniqueViolation", pgerror.CodeUniqueViolationError, pgerror.IsUniqueViolation},
+		{"IsForeignKeyViolation", pgerror.CodeForeignKeyViolationError, pgerror.IsForeignKeyViolation},
+		{"IsNotNullViolation", pgerror.CodeNotNullViolationError, pgerror.IsNotNullViolation},
+		{"IsCheckViolation", pgerror.CodeCheckViolationError, pgerror.IsCheckViolation},
+		{"IsSerializationFailure", pgerror.CodeSerializationFailureError, pgerror.IsSerializationFailure},
+		{"IsWarning", pgerror.CodeWarningStringDataRightTruncationError, pgerror.IsWarning},
+	}
+	for _, p := range predicates {
+		t.Run(p.name, func(t *testing.T) {
+			testCases := []struct {
+				err      error
+				expected bool
+			}{
+				{pgerror.New(p.code, "err"), true},
+				{errors.Wrap(pgerror.New(p.code, "err"), "wrap"), true},
+				{errors.Wrap(errors.Wrap(pgerror.New(p.code, "err"), "wrap"), "wrap"), true},
+				{errors.Wrap(&pq.Error{Code: pq.ErrorCode(p.code)}, "wrap"), true},
+				{&pq.Error{Code: pq.ErrorCode(p.code)}, true},
+				{pgerror.New(pgerror.CodeSyntaxError, "err"), false},
+				{errors.Wrap(errors.New(p.code), "wrap"), false},
+				{nil, false},
+			}
+			for _, tc := range testCases {
+				if actual := p.fn(tc.err); actual != tc.expected {
+					t.Errorf("%v: expected %t, got %t", tc.err, tc.expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWithSafeDetail(t *testing.T) {
+	err := pgerror.NewWithSafeDetail(pgerror.CodeInternalError, "unmatched column orderings",
+		log.Safe(2), 3, log.Safe("left"), "secret")
+	if err.Code != pgerror.CodeInternalError || err.Message != "unmatched column orderings" {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	// Only the safe arguments are reported verbatim.
+	details := pgerror.GetSafeDetails(errors.Wrap(err, "wrap"))
+	if len(details) != 1 {
+		t.Fatalf("expected one detail, got %v", details)
+	}
+	re := regexp.MustCompile(`^errors_test.go:\d+: 2; int; left; string$`)
+	if !re.MatchString(details[0]) {
+		t.Fatalf("expected %s, got %q", re, details[0])
+	}
+
+	if details := pgerror.GetSafeDetails(pgerror.New(pgerror.CodeInternalError, "err")); len(details) != 0 {
+		t.Fatalf("expected no details, got %v", details)
+	}
+	if details := pgerror.GetSafeDetails(errors.New("err")); details != nil {
+		t.Fatalf("expected no details, got %v", details)
+	}
+}
+
+func TestUnimplementedWithIssue(t *testing.T) {
+	for _, err := range []*pgerror.Error{
+		pgerror.UnimplementedWithIssue(1234, "merge join with mixed directions"),
+		pgerror.UnimplementedWithIssuef(1234, "merge join with %s directions", "mixed"),
+	} {
+		if err.Code != pgerror.CodeFeatureNotSupportedError {
+			t.Errorf("expected code %s, got %s", pgerror.CodeFeatureNotSupportedError, err.Code)
+		}
+		if expected := "unimplemented: merge join with mixed directions"; err.Message != expected {
+			t.Errorf("expected message %q, got %q", expected, err.Message)
+		}
+		if expected := "See: https://github.com/cockroachdb/cockroach/issues/1234"; err.Hint != expected {
+			t.Errorf("expected hint %q, got %q", expected, err.Hint)
+		}
+		if err.TelemetryKey != "#1234" {
+			t.Errorf("expected telemetry key #1234, got %q", err.TelemetryKey)
+		}
+	}
+}
+
+func TestFlattenMessage(t *testing.T) {
+	pgErr := pgerror.New(pgerror.CodeUndefinedTableError, "relation \"t\" does not exist")
+	testCases := []struct {
+		err      error
+		expected string
+	}{
+		{nil, ""},
+		{pgErr, `relation "t" does not exist`},
+		{errors.Wrap(pgErr, "wrap"), `relation "t" does not exist`},
+		{errors.Wrap(errors.Wrap(pgErr, "inner"), "outer"), `relation "t" does not exist`},
+		{pgerror.Wrap(pgErr, pgerror.CodeSyntaxError, "wrap"), `wrap: relation "t" does not exist`},
+		{&pq.Error{Code: pgerror.CodeSyntaxError, Message: "syntax error"}, "syntax error"},
+		{errors.New("plain"), "plain"},
+	}
+	for _, tc := range testCases {
+		if actual := pgerror.FlattenMessage(tc.err); actual != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.err, tc.expected, actual)
+		}
+	}
+
+	// The error itself must not be modified.
+	if pgErr.Code != pgerror.CodeUndefinedTableError {
+		t.Fatalf("error code was modified: %s", pgErr.Code)
+	}
+	if actual := fmt.Sprintf("%#v", pgErr); actual != `(42P01) relation "t" does not exist` {
+		t.Fatalf("unexpected formatting: %s", actual)
+	}
+}
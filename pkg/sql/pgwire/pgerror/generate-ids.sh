@@ -0,0 +1,34 @@
+#!/bin/sh
+
+set -eu
+
+# This script regenerates codeids.go, which assigns a stable numeric ID to
+# every error code defined in codes.go. Only the Code... constants are error
+# codes; other string constants of five characters (e.g. SeverityError) are
+# not. The IDs of codes already listed in codeids.go are preserved and new
+# codes are appended with the next IDs, so run it after adding codes to
+# codes.go. Never remove or reorder entries in
+# codeids.go by hand: the IDs are persisted outside of CockroachDB.
+existing=$(grep -oE '^	"[0-9A-Z]{5}",' codeids.go 2>/dev/null | tr -d '\t",' || true)
+all=$(grep -oE 'Code[A-Za-z0-9]+ += "[0-9A-Z]{5}"' codes.go | grep -oE '"[0-9A-Z]{5}"' | tr -d '"')
+
+{
+	echo '// Code generated by generate-ids.sh; DO NOT EDIT.'
+	echo
+	echo 'package pgerror'
+	echo
+	echo '// codesByID lists the error codes in the order in which they were assigned'
+	echo '// IDs; the ID of a code is its index. ID 0 is reserved for unknown codes.'
+	echo 'var codesByID = [...]string{'
+	echo '	"",'
+	for c in $existing; do
+		echo "	\"$c\","
+	done
+	for c in $all; do
+		if ! echo "$existing" | grep -qx "$c"; then
+			echo "	\"$c\","
+		fi
+	done
+	echo '}'
+} > codeids.go.tmp
+mv codeids.go.tmp codeids.go
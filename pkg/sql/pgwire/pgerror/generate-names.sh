@@ -0,0 +1,26 @@
+#!/bin/sh
+
+set -eu
+
+# This script regenerates condnames.go, which maps error codes to their
+# PL/pgSQL condition names, from errcodes.txt. Codes that have no condition
+# name in errcodes.txt are omitted.
+#
+# Some codes are listed more than once in errcodes.txt (e.g. 2202E is both
+# ERRCODE_ARRAY_ELEMENT_ERROR and ERRCODE_ARRAY_SUBSCRIPT_ERROR). Only the
+# entries that have a condition name produce a map entry, so such a code maps
+# to the name of its named entry. If two entries for the same code ever both
+# had names, the generated map literal would not compile.
+{
+	echo '// Code generated by generate-names.sh; DO NOT EDIT.'
+	echo
+	echo 'package pgerror'
+	echo
+	echo '// conditionNames maps error codes to their PL/pgSQL condition names.'
+	echo 'var conditionNames = map[string]string{'
+	grep -E '^[0-9A-Z]{5} ' errcodes.txt |
+	awk 'NF >= 4 { printf "\t\"%s\": \"%s\",\n", $1, $4 }'
+	echo '}'
+} > condnames.go.tmp
+gofmt -w condnames.go.tmp
+mv condnames.go.tmp condnames.go
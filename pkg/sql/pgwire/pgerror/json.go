@@ -0,0 +1,63 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pgerror
+
+import (
+	"encoding/json"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// MarshalJSON encodes err as JSON, so that it can be shipped to another
+// process and decoded there with UnmarshalJSON. The message of err is
+// preserved, as well as the code, detail and hint (and the other fields of
+// Error) of the pg error it wraps, if any. Both errors generated by this
+// package and errors received by lib/pq clients are recognized. A nil error
+// is encoded as null.
+func MarshalJSON(err error) ([]byte, error) {
+	if err == nil {
+		return json.Marshal(nil)
+	}
+	var pgErr Error
+	switch e := cause(err).(type) {
+	case *Error:
+		pgErr = *e
+	case *pq.Error:
+		pgErr = Error{Code: string(e.Code), Detail: e.Detail, Hint: e.Hint, Context: e.Where}
+	}
+	// The message of err includes the context added by any wrappers.
+	pgErr.Message = err.Error()
+	return json.Marshal(&pgErr)
+}
+
+// UnmarshalJSON decodes an error encoded with MarshalJSON. The first return
+// value is the decoded error: an *Error if the encoded error carried a pg
+// error code, a plain error with the same message otherwise, or nil if the
+// encoded error was nil. The second return value is set if data could not be
+// decoded.
+func UnmarshalJSON(data []byte) (error, error) {
+	var pgErr *Error
+	if err := json.Unmarshal(data, &pgErr); err != nil {
+		return nil, errors.Wrap(err, "decoding pg error")
+	}
+	if pgErr == nil {
+		return nil, nil
+	}
+	if pgErr.Code == "" {
+		return errors.New(pgErr.Message), nil
+	}
+	return pgErr, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pgerror_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	uniqueErr := pgerror.New(pgerror.CodeUniqueViolationError,
+		`duplicate key value (k)=(1) violates unique constraint "primary"`)
+	uniqueErr.SetDetailf("key (k)=(1) already exists")
+	uniqueErr.SetHintf("use UPSERT")
+
+	testCases := []struct {
+		err    error
+		code   string
+		msg    string
+		detail string
+		hint   string
+	}{
+		{
+			err:    uniqueErr,
+			code:   pgerror.CodeUniqueViolationError,
+			msg:    uniqueErr.Message,
+			detail: "key (k)=(1) already exists",
+			hint:   "use UPSERT",
+		},
+		{
+			err:  errors.Wrap(pgerror.New(pgerror.CodeSyntaxError, "syntax error"), "parsing"),
+			code: pgerror.CodeSyntaxError,
+			msg:  "parsing: syntax error",
+		},
+		{
+			err: &pq.Error{
+				Code: pq.ErrorCode(pgerror.CodeDivisionByZeroError), Message: "division by zero", Detail: "d",
+			},
+			code:   pgerror.CodeDivisionByZeroError,
+			msg:    "pq: division by zero",
+			detail: "d",
+		},
+		{
+			err: errors.New("no code"),
+			msg: "no code",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.msg, func(t *testing.T) {
+			data, err := pgerror.MarshalJSON(tc.err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := pgerror.UnmarshalJSON(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Error() != tc.msg {
+				t.Errorf("expected message %q, got %q", tc.msg, res.Error())
+			}
+			code, ok := pgerror.GetPGCode(res)
+			if code != tc.code || ok != (tc.code != "") {
+				t.Errorf("expected code %q, got %q (%t)", tc.code, code, ok)
+			}
+			if pgErr, ok := pgerror.GetPGCause(res); ok {
+				if pgErr.Detail != tc.detail {
+					t.Errorf("expected detail %q, got %q", tc.detail, pgErr.Detail)
+				}
+				if pgErr.Hint != tc.hint {
+					t.Errorf("expected hint %q, got %q", tc.hint, pgErr.Hint)
+				}
+			}
+		})
+	}
+
+	// A nil error round-trips to nil.
+	data, err := pgerror.MarshalJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := pgerror.UnmarshalJSON(data); err != nil || res != nil {
+		t.Fatalf("expected nil, got %v (%v)", res, err)
+	}
+	if _, err := pgerror.UnmarshalJSON([]byte("{")); err == nil {
+		t.Fatal("expected an error decoding invalid JSON")
+	}
+}
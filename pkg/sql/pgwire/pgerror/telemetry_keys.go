@@ -0,0 +1,88 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pgerror
+
+import (
+	"fmt"
+	"io"
+)
+
+// withTelemetryKey annotates an error with a telemetry key. It does not
+// change the message of the error, and the annotated error remains
+// accessible via errors.Cause().
+type withTelemetryKey struct {
+	cause error
+	key   string
+}
+
+var _ error = &withTelemetryKey{}
+
+// Error implements the error interface.
+func (w *withTelemetryKey) Error() string { return w.cause.Error() }
+
+// Cause implements the causer interface of github.com/pkg/errors.
+func (w *withTelemetryKey) Cause() error { return w.cause }
+
+// Format implements the fmt.Formatter interface.
+func (w *withTelemetryKey) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprintf(s, "%+v", w.cause)
+		return
+	}
+	_, _ = io.WriteString(s, w.Error())
+}
+
+// WithTelemetryKey annotates err with a telemetry key, used to count
+// occurrences of the error independently of its (possibly variable) message.
+// Keys accumulate when an error is annotated several times; they can be
+// retrieved with GetTelemetryKeys. A nil err is propagated as nil.
+func WithTelemetryKey(err error, key string) error {
+	if err == nil {
+		return nil
+	}
+	return &withTelemetryKey{cause: err, key: key}
+}
+
+// GetTelemetryKeys returns the telemetry keys of err, in the order in which
+// they were attached: the key of the underlying Error, if any, comes first,
+// followed by the keys added with WithTelemetryKey from the innermost to the
+// outermost. The chain of causes is followed through errors.Wrap() and
+// similar wrappers.
+func GetTelemetryKeys(err error) []string {
+	type causer interface {
+		Cause() error
+	}
+	var keys []string
+	for err != nil {
+		switch e := err.(type) {
+		case *withTelemetryKey:
+			keys = append(keys, e.key)
+		case *Error:
+			if e.TelemetryKey != "" {
+				keys = append(keys, e.TelemetryKey)
+			}
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	// The keys were collected from the outermost error inwards.
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys
+}
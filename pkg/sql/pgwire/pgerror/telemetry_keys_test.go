@@ -0,0 +1,65 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pgerror_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/pkg/errors"
+)
+
+func TestTelemetryKeys(t *testing.T) {
+	if err := pgerror.WithTelemetryKey(nil, "a"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	base := pgerror.Newf(pgerror.CodeDataExceptionError, "could not cancel query %s", "123")
+	base.TelemetryKey = "base"
+
+	testData := []struct {
+		err      error
+		expected []string
+	}{
+		{errors.New("woo"), nil},
+		{pgerror.New(pgerror.CodeSyntaxError, "woo"), nil},
+		{base, []string{"base"}},
+		{pgerror.WithTelemetryKey(errors.New("woo"), "a"), []string{"a"}},
+		{pgerror.WithTelemetryKey(base, "a"), []string{"base", "a"}},
+		{
+			pgerror.WithTelemetryKey(
+				errors.Wrap(pgerror.WithTelemetryKey(base, "a"), "wrapped"),
+				"b"),
+			[]string{"base", "a", "b"},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			if keys := pgerror.GetTelemetryKeys(test.err); !reflect.DeepEqual(keys, test.expected) {
+				t.Fatalf("expected %q, got %q", test.expected, keys)
+			}
+		})
+	}
+
+	// The annotation is transparent to the error message and code.
+	err := pgerror.WithTelemetryKey(base, "cancel.failed")
+	if err.Error() != base.Error() {
+		t.Fatalf("expected %q, got %q", base.Error(), err.Error())
+	}
+	if pgErr, ok := pgerror.GetPGCause(err); !ok || pgErr.Code != pgerror.CodeDataExceptionError {
+		t.Fatalf("expected the pgerror to be preserved, got %+v", err)
+	}
+}
@@ -124,6 +124,61 @@ func Wrapf(err error, code, format string, args ...interface{}) error {
 	return WrapWithDepthf(1, err, code, format, args...)
 }
 
+// WithCandidateCode returns err annotated with the given code, unless err
+// already carries a code other than CodeUncategorizedError, in which case it
+// is returned unchanged. This makes it possible to attach a best-guess code
+// to an error idempotently. The message of err is preserved. Errors that
+// cannot be converted to a pgerror (see WrapWithDepthf) are returned
+// unchanged as well.
+func WithCandidateCode(err error, code string) error {
+	if err == nil {
+		return nil
+	}
+	if c, ok := GetPGCode(err); ok && c != CodeUncategorizedError {
+		return err
+	}
+	pgErr, ok := WrapWithDepthf(1, err, code, "" /* format */).(*Error)
+	if !ok {
+		return err
+	}
+	// Wrapping doesn't override the code of an error that already has one.
+	pgErr.Code = code
+	return pgErr
+}
+
+// WithContext returns err annotated with the given context, which describes
+// where the error occurred (e.g. "in ROWS FROM expression #2") and is reported
+// to clients in the WHERE field of the error. If err already carries a
+// context, the new one is appended on a separate line, so that, as in
+// Postgres, the innermost context comes first. The message and code of err
+// are preserved; errors without a code get CodeUncategorizedError. Errors
+// that cannot be converted to a pgerror (see WrapWithDepthf) are returned
+// unchanged.
+func WithContext(err error, context string) error {
+	if err == nil {
+		return nil
+	}
+	pgErr, ok := WrapWithDepthf(1, err, CodeUncategorizedError, "" /* format */).(*Error)
+	if !ok {
+		return err
+	}
+	if pgErr.Context != "" {
+		pgErr.Context += "\n" + context
+	} else {
+		pgErr.Context = context
+	}
+	return pgErr
+}
+
+// GetContext returns the context carried by err, as added by WithContext, or
+// an empty string if there is none.
+func GetContext(err error) string {
+	if pgErr, ok := GetPGCause(err); ok {
+		return pgErr.Context
+	}
+	return ""
+}
+
 // collectErrForWrap disassembles the provided error and
 // collect details.
 //
@@ -49,3 +49,82 @@ func TestWrap(t *testing.T) {
 		}
 	}
 }
+
+func TestWithCandidateCode(t *testing.T) {
+	testData := []struct {
+		err          error
+		expectedCode string
+	}{
+		// Errors without a code, or with the uncategorized code, get the
+		// candidate code.
+		{errors.New("woo"), pgerror.CodeSyntaxError},
+		{errors.Wrap(errors.New("woo"), "wrapped"), pgerror.CodeSyntaxError},
+		{pgerror.New(pgerror.CodeUncategorizedError, "woo"), pgerror.CodeSyntaxError},
+		// Errors that already carry a code are left alone.
+		{pgerror.New(pgerror.CodeDivisionByZeroError, "woo"), pgerror.CodeDivisionByZeroError},
+		{errors.Wrap(pgerror.New(pgerror.CodeDivisionByZeroError, "woo"), "wrapped"),
+			pgerror.CodeDivisionByZeroError},
+	}
+
+	for i, test := range testData {
+		werr := pgerror.WithCandidateCode(test.err, pgerror.CodeSyntaxError)
+		if code, ok := pgerror.GetPGCode(werr); !ok || code != test.expectedCode {
+			t.Errorf("%d: expected code %s, got %s", i, test.expectedCode, code)
+		}
+		if werr.Error() != test.err.Error() {
+			t.Errorf("%d: expected message %q, got %q", i, test.err.Error(), werr.Error())
+		}
+		// Assigning a candidate code again is a no-op.
+		if werr2 := pgerror.WithCandidateCode(werr, pgerror.CodeDataExceptionError); werr2 != werr {
+			t.Errorf("%d: expected %v to be returned unchanged, got %v", i, werr, werr2)
+		}
+	}
+
+	if err := pgerror.WithCandidateCode(nil, pgerror.CodeSyntaxError); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	// Retry errors are not converted.
+	retryErr := &roachpb.UnhandledRetryableError{}
+	if err := pgerror.WithCandidateCode(retryErr, pgerror.CodeSyntaxError); err != retryErr {
+		t.Errorf("expected %v to be returned unchanged, got %v", retryErr, err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	err := pgerror.WithContext(errors.New("woo"), "in ROWS FROM expression #2")
+	if code, ok := pgerror.GetPGCode(err); !ok || code != pgerror.CodeUncategorizedError {
+		t.Errorf("expected code %s, got %s", pgerror.CodeUncategorizedError, code)
+	}
+	if err.Error() != "woo" {
+		t.Errorf("expected message %q, got %q", "woo", err.Error())
+	}
+
+	// The context survives wrapping.
+	err = errors.Wrap(err, "wrapped")
+	err = pgerror.Wrap(err, pgerror.CodeDataExceptionError, "wrapped again")
+	if c := pgerror.GetContext(err); c != "in ROWS FROM expression #2" {
+		t.Errorf("unexpected context %q", c)
+	}
+
+	// Outer contexts are appended to the existing ones.
+	err = pgerror.WithContext(err, "in statement 1")
+	if c := pgerror.GetContext(err); c != "in ROWS FROM expression #2\nin statement 1" {
+		t.Errorf("unexpected context %q", c)
+	}
+	// The code is preserved.
+	if code, ok := pgerror.GetPGCode(err); !ok || code != pgerror.CodeUncategorizedError {
+		t.Errorf("expected code %s, got %s", pgerror.CodeUncategorizedError, code)
+	}
+
+	if c := pgerror.GetContext(errors.New("woo")); c != "" {
+		t.Errorf("expected no context, got %q", c)
+	}
+	if err := pgerror.WithContext(nil, "woo"); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	// Retry errors are not converted.
+	retryErr := &roachpb.UnhandledRetryableError{}
+	if err := pgerror.WithContext(retryErr, "woo"); err != retryErr {
+		t.Errorf("expected %v to be returned unchanged, got %v", retryErr, err)
+	}
+}
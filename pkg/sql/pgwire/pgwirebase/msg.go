@@ -70,6 +70,7 @@ const (
 	ServerErrFieldSrcFile     ServerErrFieldType = 'F'
 	ServerErrFieldSrcLine     ServerErrFieldType = 'L'
 	ServerErrFieldSrcFunction ServerErrFieldType = 'R'
+	ServerErrFieldWhere       ServerErrFieldType = 'W'
 )
 
 // PrepareType represents a subtype for prepare messages.
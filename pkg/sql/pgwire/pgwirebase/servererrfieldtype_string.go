@@ -16,6 +16,7 @@ func _() {
 	_ = x[ServerErrFieldSrcFile-70]
 	_ = x[ServerErrFieldSrcLine-76]
 	_ = x[ServerErrFieldSrcFunction-82]
+	_ = x[ServerErrFieldWhere-87]
 }
 
 const (
@@ -24,6 +25,7 @@ const (
 	_ServerErrFieldType_name_2 = "ServerErrFileldHint"
 	_ServerErrFieldType_name_3 = "ServerErrFieldSrcLineServerErrFieldMsgPrimary"
 	_ServerErrFieldType_name_4 = "ServerErrFieldSrcFunctionServerErrFieldSeverity"
+	_ServerErrFieldType_name_5 = "ServerErrFieldWhere"
 )
 
 var (
@@ -47,6 +49,8 @@ func (i ServerErrFieldType) String() string {
 	case 82 <= i && i <= 83:
 		i -= 82
 		return _ServerErrFieldType_name_4[_ServerErrFieldType_index_4[i]:_ServerErrFieldType_index_4[i+1]]
+	case i == 87:
+		return _ServerErrFieldType_name_5
 	default:
 		return "ServerErrFieldType(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
@@ -97,7 +97,13 @@ func (p *planner) Select(
 	orderBy := n.OrderBy
 	with := n.With
 
+	if n.Locking != nil {
+		return nil, pgerror.UnimplementedWithIssue(6583, "locking clauses are not supported")
+	}
 	for s, ok := wrapped.(*tree.ParenSelect); ok; s, ok = wrapped.(*tree.ParenSelect) {
+		if s.Select.Locking != nil {
+			return nil, pgerror.UnimplementedWithIssue(6583, "locking clauses are not supported")
+		}
 		wrapped = s.Select.Select
 		if s.Select.With != nil {
 			if with != nil {
@@ -191,6 +197,10 @@ func (p *planner) SelectClause(
 	scalarProps := &p.semaCtx.Properties
 	defer scalarProps.Restore(*scalarProps)
 
+	if parsed.Into != nil {
+		return nil, pgerror.Unimplemented("select into", "SELECT ... INTO is not supported")
+	}
+
 	r := &renderNode{}
 
 	resetter, err := p.initWith(ctx, with)
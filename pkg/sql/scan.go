@@ -22,6 +22,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlrun"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
 	"github.com/cockroachdb/cockroach/pkg/sql/privilege"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
@@ -309,6 +310,17 @@ func (n *scanNode) lookupSpecifiedIndex(indexFlags *tree.IndexFlags) error {
 			return errors.Errorf("index [%d] not found", indexFlags.IndexID)
 		}
 	}
+	if n.specifiedIndex != nil {
+		colIDs, _ := n.specifiedIndex.FullColumnIDs()
+		if err := indexFlags.CheckIndexColumns(len(colIDs)); err != nil {
+			return err
+		}
+	}
+	if len(indexFlags.ColumnDirections) > 0 {
+		return pgerror.Unimplemented(
+			"index flags per-column directions",
+			"per-column ASC/DESC index flags are not supported")
+	}
 	if indexFlags.Direction == tree.Descending {
 		n.specifiedIndexReverse = true
 	}
@@ -130,6 +130,57 @@ func EvalAsOfTimestamp(
 	return ts, nil
 }
 
+// asOfFreezeFormat is the format of the timestamp literals produced by
+// FreezeAsOf and by the formatting of AS OF SYSTEM TIME clauses that hold a
+// timestamp datum. It keeps nanosecond precision, which EvalAsOfTimestamp
+// accepts.
+const asOfFreezeFormat = "2006-01-02 15:04:05.999999999"
+
+// FreezeAsOf rewrites an AS OF SYSTEM TIME clause of the statement that is
+// relative to the statement time (for example '-10s') into the absolute
+// timestamp it denotes at time now, so that the statement reads at the same
+// time however often it is run. Absolute timestamps are left untouched. An
+// error is returned if the clause is not a constant that EvalAsOfTimestamp
+// would accept.
+func (node *Select) FreezeAsOf(now time.Time) error {
+	sel, ok := stripSelectParens(node.Select).(*SelectClause)
+	if !ok || sel.From == nil || sel.From.AsOf.Expr == nil {
+		return nil
+	}
+	asOf := &sel.From.AsOf
+
+	var iv *DInterval
+	switch e := StripParens(asOf.Expr).(type) {
+	case *StrVal:
+		s := e.RawString()
+		ctx := NewParseTimeContext(duration.AdditionModeCompatible, now)
+		if _, err := ParseDTimestamp(ctx, s, time.Nanosecond); err == nil {
+			return nil
+		}
+		if _, _, err := apd.NewFromString(s); err == nil {
+			return nil
+		}
+		d, err := ParseDInterval(s)
+		if err != nil {
+			return errors.Errorf("AS OF SYSTEM TIME: value is neither timestamp, decimal, nor interval")
+		}
+		iv = d
+	case *DInterval:
+		iv = e
+	case *NumVal, *DInt, *DDecimal, *DTimestamp, *DTimestampTZ:
+		return nil
+	default:
+		return errors.Errorf("AS OF SYSTEM TIME: cannot freeze expression %s", asOf.Expr)
+	}
+
+	if (iv.Duration == duration.Duration{}) {
+		return errors.Errorf("AS OF SYSTEM TIME: interval value %v too small, must be <= %v", iv, -1*time.Microsecond)
+	}
+	ts := duration.Add(duration.AdditionModeCompatible, now, iv.Duration)
+	asOf.Expr = NewStrVal(ts.UTC().Format(asOfFreezeFormat))
+	return nil
+}
+
 // DecimalToHLC performs the conversion from an inputted DECIMAL datum for an
 // AS OF SYSTEM TIME query to an HLC timestamp.
 func DecimalToHLC(d *apd.Decimal) (hlc.Timestamp, error) {
@@ -579,6 +579,10 @@ func (*UniqueConstraintTableDef) constraintTableDef() {}
 type UniqueConstraintTableDef struct {
 	IndexTableDef
 	PrimaryKey bool
+	// NullsNotDistinct is set for UNIQUE NULLS NOT DISTINCT constraints, for
+	// which NULL values are considered equal to each other. It is never set
+	// for primary keys.
+	NullsNotDistinct bool
 }
 
 // Format implements the NodeFormatter interface.
@@ -592,6 +596,9 @@ func (node *UniqueConstraintTableDef) Format(ctx *FmtCtx) {
 		ctx.WriteString("PRIMARY KEY ")
 	} else {
 		ctx.WriteString("UNIQUE ")
+		if node.NullsNotDistinct {
+			ctx.WriteString("NULLS NOT DISTINCT ")
+		}
 	}
 	ctx.WriteByte('(')
 	ctx.FormatNode(&node.Columns)
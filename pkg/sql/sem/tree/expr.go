@@ -22,6 +22,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
 	"github.com/cockroachdb/cockroach/pkg/sql/lex"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util"
 )
@@ -98,6 +99,7 @@ var _ operatorExpr = &UnaryExpr{}
 var _ operatorExpr = &ComparisonExpr{}
 var _ operatorExpr = &RangeCond{}
 var _ operatorExpr = &IsOfTypeExpr{}
+var _ operatorExpr = &OverlapsExpr{}
 
 // Operator is used to identify Operators; used in sql.y.
 type Operator interface {
@@ -165,7 +167,7 @@ func binExprFmtWithParen(ctx *FmtCtx, e1 Expr, op string, e2 Expr, pad bool) {
 	if pad {
 		ctx.WriteByte(' ')
 	}
-	ctx.WriteString(op)
+	ctx.writeKeyword(op)
 	if pad {
 		ctx.WriteByte(' ')
 	}
@@ -176,10 +178,10 @@ func binExprFmtWithParenAndSubOp(ctx *FmtCtx, e1 Expr, subOp, op string, e2 Expr
 	exprFmtWithParen(ctx, e1)
 	ctx.WriteByte(' ')
 	if subOp != "" {
-		ctx.WriteString(subOp)
+		ctx.writeKeyword(subOp)
 		ctx.WriteByte(' ')
 	}
-	ctx.WriteString(op)
+	ctx.writeKeyword(op)
 	ctx.WriteByte(' ')
 	exprFmtWithParen(ctx, e2)
 }
@@ -248,7 +250,7 @@ func (*NotExpr) operatorExpr() {}
 
 // Format implements the NodeFormatter interface.
 func (node *NotExpr) Format(ctx *FmtCtx) {
-	ctx.WriteString("NOT ")
+	ctx.writeKeyword("NOT ")
 	exprFmtWithParen(ctx, node.Expr)
 }
 
@@ -560,9 +562,9 @@ func (node *RangeCond) Format(ctx *FmtCtx) {
 		notStr = " NOT BETWEEN "
 	}
 	exprFmtWithParen(ctx, node.Left)
-	ctx.WriteString(notStr)
+	ctx.writeKeyword(notStr)
 	if node.Symmetric {
-		ctx.WriteString("SYMMETRIC ")
+		ctx.writeKeyword("SYMMETRIC ")
 	}
 	binExprFmtWithParen(ctx, node.From, "AND", node.To, true)
 }
@@ -596,11 +598,11 @@ func (*IsOfTypeExpr) operatorExpr() {}
 // Format implements the NodeFormatter interface.
 func (node *IsOfTypeExpr) Format(ctx *FmtCtx) {
 	exprFmtWithParen(ctx, node.Expr)
-	ctx.WriteString(" IS")
+	ctx.writeKeyword(" IS")
 	if node.Not {
-		ctx.WriteString(" NOT")
+		ctx.writeKeyword(" NOT")
 	}
-	ctx.WriteString(" OF (")
+	ctx.writeKeyword(" OF (")
 	for i, t := range node.Types {
 		if i > 0 {
 			ctx.WriteString(", ")
@@ -610,6 +612,23 @@ func (node *IsOfTypeExpr) Format(ctx *FmtCtx) {
 	ctx.WriteByte(')')
 }
 
+// OverlapsExpr represents the SQL-standard OVERLAPS predicate, which tests
+// whether two periods of time overlap: (start1, end1) OVERLAPS (start2, end2).
+// Each side is a two-element row whose second element is either the end of
+// the period or its length, as an interval.
+type OverlapsExpr struct {
+	Left, Right Expr
+}
+
+func (*OverlapsExpr) operatorExpr() {}
+
+// Format implements the NodeFormatter interface.
+func (node *OverlapsExpr) Format(ctx *FmtCtx) {
+	exprFmtWithParen(ctx, node.Left)
+	ctx.writeKeyword(" OVERLAPS ")
+	exprFmtWithParen(ctx, node.Right)
+}
+
 // IfErrExpr represents an IFERROR expression.
 type IfErrExpr struct {
 	Cond    Expr
@@ -984,7 +1003,7 @@ func (node *Subquery) Format(ctx *FmtCtx) {
 		// the type annotations are not available in subqueries.
 		ctx.WithFlags(ctx.flags & ^FmtShowTypes, func() {
 			if node.Exists {
-				ctx.WriteString("EXISTS ")
+				ctx.writeKeyword("EXISTS ")
 			}
 			if node.Select == nil {
 				// If the subquery is generated by the optimizer, we
@@ -1231,9 +1250,19 @@ type FuncExpr struct {
 	Func  ResolvableFunctionReference
 	Type  funcType
 	Exprs Exprs
+	// ArgNames are the names of the arguments passed by name: f(1, b => 2). It
+	// is either empty, if all the arguments are positional, or parallel to
+	// Exprs, with empty names for the positional arguments.
+	ArgNames []Name
+	// OrderBy is the ordering of the input rows of aggregates:
+	// array_agg(DISTINCT k ORDER BY k)
+	OrderBy OrderBy
 	// Filter is used for filters on aggregates: SUM(k) FILTER (WHERE k > 0)
 	Filter    Expr
 	WindowDef *WindowDef
+	// WithinGroup is the ordering of the input rows of ordered-set aggregates:
+	// percentile_cont(0.5) WITHIN GROUP (ORDER BY k)
+	WithinGroup *OrderBy
 
 	typeAnnotation
 	fnProps *FunctionProperties
@@ -1315,6 +1344,128 @@ func (node *FuncExpr) IsDistSQLBlacklist() bool {
 	return node.fnProps != nil && node.fnProps.DistsqlBlacklist
 }
 
+// orderedSetAggregates contains the names of the aggregates that accept a
+// WITHIN GROUP clause: the ordered-set aggregates and the hypothetical-set
+// aggregates.
+var orderedSetAggregates = map[string]struct{}{
+	"percentile_cont": {},
+	"percentile_disc": {},
+	"mode":            {},
+	"rank":            {},
+	"dense_rank":      {},
+	"percent_rank":    {},
+	"cume_dist":       {},
+}
+
+// ValidateWithinGroup checks that a WITHIN GROUP clause, if present, is
+// applied to an ordered-set aggregate and is not combined with DISTINCT or
+// OVER.
+func (node *FuncExpr) ValidateWithinGroup() error {
+	if node.WithinGroup == nil {
+		return nil
+	}
+	var name string
+	switch t := node.Func.FunctionReference.(type) {
+	case *UnresolvedName:
+		name = t.Parts[0]
+	case *FunctionDefinition:
+		name = t.Name
+	}
+	if _, ok := orderedSetAggregates[name]; !ok {
+		return pgerror.Newf(pgerror.CodeWrongObjectTypeError,
+			"WITHIN GROUP is specified, but %s is not an ordered-set aggregate", &node.Func)
+	}
+	if node.Type == DistinctFuncType {
+		return pgerror.New(pgerror.CodeFeatureNotSupportedError,
+			"cannot use DISTINCT with WITHIN GROUP")
+	}
+	if node.WindowDef != nil {
+		return pgerror.New(pgerror.CodeWrongObjectTypeError,
+			"OVER is not supported for ordered-set aggregate "+name)
+	}
+	return nil
+}
+
+// ValidateArgNames checks that the arguments passed by name follow all the
+// positional arguments and that no name is used twice.
+func (node *FuncExpr) ValidateArgNames() error {
+	if len(node.ArgNames) == 0 {
+		return nil
+	}
+	if len(node.ArgNames) != len(node.Exprs) {
+		return pgerror.AssertionFailedf("%d argument names for %d arguments",
+			len(node.ArgNames), len(node.Exprs))
+	}
+	seen := make(map[Name]struct{}, len(node.ArgNames))
+	for i, name := range node.ArgNames {
+		if name == "" {
+			if i > 0 && node.ArgNames[i-1] != "" {
+				return pgerror.New(pgerror.CodeSyntaxError,
+					"positional argument cannot follow named argument")
+			}
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			return pgerror.Newf(pgerror.CodeSyntaxError,
+				"argument name %q used more than once", string(name))
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+// ValidateFilter checks that a FILTER clause, if present, is applied to an
+// aggregate function.
+func (node *FuncExpr) ValidateFilter(searchPath sessiondata.SearchPath) error {
+	if node.Filter == nil {
+		return nil
+	}
+	def, err := node.Func.Resolve(searchPath)
+	if err != nil {
+		return err
+	}
+	if def.Class != AggregateClass {
+		return pgerror.Newf(pgerror.CodeWrongObjectTypeError,
+			"FILTER specified but %s() is not an aggregate function", def.Name)
+	}
+	return nil
+}
+
+// ValidateDistinct checks that DISTINCT, if present, qualifies the arguments
+// of an aggregate function that is not applied as a window function, and that
+// the aggregate's ORDER BY expressions all appear in its arguments.
+func (node *FuncExpr) ValidateDistinct(searchPath sessiondata.SearchPath) error {
+	if node.Type != DistinctFuncType {
+		return nil
+	}
+	def, err := node.Func.Resolve(searchPath)
+	if err != nil {
+		return err
+	}
+	if def.Class != AggregateClass {
+		return pgerror.Newf(pgerror.CodeWrongObjectTypeError,
+			"DISTINCT specified, but %s() is not an aggregate function", def.Name)
+	}
+	if node.WindowDef != nil {
+		return pgerror.New(pgerror.CodeFeatureNotSupportedError,
+			"DISTINCT is not implemented for window functions")
+	}
+	for _, o := range node.OrderBy {
+		found := false
+		for _, arg := range node.Exprs {
+			if exprsEqual(o.Expr, arg) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return pgerror.New(pgerror.CodeInvalidColumnReferenceError,
+				"in an aggregate with DISTINCT, ORDER BY expressions must appear in argument list")
+		}
+	}
+	return nil
+}
+
 type funcType int
 
 // FuncExpr.Type
@@ -1344,7 +1495,24 @@ func (node *FuncExpr) Format(ctx *FmtCtx) {
 
 	ctx.WriteByte('(')
 	ctx.WriteString(typ)
-	ctx.FormatNode(&node.Exprs)
+	if len(node.ArgNames) == 0 {
+		ctx.FormatNode(&node.Exprs)
+	} else {
+		for i, e := range node.Exprs {
+			if i > 0 {
+				ctx.WriteString(", ")
+			}
+			if i < len(node.ArgNames) && node.ArgNames[i] != "" {
+				ctx.FormatNode(&node.ArgNames[i])
+				ctx.WriteString(" => ")
+			}
+			ctx.FormatNode(e)
+		}
+	}
+	if len(node.OrderBy) > 0 {
+		ctx.WriteByte(' ')
+		ctx.FormatNode(&node.OrderBy)
+	}
 	ctx.WriteByte(')')
 	if ctx.HasFlags(FmtParsable) && node.typ != nil {
 		if node.fnProps.AmbiguousReturnType {
@@ -1357,6 +1525,11 @@ func (node *FuncExpr) Format(ctx *FmtCtx) {
 			}
 		}
 	}
+	if node.WithinGroup != nil {
+		ctx.WriteString(" WITHIN GROUP (")
+		ctx.FormatNode(node.WithinGroup)
+		ctx.WriteByte(')')
+	}
 	if node.Filter != nil {
 		ctx.WriteString(" FILTER (WHERE ")
 		ctx.FormatNode(node.Filter)
@@ -1383,7 +1556,7 @@ type CaseExpr struct {
 
 // Format implements the NodeFormatter interface.
 func (node *CaseExpr) Format(ctx *FmtCtx) {
-	ctx.WriteString("CASE ")
+	ctx.writeKeyword("CASE ")
 	if node.Expr != nil {
 		ctx.FormatNode(node.Expr)
 		ctx.WriteByte(' ')
@@ -1393,11 +1566,11 @@ func (node *CaseExpr) Format(ctx *FmtCtx) {
 		ctx.WriteByte(' ')
 	}
 	if node.Else != nil {
-		ctx.WriteString("ELSE ")
+		ctx.writeKeyword("ELSE ")
 		ctx.FormatNode(node.Else)
 		ctx.WriteByte(' ')
 	}
-	ctx.WriteString("END")
+	ctx.writeKeyword("END")
 }
 
 // NewTypedCaseExpr returns a new CaseExpr that is verified to be well-typed.
@@ -1417,9 +1590,9 @@ type When struct {
 
 // Format implements the NodeFormatter interface.
 func (node *When) Format(ctx *FmtCtx) {
-	ctx.WriteString("WHEN ")
+	ctx.writeKeyword("WHEN ")
 	ctx.FormatNode(node.Cond)
-	ctx.WriteString(" THEN ")
+	ctx.writeKeyword(" THEN ")
 	ctx.FormatNode(node.Val)
 }
 
@@ -1728,6 +1901,7 @@ func (node *IfErrExpr) String() string        { return AsString(node) }
 func (node *IndexedVar) String() string       { return AsString(node) }
 func (node *IndirectionExpr) String() string  { return AsString(node) }
 func (node *IsOfTypeExpr) String() string     { return AsString(node) }
+func (node *OverlapsExpr) String() string     { return AsString(node) }
 func (node *Name) String() string             { return AsString(node) }
 func (node *UnrestrictedName) String() string { return AsString(node) }
 func (node *NotExpr) String() string          { return AsString(node) }
@@ -1739,6 +1913,9 @@ func (node *RangeCond) String() string        { return AsString(node) }
 func (node *StrVal) String() string           { return AsString(node) }
 func (node *Subquery) String() string         { return AsString(node) }
 func (node *Tuple) String() string            { return AsString(node) }
+func (node *GroupingSets) String() string     { return AsString(node) }
+func (node *Rollup) String() string           { return AsString(node) }
+func (node *Cube) String() string             { return AsString(node) }
 func (node *TupleStar) String() string        { return AsString(node) }
 func (node *AnnotateTypeExpr) String() string { return AsString(node) }
 func (node *UnaryExpr) String() string        { return AsString(node) }
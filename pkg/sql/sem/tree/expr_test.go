@@ -23,7 +23,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/parser"
 	_ "github.com/cockroachdb/cockroach/pkg/sql/sem/builtins"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 )
 
 // TestUnresolvedNameString tests the string representation of tree.UnresolvedName and thus tree.Name.
@@ -165,3 +167,188 @@ func TestStripParens(t *testing.T) {
 		}
 	}
 }
+
+func TestFuncExprWithinGroup(t *testing.T) {
+	testCases := []struct {
+		expr        string
+		expectedErr string
+	}{
+		{expr: `percentile_cont(0.5) WITHIN GROUP (ORDER BY x)`},
+		{expr: `percentile_disc(ARRAY[0.25, 0.75]) WITHIN GROUP (ORDER BY x DESC, y) FILTER (WHERE y > 0)`},
+		{expr: `rank(3) WITHIN GROUP (ORDER BY x)`},
+		{
+			expr:        `sum(x) WITHIN GROUP (ORDER BY x)`,
+			expectedErr: `WITHIN GROUP is specified, but sum is not an ordered-set aggregate`,
+		},
+		{
+			expr:        `mode() WITHIN GROUP (ORDER BY x) OVER ()`,
+			expectedErr: `OVER is not supported for ordered-set aggregate mode`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.expr)
+			if tc.expectedErr != "" {
+				if !testutils.IsError(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := expr.(*tree.FuncExpr)
+			if f.WithinGroup == nil {
+				t.Fatalf("expected WITHIN GROUP to be set for %s", tc.expr)
+			}
+			if res := tree.AsString(f); res != tc.expr {
+				t.Fatalf("expected %s, got %s", tc.expr, res)
+			}
+		})
+	}
+}
+
+func TestFuncExprDistinctOrderBy(t *testing.T) {
+	testCases := []struct {
+		expr        string
+		expectedErr string
+	}{
+		{expr: `string_agg(DISTINCT s, ',' ORDER BY s)`},
+		{expr: `array_agg(DISTINCT x ORDER BY x DESC)`},
+		{expr: `array_agg(x ORDER BY y, z)`},
+		{expr: `count(DISTINCT x) FILTER (WHERE x > 0)`},
+		{
+			expr:        `array_agg(DISTINCT x ORDER BY y)`,
+			expectedErr: `in an aggregate with DISTINCT, ORDER BY expressions must appear in argument list`,
+		},
+		{
+			expr:        `lower(DISTINCT s)`,
+			expectedErr: `DISTINCT specified, but lower\(\) is not an aggregate function`,
+		},
+		{
+			expr:        `count(DISTINCT x) OVER ()`,
+			expectedErr: `DISTINCT is not implemented for window functions`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The expression round-trips through formatting.
+			if res := tree.AsString(expr); res != tc.expr {
+				t.Fatalf("expected %s, got %s", tc.expr, res)
+			}
+			reparsed, err := parser.ParseExpr(tree.AsString(expr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(reparsed); res != tc.expr {
+				t.Fatalf("expected %s after reparsing, got %s", tc.expr, res)
+			}
+
+			err = expr.(*tree.FuncExpr).ValidateDistinct(sessiondata.SearchPath{})
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !testutils.IsError(err, tc.expectedErr) {
+				t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFuncExprFilter(t *testing.T) {
+	testCases := []struct {
+		expr        string
+		expectedErr string
+	}{
+		{expr: `array_agg(x) FILTER (WHERE x > 0)`},
+		{expr: `array_agg(x ORDER BY x DESC) FILTER (WHERE x > 0)`},
+		{expr: `string_agg(DISTINCT s, ',' ORDER BY s) FILTER (WHERE s != '')`},
+		{expr: `sum(x) FILTER (WHERE x > 0) OVER (PARTITION BY y)`},
+		{expr: `lower(s)`},
+		{
+			expr:        `lower(s) FILTER (WHERE s != '')`,
+			expectedErr: `FILTER specified but lower\(\) is not an aggregate function`,
+		},
+		{
+			expr:        `row_number() FILTER (WHERE x > 0) OVER ()`,
+			expectedErr: `FILTER specified but row_number\(\) is not an aggregate function`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(expr); res != tc.expr {
+				t.Fatalf("expected %s, got %s", tc.expr, res)
+			}
+
+			err = expr.(*tree.FuncExpr).ValidateFilter(sessiondata.SearchPath{})
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !testutils.IsError(err, tc.expectedErr) {
+				t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFuncExprArgNames(t *testing.T) {
+	testCases := []struct {
+		expr        string
+		argNames    []tree.Name
+		expectedErr string
+	}{
+		{expr: `f(1, 2)`, argNames: nil},
+		{expr: `f(1, x => 2)`, argNames: []tree.Name{"", "x"}},
+		{expr: `f(x => 1, y => 2)`, argNames: []tree.Name{"x", "y"}},
+		{expr: `f(x => 1, "Y" => 2)`, argNames: []tree.Name{"x", "Y"}},
+		{
+			expr:        `f(x => 1, 2)`,
+			expectedErr: `positional argument cannot follow named argument`,
+		},
+		{
+			expr:        `f(x => 1, x => 2)`,
+			expectedErr: `argument name "x" used more than once`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.expr)
+			if tc.expectedErr != "" {
+				if !testutils.IsError(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := expr.(*tree.FuncExpr)
+			if !reflect.DeepEqual(f.ArgNames, tc.argNames) {
+				t.Fatalf("expected argument names %v, got %v", tc.argNames, f.ArgNames)
+			}
+			if res := tree.AsString(f); res != tc.expr {
+				t.Fatalf("expected %s, got %s", tc.expr, res)
+			}
+		})
+	}
+
+	// The argument names must be parallel to the arguments.
+	f := &tree.FuncExpr{
+		Func:     tree.WrapFunction("length"),
+		Exprs:    tree.Exprs{tree.NewDString("a"), tree.NewDString("b")},
+		ArgNames: []tree.Name{"x"},
+	}
+	if err := f.ValidateArgNames(); !testutils.IsError(err, "1 argument names for 2 arguments") {
+		t.Fatalf("expected assertion error, got %v", err)
+	}
+}
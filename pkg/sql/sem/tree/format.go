@@ -17,6 +17,7 @@ package tree
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/lex"
@@ -120,6 +121,27 @@ const (
 	// representation like -Inf. Negative values are preserved "inside"
 	// the numeric by enclosing them within parentheses.
 	FmtParsableNumerics
+
+	// FmtPretty instructs the pretty-printer to lay out SELECT statements
+	// over multiple lines: each clause starts on its own line and
+	// parenthesized subqueries are indented. See PrettyString.
+	FmtPretty
+
+	// FmtFullyQualifyNames instructs the formatter to qualify table names
+	// with every prefix part that is known, even if it was originally
+	// omitted. Unlike FmtAlwaysQualifyTableNames, it does not require
+	// Annotations: names that are not (fully) resolved are formatted with the
+	// parts available. Column references are unresolved names and are
+	// formatted as written.
+	FmtFullyQualifyNames
+
+	// FmtLowerCaseKeywords instructs the formatter to write the keywords of
+	// SELECT statements (SELECT, FROM, JOIN, UNION, VALUES, WITH, etc.) and
+	// of the expressions within them (AND, NOT, IN, CASE, etc.) in lower
+	// case. Names, literals, symbolic operators, function names and types are
+	// formatted as usual. The flag has no effect on the pretty-printer
+	// (tree.Pretty).
+	FmtLowerCaseKeywords
 )
 
 // Composite/derived flag definitions follow.
@@ -196,6 +218,8 @@ type FmtCtx struct {
 	// placeholderFormat is an optional interceptor for Placeholder.Format calls;
 	// it can be used to format placeholders differently than normal.
 	placeholderFormat func(ctx *FmtCtx, p *Placeholder)
+	// indent is the current indentation level, used with FmtPretty.
+	indent int
 
 	_ util.NoCopy
 }
@@ -252,6 +276,15 @@ func (ctx *FmtCtx) HasFlags(f FmtFlags) bool {
 	return ctx.flags.HasFlags(f)
 }
 
+// writeKeyword writes the keyword s, lower-cased if FmtLowerCaseKeywords is
+// set. s is expected to be written in upper case.
+func (ctx *FmtCtx) writeKeyword(s string) {
+	if ctx.flags.HasFlags(FmtLowerCaseKeywords) {
+		s = strings.ToLower(s)
+	}
+	ctx.WriteString(s)
+}
+
 // Printf calls fmt.Fprintf on the linked bytes.Buffer. It is provided
 // for convenience, to avoid having to call fmt.Fprintf(&ctx.Buffer, ...).
 //
@@ -319,6 +352,48 @@ func (ctx *FmtCtx) FormatNameP(s *string) {
 	ctx.FormatNode((*Name)(s))
 }
 
+// prettyIndent is the string written for each indentation level with
+// FmtPretty.
+const prettyIndent = "    "
+
+// writeClauseSep separates two clauses of a statement: with FmtPretty it starts
+// a new line at the current indentation level, otherwise it writes a space.
+func (ctx *FmtCtx) writeClauseSep() {
+	if !ctx.HasFlags(FmtPretty) {
+		ctx.WriteByte(' ')
+		return
+	}
+	ctx.WriteByte('\n')
+	for i := 0; i < ctx.indent; i++ {
+		ctx.WriteString(prettyIndent)
+	}
+}
+
+// formatParenthesized formats n within parentheses. With FmtPretty, n starts
+// on a new, further indented line and the closing parenthesis gets its own
+// line.
+func (ctx *FmtCtx) formatParenthesized(n NodeFormatter) {
+	ctx.WriteByte('(')
+	if ctx.HasFlags(FmtPretty) {
+		ctx.withIndent(func() {
+			ctx.writeClauseSep()
+			ctx.FormatNode(n)
+		})
+		ctx.writeClauseSep()
+	} else {
+		ctx.FormatNode(n)
+	}
+	ctx.WriteByte(')')
+}
+
+// withIndent runs fn with the indentation level increased by one.
+func (ctx *FmtCtx) withIndent(fn func()) {
+	ctx.indent++
+	defer func() { ctx.indent-- }()
+
+	fn()
+}
+
 // FormatNode recurses into a node for pretty-printing.
 // Flag-driven special cases can hook into this.
 func (ctx *FmtCtx) FormatNode(n NodeFormatter) {
@@ -390,6 +465,13 @@ func AsString(n NodeFormatter) string {
 	return AsStringWithFlags(n, FmtSimple)
 }
 
+// PrettyString prints a statement over multiple lines using FmtPretty. Unlike
+// Pretty, it does not try to fit the output within a line width: it only
+// breaks lines between clauses.
+func PrettyString(stmt Statement) string {
+	return AsStringWithFlags(stmt, FmtPretty)
+}
+
 // ErrString pretty prints a node to a string. Identifiers are not quoted.
 func ErrString(n NodeFormatter) string {
 	return AsStringWithFlags(n, FmtBareIdentifiers)
@@ -416,6 +498,7 @@ func (ctx *FmtCtx) Close() {
 	ctx.indexedVarFormat = nil
 	ctx.tableNameFormatter = nil
 	ctx.placeholderFormat = nil
+	ctx.indent = 0
 	fmtCtxPool.Put(ctx)
 }
 
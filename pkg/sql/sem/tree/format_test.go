@@ -25,6 +25,7 @@ import (
 	_ "github.com/cockroachdb/cockroach/pkg/sql/sem/builtins"
 	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
 	"github.com/cockroachdb/cockroach/pkg/sql/types"
+	"github.com/cockroachdb/cockroach/pkg/testutils/datadriven"
 )
 
 func TestFormatStatement(t *testing.T) {
@@ -450,3 +451,204 @@ func BenchmarkFormatRandomStatements(b *testing.B) {
 		}
 	})
 }
+
+// TestFormatPretty checks the output of tree.PrettyString against the files in
+// testdata/fmt_pretty, and that it parses back to the same statement.
+func TestFormatPretty(t *testing.T) {
+	datadriven.Walk(t, filepath.Join("testdata", "fmt_pretty"), func(t *testing.T, path string) {
+		datadriven.RunTest(t, path, func(d *datadriven.TestData) string {
+			if d.Cmd != "pretty" {
+				t.Fatalf("unsupported command %s", d.Cmd)
+			}
+			stmt, err := parser.ParseOne(d.Input)
+			if err != nil {
+				t.Fatalf("%s: %v", d.Input, err)
+			}
+			pretty := tree.PrettyString(stmt.AST)
+
+			reparsed, err := parser.ParseOne(pretty)
+			if err != nil {
+				t.Fatalf("%s: %v", pretty, err)
+			}
+			if exp, actual := tree.AsString(stmt.AST), tree.AsString(reparsed.AST); exp != actual {
+				t.Fatalf("pretty output doesn't round-trip; expected %s, got %s", exp, actual)
+			}
+			return pretty + "\n"
+		})
+	})
+}
+
+// TestFormatFullyQualifyNames verifies that FmtFullyQualifyNames formats the
+// known prefix parts of the table names, whether or not they were explicitly
+// specified.
+func TestFormatFullyQualifyNames(t *testing.T) {
+	datadriven.Walk(t, filepath.Join("testdata", "fmt_qualified"), func(t *testing.T, path string) {
+		datadriven.RunTest(t, path, func(d *datadriven.TestData) string {
+			if d.Cmd != "qualify" {
+				t.Fatalf("unsupported command %s", d.Cmd)
+			}
+			var catalog, schema tree.Name
+			for _, arg := range d.CmdArgs {
+				switch arg.Key {
+				case "catalog":
+					catalog = tree.Name(arg.Vals[0])
+				case "schema":
+					schema = tree.Name(arg.Vals[0])
+				default:
+					t.Fatalf("unknown argument %s", arg.Key)
+				}
+			}
+			stmt, err := parser.ParseOne(d.Input)
+			if err != nil {
+				t.Fatalf("%s: %v", d.Input, err)
+			}
+			expected := tree.AsString(stmt.AST)
+
+			// Resolve the names without marking the resolved parts as explicit,
+			// so that they are only formatted with FmtFullyQualifyNames.
+			if err := stmt.AST.(*tree.Select).RewriteTableNames(func(tn *tree.TableName) error {
+				if !tn.ExplicitSchema {
+					tn.SchemaName = schema
+				}
+				if !tn.ExplicitCatalog {
+					tn.CatalogName = catalog
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(stmt.AST); res != expected {
+				t.Fatalf("expected %s without FmtFullyQualifyNames, got %s", expected, res)
+			}
+			return tree.AsStringWithFlags(stmt.AST, tree.FmtFullyQualifyNames) + "\n"
+		})
+	})
+}
+
+// TestFormatUniqueNullsNotDistinct verifies the parsing and formatting of
+// UNIQUE NULLS NOT DISTINCT constraints.
+func TestFormatUniqueNullsNotDistinct(t *testing.T) {
+	testData := []struct {
+		stmt             string
+		expected         string
+		nullsNotDistinct bool
+	}{
+		{`CREATE TABLE t (a INT, CONSTRAINT c UNIQUE NULLS NOT DISTINCT (a))`,
+			`CONSTRAINT c UNIQUE NULLS NOT DISTINCT (a)`, true},
+		{`CREATE TABLE t (a INT, b INT, UNIQUE NULLS NOT DISTINCT (a, b DESC))`,
+			`UNIQUE NULLS NOT DISTINCT (a, b DESC)`, true},
+		{`CREATE TABLE t (a INT, b INT, UNIQUE NULLS NOT DISTINCT (a) STORING (b))`,
+			`UNIQUE NULLS NOT DISTINCT (a) STORING (b)`, true},
+		// NULLS DISTINCT is the default.
+		{`CREATE TABLE t (a INT, UNIQUE NULLS DISTINCT (a))`,
+			`UNIQUE (a)`, false},
+		{`CREATE TABLE t (a INT, PRIMARY KEY (a))`,
+			`PRIMARY KEY (a)`, false},
+	}
+	for _, test := range testData {
+		t.Run(test.stmt, func(t *testing.T) {
+			stmt, err := parser.ParseOne(test.stmt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var def *tree.UniqueConstraintTableDef
+			for _, d := range stmt.AST.(*tree.CreateTable).Defs {
+				if u, ok := d.(*tree.UniqueConstraintTableDef); ok {
+					def = u
+				}
+			}
+			if def == nil {
+				t.Fatalf("no unique constraint in %s", test.stmt)
+			}
+			if def.NullsNotDistinct != test.nullsNotDistinct {
+				t.Errorf("expected NullsNotDistinct = %t, got %t",
+					test.nullsNotDistinct, def.NullsNotDistinct)
+			}
+			if res := tree.AsString(def); res != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, res)
+			}
+			if res := tree.Pretty(def); res != test.expected {
+				t.Errorf("expected pretty %s, got %s", test.expected, res)
+			}
+		})
+	}
+}
+
+func TestFormatRowsFromColDefLists(t *testing.T) {
+	item := func(s string) tree.Expr {
+		expr, err := parser.ParseExpr(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return expr
+	}
+	testData := []struct {
+		node     *tree.RowsFromExpr
+		expected string
+	}{
+		{&tree.RowsFromExpr{
+			Items: tree.Exprs{item(`a(x)`)},
+			ColDefLists: []tree.ColumnDefList{
+				{{Name: "c", Type: types.Int}, {Name: "d", Type: types.String}},
+			},
+		}, `ROWS FROM (a(x) AS (c INT8, d STRING))`},
+		// ColDefLists may be shorter than Items.
+		{&tree.RowsFromExpr{
+			Items: tree.Exprs{item(`a(x)`), item(`b(y)`)},
+			ColDefLists: []tree.ColumnDefList{
+				{{Name: "c", Type: types.Int}},
+			},
+		}, `ROWS FROM (a(x) AS (c INT8), b(y))`},
+		{&tree.RowsFromExpr{
+			Items: tree.Exprs{item(`a(x)`), item(`b(y)`)},
+			ColDefLists: []tree.ColumnDefList{
+				nil, {{Name: "c", Type: types.Int}},
+			},
+		}, `ROWS FROM (a(x), b(y) AS (c INT8))`},
+	}
+	for _, test := range testData {
+		t.Run(test.expected, func(t *testing.T) {
+			if res := tree.AsString(test.node); res != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, res)
+			}
+			if res := tree.Pretty(test.node); res != test.expected {
+				t.Errorf("expected pretty %s, got %s", test.expected, res)
+			}
+		})
+	}
+}
+
+// TestFormatLowerCaseKeywords checks the formatting of the keywords of SELECT
+// statements with and without FmtLowerCaseKeywords against the file in
+// testdata/fmt_keywords, and that the output parses back to the same
+// statement.
+func TestFormatLowerCaseKeywords(t *testing.T) {
+	datadriven.RunTest(t, filepath.Join("testdata", "fmt_keywords"), func(d *datadriven.TestData) string {
+		if d.Cmd != "format" {
+			t.Fatalf("unsupported command %s", d.Cmd)
+		}
+		f := tree.FmtSimple
+		for _, arg := range d.CmdArgs {
+			switch arg.Key {
+			case "lower":
+				f = tree.FmtLowerCaseKeywords
+			default:
+				t.Fatalf("unknown argument %s", arg.Key)
+			}
+		}
+		stmt, err := parser.ParseOne(d.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", d.Input, err)
+		}
+		res := tree.AsStringWithFlags(stmt.AST, f)
+
+		reparsed, err := parser.ParseOne(res)
+		if err != nil {
+			t.Fatalf("%s: %v", res, err)
+		}
+		if exp, actual := tree.AsString(stmt.AST), tree.AsString(reparsed.AST); exp != actual {
+			t.Fatalf("output doesn't round-trip; expected %s, got %s", exp, actual)
+		}
+		return res + "\n"
+	})
+}
@@ -272,7 +272,8 @@ func (u *UnresolvedObjectName) Resolved(ann *Annotations) *TableName {
 func (u *UnresolvedObjectName) Format(ctx *FmtCtx) {
 	// If we want to format the corresponding resolved name, look it up in the
 	// annotation.
-	if ctx.HasFlags(FmtAlwaysQualifyTableNames) || ctx.tableNameFormatter != nil {
+	if ctx.HasFlags(FmtAlwaysQualifyTableNames) || ctx.tableNameFormatter != nil ||
+		(ctx.HasFlags(FmtFullyQualifyNames) && ctx.ann != nil) {
 		if ctx.tableNameFormatter != nil && ctx.ann == nil {
 			// TODO(radu): this is a temporary hack while we transition to using
 			// unresolved names everywhere. We will need to revisit and see if we need
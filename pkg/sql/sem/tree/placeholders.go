@@ -40,6 +40,22 @@ func (idx PlaceholderIdx) String() string {
 	return fmt.Sprintf("$%d", idx+1)
 }
 
+// CollectPlaceholders returns the indexes of all the placeholders referenced
+// by the select, including the ones in subqueries, common table expressions,
+// join conditions and LIMIT/OFFSET clauses. It can be used to check that the
+// arguments of an EXECUTE cover exactly the placeholders of a statement.
+func (node *Select) CollectPlaceholders() (util.FastIntSet, error) {
+	var res util.FastIntSet
+	r := tableNameRewriter{exprFn: func(expr Expr) error {
+		if p, ok := expr.(*Placeholder); ok {
+			res.Add(int(p.Idx))
+		}
+		return nil
+	}}
+	r.rewriteSelect(node)
+	return res, r.err
+}
+
 // PlaceholderTypes stores placeholder types (or type hints), one per
 // PlaceholderIdx.  The slice is always pre-allocated to the number of
 // placeholders in the statement. Entries that don't yet have a type are nil.
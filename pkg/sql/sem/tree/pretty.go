@@ -490,6 +490,25 @@ func (node *Limit) doc(p *PrettyCfg) pretty.Doc {
 	return res
 }
 
+func (node *LockingItem) doc(p *PrettyCfg) pretty.Doc {
+	d := pretty.Keyword(node.Strength.String())
+	if len(node.Targets) > 0 {
+		d = pretty.ConcatSpace(d, pretty.ConcatSpace(pretty.Keyword("OF"), p.Doc(&node.Targets)))
+	}
+	if node.WaitPolicy != LockWaitBlock {
+		d = pretty.ConcatSpace(d, pretty.Keyword(node.WaitPolicy.String()))
+	}
+	return d
+}
+
+func (node LockingClause) docTable(p *PrettyCfg) []pretty.TableRow {
+	res := make([]pretty.TableRow, len(node))
+	for i, n := range node {
+		res[i] = p.row("", p.Doc(n))
+	}
+	return res
+}
+
 func (node *Limit) docTable(p *PrettyCfg) []pretty.TableRow {
 	if node == nil {
 		return nil
@@ -543,6 +562,7 @@ func (node *Select) docTable(p *PrettyCfg) []pretty.TableRow {
 	}
 	items = append(items, node.OrderBy.docRow(p))
 	items = append(items, node.Limit.docTable(p)...)
+	items = append(items, node.Locking.docTable(p)...)
 	return items
 }
 
@@ -552,7 +572,7 @@ func (node *SelectClause) doc(p *PrettyCfg) pretty.Doc {
 
 func (node *SelectClause) docTable(p *PrettyCfg) []pretty.TableRow {
 	if node.TableSelect {
-		return []pretty.TableRow{p.row("TABLE", p.Doc(node.From.Tables[0]))}
+		return []pretty.TableRow{p.row("TABLE", p.Doc(node.tableSelectTable()))}
 	}
 	exprs := node.Exprs.doc(p)
 	if node.Distinct {
@@ -564,6 +584,7 @@ func (node *SelectClause) docTable(p *PrettyCfg) []pretty.TableRow {
 	}
 	return []pretty.TableRow{
 		p.row("SELECT", exprs),
+		node.Into.docRow(p),
 		node.From.docRow(p),
 		node.Where.docRow(p),
 		node.GroupBy.docRow(p),
@@ -572,6 +593,21 @@ func (node *SelectClause) docTable(p *PrettyCfg) []pretty.TableRow {
 	}
 }
 
+func (node *IntoClause) doc(p *PrettyCfg) pretty.Doc {
+	return p.unrow(node.docRow(p))
+}
+
+func (node *IntoClause) docRow(p *PrettyCfg) pretty.TableRow {
+	if node == nil {
+		return emptyRow
+	}
+	d := p.Doc(&node.Table)
+	if node.Persistence != IntoPermanent {
+		d = pretty.ConcatSpace(pretty.Keyword(node.Persistence.String()), d)
+	}
+	return p.row("INTO", d)
+}
+
 func (node *From) doc(p *PrettyCfg) pretty.Doc {
 	return p.unrow(node.docRow(p))
 }
@@ -621,7 +657,7 @@ func (node *With) docRow(p *PrettyCfg) pretty.TableRow {
 	for i, cte := range node.CTEList {
 		d[i] = p.nestUnder(
 			p.Doc(&cte.Name),
-			p.bracketKeyword("AS", " (", p.Doc(cte.Stmt), ")", ""),
+			p.bracketKeyword(cteMaterializeKeywords[cte.Materialized], " (", p.Doc(cte.Stmt), ")", ""),
 		)
 	}
 	return p.row("WITH", p.commaSeparated(d...))
@@ -643,6 +679,12 @@ func (node *Subquery) doc(p *PrettyCfg) pretty.Doc {
 
 func (node *AliasedTableExpr) doc(p *PrettyCfg) pretty.Doc {
 	d := p.Doc(node.Expr)
+	if node.Only {
+		d = pretty.Concat(
+			p.keywordWithText("", "ONLY", " "),
+			d,
+		)
+	}
 	if node.Lateral {
 		d = pretty.Concat(
 			p.keywordWithText("", "LATERAL", " "),
@@ -655,6 +697,12 @@ func (node *AliasedTableExpr) doc(p *PrettyCfg) pretty.Doc {
 			p.Doc(node.IndexFlags),
 		)
 	}
+	if node.AsOf != nil {
+		d = p.nestUnder(
+			d,
+			p.Doc(node.AsOf),
+		)
+	}
 	if node.Ordinality {
 		d = pretty.Concat(
 			d,
@@ -678,16 +726,36 @@ func (node *FuncExpr) doc(p *PrettyCfg) pretty.Doc {
 
 	if len(node.Exprs) > 0 {
 		args := node.Exprs.doc(p)
+		if len(node.ArgNames) > 0 {
+			argDocs := make([]pretty.Doc, len(node.Exprs))
+			for i, e := range node.Exprs {
+				argDocs[i] = p.Doc(e)
+				if i < len(node.ArgNames) && node.ArgNames[i] != "" {
+					argDocs[i] = pretty.Fold(pretty.ConcatSpace,
+						p.Doc(&node.ArgNames[i]), pretty.Text("=>"), argDocs[i])
+				}
+			}
+			args = p.commaSeparated(argDocs...)
+		}
 		if node.Type != 0 {
 			args = pretty.ConcatLine(
 				pretty.Text(funcTypeName[node.Type]),
 				args,
 			)
 		}
+		if len(node.OrderBy) > 0 {
+			args = pretty.ConcatSpace(args, p.Doc(&node.OrderBy))
+		}
 		d = pretty.Concat(d, p.bracket("(", args, ")"))
 	} else {
 		d = pretty.Concat(d, pretty.Text("()"))
 	}
+	if node.WithinGroup != nil {
+		d = pretty.Fold(pretty.ConcatSpace,
+			d,
+			pretty.Keyword("WITHIN GROUP"),
+			p.bracket("(", p.Doc(node.WithinGroup), ")"))
+	}
 	if node.Filter != nil {
 		d = pretty.Fold(pretty.ConcatSpace,
 			d,
@@ -975,10 +1043,23 @@ func (node *StatementSource) doc(p *PrettyCfg) pretty.Doc {
 }
 
 func (node *RowsFromExpr) doc(p *PrettyCfg) pretty.Doc {
-	if p.Simplify && len(node.Items) == 1 {
+	if p.Simplify && len(node.Items) == 1 && !node.HasColDefLists() {
 		return p.Doc(node.Items[0])
 	}
-	return p.bracketKeyword("ROWS FROM", " (", p.Doc(&node.Items), ")", "")
+	if !node.HasColDefLists() {
+		return p.bracketKeyword("ROWS FROM", " (", p.Doc(&node.Items), ")", "")
+	}
+	d := make([]pretty.Doc, len(node.Items))
+	for i, e := range node.Items {
+		if p.Simplify {
+			e = StripParens(e)
+		}
+		d[i] = p.Doc(e)
+		if defs := node.ColDefList(i); defs != nil {
+			d[i] = pretty.ConcatSpace(d[i], pretty.ConcatSpace(pretty.Keyword("AS"), p.Doc(&defs)))
+		}
+	}
+	return p.bracketKeyword("ROWS FROM", " (", p.commaSeparated(d...), ")", "")
 }
 
 func (node *Array) doc(p *PrettyCfg) pretty.Doc {
@@ -1241,7 +1322,16 @@ func (node *UnionClause) doc(p *PrettyCfg) pretty.Doc {
 	if node.All {
 		op += " ALL"
 	}
-	return pretty.Stack(p.Doc(node.Left), p.nestUnder(pretty.Keyword(op), p.Doc(node.Right)))
+	if node.Corresponding {
+		op += " CORRESPONDING"
+	}
+	opDoc := pretty.Keyword(op)
+	if len(node.CorrespondingCols) > 0 {
+		opDoc = pretty.ConcatSpace(
+			opDoc, p.bracketKeyword("BY", " (", p.Doc(&node.CorrespondingCols), ")", ""),
+		)
+	}
+	return pretty.Stack(p.Doc(node.Left), p.nestUnder(opDoc, p.Doc(node.Right)))
 }
 
 func (node *IfErrExpr) doc(p *PrettyCfg) pretty.Doc {
@@ -1492,14 +1582,14 @@ func (node *IndexTableDef) doc(p *PrettyCfg) pretty.Doc {
 func (node *UniqueConstraintTableDef) doc(p *PrettyCfg) pretty.Doc {
 	// Final layout:
 	// [CONSTRAINT name]
-	//    [PRIMARY KEY|UNIQUE] ( ... )
+	//    [PRIMARY KEY|UNIQUE [NULLS NOT DISTINCT]] ( ... )
 	//    [STORING ( ... )]
 	//    [INTERLEAVE ...]
 	//    [PARTITION BY ...]
 	//
 	// or (no constraint name):
 	//
-	// [PRIMARY KEY|UNIQUE] ( ... )
+	// [PRIMARY KEY|UNIQUE [NULLS NOT DISTINCT]] ( ... )
 	//    [STORING ( ... )]
 	//    [INTERLEAVE ...]
 	//    [PARTITION BY ...]
@@ -1508,6 +1598,8 @@ func (node *UniqueConstraintTableDef) doc(p *PrettyCfg) pretty.Doc {
 	var title pretty.Doc
 	if node.PrimaryKey {
 		title = pretty.Keyword("PRIMARY KEY")
+	} else if node.NullsNotDistinct {
+		title = pretty.Keyword("UNIQUE NULLS NOT DISTINCT")
 	} else {
 		title = pretty.Keyword("UNIQUE")
 	}
@@ -1571,7 +1663,7 @@ func (node *ForeignKeyConstraintTableDef) doc(p *PrettyCfg) pretty.Doc {
 		clauses = append(clauses, pretty.Keyword(node.Match.String()))
 	}
 
-	if actions := p.Doc(&node.Actions); ref != pretty.Nil {
+	if actions := p.Doc(&node.Actions); actions != pretty.Nil {
 		clauses = append(clauses, actions)
 	}
 
@@ -1790,7 +1882,7 @@ func (node *AsOfClause) doc(p *PrettyCfg) pretty.Doc {
 }
 
 func (node *AsOfClause) docRow(p *PrettyCfg) pretty.TableRow {
-	return p.row("AS OF SYSTEM TIME", p.Doc(node.Expr))
+	return p.row("AS OF SYSTEM TIME", p.Doc(node.formattedExpr()))
 }
 
 func (node *KVOptions) doc(p *PrettyCfg) pretty.Doc {
@@ -28,6 +28,7 @@ import (
 	"fmt"
 
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/types"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 )
 
@@ -48,6 +49,7 @@ type Select struct {
 	Select  SelectStatement
 	OrderBy OrderBy
 	Limit   *Limit
+	Locking LockingClause
 }
 
 // Format implements the NodeFormatter interface.
@@ -55,13 +57,17 @@ func (node *Select) Format(ctx *FmtCtx) {
 	ctx.FormatNode(node.With)
 	ctx.FormatNode(node.Select)
 	if len(node.OrderBy) > 0 {
-		ctx.WriteByte(' ')
+		ctx.writeClauseSep()
 		ctx.FormatNode(&node.OrderBy)
 	}
 	if node.Limit != nil {
-		ctx.WriteByte(' ')
+		ctx.writeClauseSep()
 		ctx.FormatNode(node.Limit)
 	}
+	if len(node.Locking) > 0 {
+		ctx.writeClauseSep()
+		ctx.FormatNode(&node.Locking)
+	}
 }
 
 // ParenSelect represents a parenthesized SELECT/UNION/VALUES statement.
@@ -71,9 +77,7 @@ type ParenSelect struct {
 
 // Format implements the NodeFormatter interface.
 func (node *ParenSelect) Format(ctx *FmtCtx) {
-	ctx.WriteByte('(')
-	ctx.FormatNode(node.Select)
-	ctx.WriteByte(')')
+	ctx.formatParenthesized(node.Select)
 }
 
 // SelectClause represents a SELECT statement.
@@ -81,6 +85,7 @@ type SelectClause struct {
 	Distinct    bool
 	DistinctOn  DistinctOn
 	Exprs       SelectExprs
+	Into        *IntoClause
 	From        *From
 	Where       *Where
 	GroupBy     GroupBy
@@ -89,45 +94,272 @@ type SelectClause struct {
 	TableSelect bool
 }
 
+// HasWindowFunctions returns true if the clause has a WINDOW clause or if any of
+// its select expressions is a window function application. Only the top level
+// of each select expression is inspected, which makes this a cheap check; window
+// functions nested inside other expressions are not detected.
+func (node *SelectClause) HasWindowFunctions() bool {
+	if len(node.Window) > 0 {
+		return true
+	}
+	for _, expr := range node.Exprs {
+		if f, ok := StripParens(expr.Expr).(*FuncExpr); ok && f.IsWindowFunctionApplication() {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWindowReferences checks that the windows referenced by the clause
+// are defined and that references to them are legal. A window application
+// that names a window (OVER w) or copies one (OVER (w ORDER BY ...)) must
+// refer to a window of the WINDOW clause, and a window of the WINDOW clause
+// can only copy the windows defined before it. A copy cannot override the
+// PARTITION BY clause of the copied window, nor its ORDER BY clause if it has
+// one, and a window with a frame clause cannot be copied. Window applications
+// inside subqueries are not inspected.
+func (node *SelectClause) ValidateWindowReferences() error {
+	namedWindows := make(map[Name]*WindowDef, len(node.Window))
+	for _, def := range node.Window {
+		if _, ok := namedWindows[def.Name]; ok {
+			return pgerror.Newf(pgerror.CodeWindowingError, "window %q is already defined", string(def.Name))
+		}
+		if err := validateWindowCopy(def, namedWindows); err != nil {
+			return err
+		}
+		namedWindows[def.Name] = def
+	}
+
+	var err error
+	for _, expr := range node.Exprs {
+		_, _ = SimpleVisit(expr.Expr, func(expr Expr) (bool, Expr, error) {
+			switch t := expr.(type) {
+			case *Subquery:
+				return false, expr, nil
+			case *FuncExpr:
+				if t.WindowDef == nil {
+					break
+				}
+				if t.WindowDef.Name != "" {
+					if _, ok := namedWindows[t.WindowDef.Name]; !ok {
+						err = pgerror.Newf(pgerror.CodeUndefinedObjectError,
+							"window %q does not exist", string(t.WindowDef.Name))
+					}
+				} else {
+					err = validateWindowCopy(t.WindowDef, namedWindows)
+				}
+			}
+			return err == nil, expr, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateWindowCopy checks that the window referenced by the RefName of def,
+// if any, is one of the given windows and that def can copy it. The errors
+// match the ones returned when window definitions are constructed during
+// planning.
+func validateWindowCopy(def *WindowDef, namedWindows map[Name]*WindowDef) error {
+	if def.RefName == "" {
+		return nil
+	}
+	refName := string(def.RefName)
+	ref, ok := namedWindows[def.RefName]
+	if !ok {
+		return pgerror.Newf(pgerror.CodeUndefinedObjectError, "window %q does not exist", refName)
+	}
+	if len(def.Partitions) > 0 {
+		return pgerror.Newf(pgerror.CodeWindowingError, "cannot override PARTITION BY clause of window %q", refName)
+	}
+	if len(def.OrderBy) > 0 && len(ref.OrderBy) > 0 {
+		return pgerror.Newf(pgerror.CodeWindowingError, "cannot override ORDER BY clause of window %q", refName)
+	}
+	if ref.Frame != nil {
+		return pgerror.Newf(pgerror.CodeWindowingError, "cannot copy window %q because it has a frame clause", refName)
+	}
+	return nil
+}
+
+// tableSelectTable returns the table selected by a TABLE clause. It panics
+// with an assertion error if the clause does not carry exactly one table.
+func (node *SelectClause) tableSelectTable() TableExpr {
+	if node.From == nil || len(node.From.Tables) != 1 {
+		panic(pgerror.AssertionFailedf("TABLE clause must select exactly one table"))
+	}
+	return node.From.Tables[0]
+}
+
 // Format implements the NodeFormatter interface.
 func (node *SelectClause) Format(ctx *FmtCtx) {
 	if node.TableSelect {
-		ctx.WriteString("TABLE ")
-		ctx.FormatNode(node.From.Tables[0])
+		ctx.writeKeyword("TABLE ")
+		ctx.FormatNode(node.tableSelectTable())
 	} else {
-		ctx.WriteString("SELECT ")
+		ctx.writeKeyword("SELECT ")
 		if node.Distinct {
 			if node.DistinctOn != nil {
 				ctx.FormatNode(&node.DistinctOn)
 				ctx.WriteByte(' ')
 			} else {
-				ctx.WriteString("DISTINCT ")
+				ctx.writeKeyword("DISTINCT ")
 			}
 		}
 		ctx.FormatNode(&node.Exprs)
+		if node.Into != nil {
+			ctx.writeClauseSep()
+			ctx.FormatNode(node.Into)
+		}
 		if len(node.From.Tables) > 0 {
-			ctx.WriteByte(' ')
+			ctx.writeClauseSep()
 			ctx.FormatNode(node.From)
 		}
 		if node.Where != nil {
-			ctx.WriteByte(' ')
+			ctx.writeClauseSep()
 			ctx.FormatNode(node.Where)
 		}
 		if len(node.GroupBy) > 0 {
-			ctx.WriteByte(' ')
+			ctx.writeClauseSep()
 			ctx.FormatNode(&node.GroupBy)
 		}
 		if node.Having != nil {
-			ctx.WriteByte(' ')
+			ctx.writeClauseSep()
 			ctx.FormatNode(node.Having)
 		}
 		if len(node.Window) > 0 {
-			ctx.WriteByte(' ')
+			ctx.writeClauseSep()
 			ctx.FormatNode(&node.Window)
 		}
 	}
 }
 
+// IntoPersistence indicates the persistence of the table created by a
+// SELECT ... INTO clause.
+type IntoPersistence int
+
+const (
+	// IntoPermanent creates a regular table.
+	IntoPermanent IntoPersistence = iota
+	// IntoTemporary creates a temporary table (INTO TEMP).
+	IntoTemporary
+	// IntoUnlogged creates an unlogged table (INTO UNLOGGED).
+	IntoUnlogged
+)
+
+var intoPersistenceName = [...]string{
+	IntoPermanent: "",
+	IntoTemporary: "TEMP",
+	IntoUnlogged:  "UNLOGGED",
+}
+
+func (p IntoPersistence) String() string {
+	if p < 0 || p > IntoPersistence(len(intoPersistenceName)-1) {
+		return fmt.Sprintf("IntoPersistence(%d)", p)
+	}
+	return intoPersistenceName[p]
+}
+
+// IntoClause represents the INTO clause of a SELECT ... INTO statement,
+// which names a new table to be created from the query results.
+type IntoClause struct {
+	Persistence IntoPersistence
+	Table       TableName
+}
+
+// Format implements the NodeFormatter interface.
+func (node *IntoClause) Format(ctx *FmtCtx) {
+	ctx.writeKeyword("INTO ")
+	if node.Persistence != IntoPermanent {
+		ctx.writeKeyword(node.Persistence.String())
+		ctx.WriteByte(' ')
+	}
+	ctx.FormatNode(&node.Table)
+}
+
+// ValidateInto checks that any INTO clause in the statement appears in a
+// position where it is legal. INTO is rejected in combination with DISTINCT
+// ON and with TABLE, and may only appear on the first SELECT of a set
+// operation, as in Postgres.
+func (node *Select) ValidateInto() error {
+	return validateInto(node.Select, true /* allowInto */)
+}
+
+func validateInto(stmt SelectStatement, allowInto bool) error {
+	switch s := stmt.(type) {
+	case *SelectClause:
+		if s.Into == nil {
+			return nil
+		}
+		if !allowInto {
+			return pgerror.New(pgerror.CodeSyntaxError,
+				"INTO is only allowed on first SELECT of UNION/INTERSECT/EXCEPT")
+		}
+		if s.TableSelect {
+			return pgerror.New(pgerror.CodeSyntaxError, "INTO is not allowed with TABLE")
+		}
+		if s.DistinctOn != nil {
+			return pgerror.New(pgerror.CodeSyntaxError, "INTO is not allowed with DISTINCT ON")
+		}
+	case *ParenSelect:
+		return validateInto(s.Select.Select, allowInto)
+	case *UnionClause:
+		if err := validateInto(s.Left.Select, allowInto); err != nil {
+			return err
+		}
+		return validateInto(s.Right.Select, false /* allowInto */)
+	}
+	return nil
+}
+
+// ValidateTableSelect checks that every TABLE clause in the statement only
+// carries what TABLE can express: a single table, optionally followed by the
+// ORDER BY, LIMIT and locking clauses of the enclosing Select. TABLE clauses
+// with a WHERE, GROUP BY, HAVING, WINDOW, DISTINCT or INTO clause are
+// rejected.
+func (node *Select) ValidateTableSelect() error {
+	return validateTableSelect(node.Select)
+}
+
+func validateTableSelect(stmt SelectStatement) error {
+	switch s := stmt.(type) {
+	case *SelectClause:
+		if !s.TableSelect {
+			return nil
+		}
+		if s.From == nil || len(s.From.Tables) != 1 {
+			return pgerror.AssertionFailedf("TABLE clause must select exactly one table")
+		}
+		var clause string
+		switch {
+		case s.Where != nil:
+			clause = "WHERE"
+		case len(s.GroupBy) > 0:
+			clause = "GROUP BY"
+		case s.Having != nil:
+			clause = "HAVING"
+		case len(s.Window) > 0:
+			clause = "WINDOW"
+		case s.Distinct:
+			clause = "DISTINCT"
+		case s.Into != nil:
+			clause = "INTO"
+		default:
+			return nil
+		}
+		return pgerror.Newf(pgerror.CodeSyntaxError, "%s is not allowed with TABLE", clause)
+	case *ParenSelect:
+		return s.Select.ValidateTableSelect()
+	case *UnionClause:
+		if err := s.Left.ValidateTableSelect(); err != nil {
+			return err
+		}
+		return s.Right.ValidateTableSelect()
+	}
+	return nil
+}
+
 // SelectExprs represents SELECT expressions.
 type SelectExprs []SelectExpr
 
@@ -172,7 +404,7 @@ func StarSelectExpr() SelectExpr {
 func (node *SelectExpr) Format(ctx *FmtCtx) {
 	ctx.FormatNode(node.Expr)
 	if node.As != "" {
-		ctx.WriteString(" AS ")
+		ctx.writeKeyword(" AS ")
 		ctx.FormatNode(&node.As)
 	}
 }
@@ -202,8 +434,22 @@ type AsOfClause struct {
 
 // Format implements the NodeFormatter interface.
 func (a *AsOfClause) Format(ctx *FmtCtx) {
-	ctx.WriteString("AS OF SYSTEM TIME ")
-	ctx.FormatNode(a.Expr)
+	ctx.writeKeyword("AS OF SYSTEM TIME ")
+	ctx.FormatNode(a.formattedExpr())
+}
+
+// formattedExpr returns the expression to format for the clause. Timestamp
+// datums are replaced by string literals with nanosecond precision, which
+// EvalAsOfTimestamp parses back to the same timestamp; the regular
+// formatting of timestamps is only precise to the microsecond.
+func (a *AsOfClause) formattedExpr() Expr {
+	switch t := a.Expr.(type) {
+	case *DTimestamp:
+		return NewStrVal(t.UTC().Format(asOfFreezeFormat))
+	case *DTimestampTZ:
+		return NewStrVal(t.UTC().Format(asOfFreezeFormat))
+	}
+	return a.Expr
 }
 
 // From represents a FROM clause.
@@ -214,14 +460,44 @@ type From struct {
 
 // Format implements the NodeFormatter interface.
 func (node *From) Format(ctx *FmtCtx) {
-	ctx.WriteString("FROM ")
+	ctx.writeKeyword("FROM ")
 	ctx.FormatNode(&node.Tables)
 	if node.AsOf.Expr != nil {
-		ctx.WriteByte(' ')
+		ctx.writeClauseSep()
 		ctx.FormatNode(&node.AsOf)
 	}
 }
 
+// ValidateAsOf checks that the AS OF SYSTEM TIME clause of the FROM clause is
+// not combined with an AS OF SYSTEM TIME clause on any of its table
+// references.
+func (node *From) ValidateAsOf() error {
+	if node.AsOf.Expr == nil {
+		return nil
+	}
+	for _, t := range node.Tables {
+		if tableExprHasAsOf(t) {
+			return pgerror.New(pgerror.CodeSyntaxError,
+				"AS OF SYSTEM TIME cannot be specified both on a table and on the statement")
+		}
+	}
+	return nil
+}
+
+// tableExprHasAsOf returns whether expr, or any of the table expressions it is
+// composed of, has an AS OF SYSTEM TIME clause.
+func tableExprHasAsOf(expr TableExpr) bool {
+	switch t := expr.(type) {
+	case *AliasedTableExpr:
+		return t.AsOf != nil || tableExprHasAsOf(t.Expr)
+	case *ParenTableExpr:
+		return tableExprHasAsOf(t.Expr)
+	case *JoinTableExpr:
+		return tableExprHasAsOf(t.Left) || tableExprHasAsOf(t.Right)
+	}
+	return false
+}
+
 // TableExprs represents a list of table expressions.
 type TableExprs []TableExpr
 
@@ -266,7 +542,7 @@ type IndexID uint32
 // IndexFlags represents "@<index_name|index_id>" or "@{param[,param]}" where
 // param is one of:
 //  - FORCE_INDEX=<index_name|index_id>
-//  - ASC / DESC
+//  - ASC / DESC, once or once per leading column of the index
 //  - NO_INDEX_JOIN
 //  - IGNORE_FOREIGN_KEYS
 // It is used optionally after a table name in SELECT statements.
@@ -276,6 +552,11 @@ type IndexFlags struct {
 	// Direction of the scan, if provided. Can only be set if
 	// one of Index or IndexID is set.
 	Direction Direction
+	// ColumnDirections contains the directions of the leading columns of the
+	// index, if more than one direction was provided (a single direction is
+	// stored in Direction). Can only be set if one of Index or IndexID is set,
+	// and never together with Direction.
+	ColumnDirections []Direction
 	// NoIndexJoin cannot be specified together with an index.
 	NoIndexJoin bool
 	// IgnoreForeignKeys disables optimizations based on outbound foreign key
@@ -303,11 +584,15 @@ func (ih *IndexFlags) CombineWith(other *IndexFlags) error {
 	result.NoIndexJoin = ih.NoIndexJoin || other.NoIndexJoin
 	result.IgnoreForeignKeys = ih.IgnoreForeignKeys || other.IgnoreForeignKeys
 
-	if other.Direction != 0 {
-		if ih.Direction != 0 {
+	// Directions are accumulated in the order in which they were specified:
+	// "@{FORCE_INDEX=idx,ASC,DESC}" lists the directions of the first two
+	// columns of idx.
+	if otherDirs := other.directions(); len(otherDirs) > 0 {
+		dirs := ih.directions()
+		if len(ih.ColumnDirections) > 0 && len(other.ColumnDirections) > 0 {
 			return errors.New("ASC/DESC specified multiple times")
 		}
-		result.Direction = other.Direction
+		result.setDirections(append(append([]Direction(nil), dirs...), otherDirs...))
 	}
 
 	if other.ForceIndex() {
@@ -324,23 +609,71 @@ func (ih *IndexFlags) CombineWith(other *IndexFlags) error {
 	return nil
 }
 
+// directions returns the directions of the leading columns of the index, or
+// nil if no direction was provided.
+func (ih *IndexFlags) directions() []Direction {
+	if ih.Direction != 0 {
+		return []Direction{ih.Direction}
+	}
+	return ih.ColumnDirections
+}
+
+// setDirections sets Direction or ColumnDirections, depending on the number of
+// directions.
+func (ih *IndexFlags) setDirections(dirs []Direction) {
+	ih.Direction, ih.ColumnDirections = 0, nil
+	switch len(dirs) {
+	case 0:
+	case 1:
+		ih.Direction = dirs[0]
+	default:
+		ih.ColumnDirections = dirs
+	}
+}
+
 // Check verifies if the flags are valid:
 //  - ascending/descending is not specified without an index;
+//  - per-column directions are specified for at least two columns and not
+//    together with a single direction;
 //  - no_index_join isn't specified with an index.
 func (ih *IndexFlags) Check() error {
 	if ih.NoIndexJoin && ih.ForceIndex() {
 		return errors.New("FORCE_INDEX cannot be specified in conjunction with NO_INDEX_JOIN")
 	}
-	if ih.Direction != 0 && !ih.ForceIndex() {
+	if len(ih.directions()) > 0 && !ih.ForceIndex() {
 		return errors.New("ASC/DESC must be specified in conjunction with an index")
 	}
+	if len(ih.ColumnDirections) > 0 {
+		if ih.Direction != 0 {
+			return errors.New("ASC/DESC specified multiple times")
+		}
+		if len(ih.ColumnDirections) < 2 {
+			return errors.New("per-column ASC/DESC must be specified for at least two columns")
+		}
+		for _, d := range ih.ColumnDirections {
+			if d == DefaultDirection {
+				return errors.New("per-column ASC/DESC must be either ASC or DESC")
+			}
+		}
+	}
+	return nil
+}
+
+// CheckIndexColumns verifies that the flags don't specify more per-column
+// directions than the forced index has key columns. It complements Check once
+// the index is resolved; numKeyCols is the number of key columns of the index.
+func (ih *IndexFlags) CheckIndexColumns(numKeyCols int) error {
+	if n := len(ih.ColumnDirections); n > numKeyCols {
+		return errors.Errorf(
+			"ASC/DESC specified for %d columns, but the index has %d key columns", n, numKeyCols)
+	}
 	return nil
 }
 
 // Format implements the NodeFormatter interface.
 func (ih *IndexFlags) Format(ctx *FmtCtx) {
 	ctx.WriteByte('@')
-	if !ih.NoIndexJoin && !ih.IgnoreForeignKeys && ih.Direction == 0 {
+	if !ih.NoIndexJoin && !ih.IgnoreForeignKeys && len(ih.directions()) == 0 {
 		if ih.Index != "" {
 			ctx.FormatNode(&ih.Index)
 		} else {
@@ -354,25 +687,26 @@ func (ih *IndexFlags) Format(ctx *FmtCtx) {
 		}
 		if ih.Index != "" || ih.IndexID != 0 {
 			sep()
-			ctx.WriteString("FORCE_INDEX=")
+			ctx.writeKeyword("FORCE_INDEX=")
 			if ih.Index != "" {
 				ctx.FormatNode(&ih.Index)
 			} else {
 				ctx.Printf("[%d]", ih.IndexID)
 			}
 
-			if ih.Direction != 0 {
-				ctx.Printf(",%s", ih.Direction)
+			for _, d := range ih.directions() {
+				ctx.WriteByte(',')
+				ctx.writeKeyword(d.String())
 			}
 		}
 		if ih.NoIndexJoin {
 			sep()
-			ctx.WriteString("NO_INDEX_JOIN")
+			ctx.writeKeyword("NO_INDEX_JOIN")
 		}
 
 		if ih.IgnoreForeignKeys {
 			sep()
-			ctx.WriteString("IGNORE_FOREIGN_KEYS")
+			ctx.writeKeyword("IGNORE_FOREIGN_KEYS")
 		}
 		ctx.WriteString("}")
 	}
@@ -383,25 +717,44 @@ func (ih *IndexFlags) Format(ctx *FmtCtx) {
 type AliasedTableExpr struct {
 	Expr       TableExpr
 	IndexFlags *IndexFlags
+	// AsOf, if set, reads this table at the given system time instead of the
+	// statement's time. It cannot be combined with the AS OF SYSTEM TIME
+	// clause of the enclosing FROM clause; see From.ValidateAsOf. The parser
+	// reads an AS OF SYSTEM TIME clause that ends the FROM clause as the
+	// statement's, so it only sets AsOf on tables that are followed by WITH
+	// ORDINALITY, an alias, a join condition or another table.
+	AsOf       *AsOfClause
 	Ordinality bool
 	Lateral    bool
-	As         AliasClause
+	// Only is set if the table was prefixed with the ONLY keyword, which in
+	// Postgres excludes the tables inheriting from it. CockroachDB doesn't
+	// support table inheritance, but the keyword is preserved so that the
+	// statement can be formatted back as it was written.
+	Only bool
+	As   AliasClause
 }
 
 // Format implements the NodeFormatter interface.
 func (node *AliasedTableExpr) Format(ctx *FmtCtx) {
 	if node.Lateral {
-		ctx.WriteString("LATERAL ")
+		ctx.writeKeyword("LATERAL ")
+	}
+	if node.Only {
+		ctx.writeKeyword("ONLY ")
 	}
 	ctx.FormatNode(node.Expr)
 	if node.IndexFlags != nil {
 		ctx.FormatNode(node.IndexFlags)
 	}
+	if node.AsOf != nil {
+		ctx.WriteByte(' ')
+		ctx.FormatNode(node.AsOf)
+	}
 	if node.Ordinality {
-		ctx.WriteString(" WITH ORDINALITY")
+		ctx.writeKeyword(" WITH ORDINALITY")
 	}
 	if node.As.Alias != "" {
-		ctx.WriteString(" AS ")
+		ctx.writeKeyword(" AS ")
 		ctx.FormatNode(&node.As)
 	}
 }
@@ -454,32 +807,33 @@ const (
 // Format implements the NodeFormatter interface.
 func (node *JoinTableExpr) Format(ctx *FmtCtx) {
 	ctx.FormatNode(node.Left)
-	ctx.WriteByte(' ')
+	// With FmtPretty, every join starts on its own line.
+	ctx.writeClauseSep()
 	if _, isNatural := node.Cond.(NaturalJoinCond); isNatural {
 		// Natural joins have a different syntax: "<a> NATURAL <join_type> <b>"
 		ctx.FormatNode(node.Cond)
 		ctx.WriteByte(' ')
 		if node.JoinType != "" {
-			ctx.WriteString(node.JoinType)
+			ctx.writeKeyword(node.JoinType)
 			ctx.WriteByte(' ')
 			if node.Hint != "" {
-				ctx.WriteString(node.Hint)
+				ctx.writeKeyword(node.Hint)
 				ctx.WriteByte(' ')
 			}
 		}
-		ctx.WriteString("JOIN ")
+		ctx.writeKeyword("JOIN ")
 		ctx.FormatNode(node.Right)
 	} else {
 		// General syntax: "<a> <join_type> [<join_hint>] JOIN <b> <condition>"
 		if node.JoinType != "" {
-			ctx.WriteString(node.JoinType)
+			ctx.writeKeyword(node.JoinType)
 			ctx.WriteByte(' ')
 			if node.Hint != "" {
-				ctx.WriteString(node.Hint)
+				ctx.writeKeyword(node.Hint)
 				ctx.WriteByte(' ')
 			}
 		}
-		ctx.WriteString("JOIN ")
+		ctx.writeKeyword("JOIN ")
 		ctx.FormatNode(node.Right)
 		if node.Cond != nil {
 			ctx.WriteByte(' ')
@@ -503,7 +857,7 @@ type NaturalJoinCond struct{}
 
 // Format implements the NodeFormatter interface.
 func (NaturalJoinCond) Format(ctx *FmtCtx) {
-	ctx.WriteString("NATURAL")
+	ctx.writeKeyword("NATURAL")
 }
 
 // OnJoinCond represents an ON join condition.
@@ -513,7 +867,7 @@ type OnJoinCond struct {
 
 // Format implements the NodeFormatter interface.
 func (node *OnJoinCond) Format(ctx *FmtCtx) {
-	ctx.WriteString("ON ")
+	ctx.writeKeyword("ON ")
 	ctx.FormatNode(node.Expr)
 }
 
@@ -524,7 +878,7 @@ type UsingJoinCond struct {
 
 // Format implements the NodeFormatter interface.
 func (node *UsingJoinCond) Format(ctx *FmtCtx) {
-	ctx.WriteString("USING (")
+	ctx.writeKeyword("USING (")
 	ctx.FormatNode(&node.Cols)
 	ctx.WriteByte(')')
 }
@@ -552,30 +906,106 @@ func NewWhere(typ string, expr Expr) *Where {
 
 // Format implements the NodeFormatter interface.
 func (node *Where) Format(ctx *FmtCtx) {
-	ctx.WriteString(node.Type)
+	ctx.writeKeyword(node.Type)
 	ctx.WriteByte(' ')
+	if and, ok := node.Expr.(*AndExpr); ok && ctx.HasFlags(FmtPretty) {
+		// Put each conjunct on its own, indented line.
+		ctx.withIndent(func() {
+			formatConjuncts(ctx, and)
+		})
+		return
+	}
 	ctx.FormatNode(node.Expr)
 }
 
-// GroupBy represents a GROUP BY clause.
+// formatConjuncts formats a chain of AndExprs with a clause separator before
+// each AND. Only the left operands are unnested, since AND is left-associative
+// and the result must parse back into the same tree.
+func formatConjuncts(ctx *FmtCtx, e Expr) {
+	if and, ok := e.(*AndExpr); ok {
+		formatConjuncts(ctx, and.Left)
+		ctx.writeClauseSep()
+		ctx.writeKeyword("AND ")
+		exprFmtWithParen(ctx, and.Right)
+		return
+	}
+	exprFmtWithParen(ctx, e)
+}
+
+// GroupBy represents a GROUP BY clause. Its elements are either plain
+// expressions or GroupingExprs.
 type GroupBy []Expr
 
 // Format implements the NodeFormatter interface.
 func (node *GroupBy) Format(ctx *FmtCtx) {
 	prefix := "GROUP BY "
 	for _, n := range *node {
-		ctx.WriteString(prefix)
+		ctx.writeKeyword(prefix)
 		ctx.FormatNode(n)
 		prefix = ", "
 	}
 }
 
+// GroupingExpr is implemented by the grouping set specifications that may
+// appear as elements of a GROUP BY clause in addition to plain expressions.
+type GroupingExpr interface {
+	Expr
+	groupingExpr()
+}
+
+var _ GroupingExpr = &GroupingSets{}
+var _ GroupingExpr = &Rollup{}
+var _ GroupingExpr = &Cube{}
+
+func (*GroupingSets) groupingExpr() {}
+func (*Rollup) groupingExpr()       {}
+func (*Cube) groupingExpr()         {}
+
+// GroupingSets represents a GROUPING SETS (...) element of a GROUP BY clause.
+// Each of the Sets is either an expression, a parenthesized list of
+// expressions (an empty list denoting the empty grouping set), or a nested
+// GroupingExpr.
+type GroupingSets struct {
+	Sets Exprs
+}
+
+// Format implements the NodeFormatter interface.
+func (node *GroupingSets) Format(ctx *FmtCtx) {
+	ctx.writeKeyword("GROUPING SETS (")
+	ctx.FormatNode(&node.Sets)
+	ctx.WriteByte(')')
+}
+
+// Rollup represents a ROLLUP (...) element of a GROUP BY clause.
+type Rollup struct {
+	Exprs Exprs
+}
+
+// Format implements the NodeFormatter interface.
+func (node *Rollup) Format(ctx *FmtCtx) {
+	ctx.writeKeyword("ROLLUP(")
+	ctx.FormatNode(&node.Exprs)
+	ctx.WriteByte(')')
+}
+
+// Cube represents a CUBE (...) element of a GROUP BY clause.
+type Cube struct {
+	Exprs Exprs
+}
+
+// Format implements the NodeFormatter interface.
+func (node *Cube) Format(ctx *FmtCtx) {
+	ctx.writeKeyword("CUBE(")
+	ctx.FormatNode(&node.Exprs)
+	ctx.WriteByte(')')
+}
+
 // DistinctOn represents a DISTINCT ON clause.
 type DistinctOn []Expr
 
 // Format implements the NodeFormatter interface.
 func (node *DistinctOn) Format(ctx *FmtCtx) {
-	ctx.WriteString("DISTINCT ON (")
+	ctx.writeKeyword("DISTINCT ON (")
 	ctx.FormatNode((*Exprs)(node))
 	ctx.WriteByte(')')
 }
@@ -587,7 +1017,7 @@ type OrderBy []*Order
 func (node *OrderBy) Format(ctx *FmtCtx) {
 	prefix := "ORDER BY "
 	for _, n := range *node {
-		ctx.WriteString(prefix)
+		ctx.writeKeyword(prefix)
 		ctx.FormatNode(n)
 		prefix = ", "
 	}
@@ -643,10 +1073,10 @@ func (node *Order) Format(ctx *FmtCtx) {
 		ctx.FormatNode(node.Expr)
 	} else {
 		if node.Index == "" {
-			ctx.WriteString("PRIMARY KEY ")
+			ctx.writeKeyword("PRIMARY KEY ")
 			ctx.FormatNode(&node.Table)
 		} else {
-			ctx.WriteString("INDEX ")
+			ctx.writeKeyword("INDEX ")
 			ctx.FormatNode(&node.Table)
 			ctx.WriteByte('@')
 			ctx.FormatNode(&node.Index)
@@ -654,10 +1084,47 @@ func (node *Order) Format(ctx *FmtCtx) {
 	}
 	if node.Direction != DefaultDirection {
 		ctx.WriteByte(' ')
-		ctx.WriteString(node.Direction.String())
+		ctx.writeKeyword(node.Direction.String())
 	}
 }
 
+// ResolveOrdinal returns the expression the ordering refers to. If the
+// ordering uses a column ordinal, as in ORDER BY 2, the corresponding
+// expression of selectExprs is returned; ordinals start at 1. Otherwise,
+// the ordering expression is returned unchanged. An error is returned if the
+// ordinal is out of range, or if the ordering expression is a non-integer
+// constant. Orderings by index have no expression; nil is returned for them.
+func (node *Order) ResolveOrdinal(selectExprs SelectExprs) (Expr, error) {
+	if node.OrderType != OrderByColumn {
+		return nil, nil
+	}
+	var ord int64
+	switch e := node.Expr.(type) {
+	case *NumVal:
+		if !e.ShouldBeInt64() {
+			return nil, pgerror.Newf(pgerror.CodeSyntaxError,
+				"non-integer constant in ORDER BY: %s", node.Expr)
+		}
+		val, err := e.AsInt64()
+		if err != nil {
+			return nil, err
+		}
+		ord = val
+	case *DInt:
+		ord = int64(*e)
+	case *StrVal, Datum:
+		return nil, pgerror.Newf(pgerror.CodeSyntaxError,
+			"non-integer constant in ORDER BY: %s", node.Expr)
+	default:
+		return node.Expr, nil
+	}
+	if ord < 1 || ord > int64(len(selectExprs)) {
+		return nil, pgerror.Newf(pgerror.CodeInvalidColumnReferenceError,
+			"ORDER BY position %s is not in select list", node.Expr)
+	}
+	return selectExprs[ord-1].Expr, nil
+}
+
 // Limit represents a LIMIT clause.
 type Limit struct {
 	Offset, Count Expr
@@ -667,7 +1134,7 @@ type Limit struct {
 func (node *Limit) Format(ctx *FmtCtx) {
 	needSpace := false
 	if node.Count != nil {
-		ctx.WriteString("LIMIT ")
+		ctx.writeKeyword("LIMIT ")
 		ctx.FormatNode(node.Count)
 		needSpace = true
 	}
@@ -675,20 +1142,241 @@ func (node *Limit) Format(ctx *FmtCtx) {
 		if needSpace {
 			ctx.WriteByte(' ')
 		}
-		ctx.WriteString("OFFSET ")
+		ctx.writeKeyword("OFFSET ")
 		ctx.FormatNode(node.Offset)
 	}
 }
 
+// LockingStrength represents the strength of the row locks acquired by a
+// locking clause (FOR UPDATE, FOR SHARE, etc).
+type LockingStrength int
+
+// The ordering of the variants is important, because the highest numerical
+// value takes precedence when a table is named in several locking items.
+const (
+	// ForNone represents the default - no row locks.
+	ForNone LockingStrength = iota
+	// ForKeyShare represents FOR KEY SHARE.
+	ForKeyShare
+	// ForShare represents FOR SHARE.
+	ForShare
+	// ForNoKeyUpdate represents FOR NO KEY UPDATE.
+	ForNoKeyUpdate
+	// ForUpdate represents FOR UPDATE.
+	ForUpdate
+)
+
+var lockingStrengthName = [...]string{
+	ForNone:        "",
+	ForKeyShare:    "FOR KEY SHARE",
+	ForShare:       "FOR SHARE",
+	ForNoKeyUpdate: "FOR NO KEY UPDATE",
+	ForUpdate:      "FOR UPDATE",
+}
+
+func (s LockingStrength) String() string {
+	if s < 0 || s > LockingStrength(len(lockingStrengthName)-1) {
+		return fmt.Sprintf("LockingStrength(%d)", s)
+	}
+	return lockingStrengthName[s]
+}
+
+// LockingWaitPolicy represents the policy used by a locking clause when it
+// encounters a row that is locked by another transaction.
+type LockingWaitPolicy int
+
+// The ordering of the variants is important, because the highest numerical
+// value takes precedence when a table is named in several locking items.
+const (
+	// LockWaitBlock represents the default - wait for the lock to become
+	// available.
+	LockWaitBlock LockingWaitPolicy = iota
+	// LockWaitSkip represents SKIP LOCKED - skip rows that can't be locked.
+	LockWaitSkip
+	// LockWaitError represents NOWAIT - raise an error if a row can't be
+	// locked.
+	LockWaitError
+)
+
+var lockingWaitPolicyName = [...]string{
+	LockWaitBlock: "",
+	LockWaitSkip:  "SKIP LOCKED",
+	LockWaitError: "NOWAIT",
+}
+
+func (p LockingWaitPolicy) String() string {
+	if p < 0 || p > LockingWaitPolicy(len(lockingWaitPolicyName)-1) {
+		return fmt.Sprintf("LockingWaitPolicy(%d)", p)
+	}
+	return lockingWaitPolicyName[p]
+}
+
+// LockingItem represents a single locking item in a locking clause, e.g.
+// FOR UPDATE OF t NOWAIT.
+type LockingItem struct {
+	Strength   LockingStrength
+	Targets    TableNames
+	WaitPolicy LockingWaitPolicy
+}
+
+// Format implements the NodeFormatter interface.
+func (node *LockingItem) Format(ctx *FmtCtx) {
+	ctx.writeKeyword(node.Strength.String())
+	if len(node.Targets) > 0 {
+		ctx.writeKeyword(" OF ")
+		ctx.FormatNode(&node.Targets)
+	}
+	if node.WaitPolicy != LockWaitBlock {
+		ctx.WriteByte(' ')
+		ctx.writeKeyword(node.WaitPolicy.String())
+	}
+}
+
+// LockingClause represents the locking clause of a SELECT statement, made of
+// one or more locking items.
+type LockingClause []*LockingItem
+
+// Format implements the NodeFormatter interface.
+func (node *LockingClause) Format(ctx *FmtCtx) {
+	for i, n := range *node {
+		if i > 0 {
+			ctx.writeClauseSep()
+		}
+		ctx.FormatNode(n)
+	}
+}
+
+// Check verifies that the locking clause can be applied to the given select
+// statement. It returns a syntax error if an item has a wait policy but no
+// strength, or if a table is named in several items with conflicting wait
+// policies (NOWAIT and SKIP LOCKED are mutually exclusive). It returns a
+// feature not supported error if SKIP LOCKED is used on a query with
+// DISTINCT, GROUP BY or HAVING, since the rows that would be skipped can't be
+// traced back to the output rows of such queries.
+func (node LockingClause) Check(stmt SelectStatement) error {
+	var skipLocked bool
+	waitPolicies := make(map[string]LockingWaitPolicy)
+	for _, item := range node {
+		if item.Strength == ForNone {
+			if item.WaitPolicy != LockWaitBlock || len(item.Targets) > 0 {
+				return pgerror.New(pgerror.CodeSyntaxError,
+					"locking clause requires a lock strength")
+			}
+			continue
+		}
+		if item.WaitPolicy == LockWaitSkip {
+			skipLocked = true
+		}
+		for i := range item.Targets {
+			name := item.Targets[i].String()
+			prev := waitPolicies[name]
+			if prev != LockWaitBlock && item.WaitPolicy != LockWaitBlock && prev != item.WaitPolicy {
+				return pgerror.Newf(pgerror.CodeSyntaxError,
+					"conflicting wait policies %s and %s for table %s",
+					prev, item.WaitPolicy, name)
+			}
+			if item.WaitPolicy > prev {
+				waitPolicies[name] = item.WaitPolicy
+			}
+		}
+	}
+	if skipLocked {
+		return checkSkipLocked(stmt)
+	}
+	return nil
+}
+
+func checkSkipLocked(stmt SelectStatement) error {
+	switch s := stmt.(type) {
+	case *ParenSelect:
+		return checkSkipLocked(s.Select.Select)
+	case *SelectClause:
+		var clause string
+		switch {
+		case s.Distinct:
+			clause = "DISTINCT"
+		case len(s.GroupBy) > 0:
+			clause = "GROUP BY"
+		case s.Having != nil:
+			clause = "HAVING"
+		default:
+			return nil
+		}
+		return pgerror.Newf(pgerror.CodeFeatureNotSupportedError,
+			"SKIP LOCKED is not allowed with %s clause", clause)
+	}
+	return nil
+}
+
 // RowsFromExpr represents a ROWS FROM(...) expression.
 type RowsFromExpr struct {
 	Items Exprs
+	// ColDefLists contains the column definition lists of the items, e.g.
+	// (a INT, b STRING) in ROWS FROM (json_to_recordset(x) AS (a INT, b STRING)).
+	// It is either empty or has one entry per item; the entries of the items
+	// without a column definition list are nil.
+	ColDefLists []ColumnDefList
+}
+
+// ColDefList returns the column definition list of the i-th item, or nil if
+// the item doesn't have one.
+func (node *RowsFromExpr) ColDefList(i int) ColumnDefList {
+	if i < len(node.ColDefLists) {
+		return node.ColDefLists[i]
+	}
+	return nil
+}
+
+// HasColDefLists returns true if any of the items has a column definition
+// list.
+func (node *RowsFromExpr) HasColDefLists() bool {
+	for _, defs := range node.ColDefLists {
+		if defs != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // Format implements the NodeFormatter interface.
 func (node *RowsFromExpr) Format(ctx *FmtCtx) {
-	ctx.WriteString("ROWS FROM (")
-	ctx.FormatNode(&node.Items)
+	ctx.writeKeyword("ROWS FROM (")
+	for i, item := range node.Items {
+		if i > 0 {
+			ctx.WriteString(", ")
+		}
+		ctx.FormatNode(item)
+		if defs := node.ColDefList(i); defs != nil {
+			ctx.writeKeyword(" AS ")
+			ctx.FormatNode(&defs)
+		}
+	}
+	ctx.WriteByte(')')
+}
+
+// ColumnDef is an element of a column definition list.
+type ColumnDef struct {
+	Name Name
+	Type *types.T
+}
+
+// ColumnDefList represents the column definition list of a ROWS FROM item,
+// which declares the names and types of the columns produced by a function
+// returning records, e.g. (a INT, b STRING).
+type ColumnDefList []ColumnDef
+
+// Format implements the NodeFormatter interface.
+func (node *ColumnDefList) Format(ctx *FmtCtx) {
+	ctx.WriteByte('(')
+	for i := range *node {
+		if i > 0 {
+			ctx.WriteString(", ")
+		}
+		def := &(*node)[i]
+		ctx.FormatNode(&def.Name)
+		ctx.WriteByte(' ')
+		ctx.WriteString(def.Type.SQLString())
+	}
 	ctx.WriteByte(')')
 }
 
@@ -699,9 +1387,9 @@ type Window []*WindowDef
 func (node *Window) Format(ctx *FmtCtx) {
 	prefix := "WINDOW "
 	for _, n := range *node {
-		ctx.WriteString(prefix)
+		ctx.writeKeyword(prefix)
 		ctx.FormatNode(&n.Name)
-		ctx.WriteString(" AS ")
+		ctx.writeKeyword(" AS ")
 		ctx.FormatNode(n)
 		prefix = ", "
 	}
@@ -728,7 +1416,7 @@ func (node *WindowDef) Format(ctx *FmtCtx) {
 		if needSpaceSeparator {
 			ctx.WriteByte(' ')
 		}
-		ctx.WriteString("PARTITION BY ")
+		ctx.writeKeyword("PARTITION BY ")
 		ctx.FormatNode(&node.Partitions)
 		needSpaceSeparator = true
 	}
@@ -809,17 +1497,17 @@ type WindowFrame struct {
 func (node *WindowFrameBound) Format(ctx *FmtCtx) {
 	switch node.BoundType {
 	case UnboundedPreceding:
-		ctx.WriteString("UNBOUNDED PRECEDING")
+		ctx.writeKeyword("UNBOUNDED PRECEDING")
 	case OffsetPreceding:
 		ctx.FormatNode(node.OffsetExpr)
-		ctx.WriteString(" PRECEDING")
+		ctx.writeKeyword(" PRECEDING")
 	case CurrentRow:
-		ctx.WriteString("CURRENT ROW")
+		ctx.writeKeyword("CURRENT ROW")
 	case OffsetFollowing:
 		ctx.FormatNode(node.OffsetExpr)
-		ctx.WriteString(" FOLLOWING")
+		ctx.writeKeyword(" FOLLOWING")
 	case UnboundedFollowing:
-		ctx.WriteString("UNBOUNDED FOLLOWING")
+		ctx.writeKeyword("UNBOUNDED FOLLOWING")
 	default:
 		panic(pgerror.AssertionFailedf("unhandled case: %d", log.Safe(node.BoundType)))
 	}
@@ -829,20 +1517,70 @@ func (node *WindowFrameBound) Format(ctx *FmtCtx) {
 func (node *WindowFrame) Format(ctx *FmtCtx) {
 	switch node.Mode {
 	case RANGE:
-		ctx.WriteString("RANGE ")
+		ctx.writeKeyword("RANGE ")
 	case ROWS:
-		ctx.WriteString("ROWS ")
+		ctx.writeKeyword("ROWS ")
 	case GROUPS:
-		ctx.WriteString("GROUPS ")
+		ctx.writeKeyword("GROUPS ")
 	default:
 		panic(pgerror.AssertionFailedf("unhandled case: %d", log.Safe(node.Mode)))
 	}
 	if node.Bounds.EndBound != nil {
-		ctx.WriteString("BETWEEN ")
+		ctx.writeKeyword("BETWEEN ")
 		ctx.FormatNode(node.Bounds.StartBound)
-		ctx.WriteString(" AND ")
+		ctx.writeKeyword(" AND ")
 		ctx.FormatNode(node.Bounds.EndBound)
 	} else {
 		ctx.FormatNode(node.Bounds.StartBound)
 	}
 }
+
+// Validate checks that the frame bounds are legal: the start bound can't be
+// UNBOUNDED FOLLOWING, the end bound can't be UNBOUNDED PRECEDING, the frame
+// can't start after it ends (without an end bound, the frame ends at the
+// current row), and offset bounds must have an offset expression. The parser
+// rejects the frames that fail these checks.
+func (node *WindowFrame) Validate() error {
+	switch node.Mode {
+	case RANGE, ROWS, GROUPS:
+	default:
+		return pgerror.AssertionFailedf("unhandled window frame mode: %d", log.Safe(node.Mode))
+	}
+	start, end := node.Bounds.StartBound, node.Bounds.EndBound
+	if start == nil {
+		return pgerror.AssertionFailedf("window frame without a start bound")
+	}
+	for _, b := range []*WindowFrameBound{start, end} {
+		if b == nil {
+			continue
+		}
+		if b.BoundType < UnboundedPreceding || b.BoundType > UnboundedFollowing {
+			return pgerror.AssertionFailedf("unhandled window frame bound type: %d", log.Safe(b.BoundType))
+		}
+		if b.HasOffset() && b.OffsetExpr == nil {
+			return pgerror.New(pgerror.CodeSyntaxError, "frame offset bound must have an offset")
+		}
+	}
+	if start.BoundType == UnboundedFollowing {
+		return pgerror.New(pgerror.CodeWindowingError, "frame start cannot be UNBOUNDED FOLLOWING")
+	}
+	if end == nil {
+		if start.BoundType == OffsetFollowing {
+			return pgerror.New(pgerror.CodeWindowingError,
+				"frame starting from following row cannot end with current row")
+		}
+		return nil
+	}
+	switch {
+	case end.BoundType == UnboundedPreceding:
+		return pgerror.New(pgerror.CodeWindowingError, "frame end cannot be UNBOUNDED PRECEDING")
+	case start.BoundType == CurrentRow && end.BoundType == OffsetPreceding:
+		return pgerror.New(pgerror.CodeWindowingError,
+			"frame starting from current row cannot have preceding rows")
+	case start.BoundType == OffsetFollowing &&
+		(end.BoundType == OffsetPreceding || end.BoundType == CurrentRow):
+		return pgerror.New(pgerror.CodeWindowingError,
+			"frame starting from following row cannot have preceding rows")
+	}
+	return nil
+}
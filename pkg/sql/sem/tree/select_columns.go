@@ -0,0 +1,194 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+import "sort"
+
+// ReferencedColumns returns the columns referenced anywhere in the statement:
+// in the render lists, the WHERE, GROUP BY and HAVING clauses, the ORDER BY
+// and LIMIT clauses, the join conditions and the window definitions, including
+// those of subqueries, set operations and common table expressions. The
+// columns of a USING join condition are reported as unqualified references.
+//
+// The references are reported as written, before name resolution: `a` and
+// `t.a` are both returned if they both appear in the statement. Stars (`*` and
+// `t.*`) are not column references. The result is deduplicated and sorted by
+// the formatted names of the columns.
+func (node *Select) ReferencedColumns() []ColumnItem {
+	c := columnCollector{seen: make(map[string]struct{})}
+	c.collectSelect(node)
+	sort.Slice(c.cols, func(i, j int) bool {
+		return c.cols[i].key < c.cols[j].key
+	})
+	res := make([]ColumnItem, len(c.cols))
+	for i := range c.cols {
+		res[i] = c.cols[i].col
+	}
+	return res
+}
+
+type collectedColumn struct {
+	// key is the formatted name of col.
+	key string
+	col ColumnItem
+}
+
+// columnCollector accumulates the column references of a statement for
+// ReferencedColumns.
+type columnCollector struct {
+	seen map[string]struct{}
+	cols []collectedColumn
+}
+
+func (c *columnCollector) add(col *ColumnItem) {
+	key := AsString(col)
+	if _, ok := c.seen[key]; ok {
+		return
+	}
+	c.seen[key] = struct{}{}
+	c.cols = append(c.cols, collectedColumn{key: key, col: *col})
+}
+
+func (c *columnCollector) collectSelect(node *Select) {
+	if node == nil {
+		return
+	}
+	if node.With != nil {
+		for _, cte := range node.With.CTEList {
+			if s, ok := cte.Stmt.(*Select); ok {
+				c.collectSelect(s)
+			}
+		}
+	}
+	c.collectSelectStatement(node.Select)
+	c.collectOrderBy(node.OrderBy)
+	if node.Limit != nil {
+		c.collectExpr(node.Limit.Count)
+		c.collectExpr(node.Limit.Offset)
+	}
+}
+
+func (c *columnCollector) collectSelectStatement(stmt SelectStatement) {
+	switch s := stmt.(type) {
+	case *SelectClause:
+		c.collectSelectClause(s)
+	case *ParenSelect:
+		c.collectSelect(s.Select)
+	case *UnionClause:
+		c.collectSelect(s.Left)
+		c.collectSelect(s.Right)
+	case *ValuesClause:
+		for _, row := range s.Rows {
+			c.collectExprs(row)
+		}
+	}
+}
+
+func (c *columnCollector) collectSelectClause(node *SelectClause) {
+	c.collectExprs(node.DistinctOn)
+	for _, expr := range node.Exprs {
+		c.collectExpr(expr.Expr)
+	}
+	if node.From != nil {
+		for _, t := range node.From.Tables {
+			c.collectTableExpr(t)
+		}
+	}
+	if node.Where != nil {
+		c.collectExpr(node.Where.Expr)
+	}
+	c.collectExprs(node.GroupBy)
+	if node.Having != nil {
+		c.collectExpr(node.Having.Expr)
+	}
+	for _, w := range node.Window {
+		c.collectWindowDef(w)
+	}
+}
+
+func (c *columnCollector) collectTableExpr(expr TableExpr) {
+	switch t := expr.(type) {
+	case *AliasedTableExpr:
+		c.collectTableExpr(t.Expr)
+	case *ParenTableExpr:
+		c.collectTableExpr(t.Expr)
+	case *JoinTableExpr:
+		c.collectTableExpr(t.Left)
+		c.collectTableExpr(t.Right)
+		switch cond := t.Cond.(type) {
+		case *OnJoinCond:
+			c.collectExpr(cond.Expr)
+		case *UsingJoinCond:
+			for _, col := range cond.Cols {
+				c.add(&ColumnItem{ColumnName: col})
+			}
+		}
+	case *RowsFromExpr:
+		c.collectExprs(t.Items)
+	case *Subquery:
+		c.collectSelectStatement(t.Select)
+	}
+}
+
+func (c *columnCollector) collectWindowDef(w *WindowDef) {
+	if w == nil {
+		return
+	}
+	c.collectExprs(w.Partitions)
+	c.collectOrderBy(w.OrderBy)
+	if w.Frame != nil {
+		for _, b := range []*WindowFrameBound{w.Frame.Bounds.StartBound, w.Frame.Bounds.EndBound} {
+			if b != nil {
+				c.collectExpr(b.OffsetExpr)
+			}
+		}
+	}
+}
+
+func (c *columnCollector) collectOrderBy(orderBy OrderBy) {
+	for _, o := range orderBy {
+		c.collectExpr(o.Expr)
+	}
+}
+
+func (c *columnCollector) collectExprs(exprs []Expr) {
+	for _, expr := range exprs {
+		c.collectExpr(expr)
+	}
+}
+
+func (c *columnCollector) collectExpr(expr Expr) {
+	if expr == nil {
+		return
+	}
+	_, _ = SimpleVisit(expr, func(expr Expr) (recurse bool, newExpr Expr, err error) {
+		switch t := expr.(type) {
+		case *Subquery:
+			c.collectSelectStatement(t.Select)
+			return false, expr, nil
+		case *UnresolvedName:
+			if vn, err := t.NormalizeVarName(); err == nil {
+				if col, ok := vn.(*ColumnItem); ok {
+					c.add(col)
+				}
+			}
+			return false, expr, nil
+		case *ColumnItem:
+			c.add(t)
+			return false, expr, nil
+		}
+		return true, expr, nil
+	})
+}
@@ -0,0 +1,364 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+// This file implements structural equality on SELECT statements. Nodes are
+// compared field by field, with a few normalizations so that trees that only
+// differ in how they were constructed compare equal. Redundant parentheses
+// around table expressions, and around SELECT statements that carry no clauses
+// of their own, are ignored. Nil and empty lists (GROUP BY, ORDER BY, WINDOW,
+// ...) are equivalent, as are a nil FROM, WHERE or LIMIT clause and an empty
+// one. A join without a join type is an INNER join.
+//
+// Expressions, as well as the less common nodes that have no Equal method,
+// are compared by their parsable representation, after stripping any
+// top-level parentheses.
+
+// Equal returns true if the two statements are structurally equal.
+func (node *Select) Equal(other *Select) bool {
+	if node == nil || other == nil {
+		return node == other
+	}
+	return withsEqual(node.With, other.With) &&
+		selectStatementsEqual(node.Select, other.Select) &&
+		node.OrderBy.Equal(other.OrderBy) &&
+		node.Limit.Equal(other.Limit) &&
+		lockingClausesEqual(node.Locking, other.Locking)
+}
+
+// stripSelectParens removes the parentheses around a SELECT statement, as
+// long as the parenthesized statement doesn't carry a WITH, ORDER BY, LIMIT
+// or locking clause.
+func stripSelectParens(stmt SelectStatement) SelectStatement {
+	for {
+		p, ok := stmt.(*ParenSelect)
+		if !ok || p.Select == nil {
+			return stmt
+		}
+		s := p.Select
+		if s.With != nil || len(s.OrderBy) > 0 || s.Limit != nil || len(s.Locking) > 0 {
+			return stmt
+		}
+		stmt = s.Select
+	}
+}
+
+func selectStatementsEqual(a, b SelectStatement) bool {
+	a, b = stripSelectParens(a), stripSelectParens(b)
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch a := a.(type) {
+	case *SelectClause:
+		b, ok := b.(*SelectClause)
+		return ok && a.Equal(b)
+	case *UnionClause:
+		b, ok := b.(*UnionClause)
+		return ok && a.Equal(b)
+	case *ValuesClause:
+		b, ok := b.(*ValuesClause)
+		if !ok || len(a.Rows) != len(b.Rows) {
+			return false
+		}
+		for i := range a.Rows {
+			if !exprListsEqual(a.Rows[i], b.Rows[i]) {
+				return false
+			}
+		}
+		return true
+	case *ParenSelect:
+		b, ok := b.(*ParenSelect)
+		return ok && a.Select.Equal(b.Select)
+	}
+	return nodesFormatEqual(a, b)
+}
+
+// Equal returns true if the two clauses are structurally equal.
+func (node *SelectClause) Equal(other *SelectClause) bool {
+	if node == nil || other == nil {
+		return node == other
+	}
+	if node.Distinct != other.Distinct ||
+		node.TableSelect != other.TableSelect ||
+		!exprListsEqual(node.DistinctOn, other.DistinctOn) ||
+		len(node.Exprs) != len(other.Exprs) {
+		return false
+	}
+	for i := range node.Exprs {
+		if node.Exprs[i].As != other.Exprs[i].As ||
+			!exprsEqual(node.Exprs[i].Expr, other.Exprs[i].Expr) {
+			return false
+		}
+	}
+	if (node.Into == nil) != (other.Into == nil) ||
+		(node.Into != nil && !nodesFormatEqual(node.Into, other.Into)) {
+		return false
+	}
+	return node.From.Equal(other.From) &&
+		wheresEqual(node.Where, other.Where) &&
+		exprListsEqual(node.GroupBy, other.GroupBy) &&
+		wheresEqual(node.Having, other.Having) &&
+		node.Window.Equal(other.Window)
+}
+
+// Equal returns true if the two set operations are structurally equal.
+func (node *UnionClause) Equal(other *UnionClause) bool {
+	if node == nil || other == nil {
+		return node == other
+	}
+	if node.Type != other.Type || node.All != other.All ||
+		node.Corresponding != other.Corresponding ||
+		len(node.CorrespondingCols) != len(other.CorrespondingCols) {
+		return false
+	}
+	for i := range node.CorrespondingCols {
+		if node.CorrespondingCols[i] != other.CorrespondingCols[i] {
+			return false
+		}
+	}
+	return node.Left.Equal(other.Left) && node.Right.Equal(other.Right)
+}
+
+// Equal returns true if the two FROM clauses are structurally equal. A nil
+// FROM clause is equal to an empty one.
+func (node *From) Equal(other *From) bool {
+	var empty From
+	if node == nil {
+		node = &empty
+	}
+	if other == nil {
+		other = &empty
+	}
+	if len(node.Tables) != len(other.Tables) ||
+		!exprsEqual(node.AsOf.Expr, other.AsOf.Expr) {
+		return false
+	}
+	for i := range node.Tables {
+		if !tableExprsEqual(node.Tables[i], other.Tables[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func tableExprsEqual(a, b TableExpr) bool {
+	a, b = StripTableParens(a), StripTableParens(b)
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch a := a.(type) {
+	case *AliasedTableExpr:
+		b, ok := b.(*AliasedTableExpr)
+		return ok && a.Equal(b)
+	case *JoinTableExpr:
+		b, ok := b.(*JoinTableExpr)
+		return ok && a.Equal(b)
+	case *Subquery:
+		b, ok := b.(*Subquery)
+		return ok && a.Exists == b.Exists && selectStatementsEqual(a.Select, b.Select)
+	}
+	return nodesFormatEqual(a, b)
+}
+
+// Equal returns true if the two table expressions are structurally equal.
+func (node *AliasedTableExpr) Equal(other *AliasedTableExpr) bool {
+	if node == nil || other == nil {
+		return node == other
+	}
+	if node.Ordinality != other.Ordinality || node.Lateral != other.Lateral ||
+		node.Only != other.Only || node.As.Alias != other.As.Alias || len(node.As.Cols) != len(other.As.Cols) {
+		return false
+	}
+	for i := range node.As.Cols {
+		if node.As.Cols[i] != other.As.Cols[i] {
+			return false
+		}
+	}
+	if (node.IndexFlags == nil) != (other.IndexFlags == nil) ||
+		(node.IndexFlags != nil && !indexFlagsEqual(node.IndexFlags, other.IndexFlags)) {
+		return false
+	}
+	if (node.AsOf == nil) != (other.AsOf == nil) ||
+		(node.AsOf != nil && !exprsEqual(node.AsOf.Expr, other.AsOf.Expr)) {
+		return false
+	}
+	return tableExprsEqual(node.Expr, other.Expr)
+}
+
+func indexFlagsEqual(a, b *IndexFlags) bool {
+	if a.Index != b.Index || a.IndexID != b.IndexID || a.Direction != b.Direction ||
+		a.NoIndexJoin != b.NoIndexJoin || a.IgnoreForeignKeys != b.IgnoreForeignKeys ||
+		len(a.ColumnDirections) != len(b.ColumnDirections) {
+		return false
+	}
+	for i := range a.ColumnDirections {
+		if a.ColumnDirections[i] != b.ColumnDirections[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if the two joins are structurally equal. A join without
+// a join type is equal to the same INNER join.
+func (node *JoinTableExpr) Equal(other *JoinTableExpr) bool {
+	if node == nil || other == nil {
+		return node == other
+	}
+	joinType := func(j *JoinTableExpr) string {
+		if j.JoinType == "" {
+			return AstInner
+		}
+		return j.JoinType
+	}
+	if joinType(node) != joinType(other) || node.Hint != other.Hint ||
+		!tableExprsEqual(node.Left, other.Left) || !tableExprsEqual(node.Right, other.Right) {
+		return false
+	}
+	switch a := node.Cond.(type) {
+	case nil:
+		return other.Cond == nil
+	case *OnJoinCond:
+		b, ok := other.Cond.(*OnJoinCond)
+		return ok && exprsEqual(a.Expr, b.Expr)
+	}
+	return other.Cond != nil && nodesFormatEqual(node.Cond, other.Cond)
+}
+
+// Equal returns true if the two WINDOW clauses are structurally equal.
+func (node Window) Equal(other Window) bool {
+	if len(node) != len(other) {
+		return false
+	}
+	for i := range node {
+		if !node[i].Equal(other[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if the two window definitions are structurally equal.
+func (node *WindowDef) Equal(other *WindowDef) bool {
+	if node == nil || other == nil {
+		return node == other
+	}
+	if node.Name != other.Name || node.RefName != other.RefName ||
+		!exprListsEqual(node.Partitions, other.Partitions) ||
+		!node.OrderBy.Equal(other.OrderBy) {
+		return false
+	}
+	if node.Frame == nil || other.Frame == nil {
+		return node.Frame == other.Frame
+	}
+	return nodesFormatEqual(node.Frame, other.Frame)
+}
+
+// Equal returns true if the two ORDER BY clauses are structurally equal.
+func (node OrderBy) Equal(other OrderBy) bool {
+	if len(node) != len(other) {
+		return false
+	}
+	for i := range node {
+		a, b := node[i], other[i]
+		if a.OrderType != b.OrderType || a.Direction != b.Direction ||
+			a.Index != b.Index || !exprsEqual(a.Expr, b.Expr) ||
+			!nodesFormatEqual(&a.Table, &b.Table) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if the two LIMIT clauses are structurally equal. A nil
+// LIMIT clause is equal to an empty one.
+func (node *Limit) Equal(other *Limit) bool {
+	var empty Limit
+	if node == nil {
+		node = &empty
+	}
+	if other == nil {
+		other = &empty
+	}
+	return exprsEqual(node.Count, other.Count) && exprsEqual(node.Offset, other.Offset)
+}
+
+func wheresEqual(a, b *Where) bool {
+	var aExpr, bExpr Expr
+	if a != nil {
+		aExpr = a.Expr
+	}
+	if b != nil {
+		bExpr = b.Expr
+	}
+	return exprsEqual(aExpr, bExpr)
+}
+
+func withsEqual(a, b *With) bool {
+	if a == nil || b == nil || len(a.CTEList) == 0 || len(b.CTEList) == 0 {
+		return (a == nil || len(a.CTEList) == 0) && (b == nil || len(b.CTEList) == 0)
+	}
+	if len(a.CTEList) != len(b.CTEList) {
+		return false
+	}
+	for i := range a.CTEList {
+		ac, bc := a.CTEList[i], b.CTEList[i]
+		if !nodesFormatEqual(&ac.Name, &bc.Name) || ac.Materialized != bc.Materialized {
+			return false
+		}
+		as, aok := ac.Stmt.(*Select)
+		bs, bok := bc.Stmt.(*Select)
+		if aok && bok {
+			if !as.Equal(bs) {
+				return false
+			}
+		} else if aok != bok || !nodesFormatEqual(ac.Stmt, bc.Stmt) {
+			return false
+		}
+	}
+	return true
+}
+
+func lockingClausesEqual(a, b LockingClause) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(a) == 0 || nodesFormatEqual(&a, &b)
+}
+
+func exprListsEqual(a, b []Expr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !exprsEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// exprsEqual compares two expressions by their parsable representation,
+// ignoring any top-level parentheses.
+func exprsEqual(a, b Expr) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return nodesFormatEqual(StripParens(a), StripParens(b))
+}
+
+func nodesFormatEqual(a, b NodeFormatter) bool {
+	return AsStringWithFlags(a, FmtParsable) == AsStringWithFlags(b, FmtParsable)
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+)
+
+func TestSelectEqual(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{`SELECT a FROM t`, `SELECT a FROM t`, true},
+		{`SELECT a FROM t`, `SELECT b FROM t`, false},
+		{`SELECT a FROM t`, `SELECT a AS a FROM t`, false},
+		{`SELECT a FROM t`, `SELECT DISTINCT a FROM t`, false},
+
+		// Redundant parentheses are ignored.
+		{`SELECT a FROM t WHERE a > 1`, `SELECT (a) FROM t WHERE (a > 1)`, true},
+		{`SELECT a FROM t`, `((SELECT a FROM t))`, true},
+		{`SELECT a FROM t WHERE a > 1`, `SELECT a FROM t WHERE a < 1`, false},
+
+		// ORDER BY, LIMIT and set operations.
+		{`SELECT a FROM t ORDER BY a LIMIT 1`, `SELECT a FROM t ORDER BY a LIMIT 1`, true},
+		{`SELECT a FROM t ORDER BY a`, `SELECT a FROM t ORDER BY a DESC`, false},
+		{`SELECT a FROM t LIMIT 1`, `SELECT a FROM t LIMIT 2`, false},
+		{`SELECT a FROM t LIMIT 1`, `SELECT a FROM t LIMIT 1 OFFSET 1`, false},
+		{`SELECT a FROM t UNION SELECT b FROM u`, `(SELECT a FROM t) UNION (SELECT b FROM u)`, true},
+		{`SELECT a FROM t UNION SELECT b FROM u`, `SELECT a FROM t UNION ALL SELECT b FROM u`, false},
+		{`SELECT a FROM t UNION SELECT b FROM u`, `SELECT a FROM t EXCEPT SELECT b FROM u`, false},
+		{`VALUES (1, 2)`, `VALUES (1, (2))`, true},
+		{`VALUES (1, 2)`, `VALUES (1, 3)`, false},
+
+		// Joins.
+		{`SELECT * FROM t JOIN u ON t.a = u.a`, `SELECT * FROM t INNER JOIN u ON (t.a = u.a)`, true},
+		{`SELECT * FROM t JOIN u ON true`, `SELECT * FROM (t JOIN u ON true)`, true},
+		{`SELECT * FROM t JOIN u ON t.a = u.a`, `SELECT * FROM t LEFT JOIN u ON t.a = u.a`, false},
+		{`SELECT * FROM t JOIN u ON t.a = u.a`, `SELECT * FROM t JOIN u ON t.a = u.b`, false},
+		{`SELECT * FROM t JOIN u USING (a)`, `SELECT * FROM t JOIN u USING (a)`, true},
+		{`SELECT * FROM t JOIN u USING (a)`, `SELECT * FROM t JOIN u USING (b)`, false},
+		{`SELECT * FROM t NATURAL JOIN u`, `SELECT * FROM t NATURAL INNER JOIN u`, true},
+		{`SELECT * FROM t INNER HASH JOIN u ON true`, `SELECT * FROM t INNER MERGE JOIN u ON true`, false},
+		{`SELECT * FROM t JOIN u ON true`, `SELECT * FROM u JOIN t ON true`, false},
+		{`SELECT * FROM ONLY t`, `SELECT * FROM ONLY (t)`, true},
+		{`SELECT * FROM t`, `SELECT * FROM ONLY t`, false},
+		{`SELECT * FROM t, (SELECT a FROM u) AS v`, `SELECT * FROM t, ((SELECT a FROM u)) AS v`, true},
+		{`SELECT * FROM t, (SELECT a FROM u) AS v`, `SELECT * FROM t, (SELECT b FROM u) AS v`, false},
+
+		// Window functions and clauses.
+		{
+			`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY a ORDER BY b)`,
+			`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY (a) ORDER BY b)`,
+			true,
+		},
+		{
+			`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY a ORDER BY b)`,
+			`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY a ORDER BY b DESC)`,
+			false,
+		},
+		{
+			`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY a)`,
+			`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY b)`,
+			false,
+		},
+		{
+			`SELECT sum(a) OVER (ROWS 1 PRECEDING) FROM t`,
+			`SELECT sum(a) OVER (ROWS 2 PRECEDING) FROM t`,
+			false,
+		},
+
+		// WITH clauses.
+		{`WITH v AS (SELECT a FROM t) SELECT * FROM v`, `WITH v AS ((SELECT a FROM t)) SELECT * FROM v`, true},
+		{`WITH v AS (SELECT a FROM t) SELECT * FROM v`, `WITH w AS (SELECT a FROM t) SELECT * FROM v`, false},
+		{`WITH v AS MATERIALIZED (SELECT a FROM t) SELECT * FROM v`, `WITH v AS MATERIALIZED (SELECT a FROM t) SELECT * FROM v`, true},
+		{`WITH v AS (SELECT a FROM t) SELECT * FROM v`, `WITH v AS MATERIALIZED (SELECT a FROM t) SELECT * FROM v`, false},
+		{`WITH v AS MATERIALIZED (SELECT a FROM t) SELECT * FROM v`, `WITH v AS NOT MATERIALIZED (SELECT a FROM t) SELECT * FROM v`, false},
+	}
+	parse := func(t *testing.T, sql string) *tree.Select {
+		stmt, err := parser.ParseOne(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stmt.AST.(*tree.Select)
+	}
+	for _, tc := range testCases {
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			a, b := parse(t, tc.a), parse(t, tc.b)
+			if res := a.Equal(b); res != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, res)
+			}
+			if res := b.Equal(a); res != tc.expected {
+				t.Fatalf("expected %t in reverse, got %t", tc.expected, res)
+			}
+			if res := a.Hash() == b.Hash(); res != tc.expected {
+				t.Fatalf("expected equal hashes to be %t, got %t", tc.expected, res)
+			}
+		})
+	}
+
+	// Nil and empty clauses are equal.
+	a, b := parse(t, `SELECT a FROM t`), parse(t, `SELECT a FROM t`)
+	clause := b.Select.(*tree.SelectClause)
+	clause.Where = &tree.Where{Type: tree.AstWhere}
+	clause.GroupBy = tree.GroupBy{}
+	clause.Window = tree.Window{}
+	b.Limit = &tree.Limit{}
+	if !a.Equal(b) {
+		t.Fatalf("expected %s to equal itself with empty clauses", tree.AsString(a))
+	}
+	if a.Hash() != b.Hash() {
+		t.Fatalf("expected %s to hash like itself with empty clauses", tree.AsString(a))
+	}
+	if a.Equal(nil) {
+		t.Fatalf("expected %s not to equal nil", tree.AsString(a))
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"io"
+)
+
+// This file implements a content hash of SELECT statements that is consistent
+// with the structural equality in select_equal.go: statements that are Equal
+// have the same Hash. The hash walks the same nodes as Equal and applies the
+// same normalizations (redundant parentheses, nil vs empty clauses, implicit
+// INNER joins). Since Equal compares expressions and the less common nodes by
+// their parsable representation, those leaves are formatted into the hash;
+// the statement as a whole never is.
+
+// Hash returns a hash of the statement's structure. Statements that are Equal
+// have the same hash. Statements with the same hash are not necessarily
+// Equal.
+func (node *Select) Hash() uint64 {
+	h := selectHasher{h: fnv.New64a()}
+	h.hashSelect(node)
+	return h.h.Sum64()
+}
+
+// Tags written before the nodes of the different kinds that can appear at
+// the same position, so that they don't hash alike.
+const (
+	hashTagNil byte = iota
+	hashTagSelect
+	hashTagSelectClause
+	hashTagUnionClause
+	hashTagValuesClause
+	hashTagParenSelect
+	hashTagAliasedTable
+	hashTagJoin
+	hashTagSubquery
+	hashTagOnJoinCond
+	hashTagExpr
+	hashTagFormatted
+)
+
+type selectHasher struct {
+	h   hash.Hash64
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (h *selectHasher) writeUint(v uint64) {
+	n := binary.PutUvarint(h.buf[:], v)
+	_, _ = h.h.Write(h.buf[:n])
+}
+
+func (h *selectHasher) writeTag(tag byte) {
+	h.writeUint(uint64(tag))
+}
+
+func (h *selectHasher) writeBool(b bool) {
+	if b {
+		h.writeUint(1)
+	} else {
+		h.writeUint(0)
+	}
+}
+
+// writeString writes s prefixed by its length, so that consecutive strings
+// can't be confused with one another.
+func (h *selectHasher) writeString(s string) {
+	h.writeUint(uint64(len(s)))
+	_, _ = io.WriteString(h.h, s)
+}
+
+// writeFormatted writes the parsable representation of n; it mirrors
+// nodesFormatEqual.
+func (h *selectHasher) writeFormatted(n NodeFormatter) {
+	h.writeTag(hashTagFormatted)
+	h.writeString(AsStringWithFlags(n, FmtParsable))
+}
+
+func (h *selectHasher) hashSelect(node *Select) {
+	if node == nil {
+		h.writeTag(hashTagNil)
+		return
+	}
+	h.writeTag(hashTagSelect)
+	h.hashWith(node.With)
+	h.hashSelectStatement(node.Select)
+	h.hashOrderBy(node.OrderBy)
+	h.hashLimit(node.Limit)
+	h.writeUint(uint64(len(node.Locking)))
+	if len(node.Locking) > 0 {
+		h.writeFormatted(&node.Locking)
+	}
+}
+
+func (h *selectHasher) hashSelectStatement(stmt SelectStatement) {
+	switch s := stripSelectParens(stmt).(type) {
+	case nil:
+		h.writeTag(hashTagNil)
+	case *SelectClause:
+		h.hashSelectClause(s)
+	case *UnionClause:
+		h.hashUnionClause(s)
+	case *ValuesClause:
+		h.writeTag(hashTagValuesClause)
+		h.writeUint(uint64(len(s.Rows)))
+		for _, row := range s.Rows {
+			h.hashExprs(row)
+		}
+	case *ParenSelect:
+		h.writeTag(hashTagParenSelect)
+		h.hashSelect(s.Select)
+	default:
+		h.writeFormatted(s)
+	}
+}
+
+func (h *selectHasher) hashSelectClause(node *SelectClause) {
+	if node == nil {
+		h.writeTag(hashTagNil)
+		return
+	}
+	h.writeTag(hashTagSelectClause)
+	h.writeBool(node.Distinct)
+	h.writeBool(node.TableSelect)
+	h.hashExprs(node.DistinctOn)
+	h.writeUint(uint64(len(node.Exprs)))
+	for _, e := range node.Exprs {
+		h.writeString(string(e.As))
+		h.hashExpr(e.Expr)
+	}
+	h.writeBool(node.Into != nil)
+	if node.Into != nil {
+		h.writeFormatted(node.Into)
+	}
+	h.hashFrom(node.From)
+	h.hashWhere(node.Where)
+	h.hashExprs(node.GroupBy)
+	h.hashWhere(node.Having)
+	h.hashWindow(node.Window)
+}
+
+func (h *selectHasher) hashUnionClause(node *UnionClause) {
+	if node == nil {
+		h.writeTag(hashTagNil)
+		return
+	}
+	h.writeTag(hashTagUnionClause)
+	h.writeUint(uint64(node.Type))
+	h.writeBool(node.All)
+	h.writeBool(node.Corresponding)
+	h.writeUint(uint64(len(node.CorrespondingCols)))
+	for _, col := range node.CorrespondingCols {
+		h.writeString(string(col))
+	}
+	h.hashSelect(node.Left)
+	h.hashSelect(node.Right)
+}
+
+func (h *selectHasher) hashFrom(node *From) {
+	if node == nil {
+		node = &From{}
+	}
+	h.writeUint(uint64(len(node.Tables)))
+	h.hashExpr(node.AsOf.Expr)
+	for _, t := range node.Tables {
+		h.hashTableExpr(t)
+	}
+}
+
+func (h *selectHasher) hashTableExpr(expr TableExpr) {
+	switch t := StripTableParens(expr).(type) {
+	case nil:
+		h.writeTag(hashTagNil)
+	case *AliasedTableExpr:
+		h.hashAliasedTableExpr(t)
+	case *JoinTableExpr:
+		h.hashJoinTableExpr(t)
+	case *Subquery:
+		h.writeTag(hashTagSubquery)
+		h.writeBool(t.Exists)
+		h.hashSelectStatement(t.Select)
+	default:
+		h.writeFormatted(t)
+	}
+}
+
+func (h *selectHasher) hashAliasedTableExpr(node *AliasedTableExpr) {
+	if node == nil {
+		h.writeTag(hashTagNil)
+		return
+	}
+	h.writeTag(hashTagAliasedTable)
+	h.writeBool(node.Ordinality)
+	h.writeBool(node.Lateral)
+	h.writeBool(node.Only)
+	h.writeString(string(node.As.Alias))
+	h.writeUint(uint64(len(node.As.Cols)))
+	for _, col := range node.As.Cols {
+		h.writeString(string(col))
+	}
+	h.writeBool(node.IndexFlags != nil)
+	if f := node.IndexFlags; f != nil {
+		h.writeString(string(f.Index))
+		h.writeUint(uint64(f.IndexID))
+		h.writeUint(uint64(f.Direction))
+		h.writeBool(f.NoIndexJoin)
+		h.writeBool(f.IgnoreForeignKeys)
+		h.writeUint(uint64(len(f.ColumnDirections)))
+		for _, d := range f.ColumnDirections {
+			h.writeUint(uint64(d))
+		}
+	}
+	h.writeBool(node.AsOf != nil)
+	if node.AsOf != nil {
+		h.hashExpr(node.AsOf.Expr)
+	}
+	h.hashTableExpr(node.Expr)
+}
+
+func (h *selectHasher) hashJoinTableExpr(node *JoinTableExpr) {
+	if node == nil {
+		h.writeTag(hashTagNil)
+		return
+	}
+	h.writeTag(hashTagJoin)
+	joinType := node.JoinType
+	if joinType == "" {
+		joinType = AstInner
+	}
+	h.writeString(joinType)
+	h.writeString(node.Hint)
+	h.hashTableExpr(node.Left)
+	h.hashTableExpr(node.Right)
+	switch c := node.Cond.(type) {
+	case nil:
+		h.writeTag(hashTagNil)
+	case *OnJoinCond:
+		h.writeTag(hashTagOnJoinCond)
+		h.hashExpr(c.Expr)
+	default:
+		h.writeFormatted(c)
+	}
+}
+
+func (h *selectHasher) hashWindow(node Window) {
+	h.writeUint(uint64(len(node)))
+	for _, w := range node {
+		if w == nil {
+			h.writeTag(hashTagNil)
+			continue
+		}
+		h.writeString(string(w.Name))
+		h.writeString(string(w.RefName))
+		h.hashExprs(w.Partitions)
+		h.hashOrderBy(w.OrderBy)
+		if w.Frame == nil {
+			h.writeTag(hashTagNil)
+		} else {
+			h.writeFormatted(w.Frame)
+		}
+	}
+}
+
+func (h *selectHasher) hashOrderBy(node OrderBy) {
+	h.writeUint(uint64(len(node)))
+	for _, o := range node {
+		h.writeUint(uint64(o.OrderType))
+		h.writeUint(uint64(o.Direction))
+		h.writeString(string(o.Index))
+		h.hashExpr(o.Expr)
+		h.writeFormatted(&o.Table)
+	}
+}
+
+func (h *selectHasher) hashLimit(node *Limit) {
+	if node == nil {
+		node = &Limit{}
+	}
+	h.hashExpr(node.Count)
+	h.hashExpr(node.Offset)
+}
+
+func (h *selectHasher) hashWhere(node *Where) {
+	var expr Expr
+	if node != nil {
+		expr = node.Expr
+	}
+	h.hashExpr(expr)
+}
+
+func (h *selectHasher) hashWith(node *With) {
+	if node == nil {
+		h.writeUint(0)
+		return
+	}
+	h.writeUint(uint64(len(node.CTEList)))
+	for _, cte := range node.CTEList {
+		h.writeFormatted(&cte.Name)
+		h.writeUint(uint64(cte.Materialized))
+		if s, ok := cte.Stmt.(*Select); ok {
+			h.hashSelect(s)
+		} else {
+			h.writeFormatted(cte.Stmt)
+		}
+	}
+}
+
+func (h *selectHasher) hashExprs(exprs []Expr) {
+	h.writeUint(uint64(len(exprs)))
+	for _, e := range exprs {
+		h.hashExpr(e)
+	}
+}
+
+// hashExpr mirrors exprsEqual: it hashes the same parsable representation that
+// exprsEqual compares, so expressions that are equal hash alike however they
+// were built.
+func (h *selectHasher) hashExpr(expr Expr) {
+	if expr == nil {
+		h.writeTag(hashTagNil)
+		return
+	}
+	h.writeTag(hashTagExpr)
+	h.writeString(AsStringWithFlags(StripParens(expr), FmtParsable))
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+)
+
+func TestSelectHash(t *testing.T) {
+	// Each query is distinct from all the others. It is also hashed wrapped in
+	// parentheses, which are redundant (and must not change the hash) unless
+	// the query has a clause that Equal doesn't look through, such as ORDER BY.
+	queries := []string{
+		`SELECT 1`,
+		`SELECT 2`,
+		`SELECT 'a'`,
+		`SELECT a FROM t`,
+		`SELECT a AS b FROM t`,
+		`SELECT DISTINCT a FROM t`,
+		`SELECT DISTINCT ON (a) a, b FROM t`,
+		`SELECT a FROM t WHERE a > 1`,
+		`SELECT a FROM t WHERE a > 2`,
+		`SELECT a FROM t WHERE a > $1`,
+		`SELECT a FROM t WHERE a = ANY ARRAY[1, 2]`,
+		`SELECT a FROM t WHERE a = ALL ARRAY[1, 2]`,
+		`SELECT a FROM t WHERE NOT (a OR b) AND c`,
+		`SELECT a + b * c FROM t`,
+		`SELECT (a + b) * c FROM t`,
+		`SELECT -a, t.b, (1, b'x') FROM t`,
+		`SELECT a, count(*) FROM t GROUP BY a HAVING count(*) > 1`,
+		`SELECT a FROM t ORDER BY a LIMIT 10 OFFSET 5`,
+		`TABLE t`,
+		`VALUES (1, 2), (3, 4)`,
+		`SELECT a FROM t UNION SELECT a FROM u`,
+		`SELECT a FROM t UNION ALL SELECT a FROM u`,
+		`SELECT a FROM t INTERSECT SELECT a FROM u`,
+		`SELECT * FROM t JOIN u ON t.a = u.a`,
+		`SELECT * FROM t LEFT JOIN u ON t.a = u.a`,
+		`SELECT * FROM t JOIN u USING (a)`,
+		`SELECT * FROM t NATURAL JOIN u`,
+		`SELECT * FROM t INNER LOOKUP JOIN u ON t.a = u.a`,
+		`SELECT * FROM t, u`,
+		`SELECT * FROM t@idx`,
+		`SELECT * FROM t WITH ORDINALITY AS o (a, b)`,
+		`SELECT * FROM t AS OF SYSTEM TIME '-1s'`,
+		`SELECT * FROM (SELECT a FROM t) AS v`,
+		`SELECT * FROM t WHERE a IN (SELECT a FROM u)`,
+		`SELECT * FROM t WHERE EXISTS (SELECT 1 FROM u WHERE u.a = t.a)`,
+		`SELECT (SELECT max(a) FROM u) FROM t`,
+		`SELECT rank() OVER (PARTITION BY a ORDER BY b) FROM t`,
+		`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY a ORDER BY b)`,
+		`SELECT sum(a) OVER (ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) FROM t`,
+		`WITH v AS (SELECT a FROM t) SELECT * FROM v`,
+		`WITH v AS MATERIALIZED (SELECT a FROM t) SELECT * FROM v`,
+	}
+	hashes := make(map[uint64]string, len(queries))
+	for _, sql := range queries {
+		t.Run(sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := stmt.AST.(*tree.Select)
+			h := s.Hash()
+			if h != s.Hash() {
+				t.Fatal("hash is not deterministic")
+			}
+			if other, ok := hashes[h]; ok {
+				t.Fatalf("hash collides with that of %s", other)
+			}
+			hashes[h] = sql
+
+			parenStmt, err := parser.ParseOne(`((` + sql + `))`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paren := parenStmt.AST.(*tree.Select)
+			if eq, sameHash := s.Equal(paren), paren.Hash() == h; eq != sameHash {
+				t.Fatalf("expected equal hashes to be %t with parentheses, got %t", eq, sameHash)
+			}
+		})
+	}
+}
+
+// TestSelectHashEqualExprs verifies that statements whose expressions are
+// built from different nodes but are Equal have the same hash.
+func TestSelectHashEqualExprs(t *testing.T) {
+	const sql = `SELECT a FROM t WHERE a > 1`
+	parse := func(t *testing.T) (*tree.Select, *tree.SelectClause) {
+		stmt, err := parser.ParseOne(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := stmt.AST.(*tree.Select)
+		return s, s.Select.(*tree.SelectClause)
+	}
+	a, _ := parse(t)
+	b, clause := parse(t)
+	// Replace the unresolved names produced by the parser with the column
+	// items they resolve to, which format the same.
+	clause.Exprs[0].Expr = &tree.ColumnItem{ColumnName: "a"}
+	clause.Where.Expr.(*tree.ComparisonExpr).Left = &tree.ColumnItem{ColumnName: "a"}
+	if !a.Equal(b) {
+		t.Fatalf("expected %s to equal %s", tree.AsString(a), tree.AsString(b))
+	}
+	if a.Hash() != b.Hash() {
+		t.Fatalf("expected %s to hash like %s", tree.AsString(a), tree.AsString(b))
+	}
+}
+
+func BenchmarkSelectHash(b *testing.B) {
+	queries := []string{
+		`SELECT a, b FROM t WHERE a > 1 AND b = 'foo'`,
+		`SELECT a, count(*) FROM t JOIN u ON t.a = u.a GROUP BY a HAVING count(*) > $1`,
+		`SELECT * FROM t WHERE a IN (SELECT a FROM u WHERE u.b = t.b) ORDER BY a LIMIT 10`,
+	}
+	for _, sql := range queries {
+		stmt, err := parser.ParseOne(sql)
+		if err != nil {
+			b.Fatal(err)
+		}
+		s := stmt.AST.(*tree.Select)
+		b.Run(sql, func(b *testing.B) {
+			b.Run("Hash", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_ = s.Hash()
+				}
+			})
+			b.Run("AsString", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_ = tree.AsString(s)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,778 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+)
+
+func TestSelectClauseHasWindowFunctions(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected bool
+	}{
+		// WINDOW clause only.
+		{`SELECT a FROM t WINDOW w AS (PARTITION BY b)`, true},
+		// Inline OVER only.
+		{`SELECT a, rank() OVER (ORDER BY b) FROM t`, true},
+		{`SELECT (avg(a) OVER w) FROM t`, true},
+		// Neither.
+		{`SELECT a, count(*) FROM t GROUP BY a`, false},
+		{`SELECT 1`, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel, ok := stmt.AST.(*tree.Select).Select.(*tree.SelectClause)
+			if !ok {
+				t.Fatalf("%s does not parse to a tree.SelectClause", tc.sql)
+			}
+			if res := sel.HasWindowFunctions(); res != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestSelectClauseIntoFormat(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected string
+	}{
+		{`SELECT a, b INTO u FROM t WHERE a > 1`, ``},
+		{`SELECT DISTINCT a INTO TEMP u FROM t`, ``},
+		{`SELECT 1 INTO UNLOGGED u`, ``},
+		{`SELECT a INTO TEMPORARY TABLE db.u FROM t`, `SELECT a INTO TEMP db.u FROM t`},
+		{`SELECT a INTO TABLE u FROM t UNION SELECT b FROM v`, `SELECT a INTO u FROM t UNION SELECT b FROM v`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := tc.expected
+			if expected == "" {
+				expected = tc.sql
+			}
+			if res := tree.AsString(stmt.AST); res != expected {
+				t.Fatalf("expected %s, got %s", expected, res)
+			}
+		})
+	}
+
+	// Without an INTO clause the statement formats unchanged.
+	const sql = `SELECT a, b FROM t WHERE a > 1`
+	stmt, err := parser.ParseOne(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.AST.(*tree.Select).Select.(*tree.SelectClause).Into != nil {
+		t.Fatal("unexpected INTO clause")
+	}
+	if res := tree.AsString(stmt.AST); res != sql {
+		t.Fatalf("expected %s, got %s", sql, res)
+	}
+}
+
+func TestSelectValidateInto(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected string
+	}{
+		{`SELECT a INTO v FROM t`, ``},
+		{`SELECT DISTINCT ON (a) a INTO v FROM t`, `INTO is not allowed with DISTINCT ON`},
+		{`SELECT a INTO v FROM t UNION SELECT b FROM u`, ``},
+		{`SELECT a FROM t UNION SELECT b INTO v FROM u`,
+			`INTO is only allowed on first SELECT of UNION/INTERSECT/EXCEPT`},
+		{`(SELECT a INTO v FROM t) EXCEPT SELECT b FROM u`, ``},
+		{`SELECT a FROM t INTERSECT (SELECT b INTO v FROM u)`,
+			`INTO is only allowed on first SELECT of UNION/INTERSECT/EXCEPT`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			// The parser validates the placement of INTO clauses.
+			_, err := parser.ParseOne(tc.sql)
+			if tc.expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !testutils.IsError(err, tc.expected) {
+				t.Fatalf("expected error %q, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	// TABLE can't be written with an INTO clause, but an AST built
+	// programmatically is checked as well.
+	stmt, err := parser.ParseOne(`TABLE t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := stmt.AST.(*tree.Select)
+	sel.Select.(*tree.SelectClause).Into = &tree.IntoClause{Table: tree.MakeUnqualifiedTableName("v")}
+	if err := sel.ValidateInto(); !testutils.IsError(err, `INTO is not allowed with TABLE`) {
+		t.Fatalf("expected TABLE error, got %v", err)
+	}
+}
+
+func TestSelectValidateTableSelect(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		mutate   func(*tree.SelectClause)
+		expected string
+	}{
+		{`TABLE t`, nil, ``},
+		{`TABLE t ORDER BY a LIMIT 5`, nil, ``},
+		{`(TABLE t ORDER BY a) UNION TABLE u LIMIT 5`, nil, ``},
+		{`SELECT a FROM t WHERE a > 1`, nil, ``},
+		{`TABLE t`, func(s *tree.SelectClause) {
+			s.Where = tree.NewWhere(tree.AstWhere, tree.DBoolTrue)
+		}, `WHERE is not allowed with TABLE`},
+		{`TABLE t`, func(s *tree.SelectClause) {
+			s.GroupBy = tree.GroupBy{tree.NewDInt(1)}
+		}, `GROUP BY is not allowed with TABLE`},
+		{`TABLE t`, func(s *tree.SelectClause) {
+			s.Distinct = true
+		}, `DISTINCT is not allowed with TABLE`},
+		{`TABLE t`, func(s *tree.SelectClause) {
+			s.From = nil
+		}, `TABLE clause must select exactly one table`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select)
+			if tc.mutate == nil {
+				// Valid statements round-trip through formatting, including
+				// the ORDER BY and LIMIT clauses of the outer Select.
+				if res := tree.AsString(sel); res != tc.sql {
+					t.Fatalf("expected %s, got %s", tc.sql, res)
+				}
+			} else {
+				tc.mutate(sel.Select.(*tree.SelectClause))
+			}
+
+			err = sel.ValidateTableSelect()
+			if tc.expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !testutils.IsError(err, tc.expected) {
+				t.Fatalf("expected error %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestWindowFrameValidate(t *testing.T) {
+	bound := func(typ tree.WindowFrameBoundType) *tree.WindowFrameBound {
+		b := &tree.WindowFrameBound{BoundType: typ}
+		if b.HasOffset() {
+			b.OffsetExpr = tree.NewDInt(1)
+		}
+		return b
+	}
+	testCases := []struct {
+		mode       tree.WindowFrameMode
+		start, end *tree.WindowFrameBound
+		code       string
+		expected   string
+	}{
+		{tree.ROWS, bound(tree.UnboundedPreceding), nil, "", ""},
+		{tree.RANGE, bound(tree.OffsetPreceding), bound(tree.OffsetFollowing), "", ""},
+		{tree.GROUPS, bound(tree.CurrentRow), bound(tree.UnboundedFollowing), "", ""},
+		{tree.ROWS, bound(tree.OffsetFollowing), bound(tree.OffsetFollowing), "", ""},
+		{
+			tree.ROWS, bound(tree.UnboundedFollowing), nil,
+			pgerror.CodeWindowingError, "frame start cannot be UNBOUNDED FOLLOWING",
+		},
+		{
+			tree.ROWS, bound(tree.UnboundedFollowing), bound(tree.UnboundedFollowing),
+			pgerror.CodeWindowingError, "frame start cannot be UNBOUNDED FOLLOWING",
+		},
+		{
+			tree.ROWS, bound(tree.OffsetFollowing), nil,
+			pgerror.CodeWindowingError, "frame starting from following row cannot end with current row",
+		},
+		{
+			tree.ROWS, bound(tree.UnboundedPreceding), bound(tree.UnboundedPreceding),
+			pgerror.CodeWindowingError, "frame end cannot be UNBOUNDED PRECEDING",
+		},
+		{
+			tree.RANGE, bound(tree.CurrentRow), bound(tree.OffsetPreceding),
+			pgerror.CodeWindowingError, "frame starting from current row cannot have preceding rows",
+		},
+		{
+			tree.GROUPS, bound(tree.OffsetFollowing), bound(tree.CurrentRow),
+			pgerror.CodeWindowingError, "frame starting from following row cannot have preceding rows",
+		},
+		{
+			tree.ROWS, &tree.WindowFrameBound{BoundType: tree.OffsetPreceding}, nil,
+			pgerror.CodeSyntaxError, "frame offset bound must have an offset",
+		},
+		{
+			tree.ROWS, bound(tree.CurrentRow), &tree.WindowFrameBound{BoundType: tree.OffsetFollowing},
+			pgerror.CodeSyntaxError, "frame offset bound must have an offset",
+		},
+		{
+			tree.ROWS, nil, nil,
+			pgerror.CodeInternalError, "window frame without a start bound",
+		},
+		{
+			tree.WindowFrameMode(42), bound(tree.CurrentRow), nil,
+			pgerror.CodeInternalError, "unhandled window frame mode",
+		},
+	}
+	for _, tc := range testCases {
+		frame := &tree.WindowFrame{
+			Mode:   tc.mode,
+			Bounds: tree.WindowFrameBounds{StartBound: tc.start, EndBound: tc.end},
+		}
+		err := frame.Validate()
+		if tc.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tree.AsString(frame), err)
+			}
+			continue
+		}
+		if !testutils.IsError(err, tc.expected) {
+			t.Errorf("expected error %q, got %v", tc.expected, err)
+		} else if code, _ := pgerror.GetPGCode(err); code != tc.code {
+			t.Errorf("%q: expected code %s, got %s", tc.expected, tc.code, code)
+		}
+	}
+
+	// Frames produced by the parser are valid.
+	stmt, err := parser.ParseOne(
+		`SELECT sum(a) OVER (ORDER BY a ROWS BETWEEN 1 PRECEDING AND UNBOUNDED FOLLOWING) FROM t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr := stmt.AST.(*tree.Select).Select.(*tree.SelectClause).Exprs[0].Expr
+	if err := expr.(*tree.FuncExpr).WindowDef.Frame.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexFlagsCheckIndexColumns(t *testing.T) {
+	testCases := []struct {
+		flags      string
+		numKeyCols int
+		expected   string
+	}{
+		{`@{FORCE_INDEX=idx,DESC}`, 1, ``},
+		{`@{FORCE_INDEX=idx,ASC,DESC}`, 2, ``},
+		{`@{FORCE_INDEX=idx,ASC,DESC}`, 3, ``},
+		{`@{FORCE_INDEX=idx,ASC,DESC,ASC}`, 2,
+			`ASC/DESC specified for 3 columns, but the index has 2 key columns`},
+	}
+	for _, tc := range testCases {
+		stmt, err := parser.ParseOne(`SELECT * FROM t` + tc.flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from := stmt.AST.(*tree.Select).Select.(*tree.SelectClause).From
+		flags := from.Tables[0].(*tree.AliasedTableExpr).IndexFlags
+		err = flags.CheckIndexColumns(tc.numKeyCols)
+		if tc.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.flags, err)
+			}
+		} else if !testutils.IsError(err, tc.expected) {
+			t.Errorf("%s: expected error %q, got %v", tc.flags, tc.expected, err)
+		}
+	}
+}
+
+func TestAliasedTableExprAsOf(t *testing.T) {
+	testCases := []struct {
+		sql string
+		// tableAsOf and stmtAsOf indicate whether the parsed statement has an AS
+		// OF SYSTEM TIME clause on the first table of the join and on the
+		// statement, respectively.
+		tableAsOf   bool
+		stmtAsOf    bool
+		expectedErr string
+	}{
+		{
+			sql:       `SELECT * FROM t1 AS OF SYSTEM TIME '-10s' JOIN t2 ON t1.a = t2.a`,
+			tableAsOf: true,
+		},
+		{
+			sql:       `SELECT * FROM t1@idx AS OF SYSTEM TIME '-10s' AS x JOIN t2 USING (a)`,
+			tableAsOf: true,
+		},
+		{
+			// An AS OF SYSTEM TIME clause that ends the FROM clause applies to the
+			// statement.
+			sql:      `SELECT * FROM t1 CROSS JOIN t2 AS OF SYSTEM TIME '-10s'`,
+			stmtAsOf: true,
+		},
+		{
+			sql:         `SELECT * FROM (t1 AS OF SYSTEM TIME '-10s' JOIN t2 USING (a)) AS OF SYSTEM TIME '-20s'`,
+			expectedErr: `AS OF SYSTEM TIME cannot be specified both on a table and on the statement`,
+		},
+		{
+			sql:         `SELECT * FROM t1 AS OF SYSTEM TIME '-10s' AS x AS OF SYSTEM TIME '-20s'`,
+			expectedErr: `AS OF SYSTEM TIME cannot be specified both on a table and on the statement`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if tc.expectedErr != "" {
+				if !testutils.IsError(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(stmt.AST); res != tc.sql {
+				t.Fatalf("expected %s, got %s", tc.sql, res)
+			}
+			sel := stmt.AST.(*tree.Select).Select.(*tree.SelectClause)
+			left := sel.From.Tables[0].(*tree.JoinTableExpr).Left.(*tree.AliasedTableExpr)
+			if hasAsOf := left.AsOf != nil; hasAsOf != tc.tableAsOf {
+				t.Errorf("expected table AS OF %t, got %t", tc.tableAsOf, hasAsOf)
+			}
+			if hasAsOf := sel.From.AsOf.Expr != nil; hasAsOf != tc.stmtAsOf {
+				t.Errorf("expected statement AS OF %t, got %t", tc.stmtAsOf, hasAsOf)
+			}
+			if err := sel.From.ValidateAsOf(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSelectFreezeAsOf(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	testCases := []struct {
+		sql         string
+		expected    string
+		expectedErr string
+	}{
+		// Relative intervals are replaced by the timestamp they denote.
+		{
+			sql:      `SELECT * FROM t AS OF SYSTEM TIME '-10s'`,
+			expected: `SELECT * FROM t AS OF SYSTEM TIME '2019-03-01 11:59:50.123456789'`,
+		},
+		{
+			sql:      `SELECT * FROM t AS OF SYSTEM TIME INTERVAL '-1m'`,
+			expected: `SELECT * FROM t AS OF SYSTEM TIME '2019-03-01 11:59:00.123456789'`,
+		},
+		{
+			sql:      `(SELECT a FROM t AS OF SYSTEM TIME '-1h')`,
+			expected: `(SELECT a FROM t AS OF SYSTEM TIME '2019-03-01 11:00:00.123456789')`,
+		},
+		// Absolute timestamps are left untouched.
+		{
+			sql:      `SELECT * FROM t AS OF SYSTEM TIME '2019-01-01 00:00:00'`,
+			expected: `SELECT * FROM t AS OF SYSTEM TIME '2019-01-01 00:00:00'`,
+		},
+		{
+			sql:      `SELECT * FROM t AS OF SYSTEM TIME '1551441600000000000.0000000001'`,
+			expected: `SELECT * FROM t AS OF SYSTEM TIME '1551441600000000000.0000000001'`,
+		},
+		{
+			sql:      `SELECT * FROM t AS OF SYSTEM TIME 1551441600000000000`,
+			expected: `SELECT * FROM t AS OF SYSTEM TIME 1551441600000000000`,
+		},
+		// Without an AS OF clause there is nothing to do.
+		{
+			sql:      `SELECT * FROM t`,
+			expected: `SELECT * FROM t`,
+		},
+		// Unsupported expressions.
+		{
+			sql:         `SELECT * FROM t AS OF SYSTEM TIME experimental_follower_read_timestamp()`,
+			expectedErr: `AS OF SYSTEM TIME: cannot freeze expression experimental_follower_read_timestamp\(\)`,
+		},
+		{
+			sql:         `SELECT * FROM t AS OF SYSTEM TIME 'garbage'`,
+			expectedErr: `AS OF SYSTEM TIME: value is neither timestamp, decimal, nor interval`,
+		},
+		{
+			sql:         `SELECT * FROM t AS OF SYSTEM TIME '0s'`,
+			expectedErr: `AS OF SYSTEM TIME: interval value .* too small`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select)
+			err = sel.FreezeAsOf(now)
+			if tc.expectedErr != "" {
+				if !testutils.IsError(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := tree.AsString(sel)
+			if res != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, res)
+			}
+			// The frozen statement round-trips and is frozen already.
+			stmt, err = parser.ParseOne(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel = stmt.AST.(*tree.Select)
+			if err := sel.FreezeAsOf(now.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if res2 := tree.AsString(sel); res2 != res {
+				t.Fatalf("expected %s, got %s", res, res2)
+			}
+		})
+	}
+}
+
+func TestAsOfClauseFormatRoundTrip(t *testing.T) {
+	ts := time.Date(2019, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	semaCtx := tree.MakeSemaContext()
+	evalCtx := tree.NewTestingEvalContext(cluster.MakeTestingClusterSettings())
+	defer evalCtx.Mon.Stop(context.Background())
+
+	// evalFormatted formats the AS OF clause of sel, re-parses it and
+	// evaluates the timestamp of the re-parsed clause.
+	evalFormatted := func(t *testing.T, sel *tree.Select) int64 {
+		t.Helper()
+		stmt, err := parser.ParseOne(tree.AsString(sel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		from := stmt.AST.(*tree.Select).Select.(*tree.SelectClause).From
+		res, err := tree.EvalAsOfTimestamp(from.AsOf, &semaCtx, evalCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.WallTime
+	}
+
+	for _, d := range []tree.Expr{
+		tree.MakeDTimestamp(ts, time.Nanosecond),
+		tree.MakeDTimestampTZ(ts, time.Nanosecond),
+		tree.MakeDTimestampTZ(ts.In(time.FixedZone("", 5*60*60)), time.Nanosecond),
+	} {
+		t.Run(tree.AsString(d), func(t *testing.T) {
+			stmt, err := parser.ParseOne(`SELECT * FROM t`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select)
+			sel.Select.(*tree.SelectClause).From.AsOf.Expr = d
+			if res := evalFormatted(t, sel); res != ts.UnixNano() {
+				t.Fatalf("expected %d, got %d", ts.UnixNano(), res)
+			}
+		})
+	}
+
+	// Frozen relative timestamps keep their nanoseconds as well.
+	t.Run("frozen", func(t *testing.T) {
+		stmt, err := parser.ParseOne(`SELECT * FROM t AS OF SYSTEM TIME '-10s'`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sel := stmt.AST.(*tree.Select)
+		if err := sel.FreezeAsOf(ts); err != nil {
+			t.Fatal(err)
+		}
+		expected := ts.Add(-10 * time.Second).UnixNano()
+		if res := evalFormatted(t, sel); res != expected {
+			t.Fatalf("expected %d, got %d", expected, res)
+		}
+	})
+}
+
+func TestSelectReferencedColumns(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected []string
+	}{
+		{`SELECT 1`, nil},
+		{`SELECT a, t.b FROM t WHERE c > 1 GROUP BY d HAVING count(e) > 1 ORDER BY f LIMIT g`,
+			[]string{`a`, `c`, `d`, `e`, `f`, `g`, `t.b`}},
+		// Columns that only appear in ORDER BY or in a window definition.
+		{`SELECT 1 FROM t ORDER BY x`, []string{`x`}},
+		{`SELECT rank() OVER (PARTITION BY p ORDER BY o) FROM t`, []string{`o`, `p`}},
+		{`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY q)`, []string{`q`}},
+		// Join conditions.
+		{`SELECT * FROM t1 JOIN t2 ON t1.a = t2.b JOIN t3 USING (c)`, []string{`c`, `t1.a`, `t2.b`}},
+		// Duplicates are removed and stars are ignored.
+		{`SELECT a, a, t.*, t.a FROM t WHERE a = t.a`, []string{`a`, `t.a`}},
+		// Subqueries, set operations and common table expressions.
+		{`WITH w AS (SELECT x FROM u) SELECT y FROM t WHERE z IN (SELECT v FROM s) UNION SELECT k FROM r`,
+			[]string{`k`, `v`, `x`, `y`, `z`}},
+		{`SELECT * FROM (SELECT a FROM t) AS s WHERE EXISTS (SELECT b FROM u)`, []string{`a`, `b`}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cols := stmt.AST.(*tree.Select).ReferencedColumns()
+			var res []string
+			for i := range cols {
+				res = append(res, tree.AsString(&cols[i]))
+			}
+			if !reflect.DeepEqual(res, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, res)
+			}
+		})
+	}
+}
+
+// TestValuesTableSource verifies that a VALUES list used as a FROM item with
+// a column alias list round-trips through formatting.
+func TestValuesTableSource(t *testing.T) {
+	testCases := []string{
+		`SELECT * FROM (VALUES (1, 'a'), (2, 'b')) AS t (id, name)`,
+		`SELECT id FROM (VALUES (1, 'a')) AS t (id, name) WHERE name = 'a'`,
+		`SELECT * FROM (VALUES (1)) WITH ORDINALITY AS t (x, ord)`,
+		`SELECT * FROM LATERAL (VALUES (u.a, u.b)) AS t (a, b)`,
+		`SELECT * FROM (VALUES (1, 2)) AS t`,
+	}
+	for _, sql := range testCases {
+		t.Run(sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select).Select.(*tree.SelectClause)
+			source := sel.From.Tables[0].(*tree.AliasedTableExpr)
+			paren, ok := source.Expr.(*tree.Subquery).Select.(*tree.ParenSelect)
+			if !ok {
+				t.Fatalf("expected a ParenSelect, got %T", source.Expr.(*tree.Subquery).Select)
+			}
+			if _, ok := paren.Select.Select.(*tree.ValuesClause); !ok {
+				t.Fatalf("expected a ValuesClause, got %T", paren.Select.Select)
+			}
+
+			if res := tree.AsString(stmt.AST); res != sql {
+				t.Fatalf("expected %s, got %s", sql, res)
+			}
+			// The pretty-printed statement must parse back to the same AST.
+			reparsed, err := parser.ParseOne(tree.Pretty(stmt.AST))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(reparsed.AST); res != sql {
+				t.Fatalf("expected %s, got %s", sql, res)
+			}
+		})
+	}
+
+	// The column list is formatted for a manually constructed AST as well.
+	source := &tree.AliasedTableExpr{
+		Expr: &tree.Subquery{Select: &tree.ParenSelect{Select: &tree.Select{
+			Select: &tree.ValuesClause{Rows: []tree.Exprs{
+				{tree.NewDInt(1), tree.NewStrVal("a")},
+			}},
+		}}},
+		As: tree.AliasClause{Alias: "t", Cols: tree.NameList{"id", "name"}},
+	}
+	const expected = `(VALUES (1, 'a')) AS t (id, name)`
+	if res := tree.AsString(source); res != expected {
+		t.Fatalf("expected %s, got %s", expected, res)
+	}
+}
+
+func TestLockingClause(t *testing.T) {
+	testCases := []struct {
+		sql         string
+		expectedErr string
+	}{
+		{sql: `SELECT * FROM t FOR UPDATE OF t NOWAIT`},
+		{sql: `SELECT * FROM t FOR SHARE SKIP LOCKED`},
+		{sql: `SELECT * FROM t, u LIMIT 1 FOR KEY SHARE OF t FOR NO KEY UPDATE OF u SKIP LOCKED`},
+		{sql: `SELECT DISTINCT a FROM t FOR UPDATE NOWAIT`},
+		{
+			sql:         `SELECT * FROM t FOR UPDATE OF t NOWAIT FOR SHARE OF t SKIP LOCKED`,
+			expectedErr: `conflicting wait policies NOWAIT and SKIP LOCKED for table t`,
+		},
+		{
+			sql:         `SELECT DISTINCT a FROM t FOR UPDATE SKIP LOCKED`,
+			expectedErr: `SKIP LOCKED is not allowed with DISTINCT clause`,
+		},
+		{
+			sql:         `SELECT a, count(*) FROM t GROUP BY a FOR UPDATE SKIP LOCKED`,
+			expectedErr: `SKIP LOCKED is not allowed with GROUP BY clause`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if tc.expectedErr != "" {
+				if !testutils.IsError(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(stmt.AST); res != tc.sql {
+				t.Fatalf("expected %s, got %s", tc.sql, res)
+			}
+		})
+	}
+
+	// A locking clause that is built programmatically is checked as well.
+	stmt, err := parser.ParseOne(`SELECT DISTINCT a FROM t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := stmt.AST.(*tree.Select)
+	sel.Locking = tree.LockingClause{{WaitPolicy: tree.LockWaitError}}
+	if err := sel.Locking.Check(sel.Select); !testutils.IsError(err, `locking clause requires a lock strength`) {
+		t.Fatalf("expected lock strength error, got %v", err)
+	}
+}
+
+func TestOrderResolveOrdinal(t *testing.T) {
+	testCases := []struct {
+		sql         string
+		expected    string
+		expectedErr string
+	}{
+		{sql: `SELECT a, b + 1 FROM t ORDER BY 2`, expected: `b + 1`},
+		{sql: `SELECT a, b FROM t ORDER BY 1 DESC`, expected: `a`},
+		{sql: `SELECT a, b FROM t ORDER BY c`, expected: `c`},
+		{sql: `SELECT a, b FROM t ORDER BY a + 1`, expected: `a + 1`},
+		{sql: `SELECT a, b FROM t ORDER BY 3`, expectedErr: `ORDER BY position 3 is not in select list`},
+		{sql: `SELECT a, b FROM t ORDER BY 0`, expectedErr: `ORDER BY position 0 is not in select list`},
+		{sql: `SELECT a, b FROM t ORDER BY 1.5`, expectedErr: `non-integer constant in ORDER BY: 1.5`},
+		{sql: `SELECT a, b FROM t ORDER BY 'a'`, expectedErr: `non-integer constant in ORDER BY: 'a'`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select)
+			selectExprs := sel.Select.(*tree.SelectClause).Exprs
+			expr, err := sel.OrderBy[0].ResolveOrdinal(selectExprs)
+			if tc.expectedErr != "" {
+				if !testutils.IsError(err, tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(expr); res != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, res)
+			}
+		})
+	}
+
+	// Orderings by index have no expression.
+	o := tree.Order{OrderType: tree.OrderByIndex, Table: tree.MakeUnqualifiedTableName("t")}
+	if expr, err := o.ResolveOrdinal(nil); expr != nil || err != nil {
+		t.Fatalf("expected no expression and no error, got %v, %v", expr, err)
+	}
+}
+
+func TestSelectClauseValidateWindowReferences(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		code     string
+		expected string
+	}{
+		{`SELECT rank() OVER (ORDER BY a) FROM t`, "", ""},
+		{`SELECT rank() OVER w FROM t WINDOW w AS (PARTITION BY a)`, "", ""},
+		{`SELECT rank() OVER (w ORDER BY b) FROM t WINDOW w AS (PARTITION BY a)`, "", ""},
+		{`SELECT rank() OVER w2 FROM t WINDOW w AS (PARTITION BY a), w2 AS (w ORDER BY b)`, "", ""},
+		{`SELECT (SELECT rank() OVER v FROM u) FROM t`, "", ""},
+		{
+			`SELECT rank() OVER v FROM t WINDOW w AS (PARTITION BY a)`,
+			pgerror.CodeUndefinedObjectError, `window "v" does not exist`,
+		},
+		{
+			`SELECT 1 + rank() OVER (v ORDER BY b) FROM t`,
+			pgerror.CodeUndefinedObjectError, `window "v" does not exist`,
+		},
+		{
+			`SELECT 1 FROM t WINDOW w2 AS (w), w AS (PARTITION BY a)`,
+			pgerror.CodeUndefinedObjectError, `window "w" does not exist`,
+		},
+		{
+			`SELECT 1 FROM t WINDOW w AS (PARTITION BY a), w AS (PARTITION BY b)`,
+			pgerror.CodeWindowingError, `window "w" is already defined`,
+		},
+		{
+			`SELECT rank() OVER (w PARTITION BY b) FROM t WINDOW w AS (ORDER BY a)`,
+			pgerror.CodeWindowingError, `cannot override PARTITION BY clause of window "w"`,
+		},
+		{
+			`SELECT rank() OVER (w ORDER BY b) FROM t WINDOW w AS (ORDER BY a)`,
+			pgerror.CodeWindowingError, `cannot override ORDER BY clause of window "w"`,
+		},
+		{
+			`SELECT rank() OVER (w) FROM t WINDOW w AS (ROWS UNBOUNDED PRECEDING)`,
+			pgerror.CodeWindowingError, `cannot copy window "w" because it has a frame clause`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select).Select.(*tree.SelectClause)
+			err = sel.ValidateWindowReferences()
+			if tc.expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !testutils.IsError(err, tc.expected) {
+				t.Fatalf("expected error %q, got %v", tc.expected, err)
+			}
+			if code, _ := pgerror.GetPGCode(err); code != tc.code {
+				t.Fatalf("expected code %s, got %s", tc.code, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+// ColumnReferenceSet is a set of columns of an outer scope, identified by
+// their names and, optionally, the name of their table. It is used to detect
+// correlated subqueries before name resolution.
+type ColumnReferenceSet struct {
+	// qualified contains the columns that were added with a table name.
+	qualified map[columnReference]struct{}
+	// columns contains the names of all the columns.
+	columns map[Name]struct{}
+}
+
+type columnReference struct {
+	table, column Name
+}
+
+// Add adds a column to the set. The table name is optional.
+func (s *ColumnReferenceSet) Add(table, column Name) {
+	if s.columns == nil {
+		s.qualified = make(map[columnReference]struct{})
+		s.columns = make(map[Name]struct{})
+	}
+	if table != "" {
+		s.qualified[columnReference{table: table, column: column}] = struct{}{}
+	}
+	s.columns[column] = struct{}{}
+}
+
+// Empty returns true if the set contains no columns.
+func (s ColumnReferenceSet) Empty() bool {
+	return len(s.columns) == 0
+}
+
+// Contains returns true if a reference to the given column could resolve to
+// a column in the set. An unqualified reference (empty table name) matches
+// any column with the same name; a qualified reference only matches a column
+// that was added with the same table name.
+func (s ColumnReferenceSet) Contains(table, column Name) bool {
+	if table == "" {
+		_, ok := s.columns[column]
+		return ok
+	}
+	_, ok := s.qualified[columnReference{table: table, column: column}]
+	return ok
+}
+
+// containsVarName returns true if the given expression is a column reference
+// that could resolve to a column in the set.
+func (s ColumnReferenceSet) containsVarName(expr Expr) bool {
+	switch t := expr.(type) {
+	case *UnresolvedName:
+		if t.Star {
+			return false
+		}
+		var table Name
+		if t.NumParts > 1 {
+			table = Name(t.Parts[1])
+		}
+		return s.Contains(table, Name(t.Parts[0]))
+	case *ColumnItem:
+		var table Name
+		if t.TableName != nil {
+			table = Name(t.TableName.Parts[0])
+		}
+		return s.Contains(table, t.ColumnName)
+	}
+	return false
+}
+
+// HasCorrelatedSubquery returns true if any of the subqueries in the
+// statement, in the FROM clause or in any expression, references a column of
+// the given outer scope. References made in nested subqueries count as
+// references made by the enclosing subquery. References that are not inside
+// a subquery are ignored.
+//
+// Columns are matched by name, as described in ColumnReferenceSet.Contains.
+// Since the columns of the subqueries' own data sources are not known before
+// name resolution, a reference to a column of the subquery that has the same
+// name as an outer column is considered correlated; qualified names can be
+// used to avoid such false positives.
+func (node *Select) HasCorrelatedSubquery(outerCols ColumnReferenceSet) bool {
+	if outerCols.Empty() {
+		return false
+	}
+	found := false
+	visitSelectExprs(node, func(expr Expr) {
+		found = found || exprHasCorrelatedSubquery(expr, outerCols)
+	})
+	return found
+}
+
+// exprHasCorrelatedSubquery returns true if any subquery in the expression
+// references one of the given columns.
+func exprHasCorrelatedSubquery(expr Expr, outerCols ColumnReferenceSet) bool {
+	found := false
+	_, _ = SimpleVisit(expr, func(expr Expr) (bool, Expr, error) {
+		if sub, ok := expr.(*Subquery); ok {
+			found = found || selectReferencesColumns(sub.Select, outerCols)
+			return false, expr, nil
+		}
+		return !found, expr, nil
+	})
+	return found
+}
+
+// selectReferencesColumns returns true if the statement, or any subquery
+// nested in it, references one of the given columns.
+func selectReferencesColumns(stmt SelectStatement, cols ColumnReferenceSet) bool {
+	found := false
+	visitSelectExprs(stmt, func(expr Expr) {
+		found = found || exprReferencesColumns(expr, cols)
+	})
+	return found
+}
+
+// exprReferencesColumns returns true if the expression, or any subquery nested
+// in it, references one of the given columns.
+func exprReferencesColumns(expr Expr, cols ColumnReferenceSet) bool {
+	found := false
+	_, _ = SimpleVisit(expr, func(expr Expr) (bool, Expr, error) {
+		switch t := expr.(type) {
+		case *Subquery:
+			found = found || selectReferencesColumns(t.Select, cols)
+			return false, expr, nil
+		case *UnresolvedName, *ColumnItem:
+			found = found || cols.containsVarName(t)
+			return false, expr, nil
+		}
+		return !found, expr, nil
+	})
+	return found
+}
+
+// visitSelectExprs calls fn on each top-level expression of a SELECT
+// statement, including the expressions in its FROM and WITH clauses and in
+// the operands of set operations. Subqueries used as data sources are passed
+// to fn as expressions.
+func visitSelectExprs(stmt SelectStatement, fn func(Expr)) {
+	switch t := stmt.(type) {
+	case *Select:
+		if t == nil {
+			return
+		}
+		if t.With != nil {
+			for _, cte := range t.With.CTEList {
+				if sel, ok := cte.Stmt.(*Select); ok {
+					visitSelectExprs(sel, fn)
+				}
+			}
+		}
+		visitSelectExprs(t.Select, fn)
+		visitOrderByExprs(t.OrderBy, fn)
+		if t.Limit != nil {
+			visitExpr(t.Limit.Count, fn)
+			visitExpr(t.Limit.Offset, fn)
+		}
+
+	case *ParenSelect:
+		visitSelectExprs(t.Select, fn)
+
+	case *SelectClause:
+		for _, expr := range t.DistinctOn {
+			fn(expr)
+		}
+		for _, expr := range t.Exprs {
+			fn(expr.Expr)
+		}
+		if t.From != nil {
+			for _, table := range t.From.Tables {
+				visitTableExprExprs(table, fn)
+			}
+			visitExpr(t.From.AsOf.Expr, fn)
+		}
+		if t.Where != nil {
+			visitExpr(t.Where.Expr, fn)
+		}
+		for _, expr := range t.GroupBy {
+			fn(expr)
+		}
+		if t.Having != nil {
+			visitExpr(t.Having.Expr, fn)
+		}
+		for _, w := range t.Window {
+			for _, expr := range w.Partitions {
+				fn(expr)
+			}
+			visitOrderByExprs(w.OrderBy, fn)
+		}
+
+	case *UnionClause:
+		visitSelectExprs(t.Left, fn)
+		visitSelectExprs(t.Right, fn)
+
+	case *ValuesClause:
+		for _, row := range t.Rows {
+			for _, expr := range row {
+				fn(expr)
+			}
+		}
+	}
+}
+
+// visitTableExprExprs calls fn on each top-level expression of a data source.
+func visitTableExprExprs(table TableExpr, fn func(Expr)) {
+	switch t := table.(type) {
+	case *AliasedTableExpr:
+		if t.AsOf != nil {
+			visitExpr(t.AsOf.Expr, fn)
+		}
+		visitTableExprExprs(t.Expr, fn)
+	case *ParenTableExpr:
+		visitTableExprExprs(t.Expr, fn)
+	case *JoinTableExpr:
+		visitTableExprExprs(t.Left, fn)
+		visitTableExprExprs(t.Right, fn)
+		if on, ok := t.Cond.(*OnJoinCond); ok {
+			fn(on.Expr)
+		}
+	case *Subquery:
+		fn(t)
+	case *RowsFromExpr:
+		for _, expr := range t.Items {
+			fn(expr)
+		}
+	}
+}
+
+func visitOrderByExprs(orderBy OrderBy, fn func(Expr)) {
+	for _, o := range orderBy {
+		if o.OrderType == OrderByColumn {
+			fn(o.Expr)
+		}
+	}
+}
+
+func visitExpr(expr Expr, fn func(Expr)) {
+	if expr != nil {
+		fn(expr)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree_test
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+)
+
+func TestHasCorrelatedSubquery(t *testing.T) {
+	var outerCols tree.ColumnReferenceSet
+	outerCols.Add("t", "a")
+	outerCols.Add("t", "b")
+
+	testCases := []struct {
+		sql      string
+		expected bool
+	}{
+		// Uncorrelated subqueries.
+		{`SELECT t.a FROM t WHERE t.b > 1`, false},
+		{`SELECT * FROM t WHERE EXISTS (SELECT 1 FROM u WHERE u.x = 1)`, false},
+		{`SELECT * FROM t WHERE EXISTS (SELECT 1 FROM u WHERE u.a = 1)`, false},
+		{`SELECT * FROM t, (SELECT x FROM u) AS v`, false},
+		{`SELECT * FROM t JOIN (SELECT x FROM u) AS v ON v.x = t.a`, false},
+
+		// Correlated subqueries.
+		{`SELECT * FROM t WHERE EXISTS (SELECT 1 FROM u WHERE u.x = t.a)`, true},
+		{`SELECT a, (SELECT max(x) FROM u WHERE x < b) FROM t`, true},
+		{`SELECT * FROM t, LATERAL (SELECT x FROM u WHERE u.y = t.b) AS v`, true},
+		{`SELECT * FROM t WHERE a IN (SELECT x FROM u WHERE EXISTS (SELECT 1 FROM w WHERE w.z = t.b))`, true},
+		{`SELECT * FROM t ORDER BY (SELECT count(*) FROM u WHERE u.x = t.a)`, true},
+		{`SELECT a FROM t UNION SELECT x FROM u WHERE x = (SELECT max(t.b) FROM w)`, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select)
+			if res := sel.HasCorrelatedSubquery(outerCols); res != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, res)
+			}
+			if sel.HasCorrelatedSubquery(tree.ColumnReferenceSet{}) {
+				t.Fatal("expected no correlated subquery with no outer columns")
+			}
+		})
+	}
+}
@@ -55,9 +55,9 @@ type TableNamePrefix struct {
 
 // Format implements the NodeFormatter interface.
 func (tp *TableNamePrefix) Format(ctx *FmtCtx) {
-	alwaysFormat := ctx.alwaysFormatTablePrefix()
-	if tp.ExplicitSchema || alwaysFormat {
-		if tp.ExplicitCatalog || alwaysFormat {
+	formatCatalog, formatSchema := tp.formattedParts(ctx)
+	if formatSchema {
+		if formatCatalog {
 			ctx.FormatNode(&tp.CatalogName)
 			ctx.WriteByte('.')
 		}
@@ -65,6 +65,28 @@ func (tp *TableNamePrefix) Format(ctx *FmtCtx) {
 	}
 }
 
+// formattedParts returns whether the catalog and schema names are part of the
+// formatted prefix. The catalog name is only formatted along with the schema
+// name.
+func (tp *TableNamePrefix) formattedParts(ctx *FmtCtx) (catalog, schema bool) {
+	if ctx.alwaysFormatTablePrefix() {
+		return true, true
+	}
+	catalog, schema = tp.ExplicitCatalog, tp.ExplicitSchema
+	if ctx.HasFlags(FmtFullyQualifyNames) {
+		catalog = catalog || tp.CatalogName != ""
+		schema = schema || tp.SchemaName != ""
+	}
+	return catalog && schema, schema
+}
+
+// formatsSchema returns whether the prefix is formatted at all, in which case
+// it must be followed by a separator.
+func (tp *TableNamePrefix) formatsSchema(ctx *FmtCtx) bool {
+	_, schema := tp.formattedParts(ctx)
+	return schema
+}
+
 func (tp *TableNamePrefix) String() string { return AsString(tp) }
 
 // Schema retrieves the unqualified schema name.
@@ -90,7 +112,7 @@ func (t *TableName) Format(ctx *FmtCtx) {
 		return
 	}
 	t.TableNamePrefix.Format(ctx)
-	if t.ExplicitSchema || ctx.alwaysFormatTablePrefix() {
+	if t.formatsSchema(ctx) {
 		ctx.WriteByte('.')
 	}
 	ctx.FormatNode(&t.TableName)
@@ -254,7 +276,7 @@ func (n *TableIndexName) Format(ctx *FmtCtx) {
 	}
 
 	// The table is not specified. The schema/catalog can still be specified.
-	if n.Table.ExplicitSchema || ctx.alwaysFormatTablePrefix() {
+	if n.Table.formatsSchema(ctx) {
 		ctx.FormatNode(&n.Table.TableNamePrefix)
 		ctx.WriteByte('.')
 	}
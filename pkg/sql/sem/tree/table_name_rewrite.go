@@ -0,0 +1,211 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+// RewriteTableNames calls fn on every table name referenced by the select,
+// allowing fn to modify the names in place. This includes the tables in FROM
+// clauses (through joins, parentheses and aliases), the tables of index
+// orderings, the target of an INTO clause, the targets of a locking clause,
+// and the tables referenced by common table expressions and subqueries,
+// whether they appear in a FROM clause or in a scalar expression. The walk
+// stops at the first error returned by fn.
+//
+// Column references qualified by a table name are not rewritten, and neither
+// are the unqualified references to a common table expression in scope.
+func (node *Select) RewriteTableNames(fn func(*TableName) error) error {
+	r := tableNameRewriter{fn: fn}
+	r.rewriteSelect(node)
+	return r.err
+}
+
+// tableNameRewriter implements RewriteTableNames. It is also a Visitor, used
+// to find the subqueries nested in scalar expressions.
+type tableNameRewriter struct {
+	fn func(*TableName) error
+	// exprFn, if set, is called on every scalar expression visited, including
+	// the ones nested in subqueries. It is used by CollectPlaceholders.
+	exprFn func(Expr) error
+	// ctes contains the names of the common table expressions in scope.
+	ctes []Name
+	err  error
+}
+
+var _ Visitor = &tableNameRewriter{}
+
+// VisitPre is part of the Visitor interface.
+func (r *tableNameRewriter) VisitPre(expr Expr) (recurse bool, newExpr Expr) {
+	if r.err != nil {
+		return false, expr
+	}
+	if r.exprFn != nil {
+		if r.err = r.exprFn(expr); r.err != nil {
+			return false, expr
+		}
+	}
+	if sub, ok := expr.(*Subquery); ok {
+		r.rewriteSelectStatement(sub.Select)
+		return false, expr
+	}
+	return true, expr
+}
+
+// VisitPost is part of the Visitor interface.
+func (r *tableNameRewriter) VisitPost(expr Expr) Expr { return expr }
+
+func (r *tableNameRewriter) apply(tn *TableName) {
+	if r.err == nil && r.fn != nil {
+		r.err = r.fn(tn)
+	}
+}
+
+// isCTE returns whether the table name refers to a common table expression
+// in scope rather than to a table.
+func (r *tableNameRewriter) isCTE(tn *TableName) bool {
+	if tn.ExplicitSchema {
+		return false
+	}
+	for _, name := range r.ctes {
+		if name == tn.TableName {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *tableNameRewriter) rewriteExpr(expr Expr) {
+	if expr != nil && r.err == nil {
+		WalkExprConst(r, expr)
+	}
+}
+
+func (r *tableNameRewriter) rewriteExprs(exprs []Expr) {
+	for _, expr := range exprs {
+		r.rewriteExpr(expr)
+	}
+}
+
+func (r *tableNameRewriter) rewriteStatement(stmt Statement) {
+	switch s := stmt.(type) {
+	case *Select:
+		r.rewriteSelect(s)
+	case SelectStatement:
+		r.rewriteSelectStatement(s)
+	}
+}
+
+func (r *tableNameRewriter) rewriteSelect(node *Select) {
+	if node == nil {
+		return
+	}
+	if node.With != nil {
+		// Each common table expression is visible to the ones that follow it
+		// and to the rest of the statement.
+		defer func(n int) { r.ctes = r.ctes[:n] }(len(r.ctes))
+		for _, cte := range node.With.CTEList {
+			r.rewriteStatement(cte.Stmt)
+			r.ctes = append(r.ctes, cte.Name.Alias)
+		}
+	}
+	r.rewriteSelectStatement(node.Select)
+	r.rewriteOrderBy(node.OrderBy)
+	if node.Limit != nil {
+		r.rewriteExpr(node.Limit.Count)
+		r.rewriteExpr(node.Limit.Offset)
+	}
+	for _, item := range node.Locking {
+		for i := range item.Targets {
+			if !r.isCTE(&item.Targets[i]) {
+				r.apply(&item.Targets[i])
+			}
+		}
+	}
+}
+
+func (r *tableNameRewriter) rewriteSelectStatement(stmt SelectStatement) {
+	switch s := stmt.(type) {
+	case *ParenSelect:
+		r.rewriteSelect(s.Select)
+	case *UnionClause:
+		r.rewriteSelect(s.Left)
+		r.rewriteSelect(s.Right)
+	case *ValuesClause:
+		for _, row := range s.Rows {
+			r.rewriteExprs(row)
+		}
+	case *SelectClause:
+		r.rewriteExprs(s.DistinctOn)
+		for _, expr := range s.Exprs {
+			r.rewriteExpr(expr.Expr)
+		}
+		if s.Into != nil {
+			r.apply(&s.Into.Table)
+		}
+		if s.From != nil {
+			for _, t := range s.From.Tables {
+				r.rewriteTableExpr(t)
+			}
+			r.rewriteExpr(s.From.AsOf.Expr)
+		}
+		if s.Where != nil {
+			r.rewriteExpr(s.Where.Expr)
+		}
+		r.rewriteExprs(s.GroupBy)
+		if s.Having != nil {
+			r.rewriteExpr(s.Having.Expr)
+		}
+		for _, w := range s.Window {
+			r.rewriteExprs(w.Partitions)
+			r.rewriteOrderBy(w.OrderBy)
+		}
+	}
+}
+
+func (r *tableNameRewriter) rewriteTableExpr(expr TableExpr) {
+	switch t := expr.(type) {
+	case *TableName:
+		if !r.isCTE(t) {
+			r.apply(t)
+		}
+	case *AliasedTableExpr:
+		r.rewriteTableExpr(t.Expr)
+		if t.AsOf != nil {
+			r.rewriteExpr(t.AsOf.Expr)
+		}
+	case *ParenTableExpr:
+		r.rewriteTableExpr(t.Expr)
+	case *JoinTableExpr:
+		r.rewriteTableExpr(t.Left)
+		r.rewriteTableExpr(t.Right)
+		if on, ok := t.Cond.(*OnJoinCond); ok {
+			r.rewriteExpr(on.Expr)
+		}
+	case *Subquery:
+		r.rewriteSelectStatement(t.Select)
+	case *StatementSource:
+		r.rewriteStatement(t.Statement)
+	case *RowsFromExpr:
+		r.rewriteExprs(t.Items)
+	}
+}
+
+func (r *tableNameRewriter) rewriteOrderBy(orderBy OrderBy) {
+	for _, o := range orderBy {
+		if o.OrderType == OrderByIndex {
+			r.apply(&o.Table)
+		} else {
+			r.rewriteExpr(o.Expr)
+		}
+	}
+}
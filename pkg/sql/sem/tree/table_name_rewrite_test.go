@@ -0,0 +1,124 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+)
+
+func TestSelectRewriteTableNames(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected string
+	}{
+		{`SELECT a FROM t`, `SELECT a FROM tenant.t`},
+		{`SELECT a FROM t AS x, (u)`, `SELECT a FROM tenant.t AS x, (tenant.u)`},
+		{`SELECT * FROM t JOIN u ON t.a = (SELECT max(b) FROM v)`,
+			`SELECT * FROM tenant.t JOIN tenant.u ON t.a = (SELECT max(b) FROM tenant.v)`},
+		{`SELECT * FROM (SELECT a FROM t) AS s WHERE EXISTS (SELECT 1 FROM u)`,
+			`SELECT * FROM (SELECT a FROM tenant.t) AS s WHERE EXISTS (SELECT 1 FROM tenant.u)`},
+		{`WITH w AS (SELECT a FROM t) SELECT a FROM w UNION SELECT b FROM u`,
+			`WITH w AS (SELECT a FROM tenant.t) SELECT a FROM w UNION SELECT b FROM tenant.u`},
+		// Common table expressions are not rewritten while they are in scope,
+		// including in the later CTEs and in subqueries, unless the reference is
+		// qualified.
+		{`WITH w AS (SELECT a FROM t), x AS (SELECT a FROM w) SELECT * FROM x, w, s.w`,
+			`WITH w AS (SELECT a FROM tenant.t), x AS (SELECT a FROM w) SELECT * FROM x, w, tenant.w`},
+		{`WITH w AS (SELECT a FROM w) SELECT a FROM t WHERE a IN (SELECT a FROM w)`,
+			`WITH w AS (SELECT a FROM tenant.w) SELECT a FROM tenant.t WHERE a IN (SELECT a FROM w)`},
+		{`SELECT * FROM (WITH w AS (SELECT 1) SELECT * FROM w) AS s, w`,
+			`SELECT * FROM (WITH w AS (SELECT 1) SELECT * FROM w) AS s, tenant.w`},
+		{`WITH w AS (SELECT a FROM t) SELECT a FROM w, t FOR UPDATE OF w, t`,
+			`WITH w AS (SELECT a FROM tenant.t) SELECT a FROM w, tenant.t FOR UPDATE OF w, tenant.t`},
+		{`SELECT a FROM t ORDER BY INDEX t@idx`,
+			`SELECT a FROM tenant.t ORDER BY INDEX tenant.t@idx`},
+		{`SELECT a FROM [SELECT a FROM t]`, `SELECT a FROM [SELECT a FROM tenant.t]`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sel := stmt.AST.(*tree.Select)
+			if err := sel.RewriteTableNames(func(tn *tree.TableName) error {
+				tn.SchemaName = "tenant"
+				tn.ExplicitSchema = true
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if res := tree.AsString(sel); res != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestSelectRewriteTableNamesError(t *testing.T) {
+	stmt, err := parser.ParseOne(`SELECT * FROM t, u, v`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedErr := errors.New("boom")
+	var visited []string
+	err = stmt.AST.(*tree.Select).RewriteTableNames(func(tn *tree.TableName) error {
+		visited = append(visited, tn.Table())
+		if len(visited) == 2 {
+			return expectedErr
+		}
+		return nil
+	})
+	if err != expectedErr {
+		t.Fatalf("expected %v, got %v", expectedErr, err)
+	}
+	if len(visited) != 2 {
+		t.Fatalf("expected the walk to stop after the error, visited %v", visited)
+	}
+}
+
+func TestSelectCollectPlaceholders(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected string
+	}{
+		{`SELECT a FROM t`, `()`},
+		{`SELECT a FROM t WHERE a = $1 AND b = $3`, `(0,2)`},
+		{`SELECT a FROM t LIMIT $2 OFFSET $1`, `(0,1)`},
+		{`SELECT * FROM t JOIN u ON t.a = $2`, `(1)`},
+		{`SELECT * FROM t WHERE EXISTS (SELECT 1 FROM u WHERE u.b = $4)`, `(3)`},
+		{`WITH w AS (SELECT a FROM t WHERE a > $1) SELECT a FROM w UNION SELECT $2`, `(0,1)`},
+		{`SELECT a FROM (SELECT a FROM t WHERE a = $1) AS s, [SELECT b FROM u WHERE b = $1]`, `(0)`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.sql, func(t *testing.T) {
+			stmt, err := parser.ParseOne(tc.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := stmt.AST.(*tree.Select).CollectPlaceholders()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.String() != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, res)
+			}
+		})
+	}
+}
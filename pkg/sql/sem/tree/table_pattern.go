@@ -62,7 +62,7 @@ type AllTablesSelector struct {
 // Format implements the NodeFormatter interface.
 func (at *AllTablesSelector) Format(ctx *FmtCtx) {
 	at.TableNamePrefix.Format(ctx)
-	if at.ExplicitSchema || ctx.alwaysFormatTablePrefix() {
+	if at.formatsSchema(ctx) {
 		ctx.WriteByte('.')
 	}
 	ctx.WriteByte('*')
@@ -116,6 +116,7 @@ func (node *TransactionModes) Format(ctx *FmtCtx) {
 	}
 	if node.ReadWriteMode != UnspecifiedReadWriteMode {
 		ctx.Printf("%s READ %s", sep, node.ReadWriteMode)
+		sep = ","
 	}
 	if node.AsOf.Expr != nil {
 		ctx.WriteString(sep)
@@ -692,6 +692,8 @@ var (
 	errInvalidMaxUsage      = pgerror.New(pgerror.CodeSyntaxError, "MAXVALUE can only appear within a range partition expression")
 	errInvalidMinUsage      = pgerror.New(pgerror.CodeSyntaxError, "MINVALUE can only appear within a range partition expression")
 	errPrivateFunction      = pgerror.New(pgerror.CodeReservedNameError, "function reserved for internal use")
+
+	errGroupingSetsUnsupported = pgerror.Unimplemented("grouping sets", "GROUPING SETS, ROLLUP and CUBE are not supported")
 )
 
 // NewAggInAggError creates an error for the case when an aggregate function is
@@ -816,6 +818,15 @@ func (expr *FuncExpr) TypeCheck(ctx *SemaContext, desired *types.T) (TypedExpr,
 	if err != nil {
 		return nil, err
 	}
+	if len(expr.OrderBy) > 0 {
+		return nil, pgerror.UnimplementedWithIssue(23620, "ORDER BY in aggregate function arguments")
+	}
+	if len(expr.ArgNames) > 0 {
+		return nil, pgerror.Unimplemented("named function arguments", "named function arguments are not supported")
+	}
+	if expr.WithinGroup != nil {
+		return nil, pgerror.Unimplemented("within group", "WITHIN GROUP is not supported")
+	}
 
 	if err := ctx.checkFunctionUsage(expr, def); err != nil {
 		return nil, pgerror.Wrapf(err, pgerror.CodeInvalidParameterValueError,
@@ -1077,6 +1088,53 @@ func (expr *IsOfTypeExpr) TypeCheck(ctx *SemaContext, desired *types.T) (TypedEx
 	return expr, nil
 }
 
+// TypeCheck implements the Expr interface. The arguments of OVERLAPS are
+// checked, but the predicate cannot be evaluated yet.
+func (expr *OverlapsExpr) TypeCheck(ctx *SemaContext, desired *types.T) (TypedExpr, error) {
+	left, right, err := expr.periods()
+	if err != nil {
+		return nil, err
+	}
+	// The starts of both periods must have the same type, and each end must
+	// either have that type too or be an interval.
+	_, startTyp, err := TypeCheckSameTypedExprs(ctx, types.Any, left.Exprs[0], right.Exprs[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, end := range []Expr{left.Exprs[1], right.Exprs[1]} {
+		typedEnd, err := end.TypeCheck(ctx, startTyp)
+		if err != nil {
+			return nil, err
+		}
+		endTyp := typedEnd.ResolvedType()
+		if !endTyp.Equivalent(startTyp) && endTyp.Family() != types.IntervalFamily &&
+			endTyp.Family() != types.UnknownFamily && startTyp.Family() != types.UnknownFamily {
+			return nil, pgerror.Newf(pgerror.CodeDatatypeMismatchError,
+				"OVERLAPS periods must end with a %s or an interval, found %s", startTyp, endTyp)
+		}
+	}
+	return nil, pgerror.Unimplemented("overlaps", "OVERLAPS is not supported")
+}
+
+// periods returns the two sides of the OVERLAPS predicate, checking that they
+// are two-element rows.
+func (expr *OverlapsExpr) periods() (left, right *Tuple, _ error) {
+	sides := [2]*Tuple{}
+	for i, side := range [2]Expr{expr.Left, expr.Right} {
+		t, ok := StripParens(side).(*Tuple)
+		if !ok || len(t.Exprs) != 2 {
+			name := "left"
+			if i == 1 {
+				name = "right"
+			}
+			return nil, nil, pgerror.Newf(pgerror.CodeSyntaxError,
+				"wrong number of parameters on %s side of OVERLAPS expression", name)
+		}
+		sides[i] = t
+	}
+	return sides[0], sides[1], nil
+}
+
 // TypeCheck implements the Expr interface.
 func (expr *NotExpr) TypeCheck(ctx *SemaContext, desired *types.T) (TypedExpr, error) {
 	exprTyped, err := typeCheckAndRequireBoolean(ctx, expr.Expr, "NOT argument")
@@ -1233,6 +1291,21 @@ func (expr *UnaryExpr) TypeCheck(ctx *SemaContext, desired *types.T) (TypedExpr,
 	return expr, nil
 }
 
+// TypeCheck implements the Expr interface.
+func (expr *GroupingSets) TypeCheck(_ *SemaContext, desired *types.T) (TypedExpr, error) {
+	return nil, errGroupingSetsUnsupported
+}
+
+// TypeCheck implements the Expr interface.
+func (expr *Rollup) TypeCheck(_ *SemaContext, desired *types.T) (TypedExpr, error) {
+	return nil, errGroupingSetsUnsupported
+}
+
+// TypeCheck implements the Expr interface.
+func (expr *Cube) TypeCheck(_ *SemaContext, desired *types.T) (TypedExpr, error) {
+	return nil, errGroupingSetsUnsupported
+}
+
 // TypeCheck implements the Expr interface.
 func (expr DefaultVal) TypeCheck(_ *SemaContext, desired *types.T) (TypedExpr, error) {
 	return nil, errInvalidDefaultUsage
@@ -238,6 +238,16 @@ func TestTypeCheckError(t *testing.T) {
 		{`3:::int[]`, `incompatible type annotation for 3 as int[], found type: int`},
 		{`B'1001'::decimal`, `invalid cast: varbit -> decimal`},
 		{`101.3::bit`, `invalid cast: decimal -> bit`},
+		{`(1, 2, 3) OVERLAPS (1, 2)`, `wrong number of parameters on left side of OVERLAPS expression`},
+		{`(1, 2) OVERLAPS ROW(1)`, `wrong number of parameters on right side of OVERLAPS expression`},
+		{
+			`('2019-01-01'::DATE, 1) OVERLAPS ('2019-01-02'::DATE, '2019-01-03')`,
+			`OVERLAPS periods must end with a date or an interval, found int`,
+		},
+		{
+			`('2019-01-01'::DATE, '1 day'::INTERVAL) OVERLAPS ('2019-01-02'::DATE, '2019-01-03')`,
+			`OVERLAPS is not supported`,
+		},
 		{
 			`((1,2) AS a)`,
 			`mismatch in tuple definition: 2 expressions, 1 labels`,
@@ -30,6 +30,15 @@ type UnionClause struct {
 	Type        UnionType
 	Left, Right *Select
 	All         bool
+
+	// Corresponding is set if the operands' columns are to be matched up by
+	// name rather than by position (CORRESPONDING [BY (cols)]). It is
+	// orthogonal to All: ALL vs DISTINCT still determines whether duplicate
+	// rows are retained.
+	Corresponding bool
+	// CorrespondingCols is the optional BY column list of a CORRESPONDING
+	// clause. It is always empty if Corresponding is not set.
+	CorrespondingCols NameList
 }
 
 // UnionType represents one of the three set operations in sql.
@@ -58,11 +67,19 @@ func (i UnionType) String() string {
 // Format implements the NodeFormatter interface.
 func (node *UnionClause) Format(ctx *FmtCtx) {
 	ctx.FormatNode(node.Left)
-	ctx.WriteByte(' ')
-	ctx.WriteString(node.Type.String())
+	ctx.writeClauseSep()
+	ctx.writeKeyword(node.Type.String())
 	if node.All {
-		ctx.WriteString(" ALL")
+		ctx.writeKeyword(" ALL")
+	}
+	if node.Corresponding {
+		ctx.writeKeyword(" CORRESPONDING")
+		if len(node.CorrespondingCols) > 0 {
+			ctx.writeKeyword(" BY (")
+			ctx.FormatNode(&node.CorrespondingCols)
+			ctx.WriteByte(')')
+		}
 	}
-	ctx.WriteByte(' ')
+	ctx.writeClauseSep()
 	ctx.FormatNode(node.Right)
 }
@@ -30,7 +30,7 @@ type ValuesClause struct {
 
 // Format implements the NodeFormatter interface.
 func (node *ValuesClause) Format(ctx *FmtCtx) {
-	ctx.WriteString("VALUES ")
+	ctx.writeKeyword("VALUES ")
 	comma := ""
 	for i := range node.Rows {
 		ctx.WriteString(comma)
@@ -307,6 +307,15 @@ func (expr *FuncExpr) Walk(v Visitor) Expr {
 		}
 		ret.Exprs = exprs
 	}
+	if len(expr.OrderBy) > 0 {
+		order, changed := walkOrderBy(v, expr.OrderBy)
+		if changed {
+			if ret == expr {
+				ret = expr.copyNode()
+			}
+			ret.OrderBy = order
+		}
+	}
 	if expr.WindowDef != nil {
 		windowDef, changed := walkWindowDef(v, expr.WindowDef)
 		if changed {
@@ -325,6 +334,15 @@ func (expr *FuncExpr) Walk(v Visitor) Expr {
 			ret.Filter = e
 		}
 	}
+	if expr.WithinGroup != nil {
+		order, changed := walkOrderBy(v, *expr.WithinGroup)
+		if changed {
+			if ret == expr {
+				ret = expr.copyNode()
+			}
+			ret.WithinGroup = &order
+		}
+	}
 	return ret
 }
 
@@ -424,6 +442,19 @@ func (expr *IsOfTypeExpr) Walk(v Visitor) Expr {
 	return expr
 }
 
+// Walk implements the Expr interface.
+func (expr *OverlapsExpr) Walk(v Visitor) Expr {
+	left, changedL := WalkExpr(v, expr.Left)
+	right, changedR := WalkExpr(v, expr.Right)
+	if changedL || changedR {
+		exprCopy := *expr
+		exprCopy.Left = left
+		exprCopy.Right = right
+		return &exprCopy
+	}
+	return expr
+}
+
 // Walk implements the Expr interface.
 func (expr *NotExpr) Walk(v Visitor) Expr {
 	e, changed := WalkExpr(v, expr.Expr)
@@ -553,6 +584,36 @@ func (expr *Tuple) Walk(v Visitor) Expr {
 	return expr
 }
 
+// Walk implements the Expr interface.
+func (expr *GroupingSets) Walk(v Visitor) Expr {
+	if sets, changed := walkExprSlice(v, expr.Sets); changed {
+		exprCopy := *expr
+		exprCopy.Sets = sets
+		return &exprCopy
+	}
+	return expr
+}
+
+// Walk implements the Expr interface.
+func (expr *Rollup) Walk(v Visitor) Expr {
+	if exprs, changed := walkExprSlice(v, expr.Exprs); changed {
+		exprCopy := *expr
+		exprCopy.Exprs = exprs
+		return &exprCopy
+	}
+	return expr
+}
+
+// Walk implements the Expr interface.
+func (expr *Cube) Walk(v Visitor) Expr {
+	if exprs, changed := walkExprSlice(v, expr.Exprs); changed {
+		exprCopy := *expr
+		exprCopy.Exprs = exprs
+		return &exprCopy
+	}
+	return expr
+}
+
 // Walk implements the Expr interface.
 func (expr *Array) Walk(v Visitor) Expr {
 	if exprs, changed := walkExprSlice(v, expr.Exprs); changed {
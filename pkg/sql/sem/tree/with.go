@@ -21,8 +21,29 @@ type With struct {
 
 // CTE represents a common table expression inside of a WITH clause.
 type CTE struct {
-	Name AliasClause
-	Stmt Statement
+	Name         AliasClause
+	Materialized CTEMaterializeClause
+	Stmt         Statement
+}
+
+// CTEMaterializeClause represents the MATERIALIZED / NOT MATERIALIZED hint on
+// a common table expression.
+type CTEMaterializeClause int8
+
+// CTEMaterializeClause values
+const (
+	// CTEMaterializeDefault indicates that no hint was specified.
+	CTEMaterializeDefault CTEMaterializeClause = iota
+	// CTEMaterializeAlways requests that the CTE be materialized.
+	CTEMaterializeAlways
+	// CTEMaterializeNever requests that the CTE be inlined.
+	CTEMaterializeNever
+)
+
+var cteMaterializeKeywords = [...]string{
+	CTEMaterializeDefault: "AS",
+	CTEMaterializeAlways:  "AS MATERIALIZED",
+	CTEMaterializeNever:   "AS NOT MATERIALIZED",
 }
 
 // Format implements the NodeFormatter interface.
@@ -30,14 +51,21 @@ func (node *With) Format(ctx *FmtCtx) {
 	if node == nil {
 		return
 	}
-	ctx.WriteString("WITH ")
+	ctx.writeKeyword("WITH ")
 	for i, cte := range node.CTEList {
 		if i != 0 {
 			ctx.WriteString(", ")
 		}
 		ctx.FormatNode(&cte.Name)
-		ctx.WriteString(" AS (")
-		ctx.FormatNode(cte.Stmt)
-		ctx.WriteString(") ")
+		ctx.WriteByte(' ')
+		ctx.writeKeyword(cteMaterializeKeywords[cte.Materialized])
+		ctx.WriteByte(' ')
+		ctx.formatParenthesized(cte.Stmt)
+		if !ctx.HasFlags(FmtPretty) {
+			ctx.WriteByte(' ')
+		}
+	}
+	if ctx.HasFlags(FmtPretty) {
+		ctx.writeClauseSep()
 	}
 }
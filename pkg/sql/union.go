@@ -86,6 +86,10 @@ type unionNode struct {
 func (p *planner) Union(
 	ctx context.Context, n *tree.UnionClause, desiredTypes []*types.T,
 ) (planNode, error) {
+	if n.Corresponding {
+		return nil, pgerror.Unimplementedf("corresponding",
+			"%v CORRESPONDING is not supported", n.Type)
+	}
 	left, err := p.newPlan(ctx, n.Left, desiredTypes)
 	if err != nil {
 		return nil, err
@@ -19,7 +19,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -28,6 +31,10 @@ const (
 	azure = "Microsoft Azure"
 )
 
+// ErrNotDetected is returned by GetProviderInfoE when the metadata endpoints
+// could be queried but none of them identified a known cloud provider.
+var ErrNotDetected = errors.New("no known cloud provider detected")
+
 // parseAWSInstanceMetadata uses the structure described
 // https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 // If we encounter JSON we cannot marhsal into this structure, we
@@ -87,16 +94,86 @@ func parseAzureInstanceMetadata(body []byte) (bool, string, string) {
 	return success, azure, instanceMetadata.ComputeEnv.InstanceClass
 }
 
+// parseAWSPreemptibleMetadata parses the instance-life-cycle metadata
+// described at
+// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
+// which is "spot" for spot instances. If we encounter a value we don't
+// recognize, we assume we're not running on AWS.
+func parseAWSPreemptibleMetadata(body []byte) (bool, bool) {
+	switch strings.TrimSpace(string(body)) {
+	case "spot":
+		return true, true
+	case "on-demand", "scheduled":
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// parseGCPPreemptibleMetadata parses the scheduling/preemptible metadata
+// described at
+// https://cloud.google.com/compute/docs/storing-retrieving-metadata
+// which is either TRUE or FALSE. If we encounter another value, we assume
+// we're not running on GCP.
+func parseGCPPreemptibleMetadata(body []byte) (bool, bool) {
+	switch strings.TrimSpace(string(body)) {
+	case "TRUE":
+		return true, true
+	case "FALSE":
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// parseAzurePreemptibleMetadata uses the same structure as
+// parseAzureInstanceMetadata. Spot (and legacy low-priority) VMs report their
+// priority and an eviction policy of either Deallocate or Delete; regular VMs
+// report neither.
+func parseAzurePreemptibleMetadata(body []byte) (bool, bool) {
+	instanceMetadata := struct {
+		ComputeEnv struct {
+			Priority       string `json:"priority"`
+			EvictionPolicy string `json:"evictionPolicy"`
+		} `json:"compute"`
+	}{}
+
+	if err := json.Unmarshal(body, &instanceMetadata); err != nil {
+		return false, false
+	}
+
+	switch strings.ToLower(instanceMetadata.ComputeEnv.Priority) {
+	case "spot", "low":
+		return true, true
+	}
+	switch strings.ToLower(instanceMetadata.ComputeEnv.EvictionPolicy) {
+	case "deallocate", "delete":
+		return true, true
+	}
+	return true, false
+}
+
 type metadataReqHeader struct {
 	key   string
 	value string
 }
 
-func getInstanceMetadata(url string, headers []metadataReqHeader) ([]byte, error) {
-	client := http.Client{
+// defaultHTTPClient returns the client used to query the metadata endpoints
+// unless httpClientFactory is overridden.
+func defaultHTTPClient() *http.Client {
+	return &http.Client{
 		Timeout: 500 * time.Millisecond,
 	}
+}
+
+// httpClientFactory returns the client used by GetProviderInfo and
+// IsPreemptible to query the metadata endpoints, unless a client is passed
+// explicitly. It can be overridden in tests to stub the responses.
+var httpClientFactory = defaultHTTPClient
 
+func getInstanceMetadata(
+	client *http.Client, url string, headers []metadataReqHeader,
+) ([]byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -118,8 +195,31 @@ func getInstanceMetadata(url string, headers []metadataReqHeader) ([]byte, error
 }
 
 // GetProviderInfo returns the node's instance provider (e.g. AWS) and
-// the name given to its instance class (e.g. m5a.large).
+// the name given to its instance class (e.g. m5a.large). Both are empty if
+// they couldn't be determined; see GetProviderInfoE to find out why.
 func GetProviderInfo() (string, string) {
+	providerName, instanceClass, _ := GetProviderInfoE()
+	return providerName, instanceClass
+}
+
+// GetProviderInfoE is like GetProviderInfo, but also returns an error if the
+// provider couldn't be determined: ErrNotDetected if no provider matched, or
+// an error listing the failures of the requests if none of the metadata
+// endpoints could be queried.
+func GetProviderInfoE() (provider, instanceClass string, err error) {
+	return getProviderInfo(httpClientFactory())
+}
+
+// GetProviderInfoWithClient is like GetProviderInfo, but queries the metadata
+// endpoints using the given client. This allows deployments where the
+// endpoints are only reachable through a proxy to configure the client's
+// transport accordingly.
+func GetProviderInfoWithClient(client *http.Client) (string, string) {
+	providerName, instanceClass, _ := getProviderInfo(client)
+	return providerName, instanceClass
+}
+
+func getProviderInfo(client *http.Client) (string, string, error) {
 
 	// providerInstanceMetadataDetails provides all necessary details
 	// to make http.Get() request to cloud provider metadata endpoint
@@ -154,18 +254,81 @@ func GetProviderInfo() (string, string) {
 
 	var success bool
 	var providerName, instanceClass string
+	var reqErrs []string
 
 	for _, p := range providerInstanceMetadataDetails {
-		body, err := getInstanceMetadata(p.url, p.headers)
+		body, err := getInstanceMetadata(client, p.url, p.headers)
 
 		if err != nil {
+			reqErrs = append(reqErrs, err.Error())
 			continue
 		}
 		success, providerName, instanceClass = p.parse(body)
 		if success {
-			return providerName, instanceClass
+			return providerName, instanceClass, nil
+		}
+	}
+
+	if len(reqErrs) == len(providerInstanceMetadataDetails) {
+		return "", "", errors.Errorf(
+			"failed to query the cloud provider metadata endpoints: %s", strings.Join(reqErrs, "; "))
+	}
+	return "", "", ErrNotDetected
+}
+
+// IsPreemptible returns whether the node runs on an instance that its cloud
+// provider can reclaim at any time: a spot instance on AWS or Azure, or a
+// preemptible instance on GCP. If this can't be determined, the instance is
+// assumed not to be preemptible.
+func IsPreemptible() bool {
+	return IsPreemptibleWithClient(httpClientFactory())
+}
+
+// IsPreemptibleWithClient is like IsPreemptible, but queries the metadata
+// endpoints using the given client; see GetProviderInfoWithClient.
+func IsPreemptibleWithClient(client *http.Client) bool {
+	// providerPreemptibleMetadataDetails mirrors
+	// providerInstanceMetadataDetails in GetProviderInfo.
+	providerPreemptibleMetadataDetails := []struct {
+		url     string
+		headers []metadataReqHeader
+		parse   func([]byte) (bool, bool)
+	}{
+		// AWS reference https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
+		{
+			url:   "http://instance-data.ec2.internal/latest/meta-data/instance-life-cycle",
+			parse: parseAWSPreemptibleMetadata,
+		},
+		// GCP reference https://cloud.google.com/compute/docs/storing-retrieving-metadata
+		{
+			url: "http://metadata.google.internal/computeMetadata/v1/instance/scheduling/preemptible",
+			headers: []metadataReqHeader{{
+				"Metadata-Flavor", "Google",
+			}},
+			parse: parseGCPPreemptibleMetadata,
+		},
+		// Azure reference https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service
+		// The priority and eviction policy are only reported by newer API
+		// versions.
+		{
+			url: "http://169.254.169.254/metadata/instance?api-version=2020-12-01",
+			headers: []metadataReqHeader{{
+				"Metadata", "true",
+			}},
+			parse: parseAzurePreemptibleMetadata,
+		},
+	}
+
+	for _, p := range providerPreemptibleMetadataDetails {
+		body, err := getInstanceMetadata(client, p.url, p.headers)
+
+		if err != nil {
+			continue
+		}
+		if success, preemptible := p.parse(body); success {
+			return preemptible
 		}
 	}
 
-	return "", ""
+	return false
 }
@@ -15,6 +15,11 @@
 package cloudinfo
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
@@ -157,3 +162,254 @@ func TestAzureInstanceMetadataParsing(t *testing.T) {
 		t.Fatalf("expected parsing to get machineTypes Standard_D2s_v3")
 	}
 }
+
+func TestAWSPreemptibleMetadataParsing(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	testCases := []struct {
+		body        string
+		success     bool
+		preemptible bool
+	}{
+		{body: "spot", success: true, preemptible: true},
+		{body: "on-demand", success: true, preemptible: false},
+		{body: "scheduled\n", success: true, preemptible: false},
+		{body: "<html>Not Found</html>", success: false, preemptible: false},
+	}
+
+	for _, tc := range testCases {
+		s, p := parseAWSPreemptibleMetadata([]byte(tc.body))
+		if s != tc.success || p != tc.preemptible {
+			t.Errorf("%q: expected (%t, %t), got (%t, %t)", tc.body, tc.success, tc.preemptible, s, p)
+		}
+	}
+}
+
+func TestGCPPreemptibleMetadataParsing(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	testCases := []struct {
+		body        string
+		success     bool
+		preemptible bool
+	}{
+		{body: "TRUE", success: true, preemptible: true},
+		{body: "FALSE", success: true, preemptible: false},
+		{body: "<html>Not Found</html>", success: false, preemptible: false},
+	}
+
+	for _, tc := range testCases {
+		s, p := parseGCPPreemptibleMetadata([]byte(tc.body))
+		if s != tc.success || p != tc.preemptible {
+			t.Errorf("%q: expected (%t, %t), got (%t, %t)", tc.body, tc.success, tc.preemptible, s, p)
+		}
+	}
+}
+
+func TestAzurePreemptibleMetadataParsing(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	testCases := []struct {
+		body        string
+		success     bool
+		preemptible bool
+	}{
+		{
+			body: `{
+				"compute":{
+					"evictionPolicy":"Deallocate",
+					"location":"eastus",
+					"priority":"Spot",
+					"vmSize":"Standard_D2s_v3"
+				}
+			}`,
+			success:     true,
+			preemptible: true,
+		},
+		{
+			body: `{
+				"compute":{
+					"evictionPolicy":"",
+					"location":"eastus",
+					"priority":"Regular",
+					"vmSize":"Standard_D2s_v3"
+				}
+			}`,
+			success:     true,
+			preemptible: false,
+		},
+		{
+			body: `{
+				"compute":{
+					"evictionPolicy":"Delete",
+					"location":"eastus",
+					"vmSize":"Standard_D2s_v3"
+				}
+			}`,
+			success:     true,
+			preemptible: true,
+		},
+		{
+			// Only Deallocate and Delete are eviction policies.
+			body: `{
+				"compute":{
+					"evictionPolicy":"None",
+					"location":"eastus",
+					"priority":"Regular",
+					"vmSize":"Standard_D2s_v3"
+				}
+			}`,
+			success:     true,
+			preemptible: false,
+		},
+		{
+			// Older API versions don't report the priority at all.
+			body: `{
+				"compute":{
+					"location":"eastus",
+					"vmSize":"Standard_D2s_v3"
+				}
+			}`,
+			success:     true,
+			preemptible: false,
+		},
+		{body: "<html>Not Found</html>", success: false, preemptible: false},
+	}
+
+	for _, tc := range testCases {
+		s, p := parseAzurePreemptibleMetadata([]byte(tc.body))
+		if s != tc.success || p != tc.preemptible {
+			t.Errorf("%q: expected (%t, %t), got (%t, %t)", tc.body, tc.success, tc.preemptible, s, p)
+		}
+	}
+}
+
+// redirectTransport sends all requests to the given server, regardless of
+// their host.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	redirected := *req
+	u := *req.URL
+	u.Scheme = rt.target.Scheme
+	u.Host = rt.target.Host
+	redirected.URL = &u
+	return http.DefaultTransport.RoundTrip(&redirected)
+}
+
+func TestGetProviderInfoWithStubbedClient(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// The stub only answers the GCP endpoints, and only if the request
+	// carries the expected header.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/machine-type":
+			fmt.Fprint(w, "projects/93358566124/machineTypes/n1-standard-4")
+		case "/computeMetadata/v1/instance/scheduling/preemptible":
+			fmt.Fprint(w, "TRUE")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(f func() *http.Client) { httpClientFactory = f }(httpClientFactory)
+	httpClientFactory = func() *http.Client {
+		client := defaultHTTPClient()
+		client.Transport = redirectTransport{target: target}
+		return client
+	}
+
+	if p, i := GetProviderInfo(); p != gcp || i != "n1-standard-4" {
+		t.Fatalf("expected (%s, n1-standard-4), got (%s, %s)", gcp, p, i)
+	}
+	if !IsPreemptible() {
+		t.Fatalf("expected instance to be preemptible")
+	}
+
+	// The same stub, passed explicitly. httpClientFactory now fails every
+	// request, so the results can only come from the given client.
+	httpClientFactory = func() *http.Client {
+		client := defaultHTTPClient()
+		client.Transport = failingTransport{}
+		return client
+	}
+	client := defaultHTTPClient()
+	client.Transport = redirectTransport{target: target}
+	if p, i := GetProviderInfoWithClient(client); p != gcp || i != "n1-standard-4" {
+		t.Fatalf("expected (%s, n1-standard-4), got (%s, %s)", gcp, p, i)
+	}
+	if !IsPreemptibleWithClient(client) {
+		t.Fatalf("expected instance to be preemptible")
+	}
+}
+
+// failingTransport fails all requests.
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("cannot reach %s", req.URL.Host)
+}
+
+func TestGetProviderInfoE(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// The stub doesn't answer any of the metadata endpoints.
+	srv := httptest.NewServer(http.HandlerFunc(http.NotFound))
+	defer srv.Close()
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(f func() *http.Client) { httpClientFactory = f }(httpClientFactory)
+
+	t.Run("not detected", func(t *testing.T) {
+		httpClientFactory = func() *http.Client {
+			client := defaultHTTPClient()
+			client.Transport = redirectTransport{target: target}
+			return client
+		}
+		p, i, err := GetProviderInfoE()
+		if err != ErrNotDetected {
+			t.Fatalf("expected %v, got %v", ErrNotDetected, err)
+		}
+		if p != "" || i != "" {
+			t.Fatalf("expected no provider info, got (%s, %s)", p, i)
+		}
+	})
+
+	t.Run("all requests failed", func(t *testing.T) {
+		httpClientFactory = func() *http.Client {
+			client := defaultHTTPClient()
+			client.Transport = failingTransport{}
+			return client
+		}
+		p, i, err := GetProviderInfoE()
+		if err == nil || err == ErrNotDetected {
+			t.Fatalf("expected request errors, got %v", err)
+		}
+		for _, host := range []string{
+			"instance-data.ec2.internal", "metadata.google.internal", "169.254.169.254",
+		} {
+			if !strings.Contains(err.Error(), "cannot reach "+host) {
+				t.Errorf("expected error to mention %s, got %v", host, err)
+			}
+		}
+		if p != "" || i != "" {
+			t.Fatalf("expected no provider info, got (%s, %s)", p, i)
+		}
+		// GetProviderInfo discards the error.
+		if p, i := GetProviderInfo(); p != "" || i != "" {
+			t.Fatalf("expected no provider info, got (%s, %s)", p, i)
+		}
+	})
+}